@@ -0,0 +1,160 @@
+// Command cassettes records cassettes again against the live TMDB and OMDB
+// APIs and reports how the responses' schemas changed since they were last
+// recorded. API keys are read from TMDB_API_KEY and OMDB_API_KEY.
+//
+//	go run ./cmd/cassettes                 # refresh every cassette
+//	go run ./cmd/cassettes -check          # only report, exit 1 on drift
+//	go run ./cmd/cassettes movie_550.json  # refresh some of them
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"movie-discovery-app/internal/cassette"
+)
+
+func main() {
+	dir := flag.String("dir", "internal/services/testdata/cassettes", "directory holding the cassettes")
+	check := flag.Bool("check", false, "report schema drift without writing, exit 1 if there is any")
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		var err error
+		if files, err = filepath.Glob(filepath.Join(*dir, "*.json")); err != nil {
+			fatal(err)
+		}
+	} else {
+		for i, name := range files {
+			if filepath.Dir(name) == "." {
+				files[i] = filepath.Join(*dir, name)
+			}
+		}
+	}
+	if len(files) == 0 {
+		fatal(fmt.Errorf("no cassettes in %s", *dir))
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	drifted := false
+	for _, file := range files {
+		changed, err := refresh(client, file, *check, os.Stdout)
+		if err != nil {
+			fatal(err)
+		}
+		drifted = drifted || changed
+	}
+
+	if *check && drifted {
+		os.Exit(1)
+	}
+}
+
+// refresh sends a cassette's requests again, prints how the responses
+// changed and, unless checking, saves the new ones. It reports whether any
+// status or schema changed.
+func refresh(client *http.Client, file string, check bool, out io.Writer) (bool, error) {
+	old, err := cassette.Load(file)
+	if err != nil {
+		return false, err
+	}
+	rec, err := cassette.New(file, cassette.Record, client.Transport)
+	if err != nil {
+		return false, err
+	}
+	live := *client
+	live.Transport = rec
+
+	fmt.Fprintln(out, file)
+	drifted := false
+	for i, in := range old.Interactions {
+		liveURL, err := withKeys(in.Request.URL)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", file, err)
+		}
+		req, err := http.NewRequest(in.Request.Method, liveURL, nil)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", file, err)
+		}
+		resp, err := live.Do(req)
+		if err != nil {
+			return false, fmt.Errorf("%s: %s %s: %w", file, in.Request.Method, in.Request.URL, err)
+		}
+		resp.Body.Close()
+
+		now := rec.Cassette().Interactions[i].Response
+		changes := diff(in.Response, now)
+		if len(changes) == 0 {
+			continue
+		}
+		drifted = true
+		fmt.Fprintf(out, "  %s %s\n", in.Request.Method, in.Request.URL)
+		for _, change := range changes {
+			fmt.Fprintf(out, "    %s\n", change)
+		}
+	}
+	if !drifted {
+		fmt.Fprintln(out, "  no changes")
+	}
+
+	if check {
+		return drifted, nil
+	}
+	return drifted, rec.Save()
+}
+
+// diff describes how a response changed, ignoring values
+func diff(old, now cassette.Response) []string {
+	var changes []string
+	if old.Status != now.Status {
+		changes = append(changes, fmt.Sprintf("status changed from %d to %d", old.Status, now.Status))
+	}
+	switch {
+	case old.JSON != nil && now.JSON != nil:
+		schema, err := cassette.SchemaDiff(old.JSON, now.JSON)
+		if err != nil {
+			return append(changes, err.Error())
+		}
+		for _, c := range schema {
+			changes = append(changes, c.String())
+		}
+	case old.JSON != nil:
+		changes = append(changes, "body is no longer JSON")
+	case now.JSON != nil:
+		changes = append(changes, "body is now JSON")
+	}
+	return changes
+}
+
+// withKeys puts the API keys back into a recorded URL
+func withKeys(recorded string) (string, error) {
+	u, err := url.Parse(recorded)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for param, env := range cassette.SecretParams {
+		if query.Get(param) != cassette.Redacted {
+			continue
+		}
+		key := os.Getenv(env)
+		if key == "" {
+			return "", fmt.Errorf("%s is not set", env)
+		}
+		query.Set(param, key)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(2)
+}
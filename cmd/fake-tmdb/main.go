@@ -0,0 +1,74 @@
+// Command fake-tmdb serves the fakeupstream fixtures over HTTP so the app
+// can run without TMDB and OMDB keys or a network. Start the app with
+// TMDB_BASE_URL=http://localhost:8090/3 and OMDB_BASE_URL=http://localhost:8090.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"movie-discovery-app/internal/fakeupstream"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8090", "address to listen on")
+	fixtures := flag.String("fixtures", "", "fixture directory, defaults to the built-in fixtures")
+	tmdbKey := flag.String("tmdb-key", "", "only accept this TMDB API key")
+	omdbKey := flag.String("omdb-key", "", "only accept this OMDB API key")
+	latency := flag.Duration("latency", 0, "delay before every response")
+	errorRate := flag.Float64("error-rate", 0, "share of requests, from 0 to 1, answered with a random 429, 500 or malformed JSON")
+	seed := flag.Int64("seed", 0, "seed for the random errors, for repeatable runs")
+	flag.Parse()
+
+	if *errorRate < 0 || *errorRate > 1 {
+		fmt.Fprintln(os.Stderr, "error-rate must be between 0 and 1")
+		os.Exit(2)
+	}
+
+	opts := fakeupstream.Options{
+		TMDBAPIKey: *tmdbKey,
+		OMDBAPIKey: *omdbKey,
+		Latency:    *latency,
+		ErrorRate:  *errorRate,
+		Seed:       *seed,
+		Logger:     slog.Default(),
+	}
+	if *fixtures != "" {
+		if _, err := os.Stat(*fixtures); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.Fixtures = os.DirFS(*fixtures)
+	}
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           fakeupstream.New(opts),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Fake TMDB and OMDB listening on %s\n", *addr)
+	fmt.Printf("TMDB_BASE_URL=http://%s/3 OMDB_BASE_URL=http://%s\n", *addr, *addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
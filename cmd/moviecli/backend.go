@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/demo"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/client"
+	"movie-discovery-app/pkg/models"
+)
+
+// backend is what commands run against: a *client.Client talking to a
+// server, or a localBackend doing the server's work in process
+type backend interface {
+	Search(ctx context.Context, query, mediaType string, page int) (*models.SearchResponse, error)
+	GetMovie(ctx context.Context, id int) (*models.MovieDetails, error)
+	GetTV(ctx context.Context, id int) (*models.TVDetails, error)
+	GetSeason(ctx context.Context, id, season int) (*models.SeasonDetails, error)
+	GetTrending(ctx context.Context, timeWindow string) (*models.TrendingResponse, error)
+	GetGenres(ctx context.Context) (map[string][]models.Genre, error)
+	Discover(ctx context.Context, mediaType string, opts client.DiscoverOptions) (*models.SearchResponse, error)
+	GetWatchlist(ctx context.Context) ([]models.WatchlistItem, error)
+	AddToWatchlist(ctx context.Context, mediaType string, id int) (*models.WatchlistItem, error)
+	RemoveFromWatchlist(ctx context.Context, mediaType string, id int) error
+}
+
+var _ backend = (*client.Client)(nil)
+
+// errDemoWatchlist refuses watchlist changes while the demo dataset only
+// stands in for a missing TMDB key, so its made-up titles do not end up in
+// the server's data directory
+var errDemoWatchlist = errors.New("TMDB_API_KEY is not set, so the watchlist cannot be changed with the demo dataset; set the key, or DEMO_MODE=true to use the demo on purpose")
+
+// localBackend calls TMDB with the server's configuration and keeps the
+// watchlist in the server's data directory
+type localBackend struct {
+	movies *services.MovieService
+	// implicitDemo is set when the demo dataset stands in for a missing key
+	implicitDemo bool
+	store        *storage.Store
+	userID       string
+	now          func() time.Time
+}
+
+// newLocalBackend loads the configuration and picks the movie service the
+// way the server does, falling back to the bundled demo dataset without a
+// TMDB key
+func newLocalBackend(opts *options, environ []string, stderr io.Writer) (*localBackend, error) {
+	cfg, err := config.Load(config.Sources{File: opts.config, EnvFile: opts.envFile, Environ: environ})
+	if err != nil {
+		return nil, err
+	}
+
+	userID := opts.user
+	if userID == "" {
+		userID = "default"
+	}
+	if !storage.ValidID(userID) {
+		return nil, fmt.Errorf("invalid user %q: %w", userID, errUsage)
+	}
+
+	b := &localBackend{store: storage.NewStore(cfg.Storage.DataDir), userID: userID, now: time.Now}
+	b.movies, b.implicitDemo, err = demo.Select(cfg, b.now())
+	if err != nil {
+		return nil, err
+	}
+	if b.implicitDemo {
+		fmt.Fprintln(stderr, "moviecli: TMDB_API_KEY is not set, using the bundled demo dataset")
+	}
+	return b, nil
+}
+
+func (b *localBackend) Search(ctx context.Context, query, mediaType string, page int) (*models.SearchResponse, error) {
+	return b.movies.Search(ctx, query, mediaType, strconv.Itoa(page))
+}
+
+func (b *localBackend) GetMovie(ctx context.Context, id int) (*models.MovieDetails, error) {
+	return b.movies.GetMovieDetails(ctx, strconv.Itoa(id))
+}
+
+func (b *localBackend) GetTV(ctx context.Context, id int) (*models.TVDetails, error) {
+	return b.movies.GetTVDetails(ctx, strconv.Itoa(id))
+}
+
+func (b *localBackend) GetSeason(ctx context.Context, id, season int) (*models.SeasonDetails, error) {
+	return b.movies.GetSeason(ctx, strconv.Itoa(id), season)
+}
+
+func (b *localBackend) GetTrending(ctx context.Context, timeWindow string) (*models.TrendingResponse, error) {
+	return b.movies.GetTrending(ctx, timeWindow)
+}
+
+func (b *localBackend) GetGenres(ctx context.Context) (map[string][]models.Genre, error) {
+	return b.movies.GetGenres(ctx)
+}
+
+func (b *localBackend) Discover(ctx context.Context, mediaType string, opts client.DiscoverOptions) (*models.SearchResponse, error) {
+	filters, err := services.DiscoverFilters(mediaType, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, errUsage)
+	}
+	page := opts.Page
+	if page < 1 {
+		page = 1
+	}
+	return b.movies.Discover(ctx, mediaType, filters, strconv.Itoa(page))
+}
+
+func (b *localBackend) GetWatchlist(ctx context.Context) ([]models.WatchlistItem, error) {
+	library, err := b.store.Library(b.userID)
+	if err != nil {
+		return nil, err
+	}
+	return library.Watchlist, nil
+}
+
+// AddToWatchlist adds the title, or returns the item already there
+func (b *localBackend) AddToWatchlist(ctx context.Context, mediaType string, id int) (*models.WatchlistItem, error) {
+	if b.implicitDemo {
+		return nil, errDemoWatchlist
+	}
+	item, err := b.movies.WatchlistItem(ctx, mediaType, strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	item.AddedDate = b.now().Format("2006-01-02")
+
+	saved, _, err := b.store.AddToWatchlist(b.userID, *item)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (b *localBackend) RemoveFromWatchlist(ctx context.Context, mediaType string, id int) error {
+	if b.implicitDemo {
+		return errDemoWatchlist
+	}
+	return b.store.RemoveFromWatchlist(b.userID, mediaType, id)
+}
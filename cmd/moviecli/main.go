@@ -0,0 +1,437 @@
+// Command moviecli searches movies and TV shows and manages a watchlist
+// from the terminal. It talks to a running server given with -server or
+// MOVIECLI_SERVER, or otherwise calls TMDB itself with the server's local
+// configuration, sharing its data directory.
+//
+//	moviecli search the matrix
+//	moviecli -o json show 603
+//	moviecli tv 1396 --season 5
+//	moviecli trending --week
+//	moviecli discover --genre "science fiction" --year 1999
+//	moviecli watchlist add --type tv 1396
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"movie-discovery-app/pkg/client"
+	"movie-discovery-app/pkg/models"
+)
+
+const usage = `Usage: moviecli [flags] <command> [arguments]
+
+Commands:
+  search [--type movie|tv] [--page N] <query>
+  show <id>                      a movie's details
+  tv <id> [--season N]           a TV show's details, or a season's episodes
+  trending [--week]
+  genres [--type movie|tv]
+  discover [--type movie|tv] [--genre NAMES|IDS] [--year YYYY] [--sort ORDER] [--page N]
+  watchlist list
+  watchlist add [--type movie|tv] <id>
+  watchlist remove [--type movie|tv] <id>
+
+Flags, which may also follow the command:
+`
+
+// errUsage marks errors in the command line, which exit with status 2
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Only warnings about upstream calls, such as retries, are worth showing
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	err := run(ctx, os.Args[1:], os.Environ(), os.Stdout, os.Stderr)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, "moviecli:", strings.TrimSuffix(err.Error(), ": usage"))
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "moviecli:", err)
+		os.Exit(1)
+	}
+}
+
+// options are the flags every command takes
+type options struct {
+	server  string
+	user    string
+	output  string
+	config  string
+	envFile string
+	timeout time.Duration
+}
+
+// register adds the common flags to fs, defaulting to their current values
+// so flags before the command carry over
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.server, "server", o.server, "URL of a running server, e.g. http://localhost:8080, instead of calling TMDB directly (env MOVIECLI_SERVER)")
+	fs.StringVar(&o.user, "user", o.user, "user whose watchlist to use (env MOVIECLI_USER)")
+	fs.StringVar(&o.output, "o", o.output, "output format: table, json or plain")
+	fs.StringVar(&o.config, "config", o.config, "YAML or TOML config file, without -server")
+	fs.StringVar(&o.envFile, "env-file", o.envFile, "file of KEY=value environment settings, without -server")
+	fs.DurationVar(&o.timeout, "timeout", o.timeout, "give up on a command after this long")
+}
+
+// command is a subcommand. flags adds its own flags to fs; run is called
+// with the remaining arguments.
+type command struct {
+	flags func(fs *flag.FlagSet)
+	run   func(ctx context.Context, a *app, args []string) error
+}
+
+func run(ctx context.Context, args, environ []string, stdout, stderr io.Writer) error {
+	opts := &options{
+		server:  lookupEnv(environ, "MOVIECLI_SERVER"),
+		user:    lookupEnv(environ, "MOVIECLI_USER"),
+		output:  "table",
+		envFile: "configs/.env",
+		timeout: time.Minute,
+	}
+	fs := newFlagSet("moviecli", stderr, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no command given: %w", errUsage)
+	}
+
+	name := fs.Arg(0)
+	a := &app{out: stdout}
+	cmd, ok := a.commands()[name]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q: %w", name, errUsage)
+	}
+
+	// Flags may come before or after the command's arguments
+	sub := newFlagSet("moviecli "+name, stderr, opts)
+	if cmd.flags != nil {
+		cmd.flags(sub)
+	}
+	rest, err := parseInterspersed(sub, fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	switch opts.output {
+	case "table", "json", "plain":
+		a.format = opts.output
+	default:
+		return fmt.Errorf("output format must be table, json or plain: %w", errUsage)
+	}
+
+	if opts.server != "" {
+		a.backend = client.New(opts.server, client.WithUserID(opts.user))
+	} else {
+		a.backend, err = newLocalBackend(opts, environ, stderr)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	return cmd.run(ctx, a, rest)
+}
+
+func newFlagSet(name string, stderr io.Writer, opts *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	opts.register(fs)
+	return fs
+}
+
+// parseInterspersed parses flags wherever they are among args, as in
+// "tv 1396 --season 5", and returns the other arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%v: %w", err, errUsage)
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func lookupEnv(environ []string, key string) string {
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == key {
+			return v
+		}
+	}
+	return ""
+}
+
+// app runs commands against a backend, printing results in format
+type app struct {
+	backend backend
+	format  string
+	out     io.Writer
+}
+
+func (a *app) commands() map[string]command {
+	var (
+		mediaType string
+		page      int
+		season    int
+		week      bool
+		genre     string
+		year      int
+		sortBy    string
+	)
+	typeFlag := func(fs *flag.FlagSet, def, usage string) {
+		fs.StringVar(&mediaType, "type", def, usage)
+	}
+
+	return map[string]command{
+		"search": {
+			flags: func(fs *flag.FlagSet) {
+				typeFlag(fs, "", "movie or tv, both when unset")
+				fs.IntVar(&page, "page", 1, "page of results, from 1")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				if len(args) == 0 {
+					return fmt.Errorf("search needs a query: %w", errUsage)
+				}
+				if err := checkMediaType(mediaType, true); err != nil {
+					return err
+				}
+				results, err := a.backend.Search(ctx, strings.Join(args, " "), mediaType, page)
+				if err != nil {
+					return err
+				}
+				return a.print(results, mediaTable(results.Results, mediaType))
+			},
+		},
+		"show": {
+			run: func(ctx context.Context, a *app, args []string) error {
+				id, err := idArg("show", args)
+				if err != nil {
+					return err
+				}
+				movie, err := a.backend.GetMovie(ctx, id)
+				if err != nil {
+					return fmt.Errorf("movie %d: %w", id, err)
+				}
+				return a.print(movie, movieTable(movie))
+			},
+		},
+		"tv": {
+			flags: func(fs *flag.FlagSet) {
+				fs.IntVar(&season, "season", -1, "list this season's episodes, 0 for the specials")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				id, err := idArg("tv", args)
+				if err != nil {
+					return err
+				}
+				if season >= 0 {
+					details, err := a.backend.GetSeason(ctx, id, season)
+					if err != nil {
+						return fmt.Errorf("TV show %d season %d: %w", id, season, err)
+					}
+					return a.print(details, seasonTable(details))
+				}
+				show, err := a.backend.GetTV(ctx, id)
+				if err != nil {
+					return fmt.Errorf("TV show %d: %w", id, err)
+				}
+				return a.print(show, tvTable(show))
+			},
+		},
+		"trending": {
+			flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&week, "week", false, "trending this week rather than today")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				if len(args) > 0 {
+					return fmt.Errorf("trending takes no arguments: %w", errUsage)
+				}
+				timeWindow := "day"
+				if week {
+					timeWindow = "week"
+				}
+				trending, err := a.backend.GetTrending(ctx, timeWindow)
+				if err != nil {
+					return err
+				}
+				return a.print(trending, mediaTable(trending.Results, ""))
+			},
+		},
+		"genres": {
+			flags: func(fs *flag.FlagSet) {
+				typeFlag(fs, "", "movie or tv, both when unset")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				if err := checkMediaType(mediaType, true); err != nil {
+					return err
+				}
+				genres, err := a.backend.GetGenres(ctx)
+				if err != nil {
+					return err
+				}
+				if mediaType != "" {
+					genres = map[string][]models.Genre{mediaType: genres[mediaType]}
+				}
+				return a.print(genres, genreTable(genres))
+			},
+		},
+		"discover": {
+			flags: func(fs *flag.FlagSet) {
+				typeFlag(fs, "movie", "movie or tv")
+				fs.StringVar(&genre, "genre", "", "genre names or IDs, separated by commas, all of which titles must have")
+				fs.IntVar(&year, "year", 0, "year of release, or of the first episode")
+				fs.StringVar(&sortBy, "sort", "", "popularity.desc, vote_average.desc, release_date.desc or release_date.asc")
+				fs.IntVar(&page, "page", 1, "page of results, from 1")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				if len(args) > 0 {
+					return fmt.Errorf("discover takes flags, not arguments: %w", errUsage)
+				}
+				if err := checkMediaType(mediaType, false); err != nil {
+					return err
+				}
+				genres, err := resolveGenres(ctx, a.backend, mediaType, genre)
+				if err != nil {
+					return err
+				}
+				results, err := a.backend.Discover(ctx, mediaType, client.DiscoverOptions{
+					Genres: genres,
+					Year:   year,
+					SortBy: sortBy,
+					Page:   page,
+				})
+				if err != nil {
+					return err
+				}
+				return a.print(results, mediaTable(results.Results, mediaType))
+			},
+		},
+		"watchlist": {
+			flags: func(fs *flag.FlagSet) {
+				typeFlag(fs, "movie", "movie or tv, for add and remove")
+			},
+			run: func(ctx context.Context, a *app, args []string) error {
+				if len(args) == 0 {
+					return fmt.Errorf("watchlist needs list, add or remove: %w", errUsage)
+				}
+				switch args[0] {
+				case "list", "ls":
+					watchlist, err := a.backend.GetWatchlist(ctx)
+					if err != nil {
+						return err
+					}
+					if watchlist == nil {
+						watchlist = []models.WatchlistItem{}
+					}
+					return a.print(watchlist, watchlistTable(watchlist))
+				case "add", "remove", "rm":
+					if err := checkMediaType(mediaType, false); err != nil {
+						return err
+					}
+					id, err := idArg("watchlist "+args[0], args[1:])
+					if err != nil {
+						return err
+					}
+					if args[0] != "add" {
+						if err := a.backend.RemoveFromWatchlist(ctx, mediaType, id); err != nil {
+							return fmt.Errorf("%s %d: %w", mediaType, id, err)
+						}
+						return nil
+					}
+					item, err := a.backend.AddToWatchlist(ctx, mediaType, id)
+					if err != nil {
+						return fmt.Errorf("%s %d: %w", mediaType, id, err)
+					}
+					return a.print(item, watchlistTable([]models.WatchlistItem{*item}))
+				default:
+					return fmt.Errorf("unknown watchlist command %q, want list, add or remove: %w", args[0], errUsage)
+				}
+			},
+		},
+	}
+}
+
+// idArg reads the single TMDB ID argument of cmd
+func idArg(cmd string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s needs one TMDB ID: %w", cmd, errUsage)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%q is not a TMDB ID: %w", args[0], errUsage)
+	}
+	return id, nil
+}
+
+func checkMediaType(mediaType string, optional bool) error {
+	if mediaType == "movie" || mediaType == "tv" || (optional && mediaType == "") {
+		return nil
+	}
+	return fmt.Errorf("--type must be movie or tv: %w", errUsage)
+}
+
+// resolveGenres turns a list of genre names or IDs into IDs, looking names
+// up case-insensitively in mediaType's genres
+func resolveGenres(ctx context.Context, b backend, mediaType, list string) ([]int, error) {
+	if list == "" {
+		return nil, nil
+	}
+	var known []models.Genre
+	var ids []int
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if id, err := strconv.Atoi(name); err == nil {
+			ids = append(ids, id)
+			continue
+		}
+		if known == nil {
+			genres, err := b.GetGenres(ctx)
+			if err != nil {
+				return nil, err
+			}
+			known = genres[mediaType]
+		}
+		id := 0
+		for _, g := range known {
+			if strings.EqualFold(g.Name, name) {
+				id = g.ID
+				break
+			}
+		}
+		if id == 0 {
+			return nil, fmt.Errorf("unknown %s genre %q, see moviecli genres --type %s: %w", mediaType, name, mediaType, errUsage)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"movie-discovery-app/internal/api"
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/services"
+)
+
+// newEnv starts the fake TMDB and OMDb and a server backed by them, and
+// returns the arguments and environment that run moviecli against the
+// server and locally
+func newEnv(t *testing.T) (remote, local []string) {
+	t.Helper()
+	upstream := httptest.NewServer(fakeupstream.New(fakeupstream.Options{}))
+	t.Cleanup(upstream.Close)
+
+	cfg, err := config.Load(config.Sources{Environ: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.DataDir = t.TempDir()
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:   "test",
+		TMDBBaseURL:  upstream.URL + "/3",
+		ImageBaseURL: "https://image.test/t/p/w500",
+		OMDBAPIKey:   "test",
+		OMDBBaseURL:  upstream.URL,
+	}, upstream.Client())
+	router := api.NewRouter(cfg,
+		api.WithMovieService(movieService),
+		api.WithTemplates(template.Must(template.New("index.html").Parse(""))),
+		api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	t.Cleanup(func() { router.Shutdown(context.Background()) })
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	local = []string{
+		"TMDB_API_KEY=test",
+		"TMDB_BASE_URL=" + upstream.URL + "/3",
+		"TMDB_IMAGE_BASE_URL=https://image.test/t/p/w500",
+		"OMDB_API_KEY=test",
+		"OMDB_BASE_URL=" + upstream.URL,
+		"DATA_DIR=" + t.TempDir(),
+	}
+	return []string{"MOVIECLI_SERVER=" + srv.URL}, local
+}
+
+func TestCommands(t *testing.T) {
+	remote, local := newEnv(t)
+
+	tests := []struct {
+		name string
+		args string
+		want []string
+		err  error
+	}{
+		{name: "search", args: "search inception", want: []string{"ID  ", "27205  movie  Inception  2010  8.4"}},
+		{name: "search type", args: "search --type tv bad", want: []string{"1396  tv  Breaking Bad  2008"}},
+		{name: "show", args: "show 27205", want: []string{"Title  Inception", "Director  Christopher Nolan", "IMDb  tt1375666"}},
+		{name: "show JSON", args: "-o json show 550", want: []string{`"title": "Fight Club"`}},
+		{name: "tv", args: "tv 1396", want: []string{"Name  Breaking Bad", "Created by  Vince Gilligan"}},
+		{name: "season", args: "tv 1396 --season 5", want: []string{"S05E01  "}},
+		{name: "trending", args: "trending --week -o plain", want: []string{"1396\ttv\tBreaking Bad\t2008\t"}},
+		{name: "genres", args: "genres --type movie", want: []string{"movie  878  Science Fiction"}},
+		{name: "discover", args: "discover --genre 'science fiction' --year 1999", want: []string{"603  movie  The Matrix  1999"}},
+		{name: "discover IDs", args: "discover --genre 18,53 -o plain", want: []string{"550\tmovie\tFight Club"}},
+
+		{name: "no command", err: errUsage},
+		{name: "unknown command", args: "rate 550", err: errUsage},
+		{name: "bad ID", args: "show inception", err: errUsage},
+		{name: "bad type", args: "search --type person nolan", err: errUsage},
+		{name: "bad format", args: "-o yaml trending", err: errUsage},
+		{name: "unknown genre", args: "discover --genre noir", err: errUsage},
+		{name: "help", args: "show -h", err: flag.ErrHelp},
+	}
+
+	for _, mode := range []struct {
+		name    string
+		environ []string
+	}{{"remote", remote}, {"local", local}} {
+		t.Run(mode.name, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					out, err := runCLI(t, mode.environ, tt.args)
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("error = %v, want %v", err, tt.err)
+					}
+					for _, want := range tt.want {
+						if !strings.Contains(squeeze(out), want) {
+							t.Errorf("output lacks %q:\n%s", want, out)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestWatchlist(t *testing.T) {
+	remote, local := newEnv(t)
+
+	for _, mode := range []struct {
+		name    string
+		environ []string
+	}{{"remote", remote}, {"local", local}} {
+		t.Run(mode.name, func(t *testing.T) {
+			steps := []struct {
+				args string
+				want string
+				err  bool
+			}{
+				{args: "watchlist list -o json", want: "[]"},
+				{args: "watchlist add 550", want: "550  movie  Fight Club  1999"},
+				{args: "watchlist add --type tv 1396 -o plain", want: "1396\ttv\tBreaking Bad\t2008"},
+				{args: "watchlist list", want: "550  movie  Fight Club  1999"},
+				{args: "-user bob watchlist list -o plain", want: ""},
+				{args: "watchlist rm 550", want: ""},
+				{args: "watchlist remove 550", err: true},
+				{args: "watchlist ls -o plain", want: "1396\ttv\tBreaking Bad"},
+			}
+			for _, step := range steps {
+				out, err := runCLI(t, mode.environ, step.args)
+				if (err != nil) != step.err {
+					t.Fatalf("%s: error = %v", step.args, err)
+				}
+				if !strings.Contains(squeeze(out), step.want) || (step.want == "" && out != "") {
+					t.Errorf("%s: output = %q, want %q", step.args, out, step.want)
+				}
+			}
+		})
+	}
+}
+
+// Without a TMDB key the local backend reads the demo dataset but keeps
+// its titles off the watchlist, unless the demo was asked for
+func TestLocalDemoWatchlist(t *testing.T) {
+	implicit := []string{"DATA_DIR=" + t.TempDir()}
+	if _, err := runCLI(t, implicit, "search the"); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	for _, args := range []string{"watchlist add 550", "watchlist rm 550"} {
+		if _, err := runCLI(t, implicit, args); !errors.Is(err, errDemoWatchlist) {
+			t.Errorf("%s: error = %v, want %v", args, err, errDemoWatchlist)
+		}
+	}
+
+	explicit := []string{"DATA_DIR=" + t.TempDir(), "DEMO_MODE=true"}
+	out, err := runCLI(t, explicit, "trending -o plain")
+	if err != nil || out == "" {
+		t.Fatalf("trending: %q, %v", out, err)
+	}
+	id, _, _ := strings.Cut(out, "\t")
+	if _, err := runCLI(t, explicit, "watchlist add --type "+strings.Fields(out)[1]+" "+id); err != nil {
+		t.Errorf("watchlist add in demo mode: %v", err)
+	}
+}
+
+func TestUnreachableServer(t *testing.T) {
+	_, err := runCLI(t, []string{"MOVIECLI_SERVER=http://127.0.0.1:1"}, "-timeout 1s trending")
+	if err == nil || errors.Is(err, errUsage) {
+		t.Fatalf("error = %v, want a connection error", err)
+	}
+}
+
+// runCLI runs moviecli with args, split on spaces outside single quotes,
+// and returns what it printed. The env file is one that does not exist.
+func runCLI(t *testing.T, environ []string, args string) (string, error) {
+	t.Helper()
+	argv := []string{"-env-file", filepath.Join(t.TempDir(), ".env")}
+	for i, part := range strings.Split(args, "'") {
+		if i%2 == 1 {
+			argv = append(argv, part)
+		} else {
+			argv = append(argv, strings.Fields(part)...)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), argv, environ, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+// squeeze collapses the padding of table columns to two spaces
+func squeeze(s string) string {
+	var b strings.Builder
+	spaces := 0
+	for _, r := range s {
+		if r == ' ' {
+			spaces++
+			continue
+		}
+		if spaces > 0 {
+			b.WriteString(strings.Repeat(" ", min(spaces, 2)))
+			spaces = 0
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
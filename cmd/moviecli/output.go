@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"movie-discovery-app/pkg/models"
+)
+
+// table is a command's result as rows of text, for the table and plain
+// formats
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+func (t *table) add(cells ...string) {
+	t.rows = append(t.rows, cells)
+}
+
+// print writes v as indented JSON, or t as aligned columns under a header,
+// or t as tab-separated rows without one for scripts
+func (a *app) print(v interface{}, t *table) error {
+	switch a.format {
+	case "json":
+		enc := json.NewEncoder(a.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "plain":
+		for _, row := range t.rows {
+			if _, err := fmt.Fprintln(a.out, strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 0, 2, ' ', 0)
+	if t.header != nil {
+		fmt.Fprintln(w, strings.Join(t.header, "\t"))
+	}
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// mediaTable lists search, trending or discover results. fallbackType is
+// the media type of results that do not say, as when searching one type.
+func mediaTable(results []models.Media, fallbackType string) *table {
+	t := &table{header: []string{"ID", "TYPE", "TITLE", "YEAR", "RATING"}}
+	for _, m := range results {
+		mediaType := m.MediaType
+		if mediaType == "" {
+			mediaType = fallbackType
+		}
+		title, date := m.Title, m.ReleaseDate
+		if title == "" {
+			title, date = m.Name, m.FirstAirDate
+		}
+		t.add(strconv.Itoa(m.ID), mediaType, title, year(date), rating(m.VoteAverage))
+	}
+	return t
+}
+
+// movieTable describes a movie as field and value rows
+func movieTable(m *models.MovieDetails) *table {
+	t := &table{}
+	t.add("Title", m.Title)
+	t.add("Released", m.ReleaseDate)
+	if m.Runtime > 0 {
+		t.add("Runtime", fmt.Sprintf("%d min", m.Runtime))
+	}
+	t.add("Genres", genreNames(m.Genres))
+	t.add("Rating", rating(m.VoteAverage))
+	if m.Credits != nil {
+		var directors []string
+		for _, c := range m.Credits.Crew {
+			if c.Job == "Director" {
+				directors = append(directors, c.Name)
+			}
+		}
+		t.add("Director", strings.Join(directors, ", "))
+		t.add("Starring", castNames(m.Credits.Cast, 5))
+	}
+	if m.ExternalIDs != nil && m.ExternalIDs.IMDBID != "" {
+		t.add("IMDb", m.ExternalIDs.IMDBID)
+	}
+	if m.Tagline != "" {
+		t.add("Tagline", m.Tagline)
+	}
+	t.add("Overview", m.Overview)
+	return t
+}
+
+// tvTable describes a TV show as field and value rows
+func tvTable(s *models.TVDetails) *table {
+	t := &table{}
+	t.add("Name", s.Name)
+	t.add("First aired", s.FirstAirDate)
+	t.add("Status", s.Status)
+	t.add("Seasons", fmt.Sprintf("%d (%d episodes)", s.NumberOfSeasons, s.NumberOfEpisodes))
+	t.add("Genres", genreNames(s.Genres))
+	t.add("Rating", rating(s.VoteAverage))
+	networks := make([]string, len(s.Networks))
+	for i, n := range s.Networks {
+		networks[i] = n.Name
+	}
+	t.add("Networks", strings.Join(networks, ", "))
+	creators := make([]string, len(s.CreatedBy))
+	for i, c := range s.CreatedBy {
+		creators[i] = c.Name
+	}
+	t.add("Created by", strings.Join(creators, ", "))
+	if s.Credits != nil {
+		t.add("Starring", castNames(s.Credits.Cast, 5))
+	}
+	if s.ExternalIDs != nil && s.ExternalIDs.IMDBID != "" {
+		t.add("IMDb", s.ExternalIDs.IMDBID)
+	}
+	t.add("Overview", s.Overview)
+	return t
+}
+
+// seasonTable lists a season's episodes
+func seasonTable(s *models.SeasonDetails) *table {
+	t := &table{header: []string{"EPISODE", "AIR DATE", "TITLE", "RUNTIME", "RATING"}}
+	for _, e := range s.Episodes {
+		runtime := ""
+		if e.Runtime > 0 {
+			runtime = fmt.Sprintf("%d min", e.Runtime)
+		}
+		t.add(fmt.Sprintf("S%02dE%02d", e.SeasonNumber, e.EpisodeNumber), e.AirDate, e.Name, runtime, rating(e.VoteAverage))
+	}
+	return t
+}
+
+// genreTable lists movie genres and then TV genres
+func genreTable(genres map[string][]models.Genre) *table {
+	t := &table{header: []string{"TYPE", "ID", "NAME"}}
+	for _, mediaType := range []string{"movie", "tv"} {
+		for _, g := range genres[mediaType] {
+			t.add(mediaType, strconv.Itoa(g.ID), g.Name)
+		}
+	}
+	return t
+}
+
+// watchlistTable lists watchlist items in the order they were added
+func watchlistTable(items []models.WatchlistItem) *table {
+	t := &table{header: []string{"ID", "TYPE", "TITLE", "YEAR", "ADDED"}}
+	for _, item := range items {
+		t.add(strconv.Itoa(item.ID), item.MediaType, item.Title, year(item.ReleaseDate), item.AddedDate)
+	}
+	return t
+}
+
+func genreNames(genres []models.Genre) string {
+	names := make([]string, len(genres))
+	for i, g := range genres {
+		names[i] = g.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// castNames lists the first n of the cast in billing order
+func castNames(cast []models.CastMember, n int) string {
+	var names []string
+	for i, c := range cast {
+		if i == n {
+			break
+		}
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// year is the year of a YYYY-MM-DD date, or "" when it is unknown
+func year(date string) string {
+	if len(date) < 4 {
+		return ""
+	}
+	return date[:4]
+}
+
+func rating(voteAverage float64) string {
+	if voteAverage == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(voteAverage, 'f', 1, 64)
+}
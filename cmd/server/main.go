@@ -1,65 +1,169 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"movie-discovery-app/internal/api"
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/tracing"
 )
 
-// loadEnv loads environment variables from .env file
-func loadEnv() {
-	file, err := os.Open("./configs/.env")
-	if err != nil {
-		// .env file doesn't exist, that's okay
-		return
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
+const (
+	// workerStopTimeout bounds waiting for running imports to save their progress
+	workerStopTimeout = 10 * time.Second
+	// traceFlushTimeout bounds exporting the spans still buffered
+	traceFlushTimeout = 5 * time.Second
+)
 
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
+// setupLogging sends structured logs to stderr, as JSON unless the format is text
+func setupLogging(cfg config.Log) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		level = slog.LevelInfo
+	}
 
-		// Split on first = sign
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stderr, opts)
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
 
-			// Only set if not already set in environment
-			if os.Getenv(key) == "" {
-				os.Setenv(key, value)
-			}
-		}
+// shutdown runs one step of a graceful shutdown with its own deadline,
+// logging rather than returning a failure so the next step still runs
+func shutdown(timeout time.Duration, msg string, fn func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		slog.Error(msg, "error", err)
 	}
 }
 
 func main() {
-	// Load environment variables from .env file
-	loadEnv()
+	port := flag.Int("port", 0, "port to listen on, overrides PORT")
+	configFile := flag.String("config", "", "YAML or TOML config file")
+	envFile := flag.String("env-file", "configs/.env", "file of KEY=value environment settings")
+	flag.Parse()
+
+	sources := config.Sources{File: *configFile, EnvFile: *envFile}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			sources.Overrides = map[string]string{"server.port": strconv.Itoa(*port)}
+		case "env-file":
+			// The default file is optional, one asked for by name is not
+			sources.RequireEnvFile = true
+		}
+	})
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load(sources)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	setupLogging(cfg.Log)
+	slog.Info("loaded configuration", "config", cfg)
+
+	// Export traces when an OTLP endpoint is configured
+	tracer, err := tracing.New(tracing.Options{
+		Endpoint:       cfg.Tracing.Endpoint,
+		TracesEndpoint: cfg.Tracing.TracesEndpoint,
+		Headers:        cfg.Tracing.Headers,
+		ServiceName:    cfg.Tracing.ServiceName,
+		Sampler:        cfg.Tracing.Sampler,
+		SamplerArg:     cfg.Tracing.SamplerArg,
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
+	tracing.SetDefault(tracer)
 
 	// Initialize API routes
-	router := api.NewRouter()
+	router := api.NewRouter(cfg)
+
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		// Exports look up IMDb IDs while writing, so allow slow responses
+		WriteTimeout:   2 * time.Minute,
+		IdleTimeout:    2 * time.Minute,
+		MaxHeaderBytes: 64 << 10,
+		ErrorLog:       slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	// Room event streams and gRPC streaming calls never finish on their
+	// own, so end them rather than wait for the drain to time out
+	server.RegisterOnShutdown(router.CloseStreams)
+
+	// gRPC clients speak HTTP/2 without TLS too
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	// Serve TLS when a certificate is configured, reloading it when the
+	// files change so renewals need no restart
+	if cfg.Server.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Start server
-	fmt.Printf("Movie Discovery App starting on port %s\n", port)
-	fmt.Printf("Open http://localhost:%s in your browser\n", port)
+	scheme := "http"
+	if server.TLSConfig != nil {
+		scheme = "https"
+	}
+	fmt.Printf("Movie Discovery App starting on port %d\n", cfg.Server.Port)
+	fmt.Printf("Open %s://localhost:%d in your browser\n", scheme, cfg.Server.Port)
 
 	
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	serveErr := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			serveErr <- server.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process without waiting for the drain
+	stop()
+
+	slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout)
+
+	// Stop taking requests and let in-flight ones finish, then stop the
+	// background workers and flush the remaining spans. Each step has its
+	// own deadline, so a slow drain cannot cut the others short.
+	shutdown(cfg.Server.ShutdownTimeout, "failed to drain requests", server.Shutdown)
+	shutdown(workerStopTimeout, "failed to stop background workers", router.Shutdown)
+	shutdown(traceFlushTimeout, "failed to flush traces", tracer.Shutdown)
+	slog.Info("server stopped")
 }
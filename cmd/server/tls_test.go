@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Reloads are logged to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newCert returns a self-signed certificate and its key, PEM encoded
+func newCert(t *testing.T, name string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to path and gives it a modification time of modTime
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commonName is the name on the certificate r serves
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestNewCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	certPEM, keyPEM := newCert(t, "old.test")
+	writeFile(t, certFile, certPEM, time.Now())
+	writeFile(t, keyFile, keyPEM, time.Now())
+	otherCert, _ := newCert(t, "other.test")
+	mismatched := filepath.Join(dir, "other.pem")
+	writeFile(t, mismatched, otherCert, time.Now())
+
+	tests := []struct {
+		name              string
+		certFile, keyFile string
+		wantErr           bool
+	}{
+		{"loaded", certFile, keyFile, false},
+		{"no key", certFile, "", true},
+		{"missing certificate", filepath.Join(dir, "missing.pem"), keyFile, true},
+		{"missing key", certFile, filepath.Join(dir, "missing.pem"), true},
+		{"key for another certificate", mismatched, keyFile, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := newCertReloader(tt.certFile, tt.keyFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && commonName(t, r) != "old.test" {
+				t.Errorf("serving %q", commonName(t, r))
+			}
+		})
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	oldCert, oldKey := newCert(t, "old.test")
+	writeFile(t, certFile, oldCert, start)
+	writeFile(t, keyFile, oldKey, start)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := commonName(t, r); got != "old.test" {
+		t.Fatalf("serving %q, want old.test", got)
+	}
+
+	// A renewal half written keeps the old certificate in service
+	newCertPEM, newKey := newCert(t, "new.test")
+	writeFile(t, certFile, newCertPEM, start.Add(time.Minute))
+	r.checked = time.Time{}
+	if got := commonName(t, r); got != "old.test" {
+		t.Errorf("half-written renewal: serving %q, want old.test", got)
+	}
+
+	// Files are only looked at every certCheckInterval
+	writeFile(t, keyFile, newKey, start.Add(time.Minute))
+	if got := commonName(t, r); got != "old.test" {
+		t.Errorf("within the check interval: serving %q, want old.test", got)
+	}
+
+	r.checked = time.Now().Add(-certCheckInterval)
+	if got := commonName(t, r); got != "new.test" {
+		t.Errorf("after the renewal: serving %q, want new.test", got)
+	}
+
+	// Removed files leave the loaded certificate in service
+	if err := os.Remove(certFile); err != nil {
+		t.Fatal(err)
+	}
+	r.checked = time.Time{}
+	if got := commonName(t, r); got != "new.test" {
+		t.Errorf("files removed: serving %q, want new.test", got)
+	}
+}
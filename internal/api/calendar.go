@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"movie-discovery-app/internal/ical"
+	"movie-discovery-app/internal/storage"
+)
+
+// calendarToken is a user's private calendar token and the feed URL with it
+type calendarToken struct {
+	CreatedAt time.Time `json:"created_at"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+}
+
+func (r *Router) handleCalendarToken(w http.ResponseWriter, req *http.Request) {
+	// Posting issues a new token so a leaked feed URL can be revoked
+	rotate := req.Method == http.MethodPost
+
+	token, err := r.calendarFeeds.UserToken(userID(req), rotate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	feedURL := url.URL{
+		Scheme:   scheme,
+		Host:     req.Host,
+		Path:     "/api/calendar.ics",
+		RawQuery: url.Values{"token": {token.Token}}.Encode(),
+	}
+
+	r.writeJSON(w, req, calendarToken{
+		Token:     token.Token,
+		URL:       feedURL.String(),
+		CreatedAt: token.CreatedAt,
+	})
+}
+
+func (r *Router) handleCalendarFeed(w http.ResponseWriter, req *http.Request) {
+	// Calendar apps cannot send headers, so the token in the URL identifies the user
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Calendar token is required", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := r.calendarFeeds.LookupToken(token)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	region := strings.ToUpper(req.URL.Query().Get("region"))
+	if region != "" && !validRegion(region) {
+		http.Error(w, "Region must be a two-letter country code", http.StatusBadRequest)
+		return
+	}
+	if region == "" {
+		prefs, err := r.scheduler.Preferences(user)
+		if err == nil && prefs.Region != "" {
+			region = prefs.Region
+		} else {
+			region = "US"
+		}
+	}
+
+	calendar, err := r.calendarFeeds.UserFeed(req.Context(), token, region)
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	writeCalendar(w, calendar)
+}
+
+// upcomingFilters are the TMDB discover filters the upcoming calendar takes
+var upcomingFilters = map[string]bool{
+	"with_genres":                   true,
+	"without_genres":                true,
+	"with_keywords":                 true,
+	"without_keywords":              true,
+	"with_original_language":        true,
+	"with_origin_country":           true,
+	"with_companies":                true,
+	"with_networks":                 true,
+	"with_watch_providers":          true,
+	"with_watch_monetization_types": true,
+	"with_release_type":             true,
+	"with_runtime.gte":              true,
+	"with_runtime.lte":              true,
+	"vote_average.gte":              true,
+	"vote_count.gte":                true,
+	"certification_country":         true,
+	"certification":                 true,
+	"certification.lte":             true,
+}
+
+// maxFilterLength caps a filter value, which is plenty for a list of IDs
+const maxFilterLength = 200
+
+// validRegion reports whether region looks like an ISO 3166-1 country code
+func validRegion(region string) bool {
+	if len(region) != 2 {
+		return false
+	}
+	for _, c := range region {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Router) handleUpcomingCalendar(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	mediaType := query.Get("type")
+	if mediaType == "" {
+		mediaType = "movie"
+	}
+	if mediaType != "movie" && mediaType != "tv" {
+		http.Error(w, "Type must be movie or tv", http.StatusBadRequest)
+		return
+	}
+
+	// The supported discover filters are passed on to TMDB. Paging and
+	// sorting are the feed's own, so those are ignored.
+	filters := url.Values{}
+	for key, values := range query {
+		value := values[0]
+		switch {
+		case key == "type" || key == "page" || key == "sort_by":
+			continue
+		case key == "region":
+			if !validRegion(value) {
+				http.Error(w, "Region must be a two-letter country code", http.StatusBadRequest)
+				return
+			}
+			value = strings.ToUpper(value)
+			filters.Set("watch_region", value)
+			if mediaType == "movie" {
+				filters.Set("region", value)
+			}
+		case !upcomingFilters[key]:
+			http.Error(w, fmt.Sprintf("Unsupported filter %q", key), http.StatusBadRequest)
+			return
+		case len(value) > maxFilterLength:
+			http.Error(w, fmt.Sprintf("Filter %q is too long", key), http.StatusBadRequest)
+			return
+		default:
+			filters.Set(key, value)
+		}
+	}
+
+	calendar, err := r.calendarFeeds.DiscoverFeed(req.Context(), mediaType, filters)
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	writeCalendar(w, calendar)
+}
+
+func writeCalendar(w http.ResponseWriter, calendar *ical.Calendar) {
+	var buf bytes.Buffer
+	if _, err := calendar.WriteTo(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCalendarHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+	alice := map[string]string{"X-User-ID": "alice"}
+
+	rec := serve(router, http.MethodGet, "/api/calendar/token", alice, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token: status %d\n%s", rec.Code, rec.Body)
+	}
+	var token struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+	if token.Token == "" || token.URL != "http://example.com/api/calendar.ics?token="+token.Token {
+		t.Fatalf("token = %+v", token)
+	}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "token again", target: "/api/calendar/token", header: alice, status: http.StatusOK, want: token.Token},
+		{name: "token https", target: "/api/calendar/token", header: map[string]string{"X-User-ID": "alice", "X-Forwarded-Proto": "https"}, status: http.StatusOK, want: `"url":"https://example.com/api/calendar.ics`},
+		{name: "token delete", method: http.MethodDelete, target: "/api/calendar/token", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+
+		{name: "feed", target: "/api/calendar.ics?token=" + token.Token, status: http.StatusOK, contentType: "text/calendar", want: "BEGIN:VCALENDAR"},
+		{name: "feed without token", target: "/api/calendar.ics", status: http.StatusUnauthorized, want: "Calendar token is required"},
+		{name: "feed unknown token", target: "/api/calendar.ics?token=nope", status: http.StatusNotFound},
+		{name: "feed malformed token", target: "/api/calendar.ics?token=..%2Fcalendar_users%2Falice", status: http.StatusNotFound},
+		{name: "feed bad region", target: "/api/calendar.ics?region=GBR&token=" + token.Token, status: http.StatusBadRequest, want: "two-letter"},
+		{name: "feed post", method: http.MethodPost, target: "/api/calendar.ics?token=" + token.Token, status: http.StatusMethodNotAllowed},
+
+		{name: "upcoming movies", target: "/api/calendar/upcoming.ics", status: http.StatusOK, contentType: "text/calendar", golden: "upcoming_movie.ics"},
+		{name: "upcoming tv", target: "/api/calendar/upcoming.ics?type=tv&region=GB", status: http.StatusOK, golden: "upcoming_tv.ics"},
+		{name: "upcoming bad type", target: "/api/calendar/upcoming.ics?type=person", status: http.StatusBadRequest, want: "Type must be movie or tv"},
+		{name: "upcoming unsupported filter", target: "/api/calendar/upcoming.ics?with_genres=27&x=1", status: http.StatusBadRequest, want: `Unsupported filter "x"`},
+		{name: "upcoming long filter", target: "/api/calendar/upcoming.ics?with_keywords=" + strings.Repeat("1,", 101), status: http.StatusBadRequest, want: "too long"},
+		{name: "upcoming bad region", target: "/api/calendar/upcoming.ics?region=1", status: http.StatusBadRequest, want: "two-letter"},
+		{name: "upcoming post", method: http.MethodPost, target: "/api/calendar/upcoming.ics", status: http.StatusMethodNotAllowed},
+	})
+
+	// Rotating replaces the token, so the old feed URL stops working
+	rec = serve(router, http.MethodPost, "/api/calendar/token", alice, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate: status %d", rec.Code)
+	}
+	if rec := serve(router, http.MethodGet, "/api/calendar.ics?token="+token.Token, nil, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("old token: status %d, want 404", rec.Code)
+	}
+}
+
+func TestUpcomingCalendarFilters(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	serve(router, http.MethodGet, "/api/calendar/upcoming.ics?region=GB&with_genres=878&page=4&sort_by=title.asc", nil, "")
+	fake.AssertQuery(t, "/3/discover/movie", "region", "GB")
+	fake.AssertQuery(t, "/3/discover/movie", "watch_region", "GB")
+	fake.AssertQuery(t, "/3/discover/movie", "with_genres", "878")
+	fake.AssertQuery(t, "/3/discover/movie", "page", "1")
+
+	serve(router, http.MethodGet, "/api/calendar/upcoming.ics?type=tv&region=GB", nil, "")
+	fake.AssertQuery(t, "/3/discover/tv", "watch_region", "GB")
+	fake.AssertQuery(t, "/3/discover/tv", "region", "")
+}
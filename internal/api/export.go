@@ -0,0 +1,31 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+func (r *Router) handleExport(w http.ResponseWriter, req *http.Request) {
+	user := userID(req)
+	library, err := r.store.Library(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Build the archive in memory so a failure can still be reported as a 500
+	now := r.now().UTC()
+	var buf bytes.Buffer
+	if err := r.exporter.WriteZip(req.Context(), &buf, library, now); err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	filename := fmt.Sprintf("movie-discovery-%s-%s.zip", user, now.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
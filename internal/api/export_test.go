@@ -0,0 +1,157 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"movie-discovery-app/internal/export"
+	"movie-discovery-app/pkg/models"
+)
+
+func TestExportHandler(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "export", target: "/api/export?user=alice", status: http.StatusOK, contentType: "application/zip", want: "PK"},
+		{name: "post", method: http.MethodPost, target: "/api/export", status: http.StatusMethodNotAllowed},
+		{name: "invalid user", target: "/api/export?user=../etc", status: http.StatusBadRequest},
+	})
+
+	rec := serve(router, http.MethodGet, "/api/export", map[string]string{"X-User-ID": "alice"}, "")
+	want := `attachment; filename="movie-discovery-alice-2026-10-01.zip"`
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("Content-Disposition %q, want %q", got, want)
+	}
+}
+
+func TestExportContents(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	// Only The Matrix was saved with its IMDb ID, the rest are looked up
+	err := router.store.UpdateLibrary("alice", func(library *models.Library) error {
+		library.Watchlist = []models.WatchlistItem{
+			{ID: 550, Title: "Fight Club", MediaType: "movie", ReleaseDate: "1999-10-15", AddedDate: "2026-09-01"},
+			{ID: 1396, Title: "Breaking Bad", MediaType: "tv", ReleaseDate: "2008-01-20", Watched: true},
+		}
+		library.Ratings = []models.Rating{
+			{ID: 603, Title: "The Matrix", Year: 1999, MediaType: "movie", Rating: 9, RatedDate: "2026-09-02", IMDBID: "tt0133093"},
+		}
+		library.Diary = []models.DiaryEntry{
+			{ID: 27205, Title: "Inception", Year: 2010, MediaType: "movie", WatchedDate: "2026-09-03", Rating: 8.5, Tags: []string{"imax", "friends"}},
+			{ID: 27205, Title: "Inception", Year: 2010, MediaType: "movie", WatchedDate: "2026-09-03", Rewatch: true},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := readExport(t, router)
+
+	csvs := map[string]string{
+		"watchlist.csv": "tmdbID,imdbID,Title,Year\n" +
+			"550,tt0137523,Fight Club,1999\n",
+		"ratings.csv": "tmdbID,imdbID,Title,Year,Rating10\n" +
+			"603,tt0133093,The Matrix,1999,9\n",
+		"diary.csv": "tmdbID,imdbID,Title,Year,Rating10,WatchedDate,Rewatch,Tags\n" +
+			"27205,tt1375666,Inception,2010,8.5,2026-09-03,,\"imax, friends\"\n" +
+			"27205,tt1375666,Inception,2010,,2026-09-03,Yes,\n",
+	}
+	for name, want := range csvs {
+		if got := files[name]; got != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+
+	var records []export.Record
+	dec := json.NewDecoder(strings.NewReader(files["library.jsonl"]))
+	for dec.More() {
+		var record export.Record
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	var got []string
+	for _, r := range records {
+		got = append(got, r.Type+" "+r.MediaType+" "+r.IMDBID)
+	}
+	want := []string{
+		"watchlist movie tt0137523",
+		"watchlist tv tt0903747",
+		"rating movie tt0133093",
+		"diary movie tt1375666",
+		"diary movie tt1375666",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("library.jsonl records %q, want %q", got, want)
+	}
+	if r := records[1]; r.TMDBID != 1396 || !r.Watched || r.Year != 2008 {
+		t.Errorf("watchlist record %+v", r)
+	}
+
+	ics := files["diary.ics"]
+	if n := strings.Count(ics, "BEGIN:VEVENT"); n != 2 {
+		t.Errorf("diary.ics has %d events, want 2:\n%s", n, ics)
+	}
+	for _, line := range []string{
+		"UID:diary-0-movie-27205-2026-09-03@movie-discovery-app",
+		"UID:diary-1-movie-27205-2026-09-03@movie-discovery-app",
+		"DTSTART;VALUE=DATE:20260903",
+		"SUMMARY:Inception (2010)",
+		"SUMMARY:Inception (2010) (rewatch)",
+		"DESCRIPTION:Rated 8.5/10",
+	} {
+		if !strings.Contains(ics, line+"\r\n") {
+			t.Errorf("diary.ics lacks %q:\n%s", line, ics)
+		}
+	}
+
+	// Titles are looked up once, and not again for the next export
+	for _, path := range []string{"/3/movie/550/external_ids", "/3/tv/1396/external_ids", "/3/movie/27205/external_ids"} {
+		if n := len(fake.Calls(path)); n != 1 {
+			t.Errorf("%s called %d times, want 1", path, n)
+		}
+	}
+	if n := len(fake.Calls("/3/movie/603/external_ids")); n != 0 {
+		t.Errorf("known IMDb ID looked up %d times", n)
+	}
+	readExport(t, router)
+	if n := len(fake.Calls("/3/movie/550/external_ids")); n != 1 {
+		t.Errorf("second export looked up Fight Club again")
+	}
+}
+
+// readExport downloads alice's export and returns its files by name
+func readExport(t *testing.T, router http.Handler) map[string]string {
+	t.Helper()
+	rec := serve(router, http.MethodGet, "/api/export", map[string]string{"X-User-ID": "alice"}, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d\n%s", rec.Code, rec.Body)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	return files
+}
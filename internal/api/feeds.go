@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"movie-discovery-app/internal/feed"
+	"movie-discovery-app/internal/storage"
+)
+
+func (r *Router) handleFeed(w http.ResponseWriter, req *http.Request) {
+	// The file names the feed and its format, e.g. trending.atom
+	name := req.PathValue("file")
+	format := strings.TrimPrefix(path.Ext(name), ".")
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if format != "atom" && format != "rss" {
+		http.NotFound(w, req)
+		return
+	}
+
+	query := req.URL.Query()
+
+	var (
+		f   *feed.Feed
+		err error
+	)
+	switch name {
+	case "trending":
+		f, err = r.feedBuilder.Trending(req.Context(), query.Get("time_window"))
+	case "upcoming":
+		mediaType := query.Get("type")
+		if mediaType != "" && mediaType != "movie" && mediaType != "tv" {
+			http.Error(w, "Type must be movie or tv", http.StatusBadRequest)
+			return
+		}
+		// The region is part of the cache key, so only country codes are taken
+		region := query.Get("region")
+		if region != "" && !validRegion(region) {
+			http.Error(w, "Region must be a two-letter country code", http.StatusBadRequest)
+			return
+		}
+		f, err = r.feedBuilder.Upcoming(req.Context(), mediaType, strings.ToUpper(region))
+	case "diary":
+		// Feed readers cannot send headers, so the diary uses the private
+		// calendar token to identify the user
+		token := query.Get("token")
+		if token == "" {
+			http.Error(w, "Feed token is required", http.StatusUnauthorized)
+			return
+		}
+		var user string
+		user, err = r.calendarFeeds.LookupToken(token)
+		if err == nil {
+			f, err = r.feedBuilder.Diary(user)
+		}
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	// Point the self link at the URL the reader subscribed to
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	self := *f
+	self.Self = scheme + "://" + req.Host + req.URL.RequestURI()
+
+	var buf bytes.Buffer
+	contentType := "application/atom+xml; charset=utf-8"
+	if format == "rss" {
+		contentType = "application/rss+xml; charset=utf-8"
+		err = self.WriteRSS(&buf)
+	} else {
+		err = self.WriteAtom(&buf)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// ServeContent answers If-None-Match and If-Modified-Since with 304
+	sum := sha256.Sum256(buf.Bytes())
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "public, max-age=900")
+	http.ServeContent(w, req, "", self.Updated, bytes.NewReader(buf.Bytes()))
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestFeedHandler(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := serve(router, http.MethodGet, "/api/calendar/token", map[string]string{"X-User-ID": "alice"}, "")
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &token); err != nil {
+		t.Fatal(err)
+	}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "trending atom", target: "/api/feeds/trending.atom", status: http.StatusOK, contentType: "application/atom+xml", golden: "trending.atom"},
+		{name: "trending rss", target: "/api/feeds/trending.rss?time_window=week", status: http.StatusOK, contentType: "application/rss+xml", golden: "trending_week.rss"},
+		{name: "trending head", method: http.MethodHead, target: "/api/feeds/trending.atom", status: http.StatusOK},
+		{name: "upcoming", target: "/api/feeds/upcoming.atom?type=tv", status: http.StatusOK, want: "<feed"},
+		{name: "upcoming region", target: "/api/feeds/upcoming.rss?region=gb", status: http.StatusOK, want: "<rss"},
+		{name: "upcoming bad region", target: "/api/feeds/upcoming.rss?region=" + strings.Repeat("x", 64), status: http.StatusBadRequest, want: "two-letter"},
+		{name: "upcoming bad type", target: "/api/feeds/upcoming.rss?type=person", status: http.StatusBadRequest, want: "Type must be movie or tv"},
+		{name: "diary", target: "/api/feeds/diary.atom?token=" + token.Token, status: http.StatusOK, want: "<feed"},
+		{name: "diary without token", target: "/api/feeds/diary.rss", status: http.StatusUnauthorized, want: "Feed token is required"},
+		{name: "diary unknown token", target: "/api/feeds/diary.rss?token=nope", status: http.StatusNotFound},
+		{name: "unknown format", target: "/api/feeds/trending.json", status: http.StatusNotFound},
+		{name: "no format", target: "/api/feeds/trending", status: http.StatusNotFound},
+		{name: "unknown feed", target: "/api/feeds/popular.atom", status: http.StatusNotFound},
+		{name: "nested path", target: "/api/feeds/x/trending.atom", status: http.StatusNotFound},
+		{name: "post", method: http.MethodPost, target: "/api/feeds/trending.atom", status: http.StatusMethodNotAllowed},
+	})
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := serve(router, http.MethodGet, "/api/feeds/trending.atom", nil, "")
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	rec = serve(router, http.MethodGet, "/api/feeds/trending.atom", map[string]string{"If-None-Match": etag}, "")
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status %d, want 304", rec.Code)
+	}
+}
@@ -0,0 +1,687 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"movie-discovery-app/internal/graphql"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/pkg/models"
+)
+
+const (
+	// Deep enough for a movie's cast's other titles' details, no deeper
+	graphQLMaxDepth = 8
+	// About a page of titles with their details and leading cast
+	graphQLMaxComplexity = 3000
+	// graphQLPersistedQueries is how many queries clients may send by hash
+	graphQLPersistedQueries = 1000
+	// graphQLFetchConcurrency caps the TMDB requests one batch makes at once
+	graphQLFetchConcurrency = 8
+	// upstreamCost is the complexity of a field that may call TMDB
+	upstreamCost = 10
+)
+
+// graphQLLoaders batch and cache one GraphQL request's TMDB lookups, so a
+// person in the cast of three titles is fetched once
+type graphQLLoaders struct {
+	movie           *graphql.Loader
+	tv              *graphql.Loader
+	person          *graphql.Loader
+	season          *graphql.Loader
+	recommendations *graphql.Loader
+	genres          *graphql.Loader
+}
+
+// withGraphQLLoaders gives a GraphQL request its own loaders
+func (r *Router) withGraphQLLoaders(ctx context.Context) context.Context {
+	s := r.movieService
+	notFoundIsNull := func(ctx context.Context, v interface{}, err error) (interface{}, error) {
+		if errors.Is(err, services.ErrNotFound) {
+			return nil, nil
+		}
+		return v, r.graphQLError(ctx, err)
+	}
+	loader := func(fetch func(ctx context.Context, key string) (interface{}, error)) *graphql.Loader {
+		return graphql.NewLoader(graphql.Concurrently(graphQLFetchConcurrency, func(ctx context.Context, key string) (interface{}, error) {
+			v, err := fetch(ctx, key)
+			return notFoundIsNull(ctx, v, err)
+		}))
+	}
+
+	return context.WithValue(ctx, loadersKey, &graphQLLoaders{
+		movie: loader(func(ctx context.Context, id string) (interface{}, error) {
+			return s.GetMovieDetails(ctx, id)
+		}),
+		tv: loader(func(ctx context.Context, id string) (interface{}, error) {
+			return s.GetTVDetails(ctx, id)
+		}),
+		person: loader(func(ctx context.Context, id string) (interface{}, error) {
+			return s.GetPerson(ctx, id)
+		}),
+		// Keyed by tvID/number
+		season: loader(func(ctx context.Context, key string) (interface{}, error) {
+			tvID, number, _ := strings.Cut(key, "/")
+			n, _ := strconv.Atoi(number)
+			return s.GetSeason(ctx, tvID, n)
+		}),
+		// Keyed by movie/id or tv/id
+		recommendations: loader(func(ctx context.Context, key string) (interface{}, error) {
+			mediaType, id, _ := strings.Cut(key, "/")
+			results, err := s.GetRecommendations(ctx, mediaType, id)
+			for i := range results {
+				results[i].MediaType = mediaType
+			}
+			return results, err
+		}),
+		// One key, as TMDB lists every genre at once
+		genres: loader(func(ctx context.Context, _ string) (interface{}, error) {
+			return s.GetGenres(ctx)
+		}),
+	})
+}
+
+// load looks key up with one of the request's loaders
+func load(ctx context.Context, pick func(*graphQLLoaders) *graphql.Loader, key string) (interface{}, error) {
+	loaders, ok := ctx.Value(loadersKey).(*graphQLLoaders)
+	if !ok {
+		return nil, errors.New("no loaders for this request")
+	}
+	return pick(loaders).Load(ctx, key)
+}
+
+func movieLoader(l *graphQLLoaders) *graphql.Loader           { return l.movie }
+func tvLoader(l *graphQLLoaders) *graphql.Loader              { return l.tv }
+func personLoader(l *graphQLLoaders) *graphql.Loader          { return l.person }
+func seasonLoader(l *graphQLLoaders) *graphql.Loader          { return l.season }
+func recommendationsLoader(l *graphQLLoaders) *graphql.Loader { return l.recommendations }
+func genresLoader(l *graphQLLoaders) *graphql.Loader          { return l.genres }
+
+// season is a TV season and the show it belongs to, which TMDB's season
+// objects leave out
+type season struct {
+	models.Season
+	TVID int
+	// Episodes are set when the season was fetched whole
+	Episodes []models.Episode
+	complete bool
+}
+
+// newGraphQLHandler serves the media graph at /graphql
+func (r *Router) newGraphQLHandler() *graphql.Handler {
+	schema, err := graphql.NewSchema(r.graphQLQuery())
+	if err != nil {
+		panic(err)
+	}
+	h := graphql.NewHandler(schema)
+	h.Limits = graphql.Limits{MaxDepth: graphQLMaxDepth, MaxComplexity: graphQLMaxComplexity}
+	h.Persisted = graphql.NewPersistedQueries(graphQLPersistedQueries)
+	h.Context = r.withGraphQLLoaders
+	return h
+}
+
+func (r *Router) handleGraphQLSchema(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, r.graphQL.Schema.SDL())
+}
+
+func nonNull(t graphql.Type) graphql.Type {
+	return &graphql.NonNull{Of: t}
+}
+
+// listOf is a non-null list of non-null t
+func listOf(t graphql.Type) graphql.Type {
+	return nonNull(&graphql.List{Of: nonNull(t)})
+}
+
+// firstArg limits lists to their first n items
+var firstArg = &graphql.Arg{Name: "first", Description: "Return at most this many", Type: graphql.Int}
+
+// first returns how many of length items the first argument asks for
+func first(args graphql.Args, length int) (int, error) {
+	n, ok := args["first"].(int)
+	if !ok {
+		return length, nil
+	}
+	if n < 0 {
+		return 0, errors.New("first must not be negative")
+	}
+	return min(n, length), nil
+}
+
+// idArg reads a TMDB ID argument. Anything but a positive integer is
+// refused, so only IDs reach TMDB's URLs.
+func idArg(args graphql.Args, name string) (string, error) {
+	n, ok := pathNumber(args.String(name))
+	if !ok || n == 0 {
+		return "", fmt.Errorf("%s must be a positive integer", name)
+	}
+	return strconv.Itoa(n), nil
+}
+
+// graphQLQuery builds the schema's types and returns its query type
+func (r *Router) graphQLQuery() *graphql.Object {
+	mediaType := &graphql.Enum{Name: "MediaType", Values: []string{"MOVIE", "TV"}}
+	timeWindow := &graphql.Enum{Name: "TimeWindow", Values: []string{"DAY", "WEEK"}}
+
+	genre := &graphql.Object{Name: "Genre", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+	}}
+	keyword := &graphql.Object{Name: "Keyword", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+	}}
+	company := &graphql.Object{Name: "Company", Description: "A production company or TV network", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "logoPath", Type: graphql.String},
+		{Name: "originCountry", Type: graphql.String},
+	}}
+	video := &graphql.Object{Name: "Video", Description: "A trailer, teaser or clip", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "key", Type: nonNull(graphql.String), Description: "The video's ID on its site"},
+		{Name: "site", Type: nonNull(graphql.String)},
+		{Name: "type", Type: nonNull(graphql.String)},
+		{Name: "size", Type: graphql.Int},
+		{Name: "official", Type: nonNull(graphql.Boolean)},
+		{Name: "publishedAt", Type: graphql.String},
+	}}
+	rating := &graphql.Object{Name: "Rating", Description: "A score from OMDB, such as Rotten Tomatoes'", Fields: []*graphql.Field{
+		{Name: "source", Type: nonNull(graphql.String)},
+		{Name: "value", Type: nonNull(graphql.String)},
+	}}
+	episode := &graphql.Object{Name: "Episode", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "overview", Type: graphql.String},
+		{Name: "airDate", Type: graphql.String},
+		{Name: "seasonNumber", Type: nonNull(graphql.Int)},
+		{Name: "episodeNumber", Type: nonNull(graphql.Int)},
+		{Name: "runtime", Type: graphql.Int},
+		{Name: "stillPath", Type: graphql.String},
+		{Name: "voteAverage", Type: graphql.Float},
+	}}
+
+	media := &graphql.Object{Name: "Media", Description: "A movie or TV show as it appears in search results and lists"}
+	movie := &graphql.Object{Name: "MovieDetails"}
+	tv := &graphql.Object{Name: "TVDetails"}
+	person := &graphql.Object{Name: "Person", Description: "An actor or crew member"}
+	seasonType := &graphql.Object{Name: "Season"}
+
+	personField := &graphql.Field{Name: "person", Type: person, Cost: upstreamCost,
+		Description: "Everything about the person, including their other titles",
+		Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			id := graphql.Args{"id": fmt.Sprint(resolveID(source))}
+			return loadByID(ctx, personLoader, id)
+		},
+	}
+	castMember := &graphql.Object{Name: "CastMember", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "character", Type: graphql.String},
+		{Name: "order", Type: graphql.Int},
+		{Name: "profilePath", Type: graphql.String},
+		{Name: "creditId", Type: graphql.ID},
+		{Name: "knownForDepartment", Type: graphql.String, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return source.(models.CastMember).KnownForDept, nil
+		}},
+		personField,
+	}}
+	crewMember := &graphql.Object{Name: "CrewMember", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "job", Type: nonNull(graphql.String)},
+		{Name: "department", Type: graphql.String},
+		{Name: "profilePath", Type: graphql.String},
+		{Name: "creditId", Type: graphql.ID},
+		personField,
+	}}
+	creator := &graphql.Object{Name: "Creator", Description: "Someone who created a TV show", Fields: []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "profilePath", Type: graphql.String},
+		personField,
+	}}
+
+	mediaField := &graphql.Field{Name: "media", Type: nonNull(media), Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+		switch c := source.(type) {
+		case models.PersonCastCredit:
+			return c.Media, nil
+		case models.PersonCrewCredit:
+			return c.Media, nil
+		}
+		return nil, nil
+	}}
+	castCredit := &graphql.Object{Name: "CastCredit", Description: "A title a person acted in", Fields: []*graphql.Field{
+		{Name: "character", Type: graphql.String},
+		{Name: "creditId", Type: graphql.ID},
+		mediaField,
+	}}
+	crewCredit := &graphql.Object{Name: "CrewCredit", Description: "A title a person worked on behind the camera", Fields: []*graphql.Field{
+		{Name: "job", Type: nonNull(graphql.String)},
+		{Name: "department", Type: graphql.String},
+		{Name: "creditId", Type: graphql.ID},
+		mediaField,
+	}}
+
+	media.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "mediaType", Type: graphql.String, Description: "movie or tv, or person in mixed search results"},
+		{Name: "title", Type: graphql.String, Description: "A movie's title"},
+		{Name: "name", Type: graphql.String, Description: "A TV show's name"},
+		{Name: "originalTitle", Type: graphql.String},
+		{Name: "originalName", Type: graphql.String},
+		{Name: "overview", Type: graphql.String},
+		{Name: "posterPath", Type: graphql.String},
+		{Name: "backdropPath", Type: graphql.String},
+		{Name: "releaseDate", Type: graphql.String, Description: "A movie's release date"},
+		{Name: "firstAirDate", Type: graphql.String, Description: "A TV show's first air date"},
+		{Name: "genreIds", Type: listOf(graphql.ID)},
+		{Name: "genres", Type: listOf(genre), Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			m := source.(models.Media)
+			return mediaGenres(ctx, m.MediaType, m.GenreIDs)
+		}},
+		{Name: "voteAverage", Type: graphql.Float},
+		{Name: "voteCount", Type: graphql.Int},
+		{Name: "popularity", Type: graphql.Float},
+		{Name: "adult", Type: graphql.Boolean},
+		{Name: "originalLanguage", Type: graphql.String},
+		{Name: "movie", Type: movie, Cost: upstreamCost, Description: "The movie's details, when this is a movie",
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				m := source.(models.Media)
+				if m.MediaType != "movie" {
+					return nil, nil
+				}
+				return load(ctx, movieLoader, strconv.Itoa(m.ID))
+			}},
+		{Name: "tv", Type: tv, Cost: upstreamCost, Description: "The show's details, when this is a TV show",
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				m := source.(models.Media)
+				if m.MediaType != "tv" {
+					return nil, nil
+				}
+				return load(ctx, tvLoader, strconv.Itoa(m.ID))
+			}},
+	}
+
+	// Fields shared by movies and TV shows, which differ in where they keep
+	// their credits and extras
+	type extras struct {
+		credits     *models.Credits
+		externalIDs *models.ExternalIDs
+		videos      *models.VideosResponse
+		keywords    *models.KeywordsResponse
+		omdb        *models.OMDBResponse
+		mediaType   string
+		id          int
+	}
+	extrasOf := func(source interface{}) extras {
+		switch d := source.(type) {
+		case *models.MovieDetails:
+			return extras{d.Credits, d.ExternalIDs, d.Videos, d.Keywords, d.OMDBData, "movie", d.ID}
+		case *models.TVDetails:
+			return extras{d.Credits, d.ExternalIDs, d.Videos, d.Keywords, d.OMDBData, "tv", d.ID}
+		}
+		return extras{}
+	}
+	detailFields := func() []*graphql.Field {
+		return []*graphql.Field{
+			{Name: "genres", Type: listOf(genre)},
+			{Name: "voteAverage", Type: graphql.Float},
+			{Name: "voteCount", Type: graphql.Int},
+			{Name: "popularity", Type: graphql.Float},
+			{Name: "status", Type: graphql.String},
+			{Name: "originalLanguage", Type: graphql.String},
+			{Name: "productionCompanies", Type: listOf(company)},
+			{Name: "imdbId", Type: graphql.String, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				if ids := extrasOf(source).externalIDs; ids != nil && ids.IMDBID != "" {
+					return ids.IMDBID, nil
+				}
+				return nil, nil
+			}},
+			{Name: "cast", Type: listOf(castMember), Args: []*graphql.Arg{firstArg}, Description: "Billing order",
+				Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+					credits := extrasOf(source).credits
+					if credits == nil {
+						return nil, nil
+					}
+					n, err := first(args, len(credits.Cast))
+					return credits.Cast[:n], err
+				}},
+			{Name: "crew", Type: listOf(crewMember), Args: []*graphql.Arg{{Name: "job", Type: graphql.String, Description: "Only this job, e.g. Director"}, firstArg},
+				Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+					credits := extrasOf(source).credits
+					if credits == nil {
+						return nil, nil
+					}
+					var crew []models.CrewMember
+					for _, c := range credits.Crew {
+						if job := args.String("job"); job == "" || strings.EqualFold(c.Job, job) {
+							crew = append(crew, c)
+						}
+					}
+					n, err := first(args, len(crew))
+					return crew[:n], err
+				}},
+			{Name: "videos", Type: listOf(video), Args: []*graphql.Arg{{Name: "type", Type: graphql.String, Description: "Only this type, e.g. Trailer"}, firstArg},
+				Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+					videos := extrasOf(source).videos
+					if videos == nil {
+						return nil, nil
+					}
+					var matching []models.Video
+					for _, v := range videos.Results {
+						if t := args.String("type"); t == "" || strings.EqualFold(v.Type, t) {
+							matching = append(matching, v)
+						}
+					}
+					n, err := first(args, len(matching))
+					return matching[:n], err
+				}},
+			{Name: "keywords", Type: listOf(keyword), Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				return extrasOf(source).keywords.All(), nil
+			}},
+			{Name: "ratings", Type: listOf(rating), Description: "Scores from OMDB, when it is configured",
+				Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+					if omdb := extrasOf(source).omdb; omdb != nil {
+						return omdb.Ratings, nil
+					}
+					return nil, nil
+				}},
+			{Name: "recommendations", Type: listOf(media), Args: []*graphql.Arg{firstArg}, Cost: upstreamCost, ListSize: 20,
+				Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+					e := extrasOf(source)
+					v, err := load(ctx, recommendationsLoader, e.mediaType+"/"+strconv.Itoa(e.id))
+					results, _ := v.([]models.Media)
+					if err != nil {
+						return nil, err
+					}
+					n, err := first(args, len(results))
+					return results[:n], err
+				}},
+		}
+	}
+
+	movie.Fields = append([]*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "title", Type: nonNull(graphql.String)},
+		{Name: "originalTitle", Type: graphql.String},
+		{Name: "tagline", Type: graphql.String},
+		{Name: "overview", Type: graphql.String},
+		{Name: "posterPath", Type: graphql.String},
+		{Name: "backdropPath", Type: graphql.String},
+		{Name: "releaseDate", Type: graphql.String},
+		{Name: "runtime", Type: graphql.Int, Description: "Minutes"},
+		{Name: "budget", Type: graphql.Float, Description: "US dollars", Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return float64(source.(*models.MovieDetails).Budget), nil
+		}},
+		{Name: "revenue", Type: graphql.Float, Description: "US dollars", Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return float64(source.(*models.MovieDetails).Revenue), nil
+		}},
+	}, detailFields()...)
+
+	tv.Fields = append([]*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "originalName", Type: graphql.String},
+		{Name: "overview", Type: graphql.String},
+		{Name: "posterPath", Type: graphql.String},
+		{Name: "backdropPath", Type: graphql.String},
+		{Name: "firstAirDate", Type: graphql.String},
+		{Name: "lastAirDate", Type: graphql.String},
+		{Name: "type", Type: graphql.String},
+		{Name: "numberOfSeasons", Type: graphql.Int},
+		{Name: "numberOfEpisodes", Type: graphql.Int},
+		{Name: "episodeRunTime", Type: listOf(graphql.Int), Description: "Minutes"},
+		{Name: "networks", Type: listOf(company)},
+		{Name: "createdBy", Type: listOf(creator)},
+		{Name: "seasons", Type: listOf(seasonType), Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			show := source.(*models.TVDetails)
+			seasons := make([]season, len(show.Seasons))
+			for i, s := range show.Seasons {
+				seasons[i] = season{Season: s, TVID: show.ID}
+			}
+			return seasons, nil
+		}},
+		{Name: "lastEpisodeToAir", Type: episode},
+		{Name: "nextEpisodeToAir", Type: episode},
+	}, detailFields()...)
+
+	seasonType.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "overview", Type: graphql.String},
+		{Name: "posterPath", Type: graphql.String},
+		{Name: "seasonNumber", Type: nonNull(graphql.Int)},
+		{Name: "episodeCount", Type: graphql.Int},
+		{Name: "airDate", Type: graphql.String},
+		{Name: "episodes", Type: listOf(episode), Cost: upstreamCost, ListSize: 20,
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				s := source.(season)
+				if s.complete {
+					return s.Episodes, nil
+				}
+				v, err := load(ctx, seasonLoader, fmt.Sprintf("%d/%d", s.TVID, s.SeasonNumber))
+				if details, ok := v.(*models.SeasonDetails); ok {
+					return details.Episodes, err
+				}
+				return nil, err
+			}},
+	}
+
+	person.Fields = []*graphql.Field{
+		{Name: "id", Type: nonNull(graphql.ID)},
+		{Name: "name", Type: nonNull(graphql.String)},
+		{Name: "biography", Type: graphql.String},
+		{Name: "birthday", Type: graphql.String},
+		{Name: "deathday", Type: graphql.String},
+		{Name: "placeOfBirth", Type: graphql.String},
+		{Name: "profilePath", Type: graphql.String},
+		{Name: "knownForDepartment", Type: graphql.String},
+		{Name: "gender", Type: graphql.Int, Description: "0 not set, 1 female, 2 male, 3 non-binary"},
+		{Name: "popularity", Type: graphql.Float},
+		{Name: "imdbId", Type: graphql.String},
+		{Name: "castCredits", Type: listOf(castCredit), Args: []*graphql.Arg{firstArg}, Description: "Most popular first",
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				p := source.(*models.Person)
+				if p.CombinedCredits == nil {
+					return nil, nil
+				}
+				// Sort a copy, as the person may be shared with other fields
+				credits := append([]models.PersonCastCredit(nil), p.CombinedCredits.Cast...)
+				sort.SliceStable(credits, func(i, j int) bool { return credits[i].Popularity > credits[j].Popularity })
+				n, err := first(args, len(credits))
+				return credits[:n], err
+			}},
+		{Name: "crewCredits", Type: listOf(crewCredit), Args: []*graphql.Arg{{Name: "job", Type: graphql.String, Description: "Only this job, e.g. Director"}, firstArg}, Description: "Most popular first",
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				p := source.(*models.Person)
+				if p.CombinedCredits == nil {
+					return nil, nil
+				}
+				var credits []models.PersonCrewCredit
+				for _, c := range p.CombinedCredits.Crew {
+					if job := args.String("job"); job == "" || strings.EqualFold(c.Job, job) {
+						credits = append(credits, c)
+					}
+				}
+				sort.SliceStable(credits, func(i, j int) bool { return credits[i].Popularity > credits[j].Popularity })
+				n, err := first(args, len(credits))
+				return credits[:n], err
+			}},
+	}
+
+	searchResults := &graphql.Object{Name: "SearchResults", Fields: []*graphql.Field{
+		{Name: "page", Type: nonNull(graphql.Int)},
+		{Name: "totalPages", Type: nonNull(graphql.Int)},
+		{Name: "totalResults", Type: nonNull(graphql.Int)},
+		{Name: "results", Type: listOf(media), ListSize: 20},
+	}}
+
+	idArgs := []*graphql.Arg{{Name: "id", Type: nonNull(graphql.ID)}}
+	return &graphql.Object{Name: "Query", Fields: []*graphql.Field{
+		{Name: "search", Type: nonNull(searchResults), Cost: upstreamCost, Description: "Search movies and TV shows by title",
+			Args: []*graphql.Arg{
+				{Name: "query", Type: nonNull(graphql.String)},
+				{Name: "type", Type: mediaType, Description: "Only movies or only TV shows"},
+				{Name: "page", Type: graphql.Int, Default: 1},
+			},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				if args.String("query") == "" {
+					return nil, errors.New("query must not be empty")
+				}
+				page := args.Int("page")
+				if page < 1 || page > 500 {
+					return nil, errors.New("page must be between 1 and 500")
+				}
+				return r.search(ctx, args.String("query"), strings.ToLower(args.String("type")), page)
+			}},
+		{Name: "movie", Type: movie, Args: idArgs, Cost: upstreamCost, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return loadByID(ctx, movieLoader, args)
+		}},
+		{Name: "tv", Type: tv, Args: idArgs, Cost: upstreamCost, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return loadByID(ctx, tvLoader, args)
+		}},
+		{Name: "person", Type: person, Args: idArgs, Cost: upstreamCost, Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+			return loadByID(ctx, personLoader, args)
+		}},
+		{Name: "season", Type: seasonType, Cost: upstreamCost, Description: "A TV season with its episodes",
+			Args: []*graphql.Arg{{Name: "tvId", Type: nonNull(graphql.ID)}, {Name: "number", Type: nonNull(graphql.Int)}},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				tvID, err := idArg(args, "tvId")
+				if err != nil {
+					return nil, err
+				}
+				number := args.Int("number")
+				if number < 0 {
+					return nil, errors.New("number must not be negative")
+				}
+				v, err := load(ctx, seasonLoader, fmt.Sprintf("%s/%d", tvID, number))
+				details, ok := v.(*models.SeasonDetails)
+				if err != nil || !ok {
+					return nil, err
+				}
+				id, _ := strconv.Atoi(tvID)
+				return season{
+					Season: models.Season{
+						ID:           details.ID,
+						Name:         details.Name,
+						Overview:     details.Overview,
+						PosterPath:   details.PosterPath,
+						SeasonNumber: details.SeasonNumber,
+						EpisodeCount: len(details.Episodes),
+						AirDate:      details.AirDate,
+					},
+					TVID:     id,
+					Episodes: details.Episodes,
+					complete: true,
+				}, nil
+			}},
+		{Name: "trending", Type: listOf(media), Cost: upstreamCost, ListSize: 20, Description: "Movies and TV shows trending on TMDB",
+			Args: []*graphql.Arg{{Name: "timeWindow", Type: timeWindow, Default: "DAY"}, firstArg},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				trending, err := r.movieService.GetTrending(ctx, strings.ToLower(args.String("timeWindow")))
+				if err != nil {
+					return nil, r.graphQLError(ctx, err)
+				}
+				n, err := first(args, len(trending.Results))
+				return trending.Results[:n], err
+			}},
+		{Name: "genres", Type: listOf(genre), Cost: upstreamCost,
+			Args: []*graphql.Arg{{Name: "type", Type: nonNull(mediaType)}},
+			Resolve: func(ctx context.Context, source interface{}, args graphql.Args) (interface{}, error) {
+				v, err := load(ctx, genresLoader, "")
+				genres, _ := v.(map[string][]models.Genre)
+				return genres[strings.ToLower(args.String("type"))], err
+			}},
+	}}
+}
+
+// graphQLError turns a MovieService error into one fit for the response.
+// Like writeServiceError it logs upstream errors rather than sending them.
+func (r *Router) graphQLError(ctx context.Context, err error) error {
+	switch {
+	case err == nil, errors.Is(err, services.ErrNotFound),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case errors.Is(err, services.ErrCircuitOpen):
+		return errors.New("upstream service unavailable, try again later")
+	}
+	r.logger.ErrorContext(ctx, "upstream request failed", "request_id", RequestIDFrom(ctx), "error", err)
+	return errors.New("upstream request failed")
+}
+
+// search runs a search for movies, TV shows or both. TMDB leaves the media
+// type out of the results of searches for one type, so it is filled in.
+func (r *Router) search(ctx context.Context, query, mediaType string, page int) (*models.SearchResponse, error) {
+	results, err := r.movieService.Search(ctx, query, mediaType, strconv.Itoa(page))
+	if err != nil {
+		return nil, r.graphQLError(ctx, err)
+	}
+	if mediaType != "" {
+		for i := range results.Results {
+			results.Results[i].MediaType = mediaType
+		}
+	}
+	return results, nil
+}
+
+// loadByID loads the TMDB ID in args' id with one of the request's loaders
+func loadByID(ctx context.Context, pick func(*graphQLLoaders) *graphql.Loader, args graphql.Args) (interface{}, error) {
+	id, err := idArg(args, "id")
+	if err != nil {
+		return nil, err
+	}
+	return load(ctx, pick, id)
+}
+
+// resolveID returns the ID of a cast member, crew member or creator
+func resolveID(source interface{}) int {
+	switch s := source.(type) {
+	case models.CastMember:
+		return s.ID
+	case models.CrewMember:
+		return s.ID
+	case models.Creator:
+		return s.ID
+	}
+	return 0
+}
+
+// mediaGenres names a search result's genre IDs. Results of mixed searches
+// may be either type, so the other type's genres are a fallback.
+func mediaGenres(ctx context.Context, mediaType string, ids []int) ([]models.Genre, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	v, err := load(ctx, genresLoader, "")
+	if err != nil {
+		return nil, err
+	}
+	all := v.(map[string][]models.Genre)
+	lists := [][]models.Genre{all["movie"], all["tv"]}
+	if mediaType == "tv" {
+		lists[0], lists[1] = lists[1], lists[0]
+	}
+
+	genres := make([]models.Genre, 0, len(ids))
+	for _, id := range ids {
+	lookup:
+		for _, list := range lists {
+			for _, g := range list {
+				if g.ID == id {
+					genres = append(genres, g)
+					break lookup
+				}
+			}
+		}
+	}
+	return genres, nil
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"movie-discovery-app/internal/graphql"
+)
+
+// graphQLBody is a POST /graphql body
+func graphQLBody(query string, variables map[string]interface{}) string {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	return string(body)
+}
+
+func TestGraphQL(t *testing.T) {
+	router, _ := newTestRouter(t)
+	json := map[string]string{"Content-Type": "application/json"}
+
+	runHandlerTests(t, router, []handlerTest{
+		{
+			name:   "movie",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body: graphQLBody(`query($id: ID!) {
+				movie(id: $id) {
+					id title releaseDate runtime budget revenue imdbId
+					genres { name }
+					directors: crew(job: "Director") { name job }
+					cast(first: 3) { name character person { name birthday } }
+					trailers: videos(type: "Trailer", first: 1) { site key }
+					ratings { source value }
+					recommendations(first: 2) { id title mediaType }
+				}
+			}`, map[string]interface{}{"id": "550"}),
+			status:      http.StatusOK,
+			contentType: "application/json",
+			golden:      "graphql_movie_550.json",
+		},
+		{
+			name:   "tv",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body: graphQLBody(`{
+				tv(id: 1396) {
+					name numberOfSeasons
+					createdBy { name }
+					seasons { seasonNumber episodeCount }
+					nextEpisodeToAir { name airDate }
+				}
+				season(tvId: 1396, number: 5) { name episodes { episodeNumber name } }
+			}`, nil),
+			status: http.StatusOK,
+			golden: "graphql_tv_1396.json",
+		},
+		{
+			name:   "person",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body: graphQLBody(`{
+				person(id: 287) {
+					name knownForDepartment
+					castCredits(first: 3) { character media { id mediaType title name } }
+				}
+			}`, nil),
+			status: http.StatusOK,
+			golden: "graphql_person_287.json",
+		},
+		{
+			name: "search and trending",
+			target: "/graphql?" + url.Values{"query": {`{
+				search(query: "the", type: MOVIE) { page totalResults results { id title mediaType genres { name } } }
+				trending(timeWindow: WEEK, first: 3) { id mediaType title name }
+				genres(type: TV) { id name }
+			}`}}.Encode(),
+			status: http.StatusOK,
+			golden: "graphql_search.json",
+		},
+		{
+			name:   "not found",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body:   graphQLBody(`{ movie(id: 999999999) { title } }`, nil),
+			status: http.StatusOK,
+			want:   `{"data":{"movie":null}}`,
+		},
+		{
+			name:   "invalid id",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body:   graphQLBody(`{ movie(id: "../tv/1396") { title } }`, nil),
+			status: http.StatusOK,
+			want:   `"message":"id must be a positive integer"`,
+		},
+		{
+			name:   "negative first",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body:   graphQLBody(`{ trending(first: -1) { id } }`, nil),
+			status: http.StatusOK,
+			want:   `"message":"first must not be negative"`,
+		},
+		{
+			name:   "unknown field",
+			method: http.MethodPost,
+			target: "/graphql",
+			header: json,
+			body:   graphQLBody(`{ movie(id: 550) { tit } }`, nil),
+			status: http.StatusOK,
+			want:   `Did you mean \"title\"?`,
+		},
+		{name: "no query", target: "/graphql", status: http.StatusBadRequest, want: "Must provide query string."},
+		{name: "delete", method: http.MethodDelete, target: "/graphql", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+		{name: "schema", target: "/graphql/schema", status: http.StatusOK, contentType: "text/plain", golden: "graphql_schema.graphql"},
+	})
+}
+
+func TestGraphQLBatchesUpstreamCalls(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	// Two aliases for the same movie, and its cast's people, who are also
+	// in the other movie's cast
+	query := `{
+		a: movie(id: 550) { title cast { person { name } } }
+		b: movie(id: 550) { title }
+		c: movie(id: 603) { cast(first: 2) { person { name } } genres { name } }
+		trending { genres { name } }
+		search(query: "matrix") { results { genres { name } } }
+	}`
+	rec := serve(router, http.MethodPost, "/graphql", nil, graphQLBody(query, nil))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"errors"`) {
+		t.Fatalf("status %d\n%s", rec.Code, rec.Body)
+	}
+
+	fake.AssertCallCount(t, "/3/movie/550", 1)
+	fake.AssertCallCount(t, "/3/movie/603", 1)
+	fake.AssertCallCount(t, "/3/genre/movie/list", 1)
+	fake.AssertCallCount(t, "/3/genre/tv/list", 1)
+	for _, r := range fake.Requests() {
+		if strings.HasPrefix(r.Path, "/3/person/") && len(fake.Calls(r.Path)) != 1 {
+			t.Errorf("%s was requested %d times", r.Path, len(fake.Calls(r.Path)))
+		}
+	}
+
+	// Loaders belong to one request, so nothing is cached across requests
+	fake.Reset()
+	serve(router, http.MethodPost, "/graphql", nil, graphQLBody(`{ movie(id: 550) { title } }`, nil))
+	fake.AssertCallCount(t, "/3/movie/550", 1)
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	tests := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{
+			name:  "too deep",
+			query: `{ movie(id: 550) { cast { person { castCredits { media { movie { cast { person { name } } } } } } } } }`,
+			code:  "QUERY_TOO_DEEP",
+		},
+		{
+			name:  "too complex",
+			query: `{ trending(first: 100) { movie { cast(first: 100) { person { name } } } } }`,
+			code:  "QUERY_TOO_COMPLEX",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Reset()
+			rec := serve(router, http.MethodPost, "/graphql", nil, graphQLBody(tt.query, nil))
+			var resp graphql.Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != tt.code {
+				t.Fatalf("errors %s, want %s", rec.Body, tt.code)
+			}
+			// Refused queries never reach TMDB
+			if requests := fake.Requests(); len(requests) != 0 {
+				t.Errorf("%d upstream requests", len(requests))
+			}
+		})
+	}
+}
+
+func TestGraphQLPersistedQueries(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	query := `{ movie(id: 603) { title } }`
+	extensions := `{"persistedQuery":{"version":1,"sha256Hash":"` + graphql.Hash(query) + `"}}`
+	byHash := "/graphql?" + url.Values{"extensions": {extensions}}.Encode()
+
+	if rec := serve(router, http.MethodGet, byHash, nil, ""); !strings.Contains(rec.Body.String(), "PERSISTED_QUERY_NOT_FOUND") {
+		t.Fatalf("unknown hash: %s", rec.Body)
+	}
+
+	quoted, _ := json.Marshal(query)
+	body := `{"query":` + string(quoted) + `,"extensions":` + extensions + `}`
+	want := `{"data":{"movie":{"title":"The Matrix"}}}`
+	if rec := serve(router, http.MethodPost, "/graphql", nil, body); strings.TrimSpace(rec.Body.String()) != want {
+		t.Fatalf("with query: %s, want %s", rec.Body, want)
+	}
+	if rec := serve(router, http.MethodGet, byHash, nil, ""); strings.TrimSpace(rec.Body.String()) != want {
+		t.Errorf("by hash: %s, want %s", rec.Body, want)
+	}
+	fake.AssertCallCount(t, "/3/movie/603", 2)
+}
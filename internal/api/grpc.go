@@ -0,0 +1,483 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"movie-discovery-app/internal/grpc"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/pkg/models"
+)
+
+// discoveryService is the gRPC service in proto/discovery/v1/discovery.proto
+const discoveryService = "discovery.v1.Discovery"
+
+// maxSearchPages is the last page TMDB serves of any search
+const maxSearchPages = 500
+
+// mediaTypes are the MediaType enum's values by number
+var mediaTypes = []string{"", "movie", "tv", "person"}
+
+// timeWindows are the TimeWindow enum's values by number
+var timeWindows = []string{"day", "day", "week"}
+
+// newGRPCServer serves the discovery service over gRPC. Messages are
+// encoded by hand, field numbers following the .proto file.
+func (r *Router) newGRPCServer() *grpc.Server {
+	s := grpc.NewServer()
+	s.HandleUnary(discoveryService+"/Search", r.grpcSearch)
+	s.HandleStream(discoveryService+"/SearchAll", r.grpcSearchAll)
+	s.HandleUnary(discoveryService+"/GetMovie", r.grpcGetMovie)
+	s.HandleUnary(discoveryService+"/GetTV", r.grpcGetTV)
+	s.HandleUnary(discoveryService+"/GetTrending", r.grpcGetTrending)
+	s.HandleUnary(discoveryService+"/GetGenres", r.grpcGetGenres)
+	return s
+}
+
+// grpcError gives a MovieService error its gRPC code. Like
+// writeServiceError it logs other errors rather than sending them.
+func (r *Router) grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return grpc.Errorf(grpc.NotFound, "not found")
+	case errors.Is(err, services.ErrCircuitOpen):
+		return grpc.Errorf(grpc.Unavailable, "upstream service unavailable, try again later")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	}
+	r.logger.ErrorContext(ctx, "upstream request failed", "error", err)
+	return grpc.Errorf(grpc.Internal, "upstream request failed")
+}
+
+func invalidRequest(err error) error {
+	return grpc.Errorf(grpc.InvalidArgument, "invalid request: %v", err)
+}
+
+// enumValue returns the name of an enum value, or an error for values the
+// request may not use
+func enumValue(names []string, v int64, field string) (string, error) {
+	if v < 0 || v >= int64(len(names)) || (field == "type" && names[v] == "person") {
+		return "", grpc.Errorf(grpc.InvalidArgument, "invalid %s %d", field, v)
+	}
+	return names[v], nil
+}
+
+// searchRequest is a SearchRequest or SearchAllRequest, whose third field,
+// named pagesField, is the page or the maximum number of pages
+type searchRequest struct {
+	query     string
+	mediaType string
+	pages     int
+}
+
+func decodeSearchRequest(msg []byte, pagesField string) (searchRequest, error) {
+	var req searchRequest
+	var mediaType, pages int64
+	d := grpc.NewDecoder(msg)
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			req.query = d.String()
+		case 2:
+			mediaType = d.Int()
+		case 3:
+			pages = d.Int()
+		}
+	}
+	if err := d.Err(); err != nil {
+		return req, invalidRequest(err)
+	}
+	if req.query == "" {
+		return req, grpc.Errorf(grpc.InvalidArgument, "query is required")
+	}
+	if pages < 0 || pages > maxSearchPages {
+		return req, grpc.Errorf(grpc.InvalidArgument, "%s must be between 0 and %d", pagesField, maxSearchPages)
+	}
+	req.pages = int(pages)
+	var err error
+	req.mediaType, err = enumValue(mediaTypes, mediaType, "type")
+	return req, err
+}
+
+// decodeID reads the TMDB ID of a GetMovieRequest or GetTVRequest
+func decodeID(msg []byte) (string, error) {
+	var id int64
+	d := grpc.NewDecoder(msg)
+	for d.Next() {
+		if d.Field() == 1 {
+			id = d.Int()
+		}
+	}
+	if err := d.Err(); err != nil {
+		return "", invalidRequest(err)
+	}
+	// The same IDs pathNumber accepts
+	if id <= 0 || id > 999999999 {
+		return "", grpc.Errorf(grpc.InvalidArgument, "id must be a positive integer")
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// decodeEnum reads a request whose only field is an enum
+func decodeEnum(msg []byte, names []string, field string) (string, error) {
+	var v int64
+	d := grpc.NewDecoder(msg)
+	for d.Next() {
+		if d.Field() == 1 {
+			v = d.Int()
+		}
+	}
+	if err := d.Err(); err != nil {
+		return "", invalidRequest(err)
+	}
+	return enumValue(names, v, field)
+}
+
+func (r *Router) grpcSearch(ctx context.Context, msg []byte) ([]byte, error) {
+	req, err := decodeSearchRequest(msg, "page")
+	if err != nil {
+		return nil, err
+	}
+	results, err := r.search(ctx, req.query, req.mediaType, max(req.pages, 1))
+	if err != nil {
+		return nil, r.grpcError(ctx, err)
+	}
+
+	var e grpc.Encoder
+	e.Int(1, int64(results.Page))
+	for _, m := range results.Results {
+		e.Message(2, func(e *grpc.Encoder) { encodeMedia(e, m) })
+	}
+	e.Int(3, int64(results.TotalPages))
+	e.Int(4, int64(results.TotalResults))
+	return e.Bytes(), nil
+}
+
+// grpcSearchAll streams every result of a search, sending each page's
+// results before fetching the next
+func (r *Router) grpcSearchAll(ctx context.Context, msg []byte, send func([]byte) error) error {
+	req, err := decodeSearchRequest(msg, "max_pages")
+	if err != nil {
+		return err
+	}
+	last := maxSearchPages
+	if req.pages > 0 {
+		last = req.pages
+	}
+
+	ctx, cancel := r.streamContext(ctx)
+	defer cancel()
+
+	for page := 1; page <= last; page++ {
+		// Cached pages would not notice the stream was closed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		results, err := r.search(ctx, req.query, req.mediaType, page)
+		if err != nil {
+			return r.grpcError(ctx, err)
+		}
+		for _, m := range results.Results {
+			var e grpc.Encoder
+			encodeMedia(&e, m)
+			if err := send(e.Bytes()); err != nil {
+				return err
+			}
+		}
+		if page >= results.TotalPages || len(results.Results) == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+func (r *Router) grpcGetMovie(ctx context.Context, msg []byte) ([]byte, error) {
+	id, err := decodeID(msg)
+	if err != nil {
+		return nil, err
+	}
+	details, err := r.movieService.GetMovieDetails(ctx, id)
+	if err != nil {
+		return nil, r.grpcError(ctx, err)
+	}
+	var e grpc.Encoder
+	encodeMovieDetails(&e, details)
+	return e.Bytes(), nil
+}
+
+func (r *Router) grpcGetTV(ctx context.Context, msg []byte) ([]byte, error) {
+	id, err := decodeID(msg)
+	if err != nil {
+		return nil, err
+	}
+	details, err := r.movieService.GetTVDetails(ctx, id)
+	if err != nil {
+		return nil, r.grpcError(ctx, err)
+	}
+	var e grpc.Encoder
+	encodeTVDetails(&e, details)
+	return e.Bytes(), nil
+}
+
+func (r *Router) grpcGetTrending(ctx context.Context, msg []byte) ([]byte, error) {
+	timeWindow, err := decodeEnum(msg, timeWindows, "time_window")
+	if err != nil {
+		return nil, err
+	}
+	trending, err := r.movieService.GetTrending(ctx, timeWindow)
+	if err != nil {
+		return nil, r.grpcError(ctx, err)
+	}
+	var e grpc.Encoder
+	for _, m := range trending.Results {
+		e.Message(1, func(e *grpc.Encoder) { encodeMedia(e, m) })
+	}
+	return e.Bytes(), nil
+}
+
+func (r *Router) grpcGetGenres(ctx context.Context, msg []byte) ([]byte, error) {
+	mediaType, err := decodeEnum(msg, mediaTypes, "type")
+	if err != nil {
+		return nil, err
+	}
+	genres, err := r.movieService.GetGenres(ctx)
+	if err != nil {
+		return nil, r.grpcError(ctx, err)
+	}
+	var e grpc.Encoder
+	if mediaType != "tv" {
+		encodeGenres(&e, 1, genres["movie"])
+	}
+	if mediaType != "movie" {
+		encodeGenres(&e, 2, genres["tv"])
+	}
+	return e.Bytes(), nil
+}
+
+// mediaTypeNumber returns a media type's MediaType enum value
+func mediaTypeNumber(mediaType string) int64 {
+	for i, name := range mediaTypes {
+		if name == mediaType {
+			return int64(i)
+		}
+	}
+	return 0
+}
+
+func encodeMedia(e *grpc.Encoder, m models.Media) {
+	e.Int(1, int64(m.ID))
+	e.Int(2, mediaTypeNumber(m.MediaType))
+	e.String(3, m.Title)
+	e.String(4, m.Name)
+	e.String(5, m.OriginalTitle)
+	e.String(6, m.OriginalName)
+	e.String(7, m.Overview)
+	e.String(8, m.PosterPath)
+	e.String(9, m.BackdropPath)
+	e.String(10, m.ReleaseDate)
+	e.String(11, m.FirstAirDate)
+	e.Ints(12, m.GenreIDs)
+	e.Double(13, m.VoteAverage)
+	e.Int(14, int64(m.VoteCount))
+	e.Double(15, m.Popularity)
+	e.Bool(16, m.Adult)
+	e.Bool(17, m.Video)
+	e.String(18, m.OriginalLanguage)
+}
+
+func encodeMovieDetails(e *grpc.Encoder, d *models.MovieDetails) {
+	e.Int(1, int64(d.ID))
+	e.String(2, d.Title)
+	e.String(3, d.OriginalTitle)
+	e.String(4, d.Tagline)
+	e.String(5, d.Overview)
+	e.String(6, d.PosterPath)
+	e.String(7, d.BackdropPath)
+	e.String(8, d.ReleaseDate)
+	e.Int(9, int64(d.Runtime))
+	e.Int(10, d.Budget)
+	e.Int(11, d.Revenue)
+	e.String(12, d.Status)
+	encodeGenres(e, 13, d.Genres)
+	e.Double(14, d.VoteAverage)
+	e.Int(15, int64(d.VoteCount))
+	e.Double(16, d.Popularity)
+	e.Bool(17, d.Adult)
+	e.String(18, d.OriginalLanguage)
+	encodeLanguages(e, 19, d.SpokenLanguages)
+	for _, c := range d.ProductionCompanies {
+		e.Message(20, func(e *grpc.Encoder) { encodeCompany(e, c.ID, c.Name, c.LogoPath, c.OriginCountry) })
+	}
+	encodeCountries(e, 21, d.ProductionCountries)
+	encodeExtras(e, 22, d.Credits, d.ExternalIDs, d.Videos, d.Keywords, d.OMDBData)
+}
+
+func encodeTVDetails(e *grpc.Encoder, d *models.TVDetails) {
+	e.Int(1, int64(d.ID))
+	e.String(2, d.Name)
+	e.String(3, d.OriginalName)
+	e.String(4, d.Overview)
+	e.String(5, d.PosterPath)
+	e.String(6, d.BackdropPath)
+	e.String(7, d.FirstAirDate)
+	e.String(8, d.LastAirDate)
+	e.Int(9, int64(d.NumberOfSeasons))
+	e.Int(10, int64(d.NumberOfEpisodes))
+	e.Ints(11, d.EpisodeRunTime)
+	e.String(12, d.Status)
+	e.String(13, d.Type)
+	encodeGenres(e, 14, d.Genres)
+	e.Double(15, d.VoteAverage)
+	e.Int(16, int64(d.VoteCount))
+	e.Double(17, d.Popularity)
+	e.String(18, d.OriginalLanguage)
+	encodeLanguages(e, 19, d.SpokenLanguages)
+	for _, c := range d.ProductionCompanies {
+		e.Message(20, func(e *grpc.Encoder) { encodeCompany(e, c.ID, c.Name, c.LogoPath, c.OriginCountry) })
+	}
+	encodeCountries(e, 21, d.ProductionCountries)
+	for _, n := range d.Networks {
+		e.Message(22, func(e *grpc.Encoder) { encodeCompany(e, n.ID, n.Name, n.LogoPath, n.OriginCountry) })
+	}
+	for _, c := range d.CreatedBy {
+		e.Message(23, func(e *grpc.Encoder) {
+			e.Int(1, int64(c.ID))
+			e.String(2, c.Name)
+			e.String(3, c.ProfilePath)
+			e.String(4, c.CreditID)
+			e.Int(5, int64(c.Gender))
+		})
+	}
+	for _, s := range d.Seasons {
+		e.Message(24, func(e *grpc.Encoder) {
+			e.Int(1, int64(s.ID))
+			e.String(2, s.Name)
+			e.String(3, s.Overview)
+			e.String(4, s.PosterPath)
+			e.Int(5, int64(s.SeasonNumber))
+			e.Int(6, int64(s.EpisodeCount))
+			e.String(7, s.AirDate)
+		})
+	}
+	encodeEpisode(e, 25, d.LastEpisodeToAir)
+	encodeEpisode(e, 26, d.NextEpisodeToAir)
+	encodeExtras(e, 27, d.Credits, d.ExternalIDs, d.Videos, d.Keywords, d.OMDBData)
+}
+
+// encodeExtras writes the fields movies and TV shows share at the end of
+// their details: the IMDb ID at field, then cast, crew, videos, keywords
+// and ratings
+func encodeExtras(e *grpc.Encoder, field int, credits *models.Credits, ids *models.ExternalIDs, videos *models.VideosResponse, keywords *models.KeywordsResponse, omdb *models.OMDBResponse) {
+	if ids != nil {
+		e.String(field, ids.IMDBID)
+	}
+	if credits != nil {
+		for _, c := range credits.Cast {
+			e.Message(field+1, func(e *grpc.Encoder) {
+				e.Int(1, int64(c.ID))
+				e.String(2, c.Name)
+				e.String(3, c.Character)
+				e.String(4, c.ProfilePath)
+				e.Int(5, int64(c.Order))
+				e.String(6, c.CreditID)
+				e.Int(7, int64(c.Gender))
+				e.String(8, c.KnownForDept)
+			})
+		}
+		for _, c := range credits.Crew {
+			e.Message(field+2, func(e *grpc.Encoder) {
+				e.Int(1, int64(c.ID))
+				e.String(2, c.Name)
+				e.String(3, c.Job)
+				e.String(4, c.Department)
+				e.String(5, c.ProfilePath)
+				e.String(6, c.CreditID)
+				e.Int(7, int64(c.Gender))
+				e.String(8, c.KnownForDept)
+			})
+		}
+	}
+	if videos != nil {
+		for _, v := range videos.Results {
+			e.Message(field+3, func(e *grpc.Encoder) {
+				e.String(1, v.ID)
+				e.String(2, v.Name)
+				e.String(3, v.Key)
+				e.String(4, v.Site)
+				e.String(5, v.Type)
+				e.Int(6, int64(v.Size))
+				e.Bool(7, v.Official)
+				e.String(8, v.PublishedAt)
+				e.String(9, v.ISO6391)
+				e.String(10, v.ISO31661)
+			})
+		}
+	}
+	for _, k := range keywords.All() {
+		e.Message(field+4, func(e *grpc.Encoder) {
+			e.Int(1, int64(k.ID))
+			e.String(2, k.Name)
+		})
+	}
+	if omdb != nil {
+		for _, r := range omdb.Ratings {
+			e.Message(field+5, func(e *grpc.Encoder) {
+				e.String(1, r.Source)
+				e.String(2, r.Value)
+			})
+		}
+	}
+}
+
+func encodeGenres(e *grpc.Encoder, field int, genres []models.Genre) {
+	for _, g := range genres {
+		e.Message(field, func(e *grpc.Encoder) {
+			e.Int(1, int64(g.ID))
+			e.String(2, g.Name)
+		})
+	}
+}
+
+func encodeLanguages(e *grpc.Encoder, field int, languages []models.SpokenLanguage) {
+	for _, l := range languages {
+		e.Message(field, func(e *grpc.Encoder) {
+			e.String(1, l.ISO6391)
+			e.String(2, l.Name)
+			e.String(3, l.EnglishName)
+		})
+	}
+}
+
+func encodeCountries(e *grpc.Encoder, field int, countries []models.ProductionCountry) {
+	for _, c := range countries {
+		e.Message(field, func(e *grpc.Encoder) {
+			e.String(1, c.ISO31661)
+			e.String(2, c.Name)
+		})
+	}
+}
+
+func encodeCompany(e *grpc.Encoder, id int, name, logoPath, originCountry string) {
+	e.Int(1, int64(id))
+	e.String(2, name)
+	e.String(3, logoPath)
+	e.String(4, originCountry)
+}
+
+func encodeEpisode(e *grpc.Encoder, field int, ep *models.Episode) {
+	if ep == nil {
+		return
+	}
+	e.Message(field, func(e *grpc.Encoder) {
+		e.Int(1, int64(ep.ID))
+		e.String(2, ep.Name)
+		e.String(3, ep.Overview)
+		e.String(4, ep.AirDate)
+		e.Int(5, int64(ep.SeasonNumber))
+		e.Int(6, int64(ep.EpisodeNumber))
+		e.Int(7, int64(ep.Runtime))
+		e.String(8, ep.StillPath)
+		e.Double(9, ep.VoteAverage)
+	})
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/grpc"
+)
+
+// newGRPCClient serves router over HTTP/2 without TLS, as the server does,
+// and returns a gRPC client for it
+func newGRPCClient(t *testing.T, router *Router) *grpc.Client {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(router)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return grpc.NewClient(srv.URL, nil)
+}
+
+// media is the part of a Media message the tests look at
+type media struct {
+	id        int64
+	mediaType int64
+	title     string
+	name      string
+	genreIDs  []int64
+}
+
+func decodeMedia(t *testing.T, d *grpc.Decoder) media {
+	t.Helper()
+	var m media
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			m.id = d.Int()
+		case 2:
+			m.mediaType = d.Int()
+		case 3:
+			m.title = d.String()
+		case 4:
+			m.name = d.String()
+		case 12:
+			m.genreIDs = append(m.genreIDs, d.Ints()...)
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// fields decodes a message's fields by number, each as a list of values.
+// Strings and nested messages are strings, other fields integers or
+// doubles.
+func fields(t *testing.T, msg []byte) map[int][]interface{} {
+	t.Helper()
+	readers := []func(*grpc.Decoder) interface{}{
+		func(d *grpc.Decoder) interface{} { return d.String() },
+		func(d *grpc.Decoder) interface{} { return d.Int() },
+		func(d *grpc.Decoder) interface{} { return d.Double() },
+	}
+	all := make(map[int][]interface{})
+	d := grpc.NewDecoder(msg)
+	for d.Next() {
+		// Read a copy, as reading the wrong type fails the decoder
+		for _, read := range readers {
+			try := *d
+			if v := read(&try); try.Err() == nil {
+				all[d.Field()] = append(all[d.Field()], v)
+				break
+			}
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return all
+}
+
+func searchMessage(query string, mediaType, pages int64) []byte {
+	var e grpc.Encoder
+	e.String(1, query)
+	e.Int(2, mediaType)
+	e.Int(3, pages)
+	return e.Bytes()
+}
+
+func idMessage(id int64) []byte {
+	var e grpc.Encoder
+	e.Int(1, id)
+	return e.Bytes()
+}
+
+func TestGRPC(t *testing.T) {
+	router, _ := newTestRouter(t)
+	client := newGRPCClient(t, router)
+	ctx := context.Background()
+
+	t.Run("search", func(t *testing.T) {
+		reply, err := client.Invoke(ctx, discoveryService+"/Search", searchMessage("i", 1, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		d := grpc.NewDecoder(reply)
+		for d.Next() {
+			if d.Field() == 2 {
+				m := decodeMedia(t, d.Message())
+				if m.mediaType != 1 {
+					t.Errorf("%s has media type %d, want MEDIA_TYPE_MOVIE", m.title, m.mediaType)
+				}
+				titles = append(titles, m.title)
+			}
+		}
+		if fmt.Sprint(titles) != "[Inception The Matrix Fight Club]" {
+			t.Errorf("titles %v", titles)
+		}
+	})
+
+	t.Run("movie", func(t *testing.T) {
+		reply, err := client.Invoke(ctx, discoveryService+"/GetMovie", idMessage(550))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := fields(t, reply)
+		if f[1][0] != int64(550) || f[2][0] != "Fight Club" || f[22][0] != "tt0137523" {
+			t.Errorf("id %v, title %v, imdb_id %v", f[1], f[2], f[22])
+		}
+		if len(f[13]) != 2 || len(f[23]) == 0 || len(f[27]) != 3 {
+			t.Errorf("%d genres, %d cast, %d ratings", len(f[13]), len(f[23]), len(f[27]))
+		}
+	})
+
+	t.Run("tv", func(t *testing.T) {
+		reply, err := client.Invoke(ctx, discoveryService+"/GetTV", idMessage(1396))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := fields(t, reply)
+		if f[2][0] != "Breaking Bad" || f[9][0] != int64(5) || len(f[24]) != 5 {
+			t.Errorf("name %v, %v seasons, %d season messages", f[2], f[9], len(f[24]))
+		}
+	})
+
+	t.Run("trending", func(t *testing.T) {
+		var e grpc.Encoder
+		e.Int(1, 2)
+		reply, err := client.Invoke(ctx, discoveryService+"/GetTrending", e.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := fields(t, reply); len(f[1]) == 0 {
+			t.Error("no trending results")
+		}
+	})
+
+	t.Run("genres", func(t *testing.T) {
+		reply, err := client.Invoke(ctx, discoveryService+"/GetGenres", idMessage(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := fields(t, reply); len(f[1]) != 0 || len(f[2]) != 16 {
+			t.Errorf("%d movie and %d TV genres, want only TV's 16", len(f[1]), len(f[2]))
+		}
+	})
+
+	errorTests := []struct {
+		name   string
+		method string
+		req    []byte
+		code   grpc.Code
+	}{
+		{"unknown movie", "GetMovie", idMessage(999999), grpc.NotFound},
+		{"no id", "GetMovie", nil, grpc.InvalidArgument},
+		{"id too large", "GetTV", idMessage(1e10), grpc.InvalidArgument},
+		{"no query", "Search", searchMessage("", 0, 0), grpc.InvalidArgument},
+		{"person type", "Search", searchMessage("the", 3, 0), grpc.InvalidArgument},
+		{"page too large", "Search", searchMessage("the", 0, 501), grpc.InvalidArgument},
+		{"unknown time window", "GetTrending", idMessage(7), grpc.InvalidArgument},
+		{"malformed request", "GetMovie", []byte{0x08}, grpc.InvalidArgument},
+		{"unknown method", "DeleteMovie", nil, grpc.Unimplemented},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Invoke(ctx, discoveryService+"/"+tt.method, tt.req)
+			if code := grpc.CodeOf(err); code != tt.code {
+				t.Errorf("code %s (%v), want %s", code, err, tt.code)
+			}
+		})
+	}
+}
+
+// overlayFS serves its own files, falling back to the default fixtures
+type overlayFS struct {
+	fstest.MapFS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.MapFS.Open(name); err == nil {
+		return f, nil
+	}
+	return fakeupstream.DefaultFixtures.Open(name)
+}
+
+// manyResults is a movie search fixture with 45 results, three pages' worth
+func manyResults() fstest.MapFS {
+	var results []map[string]interface{}
+	for i := 1; i <= 45; i++ {
+		results = append(results, map[string]interface{}{"id": 5000 + i, "title": fmt.Sprintf("Sequel %d", i), "genre_ids": []int{28}})
+	}
+	body, _ := json.Marshal(map[string]interface{}{"results": results})
+	return fstest.MapFS{"tmdb/search/movie.json": {Data: body}}
+}
+
+func TestGRPCSearchAll(t *testing.T) {
+	router, fake := newTestRouterWith(t, fakeupstream.Options{Fixtures: overlayFS{manyResults()}})
+	client := newGRPCClient(t, router)
+
+	tests := []struct {
+		name     string
+		maxPages int64
+		results  int
+		requests int
+	}{
+		{"every page", 0, 45, 3},
+		{"two pages", 2, 40, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Reset()
+			var got []media
+			err := client.Stream(context.Background(), discoveryService+"/SearchAll", searchMessage("sequel", 1, tt.maxPages), func(msg []byte) error {
+				got = append(got, decodeMedia(t, grpc.NewDecoder(msg)))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.results {
+				t.Fatalf("%d results, want %d", len(got), tt.results)
+			}
+			for i, m := range got {
+				if m.id != int64(5001+i) || m.mediaType != 1 || len(m.genreIDs) != 1 {
+					t.Errorf("result %d is %+v", i, m)
+					break
+				}
+			}
+			fake.AssertCallCount(t, "/3/search/movie", tt.requests)
+		})
+	}
+
+	// The client may stop reading part way
+	stop := errors.New("enough")
+	n := 0
+	err := client.Stream(context.Background(), discoveryService+"/SearchAll", searchMessage("sequel", 1, 0), func(msg []byte) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("%d results, error %v", n, err)
+	}
+
+	// Streams are ended on shutdown
+	router.CloseStreams()
+	err = client.Stream(context.Background(), discoveryService+"/SearchAll", searchMessage("sequel", 1, 0), func(msg []byte) error {
+		return nil
+	})
+	if grpc.CodeOf(err) != grpc.Canceled {
+		t.Errorf("after CloseStreams: error %v, want %v", err, grpc.Canceled)
+	}
+}
+
+func TestGRPCOverHTTP1(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	// gRPC needs HTTP/2, and the mux only routes POSTs to it
+	rec := serve(router, http.MethodPost, "/"+discoveryService+"/Search", map[string]string{"Content-Type": "application/grpc"}, "")
+	if rec.Code != http.StatusHTTPVersionNotSupported {
+		t.Errorf("HTTP/1.1: status %d", rec.Code)
+	}
+	rec = serve(router, http.MethodGet, "/"+discoveryService+"/Search", nil, "")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d", rec.Code)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"movie-discovery-app/internal/services"
+)
+
+// checkResult is the outcome of one readiness check
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// serverStatus adds uptime and the state of TMDB and OMDB to readiness
+type serverStatus struct {
+	Status        string                    `json:"status"`
+	Started       time.Time                 `json:"started"`
+	UptimeSeconds int64                     `json:"uptime_seconds"`
+	Demo          bool                      `json:"demo"`
+	Checks        map[string]checkResult    `json:"checks"`
+	Upstreams     []services.UpstreamStatus `json:"upstreams"`
+}
+
+func (r *Router) handleHealthz(w http.ResponseWriter, req *http.Request) {
+	// The process answering is all liveness needs to know
+	r.writeJSON(w, req, map[string]string{"status": "ok"})
+}
+
+func (r *Router) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	ready := r.readiness()
+	if ready.Status != "ok" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	r.writeJSON(w, req, ready)
+}
+
+// readiness checks what the server needs before it can take traffic. The
+// checks are local and cheap, so probes never wait on TMDB or OMDB.
+func (r *Router) readiness() readiness {
+	ready := readiness{Status: "ok", Checks: make(map[string]checkResult)}
+	check := func(name string, err error) {
+		if err != nil {
+			ready.Status = "unavailable"
+			ready.Checks[name] = checkResult{Status: "fail", Error: err.Error()}
+			return
+		}
+		ready.Checks[name] = checkResult{Status: "ok"}
+	}
+
+	var keyErr error
+	switch {
+	case !r.movieService.TMDBConfigured():
+		keyErr = errors.New("TMDB_API_KEY is not set")
+	case r.implicitDemo:
+		keyErr = errors.New("TMDB_API_KEY is not set, serving the demo dataset; set DEMO_MODE=true to run the demo on purpose")
+	}
+	check("tmdb_api_key", keyErr)
+
+	_, err := r.templates()
+	check("templates", err)
+	check("storage", r.store.Ping())
+
+	return ready
+}
+
+func (r *Router) handleStatus(w http.ResponseWriter, req *http.Request) {
+	ready := r.readiness()
+	r.writeJSON(w, req, serverStatus{
+		Status:        ready.Status,
+		Started:       r.started,
+		UptimeSeconds: int64(r.now().Sub(r.started).Seconds()),
+		Demo:          r.movieService.Demo(),
+		Checks:        ready.Checks,
+		Upstreams:     r.movieService.UpstreamStatus(),
+	})
+}
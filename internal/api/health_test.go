@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/services"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "healthz", target: "/healthz", status: http.StatusOK, contentType: "application/json", golden: "healthz.json"},
+		{name: "healthz head", method: http.MethodHead, target: "/healthz", status: http.StatusOK},
+		{name: "healthz post", method: http.MethodPost, target: "/healthz", status: http.StatusMethodNotAllowed},
+		{name: "readyz", target: "/readyz", status: http.StatusOK, golden: "readyz.json"},
+		{name: "readyz post", method: http.MethodPost, target: "/readyz", status: http.StatusMethodNotAllowed},
+		{name: "status", target: "/api/status", status: http.StatusOK, want: `"demo":false`},
+		{name: "status head", method: http.MethodHead, target: "/api/status", status: http.StatusOK},
+		{name: "status post", method: http.MethodPost, target: "/api/status", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+	})
+}
+
+func TestReadyzWithoutTMDBKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		checks  []handlerTest
+	}{
+		{
+			name: "implicit demo",
+			checks: []handlerTest{
+				{name: "readyz", target: "/readyz", status: http.StatusServiceUnavailable, want: "set DEMO_MODE=true to run the demo on purpose"},
+				{name: "status", target: "/api/status", status: http.StatusOK, want: `"demo":true`},
+				{name: "search", target: "/api/search?q=the", status: http.StatusOK},
+			},
+		},
+		{
+			name:    "demo mode",
+			environ: []string{"DEMO_MODE=true"},
+			checks: []handlerTest{
+				{name: "readyz", target: "/readyz", status: http.StatusOK, want: `"status":"ok"`},
+				{name: "status", target: "/api/status", status: http.StatusOK, want: `"demo":true`},
+			},
+		},
+		{
+			name:    "demo mode with a key",
+			environ: []string{"DEMO_MODE=true", "TMDB_API_KEY=key"},
+			checks: []handlerTest{
+				{name: "readyz", target: "/readyz", status: http.StatusOK, want: `"status":"ok"`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load(config.Sources{Environ: append([]string{"DATA_DIR=" + t.TempDir()}, tt.environ...)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			router := NewRouter(cfg, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			defer router.Shutdown(context.Background())
+
+			runHandlerTests(t, router, tt.checks)
+		})
+	}
+
+	// A service built without a key, as in tests, is not ready either
+	cfg, err := config.Load(config.Sources{Environ: []string{"DATA_DIR=" + t.TempDir()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter(cfg,
+		WithMovieService(services.NewMovieService(services.Config{}, nil)),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	defer router.Shutdown(context.Background())
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "readyz", target: "/readyz", status: http.StatusServiceUnavailable, want: `"error":"TMDB_API_KEY is not set"`},
+		{name: "search", target: "/api/search?q=the", status: http.StatusInternalServerError, want: "Upstream request failed"},
+	})
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"movie-discovery-app/internal/importer"
+	"movie-discovery-app/internal/storage"
+)
+
+const maxImportSize = 32 << 20
+
+// resolveImportRequest picks the title for the row on a line of the export
+type resolveImportRequest struct {
+	Line      int    `json:"line"`
+	TMDBID    int    `json:"tmdb_id"`
+	MediaType string `json:"media_type"`
+}
+
+func (r *Router) handleListImports(w http.ResponseWriter, req *http.Request) {
+	jobs, err := r.importManager.List(userID(req))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, job := range jobs {
+		// Rows can run into the thousands, the listing only carries progress
+		job.Rows = nil
+	}
+
+	r.writeJSON(w, req, jobs)
+}
+
+func (r *Router) handleCreateImport(w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxImportSize)
+
+	source := req.FormValue("source")
+	kind := req.FormValue("kind")
+	if source == "" {
+		http.Error(w, "Form field 'source' is required", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		http.Error(w, "Form field 'file' is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	job, err := r.importManager.Create(userID(req), source, kind, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/imports/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	r.writeJSON(w, req, job)
+}
+
+func (r *Router) handleImport(w http.ResponseWriter, req *http.Request) {
+	job, ok := r.userImport(w, req)
+	if !ok {
+		return
+	}
+
+	r.writeJSON(w, req, job)
+}
+
+func (r *Router) handleResumeImport(w http.ResponseWriter, req *http.Request) {
+	job, ok := r.userImport(w, req)
+	if !ok {
+		return
+	}
+
+	job, err := r.importManager.Resume(job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r.writeJSON(w, req, job)
+}
+
+func (r *Router) handleResolveImport(w http.ResponseWriter, req *http.Request) {
+	job, ok := r.userImport(w, req)
+	if !ok {
+		return
+	}
+
+	var body resolveImportRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := r.importManager.Resolve(job.ID, body.Line, body.TMDBID, body.MediaType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.writeJSON(w, req, job)
+}
+
+// userImport loads the import named in the path. Other users' imports are
+// answered with 404 like missing ones, so their IDs cannot be probed.
+func (r *Router) userImport(w http.ResponseWriter, req *http.Request) (*importer.Job, bool) {
+	id := req.PathValue("id")
+	if !storage.ValidID(id) {
+		http.NotFound(w, req)
+		return nil, false
+	}
+
+	job, err := r.importManager.Get(id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, req)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if job.UserID != userID(req) {
+		http.NotFound(w, req)
+		return nil, false
+	}
+	return job, true
+}
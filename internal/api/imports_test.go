@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const letterboxdWatched = "Date,Name,Year,Letterboxd URI\n2024-01-05,Fight Club,1999,https://boxd.it/1\n"
+
+// multipartForm encodes fields, with a file field when file is not empty
+func multipartForm(t *testing.T, fields map[string]string, file string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if file != "" {
+		part, err := w.CreateFormFile("file", "export.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(file))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), w.FormDataContentType()
+}
+
+func postImport(t *testing.T, router http.Handler, user string, fields map[string]string, file string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, contentType := multipartForm(t, fields, file)
+	return serve(router, http.MethodPost, "/api/imports", map[string]string{"X-User-ID": user, "Content-Type": contentType}, body)
+}
+
+func TestImportHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := postImport(t, router, "alice", map[string]string{"source": "letterboxd", "kind": "watched"}, letterboxdWatched)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create: status %d\n%s", rec.Code, rec.Body)
+	}
+	var job struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/imports/"+job.ID {
+		t.Errorf("Location %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		user   string
+		fields map[string]string
+		file   string
+		status int
+		want   string
+	}{
+		{"without source", "alice", map[string]string{"kind": "watched"}, letterboxdWatched, http.StatusBadRequest, "Form field 'source' is required"},
+		{"without file", "alice", map[string]string{"source": "letterboxd"}, "", http.StatusBadRequest, "Form field 'file' is required"},
+		{"unknown source", "alice", map[string]string{"source": "netflix"}, letterboxdWatched, http.StatusBadRequest, "unsupported source"},
+		{"unknown kind", "alice", map[string]string{"source": "letterboxd", "kind": "reviews"}, letterboxdWatched, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postImport(t, router, tt.user, tt.fields, tt.file)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d\n%s", rec.Code, tt.status, rec.Body)
+			}
+			if !bytes.Contains(rec.Body.Bytes(), []byte(tt.want)) {
+				t.Errorf("body %q does not contain %q", rec.Body, tt.want)
+			}
+		})
+	}
+
+	alice := map[string]string{"X-User-ID": "alice"}
+	bob := map[string]string{"X-User-ID": "bob"}
+	runHandlerTests(t, router, []handlerTest{
+		{name: "list", target: "/api/imports", header: alice, status: http.StatusOK, contentType: "application/json", want: job.ID},
+		{name: "list other user", target: "/api/imports", header: bob, status: http.StatusOK},
+		{name: "list put", method: http.MethodPut, target: "/api/imports", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+
+		{name: "get", target: "/api/imports/" + job.ID, header: alice, status: http.StatusOK, want: job.ID},
+		{name: "get other user", target: "/api/imports/" + job.ID, header: bob, status: http.StatusNotFound},
+		{name: "get without id", target: "/api/imports/", status: http.StatusNotFound},
+		{name: "get unknown", target: "/api/imports/nope", status: http.StatusNotFound},
+		{name: "get invalid id", target: "/api/imports/a%20b", status: http.StatusNotFound},
+		{name: "get post", method: http.MethodPost, target: "/api/imports/" + job.ID, header: alice, status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{name: "unknown action", target: "/api/imports/" + job.ID + "/cancel", header: alice, status: http.StatusNotFound},
+		{name: "resume get", target: "/api/imports/" + job.ID + "/resume", header: alice, status: http.StatusMethodNotAllowed, allow: "POST"},
+		{name: "resume other user", method: http.MethodPost, target: "/api/imports/" + job.ID + "/resume", header: bob, status: http.StatusNotFound},
+		{name: "resolve get", target: "/api/imports/" + job.ID + "/resolve", header: alice, status: http.StatusMethodNotAllowed},
+		{name: "resolve bad JSON", method: http.MethodPost, target: "/api/imports/" + job.ID + "/resolve", header: alice, body: "{", status: http.StatusBadRequest, want: "Invalid JSON body"},
+		{name: "resolve unknown line", method: http.MethodPost, target: "/api/imports/" + job.ID + "/resolve", header: alice, body: `{"line":99,"tmdb_id":550}`, status: http.StatusBadRequest},
+	})
+}
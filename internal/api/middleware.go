@@ -0,0 +1,377 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/internal/tracing"
+)
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middlewares to h, the first one being the outermost
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	loadersKey
+)
+
+// Incoming request IDs are only reused when they look harmless in logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestIDFrom returns the ID the RequestID middleware gave the request
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// RequestID gives every request an ID, reusing a valid X-Request-ID header
+// from the client or proxy, and echoes it in the response
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			id := req.Header.Get("X-Request-ID")
+			if !validRequestID.MatchString(id) {
+				b := make([]byte, 8)
+				rand.Read(b)
+				id = hex.EncodeToString(b)
+			}
+
+			w.Header().Set("X-Request-ID", id)
+			ctx := context.WithValue(req.Context(), requestIDKey, id)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// Tracing starts a server span for every request, continuing the trace of
+// the caller when it sends a W3C traceparent header
+func Tracing() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+			if sc, ok := tracing.ParseTraceparent(req.Header.Get("traceparent")); ok {
+				ctx = tracing.ContextWithRemoteParent(ctx, sc)
+			}
+
+			ctx, span := tracing.Start(ctx, req.Method, tracing.WithKind(tracing.KindServer), tracing.WithAttributes(
+				tracing.String("http.request.method", req.Method),
+				tracing.String("url.path", req.URL.Path),
+				tracing.String("request.id", RequestIDFrom(ctx)),
+			))
+			defer span.End()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			req = req.WithContext(ctx)
+			next.ServeHTTP(rec, req)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// Name the span after the handler's route once the mux has picked it
+			if req.Pattern != "" {
+				span.SetName(req.Method + " " + req.Pattern)
+				span.SetAttributes(tracing.String("http.route", req.Pattern))
+			}
+			span.SetAttributes(tracing.Int("http.response.status_code", status))
+			if status >= 500 {
+				span.SetStatus(tracing.StatusError, http.StatusText(status))
+			}
+		})
+	}
+}
+
+// Recover turns a panicking handler into a JSON 500 instead of a dropped connection
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				// The server uses this panic to abort a response on purpose
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				logger.ErrorContext(req.Context(), "panic serving request",
+					"request_id", RequestIDFrom(req.Context()),
+					"method", req.Method,
+					"path", req.URL.Path,
+					"panic", v,
+					"stack", string(debug.Stack()),
+				)
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error":      "Internal server error",
+					"request_id": RequestIDFrom(req.Context()),
+				})
+			}()
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// AccessLog logs one line per request once it has been served. Requests
+// coming from trustedProxies are logged with the client IP from
+// X-Forwarded-For instead of the proxy's address.
+func AccessLog(logger *slog.Logger, trustedProxies []netip.Prefix) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, req)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			// The mux records which pattern matched on the request
+			route := req.Pattern
+			if route == "" {
+				route = "unmatched"
+			}
+
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			}
+
+			logger.LogAttrs(req.Context(), level, "request",
+				slog.String("request_id", RequestIDFrom(req.Context())),
+				slog.String("trace_id", traceID(req.Context())),
+				slog.String("method", req.Method),
+				slog.String("route", route),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("bytes", rec.bytes),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("client_ip", ClientIP(req, trustedProxies)),
+				slog.String("user_agent", req.UserAgent()),
+			)
+		})
+	}
+}
+
+var (
+	httpRequests = metrics.NewCounterVec(metrics.Default, "http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec(metrics.Default, "http_request_duration_seconds",
+		"Latency of HTTP requests by method and route pattern.", nil, "method", "route")
+	httpInFlight = metrics.NewGaugeVec(metrics.Default, "http_requests_in_flight",
+		"HTTP requests currently being served.").With()
+)
+
+// Metrics records request counts, latencies and in-flight requests per route
+func Metrics() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+
+			httpInFlight.Inc()
+			defer httpInFlight.Dec()
+
+			next.ServeHTTP(rec, req)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			route := req.Pattern
+			if route == "" {
+				route = "unmatched"
+			}
+
+			httpRequests.With(req.Method, route, strconv.Itoa(status)).Inc()
+			httpDuration.With(req.Method, route).Observe(time.Since(start).Seconds())
+		})
+	}
+}
+
+// ValidUserID answers 400 when the user ID, from X-User-ID or ?user=, could
+// not name a document in the store, rather than letting handlers fail with
+// a 500 once they load the user's data. It wraps the routes marked user,
+// the only ones that read the ID.
+func ValidUserID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if !storage.ValidID(userID(req)) {
+				http.Error(w, "User ID may only contain letters, digits, '.', '-' and '_'", http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is only
+// believed when the connection comes from a trusted proxy, and then read from
+// the right, skipping other trusted proxies, so clients cannot spoof it.
+func ClientIP(req *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		hopAddr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+		if !trusted(hopAddr, trustedProxies) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func trusted(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses a comma separated list of IPs and CIDR ranges
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// responseRecorder remembers the status and size of a response. It keeps
+// streaming working by passing Flush and Hijack through.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// traceID returns the ID of the trace the request belongs to, if any
+func traceID(ctx context.Context) string {
+	sc := tracing.SpanFromContext(ctx).SpanContext()
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID.String()
+}
+
+// writeJSON encodes v as the response. Encoding errors cannot be reported to
+// the client once the body has started, so they are logged instead.
+func (r *Router) writeJSON(w http.ResponseWriter, req *http.Request, v interface{}) {
+	_, span := tracing.Start(req.Context(), "json.encode")
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		span.RecordError(err)
+		r.logger.ErrorContext(req.Context(), "failed to write response",
+			"request_id", RequestIDFrom(req.Context()),
+			"path", req.URL.Path,
+			"error", err,
+		)
+	}
+}
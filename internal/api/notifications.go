@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"movie-discovery-app/internal/notify"
+	"movie-discovery-app/internal/storage"
+)
+
+// markReadRequest names the notification to mark as read. An empty or
+// missing ID marks everything as read.
+type markReadRequest struct {
+	ID string `json:"id,omitempty"`
+}
+
+func (r *Router) handleNotifications(w http.ResponseWriter, req *http.Request) {
+	notifications, err := r.scheduler.Inbox(userID(req))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if req.URL.Query().Get("unread") == "true" {
+		unread := []notify.Notification{}
+		for _, n := range notifications {
+			if !n.Read {
+				unread = append(unread, n)
+			}
+		}
+		notifications = unread
+	}
+
+	r.writeJSON(w, req, notifications)
+}
+
+func (r *Router) handleNotificationPreferences(w http.ResponseWriter, req *http.Request) {
+	user := userID(req)
+
+	if req.Method == http.MethodPut {
+		prefs := notify.DefaultPreferences(user)
+		if err := json.NewDecoder(req.Body).Decode(&prefs); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		prefs.UserID = user
+
+		err := r.scheduler.SetPreferences(prefs)
+		if errors.Is(err, notify.ErrInvalidPreferences) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	prefs, err := r.scheduler.Preferences(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r.writeJSON(w, req, prefs)
+}
+
+func (r *Router) handleNotificationsRead(w http.ResponseWriter, req *http.Request) {
+	var body markReadRequest
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := r.scheduler.MarkRead(userID(req), body.ID); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.NotFound(w, req)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNotificationHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+	alice := map[string]string{"X-User-ID": "alice"}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "inbox", target: "/api/notifications", header: alice, status: http.StatusOK, contentType: "application/json"},
+		{name: "inbox unread", target: "/api/notifications?unread=true", header: alice, status: http.StatusOK, want: "[]"},
+		{name: "inbox post", method: http.MethodPost, target: "/api/notifications", status: http.StatusMethodNotAllowed},
+
+		{name: "preferences", target: "/api/notifications/preferences", header: alice, status: http.StatusOK, golden: "preferences_default.json"},
+		{name: "preferences put", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"region":"GB","user_id":"mallory"}`, status: http.StatusOK, want: `"user_id":"alice"`},
+		{name: "preferences saved", target: "/api/notifications/preferences", header: alice, status: http.StatusOK, want: `"region":"GB"`},
+		{name: "preferences bad JSON", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: "{", status: http.StatusBadRequest, want: "Invalid JSON body"},
+		{name: "preferences webhook", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"https://hooks.example.com/movies","email":"Alice <alice@example.com>"}`, status: http.StatusOK, want: `"email":"alice@example.com","webhook":"https://hooks.example.com/movies"`},
+		{name: "preferences webhook loopback", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"http://127.0.0.1:8080/admin"}`, status: http.StatusBadRequest, want: "internal address"},
+		{name: "preferences webhook metadata", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"http://169.254.169.254/latest/meta-data"}`, status: http.StatusBadRequest, want: "internal address"},
+		{name: "preferences webhook private", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"http://[::ffff:10.0.0.1]/"}`, status: http.StatusBadRequest, want: "internal address"},
+		{name: "preferences webhook localhost", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"http://localhost/"}`, status: http.StatusBadRequest, want: "internal address"},
+		{name: "preferences webhook scheme", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"file:///etc/passwd"}`, status: http.StatusBadRequest, want: "absolute http or https URL"},
+		{name: "preferences webhook relative", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"webhook":"/hooks"}`, status: http.StatusBadRequest, want: "absolute http or https URL"},
+		{name: "preferences email", method: http.MethodPut, target: "/api/notifications/preferences", header: alice, body: `{"email":"alice\r\nBcc: eve@example.com"}`, status: http.StatusBadRequest, want: "email must be"},
+		{name: "preferences delete", method: http.MethodDelete, target: "/api/notifications/preferences", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, PUT"},
+
+		{name: "read all", method: http.MethodPost, target: "/api/notifications/read", header: alice, status: http.StatusNoContent},
+		{name: "read unknown", method: http.MethodPost, target: "/api/notifications/read", header: alice, body: `{"id":"nope"}`, status: http.StatusNotFound},
+		{name: "read bad JSON", method: http.MethodPost, target: "/api/notifications/read", header: alice, body: "{", status: http.StatusBadRequest},
+		{name: "read get", target: "/api/notifications/read", status: http.StatusMethodNotAllowed},
+	})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"movie-discovery-app/internal/openapi"
+	"movie-discovery-app/internal/storage"
+)
+
+// openAPI describes routes as an OpenAPI document. Response and request
+// schemas come from the Go types the handlers encode and decode.
+func openAPI(routes []route) *openapi.Document {
+	schemas := openapi.NewSchemas()
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "Movie Discovery API",
+			Version: "1.0.0",
+			Description: "Search and browse movies and TV shows, and manage a library, movie night rooms and release notifications.\n\n" +
+				"Errors are answered with a plain-text message. Every path is also served under /api without the version, " +
+				"where the API started out.",
+		},
+		Servers: []openapi.Server{{URL: apiVersion}},
+		Tags:    tags,
+		Paths:   make(map[string]map[string]*openapi.Operation),
+	}
+
+	for _, rt := range routes {
+		op := &openapi.Operation{
+			OperationID: rt.id,
+			Summary:     rt.summary,
+			Description: rt.description,
+			Tags:        []string{rt.tag},
+			Parameters:  rt.params,
+			Responses:   make(map[string]*openapi.Response),
+		}
+		if rt.user {
+			op.Parameters = append(append([]openapi.Parameter{}, rt.params...), userIDParam())
+		}
+
+		if rt.body != nil {
+			bodyType := rt.bodyType
+			if bodyType == "" {
+				bodyType = "application/json"
+			}
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]*openapi.MediaType{bodyType: {Schema: schemaFor(schemas, rt.body)}},
+			}
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &openapi.Response{Description: http.StatusText(status)}
+		if rt.response != nil {
+			contentType := rt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success.Content = map[string]*openapi.MediaType{contentType: {Schema: schemaFor(schemas, rt.response)}}
+		}
+		op.Responses[strconv.Itoa(status)] = success
+		for _, code := range append(rt.errors, http.StatusInternalServerError) {
+			op.Responses[strconv.Itoa(code)] = errorResponse(code)
+		}
+
+		if doc.Paths[rt.path] == nil {
+			doc.Paths[rt.path] = make(map[string]*openapi.Operation)
+		}
+		doc.Paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+
+	doc.Components.Schemas = schemas.Components()
+	return doc
+}
+
+// schemaFor returns v as is when it is already a schema, or derives one from
+// its type
+func schemaFor(schemas *openapi.Schemas, v interface{}) *openapi.Schema {
+	if s, ok := v.(*openapi.Schema); ok {
+		return s
+	}
+	return schemas.For(v)
+}
+
+func errorResponse(code int) *openapi.Response {
+	return &openapi.Response{
+		Description: http.StatusText(code),
+		Content:     map[string]*openapi.MediaType{"text/plain": {Schema: openapi.String()}},
+	}
+}
+
+func userIDParam() openapi.Parameter {
+	return openapi.Parameter{
+		Name:        "X-User-ID",
+		In:          "header",
+		Description: "The user to act for, default when unset. The user query parameter can be sent instead.",
+		Schema:      &openapi.Schema{Type: openapi.Types{"string"}, Pattern: storage.IDPattern},
+		Example:     "default",
+	}
+}
+
+func (r *Router) handleOpenAPI(w http.ResponseWriter, req *http.Request) {
+	r.writeJSON(w, req, r.openAPI)
+}
+
+func (r *Router) handleAPIDocs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openapi.Viewer)
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"movie-discovery-app/internal/golden"
+	"movie-discovery-app/internal/openapi"
+)
+
+func loadOpenAPI(t *testing.T, h http.Handler) *openapi.Document {
+	t.Helper()
+	rec := serve(h, http.MethodGet, "/api/v1/openapi.json", nil, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d\n%s", rec.Code, rec.Body)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return &doc
+}
+
+func TestOpenAPIGolden(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := serve(router, http.MethodGet, "/api/v1/openapi.json", nil, "")
+	golden.AssertJSON(t, filepath.Join("testdata", "golden", "openapi.json"), rec.Body.Bytes())
+}
+
+// TestOpenAPIMatchesRoutes fails when an API route is missing from the
+// document, or the document describes one the server does not have
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	router, _ := newTestRouter(t)
+	doc := loadOpenAPI(t, router)
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi %q, want 3.1.0", doc.OpenAPI)
+	}
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/api/v1" {
+		t.Errorf("servers %+v, want /api/v1", doc.Servers)
+	}
+
+	registered := make(map[string]bool)
+	for _, pattern := range router.patterns {
+		registered[pattern] = true
+	}
+
+	documented := make(map[string]bool)
+	ids := make(map[string]string)
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			pattern := strings.ToUpper(method) + " /api/v1" + path
+			documented[pattern] = true
+			if !registered[pattern] {
+				t.Errorf("%s is documented but not served", pattern)
+			}
+
+			if op.OperationID == "" {
+				t.Errorf("%s has no operationId", pattern)
+			} else if other, ok := ids[op.OperationID]; ok {
+				t.Errorf("%s and %s share operationId %s", pattern, other, op.OperationID)
+			}
+			ids[op.OperationID] = pattern
+
+			if len(op.Responses) == 0 {
+				t.Errorf("%s documents no responses", pattern)
+			}
+			checkPathParams(t, pattern, path, op)
+		}
+	}
+
+	for _, pattern := range router.patterns {
+		method, path, _ := strings.Cut(pattern, " ")
+		switch {
+		case strings.HasPrefix(path, "/api/v1/"):
+			if !documented[pattern] {
+				t.Errorf("%s is served but not documented", pattern)
+			}
+		case strings.HasPrefix(path, "/api/"):
+			// Unversioned paths are aliases of versioned ones
+			if !registered[method+" /api/v1"+strings.TrimPrefix(path, "/api")] {
+				t.Errorf("%s has no /api/v1 equivalent", pattern)
+			}
+		}
+	}
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// checkPathParams checks that the parameters in path and in op agree
+func checkPathParams(t *testing.T, pattern, path string, op *openapi.Operation) {
+	t.Helper()
+	inPath := make(map[string]bool)
+	for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		inPath[m[1]] = true
+	}
+
+	for _, p := range op.Parameters {
+		if p.Schema == nil {
+			t.Errorf("%s: parameter %s has no schema", pattern, p.Name)
+		}
+		if p.In != "path" {
+			continue
+		}
+		if !inPath[p.Name] {
+			t.Errorf("%s: path parameter %s is not in the path", pattern, p.Name)
+		}
+		if !p.Required {
+			t.Errorf("%s: path parameter %s must be required", pattern, p.Name)
+		}
+		delete(inPath, p.Name)
+	}
+	for name := range inPath {
+		t.Errorf("%s: path parameter %s is not documented", pattern, name)
+	}
+}
+
+// TestOpenAPIResponsesMatchSchemas calls each JSON GET operation with its
+// parameters' examples and checks the response against the documented
+// schema, so changes to the models cannot leave the document behind
+func TestOpenAPIResponsesMatchSchemas(t *testing.T) {
+	router, _ := newTestRouter(t)
+	doc := loadOpenAPI(t, router)
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	called := 0
+	for _, path := range paths {
+		op := doc.Paths[path]["get"]
+		if op == nil {
+			continue
+		}
+		target, ok := exampleTarget(path, op)
+		if !ok {
+			continue
+		}
+		response := op.Responses["200"]
+		if response == nil || response.Content["application/json"] == nil {
+			continue
+		}
+
+		t.Run(op.OperationID, func(t *testing.T) {
+			rec := serve(router, http.MethodGet, target, nil, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s: status %d\n%s", target, rec.Code, rec.Body)
+			}
+			var body interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("GET %s: %v", target, err)
+			}
+			for _, err := range schemaErrors(doc, response.Content["application/json"].Schema, body, "$") {
+				t.Errorf("GET %s: %s", target, err)
+			}
+		})
+		called++
+	}
+	if called < 20 {
+		t.Errorf("only %d operations could be called with their examples", called)
+	}
+}
+
+// exampleTarget fills in path and the required parameters from their
+// examples. It fails when a required parameter has none.
+func exampleTarget(path string, op *openapi.Operation) (string, bool) {
+	query := url.Values{}
+	for _, p := range op.Parameters {
+		if !p.Required {
+			continue
+		}
+		if p.Example == nil {
+			return "", false
+		}
+		value := fmt.Sprint(p.Example)
+		switch p.In {
+		case "path":
+			path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(value), 1)
+		case "query":
+			query.Set(p.Name, value)
+		}
+	}
+	target := "/api/v1" + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	return target, true
+}
+
+// schemaErrors lists where value does not match schema. Objects may only
+// have the documented properties.
+func schemaErrors(doc *openapi.Document, schema *openapi.Schema, value interface{}, at string) []string {
+	s := doc.Resolve(schema)
+	if s == nil {
+		return []string{at + ": unknown schema " + schema.Ref}
+	}
+
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, alt := range s.AnyOf {
+			altErrs := schemaErrors(doc, alt, value, at)
+			if len(altErrs) == 0 {
+				return nil
+			}
+			errs = append(errs, altErrs...)
+		}
+		return errs
+	}
+
+	typ := jsonType(value)
+	if len(s.Type) > 0 && !s.Type.Has(typ) {
+		return []string{fmt.Sprintf("%s: %s, want %v", at, typ, []string(s.Type))}
+	}
+
+	var errs []string
+	switch v := value.(type) {
+	case string:
+		if len(s.Enum) > 0 && !contains(s.Enum, v) {
+			errs = append(errs, fmt.Sprintf("%s: %q is not one of %v", at, v, s.Enum))
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, schemaErrors(doc, s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs = append(errs, at+": required property "+name+" is missing")
+			}
+		}
+		for name, item := range v {
+			switch {
+			case s.Properties[name] != nil:
+				errs = append(errs, schemaErrors(doc, s.Properties[name], item, at+"."+name)...)
+			case s.AdditionalProperties != nil:
+				errs = append(errs, schemaErrors(doc, s.AdditionalProperties, item, at+"."+name)...)
+			case s.Properties != nil:
+				errs = append(errs, at+": property "+name+" is not documented")
+			}
+		}
+	}
+	return errs
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAPIVersions(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, path := range []string{"/movie/550", "/movie/550/credits", "/search?q=the", "/genres"} {
+		v1 := serve(router, http.MethodGet, "/api/v1"+path, nil, "")
+		alias := serve(router, http.MethodGet, "/api"+path, nil, "")
+		if v1.Code != http.StatusOK || v1.Body.String() != alias.Body.String() {
+			t.Errorf("%s: /api/v1 answered %d, /api %d, or the bodies differ", path, v1.Code, alias.Code)
+		}
+	}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "docs", target: "/api/v1/docs", status: http.StatusOK, contentType: "text/html", want: "openapi.json"},
+		{name: "docs without version", target: "/api/docs", status: http.StatusNotFound},
+		{name: "openapi without version", target: "/api/openapi.json", status: http.StatusNotFound},
+		{name: "v1 unknown", target: "/api/v1/people/1", status: http.StatusNotFound},
+		{name: "v1 method not allowed", method: http.MethodDelete, target: "/api/v1/movie/550", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{name: "v1 invalid id", target: "/api/v1/movie/abc", status: http.StatusBadRequest},
+		{name: "v1 user id", target: "/api/v1/for-you?user=a%2Fb", status: http.StatusBadRequest},
+	})
+}
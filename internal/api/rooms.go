@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"movie-discovery-app/internal/rooms"
+	"movie-discovery-app/internal/storage"
+)
+
+// sseHeartbeat is how often an idle event stream is written to, a variable
+// so tests can wait less
+var sseHeartbeat = 25 * time.Second
+
+// streamWriteTimeout bounds each write to a stream. Streams outlive the
+// server's WriteTimeout, so the deadline is pushed back before every write.
+const streamWriteTimeout = 30 * time.Second
+
+type createRoomRequest struct {
+	Name    string        `json:"name"`
+	Filters rooms.Filters `json:"filters"`
+}
+
+// joinRoomRequest adds UserID, or the caller when empty, to a room
+type joinRoomRequest struct {
+	UserID     string `json:"user_id,omitempty"`
+	InviteCode string `json:"invite_code,omitempty"`
+}
+
+// voteRequest is a vote of yes or no on a candidate. MediaType is movie
+// when empty.
+type voteRequest struct {
+	TMDBID    int    `json:"tmdb_id"`
+	MediaType string `json:"media_type,omitempty"`
+	Vote      string `json:"vote"`
+}
+
+func (r *Router) handleCreateRoom(w http.ResponseWriter, req *http.Request) {
+	var body createRoomRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	room, err := r.roomManager.Create(userID(req), body.Name, body.Filters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/rooms/"+room.ID)
+	w.WriteHeader(http.StatusCreated)
+	r.writeJSON(w, req, room)
+}
+
+func (r *Router) handleRoom(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	room, err := r.roomManager.Get(id, userID(req))
+	r.writeRoom(w, req, room, err)
+}
+
+func (r *Router) handleJoinRoom(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	var body joinRoomRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	// Members join with the invite code, the owner can add anyone
+	user := userID(req)
+	member := user
+	if body.UserID != "" {
+		member = body.UserID
+	}
+	room, err := r.roomManager.Join(id, member, body.InviteCode, user)
+	r.writeRoom(w, req, room, err)
+}
+
+func (r *Router) handleRoomFilters(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	var filters rooms.Filters
+	if err := json.NewDecoder(req.Body).Decode(&filters); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	room, err := r.roomManager.SetFilters(id, userID(req), filters)
+	r.writeRoom(w, req, room, err)
+}
+
+func (r *Router) handleRoomCandidates(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	room, err := r.roomManager.Refresh(req.Context(), id, userID(req))
+	r.writeRoom(w, req, room, err)
+}
+
+func (r *Router) handleRoomVote(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	var body voteRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if body.MediaType == "" {
+		body.MediaType = "movie"
+	}
+
+	room, err := r.roomManager.Vote(id, userID(req), body.TMDBID, body.MediaType, body.Vote)
+	r.writeRoom(w, req, room, err)
+}
+
+func (r *Router) handleRoomEvents(w http.ResponseWriter, req *http.Request) {
+	id, ok := roomID(w, req)
+	if !ok {
+		return
+	}
+
+	r.streamRoomEvents(w, req, id, userID(req))
+}
+
+// roomID reads the room ID from the path. IDs that could not name a room are
+// answered with 404 straight away.
+func roomID(w http.ResponseWriter, req *http.Request) (string, bool) {
+	id := req.PathValue("id")
+	if !storage.ValidID(id) {
+		http.NotFound(w, req)
+		return "", false
+	}
+	return id, true
+}
+
+// writeRoom answers with the room, or with the status err maps to
+func (r *Router) writeRoom(w http.ResponseWriter, req *http.Request, room *rooms.Room, err error) {
+	if err != nil {
+		r.writeRoomError(w, req, err)
+		return
+	}
+
+	r.writeJSON(w, req, room)
+}
+
+// streamRoomEvents sends room changes as Server-Sent Events until the client
+// goes away, starting with a snapshot of the room
+func (r *Router) streamRoomEvents(w http.ResponseWriter, req *http.Request, id, user string) {
+	room, err := r.roomManager.Get(id, user)
+	if err != nil {
+		r.writeRoomError(w, req, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	rc := http.NewResponseController(w)
+	extendDeadline := func() {
+		// httptest's recorder has no deadline to extend
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			r.logger.Warn("failed to extend write deadline", "error", err)
+		}
+	}
+
+	events, unsubscribe := r.roomManager.Hub().Subscribe(id)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	extendDeadline()
+	writeSSE(w, rooms.Event{Type: "room", Data: room})
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx, cancel := r.streamContext(req.Context())
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			extendDeadline()
+			writeSSE(w, event)
+		case <-heartbeat.C:
+			// Comments keep proxies from closing an idle connection
+			extendDeadline()
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event rooms.Event) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+func (r *Router) writeRoomError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, rooms.ErrNotMember):
+		http.NotFound(w, req)
+	case errors.Is(err, rooms.ErrForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, rooms.ErrInvalidVote):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		r.writeServiceError(w, req, err)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoomHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+	alice := map[string]string{"X-User-ID": "alice"}
+	bob := map[string]string{"X-User-ID": "bob"}
+
+	rec := serve(router, http.MethodPost, "/api/rooms", alice, `{"name":"Friday"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d\n%s", rec.Code, rec.Body)
+	}
+	var room struct {
+		ID         string `json:"id"`
+		InviteCode string `json:"invite_code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &room); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/rooms/"+room.ID {
+		t.Errorf("Location %q", got)
+	}
+	base := "/api/rooms/" + room.ID
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "create bad JSON", method: http.MethodPost, target: "/api/rooms", body: "{", status: http.StatusBadRequest, want: "Invalid JSON body"},
+		{name: "create get", target: "/api/rooms", status: http.StatusMethodNotAllowed, allow: "POST"},
+
+		{name: "get", target: base, header: alice, status: http.StatusOK, contentType: "application/json", want: `"name":"Friday"`},
+		{name: "get without id", target: "/api/rooms/", status: http.StatusNotFound},
+		{name: "get unknown", target: "/api/rooms/nope", header: alice, status: http.StatusNotFound},
+		{name: "get invalid id", target: "/api/rooms/a%20b", header: alice, status: http.StatusNotFound},
+		{name: "get non-member", target: base, header: bob, status: http.StatusNotFound},
+		{name: "get post", method: http.MethodPost, target: base, header: alice, status: http.StatusMethodNotAllowed},
+		{name: "unknown action", target: base + "/chat", header: alice, status: http.StatusNotFound},
+
+		{name: "join wrong code", method: http.MethodPost, target: base + "/members", header: bob, body: `{"invite_code":"nope"}`, status: http.StatusForbidden},
+		{name: "join bad JSON", method: http.MethodPost, target: base + "/members", header: bob, body: "[", status: http.StatusBadRequest},
+		{name: "join get", target: base + "/members", header: bob, status: http.StatusMethodNotAllowed},
+		{name: "join", method: http.MethodPost, target: base + "/members", header: bob, body: `{"invite_code":"` + room.InviteCode + `"}`, status: http.StatusOK, want: `"user_id":"bob"`},
+
+		{name: "filters by member", method: http.MethodPut, target: base + "/filters", header: bob, body: `{"max_runtime":120}`, status: http.StatusForbidden},
+		{name: "filters bad JSON", method: http.MethodPut, target: base + "/filters", header: alice, body: "x", status: http.StatusBadRequest},
+		{name: "filters post", method: http.MethodPost, target: base + "/filters", header: alice, status: http.StatusMethodNotAllowed, allow: "PUT"},
+		{name: "filters", method: http.MethodPut, target: base + "/filters", header: alice, body: `{"max_runtime":120}`, status: http.StatusOK, want: `"max_runtime":120`},
+
+		{name: "candidates get", target: base + "/candidates", header: alice, status: http.StatusMethodNotAllowed},
+		{name: "vote bad JSON", method: http.MethodPost, target: base + "/votes", header: alice, body: "{", status: http.StatusBadRequest},
+		{name: "vote invalid", method: http.MethodPost, target: base + "/votes", header: alice, body: `{"tmdb_id":550,"vote":"maybe"}`, status: http.StatusBadRequest, want: "invalid vote"},
+		{name: "vote not a candidate", method: http.MethodPost, target: base + "/votes", header: alice, body: `{"tmdb_id":1,"vote":"yes"}`, status: http.StatusBadRequest, want: "not a candidate"},
+		{name: "vote get", target: base + "/votes", header: alice, status: http.StatusMethodNotAllowed},
+		{name: "events post", method: http.MethodPost, target: base + "/events", header: alice, status: http.StatusMethodNotAllowed},
+		{name: "events non-member", target: base + "/events", status: http.StatusNotFound},
+	})
+}
+
+// A room stream lasts far longer than the server's WriteTimeout
+func TestRoomEventsOutliveWriteTimeout(t *testing.T) {
+	router, _ := newTestRouter(t)
+	defer func(d time.Duration) { sseHeartbeat = d }(sseHeartbeat)
+	sseHeartbeat = 100 * time.Millisecond
+
+	rec := serve(router, http.MethodPost, "/api/rooms", map[string]string{"X-User-ID": "alice"}, `{"name":"Friday"}`)
+	var room struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &room); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(router)
+	srv.Config.WriteTimeout = 300 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/rooms/"+room.ID+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User-ID", "alice")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	pings := 0
+	deadline := time.Now().Add(time.Second)
+	scanner := bufio.NewScanner(resp.Body)
+	for time.Now().Before(deadline) && scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), ": ping") {
+			pings++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("stream broke after %d pings: %v", pings, err)
+	}
+	if time.Now().Before(deadline) {
+		t.Fatalf("stream closed after %d pings", pings)
+	}
+	if pings < 5 {
+		t.Errorf("got %d pings, want at least 5", pings)
+	}
+}
+
+// Shutting the server down ends open streams rather than waiting on them
+func TestRoomEventsEndOnShutdown(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := serve(router, http.MethodPost, "/api/rooms", map[string]string{"X-User-ID": "alice"}, `{"name":"Friday"}`)
+	var room struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &room); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(router)
+	srv.Config.RegisterOnShutdown(router.CloseStreams)
+	srv.Start()
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/rooms/"+room.ID+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User-ID", "alice")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown waited on the stream: %v", err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("stream ended with %v", err)
+	}
+}
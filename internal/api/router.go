@@ -1,64 +1,314 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"html/template"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"path/filepath"
-
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"movie-discovery-app/internal/assets"
+	"movie-discovery-app/internal/calendar"
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/demo"
+	"movie-discovery-app/internal/export"
+	"movie-discovery-app/internal/feed"
+	"movie-discovery-app/internal/graphql"
+	"movie-discovery-app/internal/grpc"
+	"movie-discovery-app/internal/importer"
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/notify"
+	"movie-discovery-app/internal/openapi"
+	"movie-discovery-app/internal/rooms"
 	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+	"movie-discovery-app/web"
 )
 
 type Router struct {
-	movieService *services.MovieService
+	movieService          *services.MovieService
+	recommendationService *services.RecommendationService
+	store                 *storage.Store
+	importManager         *importer.Manager
+	exporter              *export.Exporter
+	roomManager           *rooms.Manager
+	scheduler             *notify.Scheduler
+	calendarFeeds         *calendar.Feeds
+	feedBuilder           *feed.Builder
+	started               time.Time
+	handler               http.Handler
+	openAPI               *openapi.Document
+	graphQL               *graphql.Handler
+	grpc                  *grpc.Server
+	// streams is cancelled by CloseStreams, ending room event streams and
+	// gRPC streaming calls
+	streams      context.Context
+	closeStreams context.CancelFunc
+	// patterns lists everything registered on the mux
+	patterns []string
+	// implicitDemo is set when the demo dataset stands in for a missing
+	// TMDB key rather than because DEMO_MODE asked for it
+	implicitDemo bool
+
+	// Set with options
+	templates func() (*template.Template, error)
+	static    http.Handler
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+// Option replaces one of the Router's dependencies, mostly for tests
+type Option func(*Router)
+
+// WithMovieService uses s instead of a service built from the config
+func WithMovieService(s *services.MovieService) Option {
+	return func(r *Router) { r.movieService = s }
+}
+
+// WithTemplates renders pages from t, which must define index.html,
+// instead of the embedded templates
+func WithTemplates(t *template.Template) Option {
+	return func(r *Router) {
+		r.templates = func() (*template.Template, error) { return t, nil }
+	}
+}
+
+// WithStatic serves /static/ from fsys instead of the embedded files
+func WithStatic(fsys fs.FS) Option {
+	return func(r *Router) { r.static = assets.NewStatic(fsys, false) }
+}
+
+// WithLogger sends access logs and errors to logger instead of slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Router) { r.logger = logger }
+}
+
+// WithClock replaces time.Now for the router and the services it creates
+func WithClock(now func() time.Time) Option {
+	return func(r *Router) { r.now = now }
 }
 
-func NewRouter() *http.ServeMux {
-	movieService := services.NewMovieService()
-	router := &Router{movieService: movieService}
+// NewRouter builds the application's handler and starts its background
+// workers, which Shutdown stops
+func NewRouter(cfg *config.Config, opts ...Option) *Router {
+	router := &Router{
+		logger: slog.Default(),
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(router)
+	}
+	if router.templates == nil || router.static == nil {
+		router.setupWeb(cfg.Web)
+	}
+	if router.movieService == nil {
+		router.movieService = router.newMovieService(cfg)
+	}
+
+	movieService := router.movieService
+	store := storage.NewStore(cfg.Storage.DataDir)
+	importManager := importer.NewManager(store, movieService)
+	router.recommendationService = services.NewRecommendationService(movieService)
+	router.store = store
+	router.importManager = importManager
+	router.exporter = export.NewExporter(movieService)
+	router.roomManager = rooms.NewManager(store, movieService)
+	router.scheduler = newScheduler(store, movieService, cfg.Notify)
+	router.calendarFeeds = calendar.NewFeeds(store, movieService)
+	router.feedBuilder = feed.NewBuilder(store, movieService)
+	router.started = router.now()
+	router.streams, router.closeStreams = context.WithCancel(context.Background())
+
+	router.scheduler.SetClock(router.now)
+	router.calendarFeeds.SetClock(router.now)
+	router.feedBuilder.SetClock(router.now)
+
+	// Pick up imports that were interrupted by a restart
+	if err := importManager.ResumeAll(); err != nil {
+		router.logger.Error("failed to resume imports", "error", err)
+	}
+
+	// Check watchlists for releases and new episodes in the background
+	router.scheduler.Start()
 
+	// Routes name their methods, so the mux answers other methods with 405
+	// and an Allow header, and unknown paths with 404. A GET route also
+	// serves HEAD.
 	mux := http.NewServeMux()
 
 	// Serve the main page
-	mux.HandleFunc("/", router.handleHome)
+	router.handle(mux, "GET /{$}", http.HandlerFunc(router.handleHome))
 
-	// API endpoints
-	mux.HandleFunc("/api/search", router.handleSearch)
-	mux.HandleFunc("/api/movie/", router.handleMovieDetails)
-	mux.HandleFunc("/api/tv/", router.handleTVDetails)
-	mux.HandleFunc("/api/trending", router.handleTrending)
-	mux.HandleFunc("/api/genres", router.handleGenres)
+	// The API, under /api/v1 and /api, described by an OpenAPI document
+	routes := router.routes()
+	router.register(mux, routes)
+	router.openAPI = openAPI(routes)
+
+	// GraphQL, for clients that want a title, its cast and their other
+	// titles in one request
+	router.graphQL = router.newGraphQLHandler()
+	router.handle(mux, "GET /graphql", router.graphQL)
+	router.handle(mux, "POST /graphql", router.graphQL)
+	router.handle(mux, "GET /graphql/schema", http.HandlerFunc(router.handleGraphQLSchema))
+
+	// gRPC, for backend services. Calls are POSTs to /<service>/<method>
+	// over HTTP/2.
+	router.grpc = router.newGRPCServer()
+	router.handle(mux, "POST /"+discoveryService+"/", router.grpc)
+
+	// Probes
+	router.handle(mux, "GET /healthz", http.HandlerFunc(router.handleHealthz))
+	router.handle(mux, "GET /readyz", http.HandlerFunc(router.handleReadyz))
+
+	// Prometheus metrics
+	router.handle(mux, "GET /metrics", metrics.Default.Handler())
 
 	// Static files
-	fs := http.FileServer(http.Dir("./web/static/"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	router.handle(mux, "GET /static/", http.StripPrefix("/static/", router.static))
+
+	trustedProxies, err := ParseTrustedProxies(strings.Join(cfg.Server.TrustedProxies, ","))
+	if err != nil {
+		router.logger.Error("ignoring invalid TRUSTED_PROXIES", "error", err)
+	}
 
-	return mux
+	logger := router.logger
+	router.handler = Chain(mux,
+		RequestID(),
+		Tracing(),
+		AccessLog(logger, trustedProxies),
+		Metrics(),
+		Recover(logger),
+	)
+	return router
 }
 
-func (r *Router) handleHome(w http.ResponseWriter, req *http.Request) {
-	if req.URL.Path != "/" {
-		http.NotFound(w, req)
-		return
+// setupWeb serves the UI embedded in the binary, or the files in cfg.Dir
+// in dev mode, for whichever of templates and static files options left unset
+func (r *Router) setupWeb(cfg config.Web) {
+	var webFS fs.FS = web.FS
+	if cfg.Dev {
+		webFS = os.DirFS(cfg.Dir)
+		r.logger.Info("serving web files from disk", "dir", cfg.Dir)
+	}
+
+	staticFS, err := fs.Sub(webFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	templateFS, err := fs.Sub(webFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	static := assets.NewStatic(staticFS, cfg.Dev)
+	if r.static == nil {
+		r.static = static
+	}
+	if r.templates == nil {
+		templates := assets.NewTemplates(templateFS, static, cfg.Dev)
+		if _, err := templates.Get(); err != nil {
+			r.logger.Error("failed to parse templates", "error", err)
+		}
+		r.templates = templates.Get
+	}
+}
+
+// newMovieService calls TMDB and OMDB, or serves the bundled demo dataset
+// in demo mode or when there is no TMDB key to call TMDB with. The latter
+// fails readiness, so a deployment missing its key is not taken for healthy.
+func (r *Router) newMovieService(cfg *config.Config) *services.MovieService {
+	s, implicit, err := demo.Select(cfg, r.now())
+	if err != nil {
+		// The dataset is embedded, so this is a bug rather than bad input
+		panic(err)
+	}
+	r.implicitDemo = implicit
+	switch {
+	case implicit:
+		r.logger.Warn("TMDB_API_KEY is not set, serving the bundled demo dataset; set DEMO_MODE=true to run the demo on purpose")
+	case s.Demo():
+		r.logger.Info("demo mode: serving the bundled demo dataset")
+	}
+	return s
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// Shutdown stops the background workers: the notification scheduler and
+// running imports. Call it once the server has stopped taking requests.
+func (r *Router) Shutdown(ctx context.Context) error {
+	r.closeStreams()
+	r.scheduler.Stop()
+	return r.importManager.Shutdown(ctx)
+}
+
+// CloseStreams ends room event streams and gRPC streaming calls, which
+// would otherwise hold up a graceful shutdown until it times out. Register
+// it with http.Server.RegisterOnShutdown.
+func (r *Router) CloseStreams() {
+	r.closeStreams()
+}
+
+// streamContext returns a context for a long-lived response, cancelled with
+// ctx or by CloseStreams
+func (r *Router) streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.streams, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// newScheduler sets up release notifications. Webhooks are always available,
+// email only when an SMTP server is configured. The demo's releases are
+// made up, so in demo mode notifications only reach the in-app inbox.
+func newScheduler(store *storage.Store, movieService *services.MovieService, cfg config.Notify) *notify.Scheduler {
+	if movieService.Demo() {
+		return notify.NewScheduler(store, movieService, cfg.Interval)
+	}
+
+	channels := []notify.Channel{notify.NewWebhookChannel(nil)}
+	if cfg.SMTP.Host != "" {
+		channels = append(channels, notify.NewEmailChannel(notify.SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		}))
 	}
 
-	tmplPath := filepath.Join("web", "templates", "index.html")
-	tmpl, err := template.ParseFiles(tmplPath)
+	return notify.NewScheduler(store, movieService, cfg.Interval, channels...)
+}
+
+func (r *Router) handleHome(w http.ResponseWriter, req *http.Request) {
+	tmpl, err := r.templates()
 	if err != nil {
 		http.Error(w, "Template not found", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html")
-	tmpl.Execute(w, nil)
+	data := struct{ Demo bool }{Demo: r.movieService.Demo()}
+	if err := tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
+		r.logger.ErrorContext(req.Context(), "failed to render template",
+			"request_id", RequestIDFrom(req.Context()),
+			"template", "index.html",
+			"error", err,
+		)
+	}
 }
 
 func (r *Router) handleSearch(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	query := req.URL.Query().Get("q")
 	contentType := req.URL.Query().Get("type")
 	page := req.URL.Query().Get("page")
@@ -72,95 +322,347 @@ func (r *Router) handleSearch(w http.ResponseWriter, req *http.Request) {
 		page = "1"
 	}
 
-	results, err := r.movieService.Search(query, contentType, page)
+	results, err := r.movieService.Search(req.Context(), query, contentType, page)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	r.writeJSON(w, req, results)
 }
 
 func (r *Router) handleMovieDetails(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	id, ok := pathID(w, req, "id")
+	if !ok {
 		return
 	}
 
-	// Extract movie ID from URL path
-	id := req.URL.Path[len("/api/movie/"):]
-	if id == "" {
-		http.Error(w, "Movie ID is required", http.StatusBadRequest)
+	details, err := r.movieService.GetMovieDetails(req.Context(), id)
+	if err != nil {
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	details, err := r.movieService.GetMovieDetails(id)
+	r.writeJSON(w, req, details)
+}
+
+func (r *Router) handleTVDetails(w http.ResponseWriter, req *http.Request) {
+	id, ok := pathID(w, req, "id")
+	if !ok {
+		return
+	}
+
+	details, err := r.movieService.GetTVDetails(req.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(details)
+	r.writeJSON(w, req, details)
 }
 
-func (r *Router) handleTVDetails(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// handleCredits serves the cast and crew of a movie or TV show
+func (r *Router) handleCredits(mediaType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id, ok := pathID(w, req, "id")
+		if !ok {
+			return
+		}
+
+		credits, err := r.movieService.GetCredits(req.Context(), mediaType, id)
+		if err != nil {
+			r.writeServiceError(w, req, err)
+			return
+		}
+
+		r.writeJSON(w, req, credits)
 	}
+}
 
-	// Extract TV show ID from URL path
-	id := req.URL.Path[len("/api/tv/"):]
-	if id == "" {
-		http.Error(w, "TV show ID is required", http.StatusBadRequest)
+// handleVideos serves the trailers and clips of a movie or TV show
+func (r *Router) handleVideos(mediaType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id, ok := pathID(w, req, "id")
+		if !ok {
+			return
+		}
+
+		videos, err := r.movieService.GetVideos(req.Context(), mediaType, id)
+		if err != nil {
+			r.writeServiceError(w, req, err)
+			return
+		}
+
+		r.writeJSON(w, req, videos)
+	}
+}
+
+// handleRecommendations serves TMDB's recommendations for a movie or TV show
+func (r *Router) handleRecommendations(mediaType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id, ok := pathID(w, req, "id")
+		if !ok {
+			return
+		}
+
+		results, err := r.movieService.GetRecommendations(req.Context(), mediaType, id)
+		if err != nil {
+			r.writeServiceError(w, req, err)
+			return
+		}
+		if results == nil {
+			results = []models.Media{}
+		}
+
+		r.writeJSON(w, req, results)
+	}
+}
+
+// handleExternalIDs serves the IMDb and social media IDs of a movie or TV show
+func (r *Router) handleExternalIDs(mediaType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id, ok := pathID(w, req, "id")
+		if !ok {
+			return
+		}
+
+		ids, err := r.movieService.GetExternalIDs(req.Context(), mediaType, id)
+		if err != nil {
+			r.writeServiceError(w, req, err)
+			return
+		}
+
+		r.writeJSON(w, req, ids)
+	}
+}
+
+// handleAvailability serves the runtime, age rating and streaming services
+// of a movie or TV show in the country given by ?region=, US by default
+func (r *Router) handleAvailability(mediaType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		id, ok := pathID(w, req, "id")
+		if !ok {
+			return
+		}
+
+		region := strings.ToUpper(req.URL.Query().Get("region"))
+		availability, err := r.movieService.GetAvailability(req.Context(), mediaType, id, region)
+		if err != nil {
+			r.writeServiceError(w, req, err)
+			return
+		}
+
+		r.writeJSON(w, req, availability)
+	}
+}
+
+func (r *Router) handleReleaseDates(w http.ResponseWriter, req *http.Request) {
+	id, ok := pathID(w, req, "id")
+	if !ok {
 		return
 	}
 
-	details, err := r.movieService.GetTVDetails(id)
+	releaseDates, err := r.movieService.GetReleaseDates(req.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(details)
+	r.writeJSON(w, req, releaseDates)
 }
 
-func (r *Router) handleTrending(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (r *Router) handleSeason(w http.ResponseWriter, req *http.Request) {
+	id, ok := pathID(w, req, "id")
+	if !ok {
+		return
+	}
+
+	// Season 0 holds the specials
+	season, ok := pathNumber(req.PathValue("season"))
+	if !ok {
+		http.Error(w, "Season number must be a non-negative integer", http.StatusBadRequest)
 		return
 	}
 
+	details, err := r.movieService.GetSeason(req.Context(), id, season)
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	r.writeJSON(w, req, details)
+}
+
+func (r *Router) handleTrending(w http.ResponseWriter, req *http.Request) {
 	timeWindow := req.URL.Query().Get("time_window")
 	if timeWindow == "" {
 		timeWindow = "day"
 	}
 
-	trending, err := r.movieService.GetTrending(timeWindow)
+	trending, err := r.movieService.GetTrending(req.Context(), timeWindow)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(trending)
+	r.writeJSON(w, req, trending)
 }
 
 func (r *Router) handleGenres(w http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	genres, err := r.movieService.GetGenres(req.Context())
+	if err != nil {
+		r.writeServiceError(w, req, err)
 		return
 	}
 
-	genres, err := r.movieService.GetGenres()
+	r.writeJSON(w, req, genres)
+}
+
+// handleDiscover lists movies or TV shows by genre and year, most popular
+// first unless ?sort_by= says otherwise
+func (r *Router) handleDiscover(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	mediaType := query.Get("type")
+	if mediaType == "" {
+		mediaType = "movie"
+	}
+	if mediaType != "movie" && mediaType != "tv" {
+		http.Error(w, "Query parameter 'type' must be 'movie' or 'tv'", http.StatusBadRequest)
+		return
+	}
+
+	var opts models.DiscoverOptions
+	if genre := query.Get("genre"); genre != "" {
+		for _, id := range strings.Split(genre, ",") {
+			n, ok := pathNumber(id)
+			if !ok || n == 0 {
+				http.Error(w, "Query parameter 'genre' must be genre IDs separated by commas", http.StatusBadRequest)
+				return
+			}
+			opts.Genres = append(opts.Genres, n)
+		}
+	}
+	if year := query.Get("year"); year != "" {
+		n, ok := pathNumber(year)
+		if !ok || len(year) != 4 || n < 1800 {
+			http.Error(w, "Query parameter 'year' must be a four digit year", http.StatusBadRequest)
+			return
+		}
+		opts.Year = n
+	}
+	opts.SortBy = query.Get("sort_by")
+	filters, err := services.DiscoverFilters(mediaType, opts)
+	if err != nil {
+		http.Error(w, "Query parameter 'sort_by' must be popularity.desc, vote_average.desc, release_date.desc or release_date.asc", http.StatusBadRequest)
+		return
+	}
+
+	page := query.Get("page")
+	if page == "" {
+		page = "1"
+	}
+	if n, ok := pathNumber(page); !ok || n < 1 || n > 500 {
+		http.Error(w, "Query parameter 'page' must be between 1 and 500", http.StatusBadRequest)
+		return
+	}
+
+	results, err := r.movieService.Discover(req.Context(), mediaType, filters, page)
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	r.writeJSON(w, req, results)
+}
+
+func (r *Router) handleForYou(w http.ResponseWriter, req *http.Request) {
+	mediaType := req.URL.Query().Get("type")
+	if mediaType == "" {
+		mediaType = "movie"
+	}
+	if mediaType != "movie" && mediaType != "tv" {
+		http.Error(w, "Query parameter 'type' must be 'movie' or 'tv'", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 50 {
+			http.Error(w, "Query parameter 'limit' must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	library, err := r.store.Library(userID(req))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(genres)
+	recommendations, err := r.recommendationService.Recommend(req.Context(), library, mediaType, limit)
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+
+	r.writeJSON(w, req, recommendations)
+}
+
+// userID identifies the user a request acts on behalf of. There are no
+// accounts, so clients pick an ID and send it in the X-User-ID header.
+func userID(req *http.Request) string {
+	id := strings.TrimSpace(req.Header.Get("X-User-ID"))
+	if id == "" {
+		id = strings.TrimSpace(req.URL.Query().Get("user"))
+	}
+	if id == "" {
+		id = "default"
+	}
+	return id
+}
+
+// pathID reads the TMDB ID in the path wildcard name. Anything but a
+// positive integer is answered with 400, so only IDs reach TMDB's URLs.
+func pathID(w http.ResponseWriter, req *http.Request, name string) (string, bool) {
+	n, ok := pathNumber(req.PathValue(name))
+	if !ok || n == 0 {
+		http.Error(w, "ID must be a positive integer", http.StatusBadRequest)
+		return "", false
+	}
+	return strconv.Itoa(n), true
+}
+
+// pathNumber parses a non-negative decimal number without a sign, spaces or
+// more digits than TMDB uses
+func pathNumber(s string) (int, bool) {
+	if s == "" || len(s) > 9 {
+		return 0, false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// writeServiceError answers 404 for a title TMDB does not have and 500 for
+// anything else
+func (r *Router) writeServiceError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		http.NotFound(w, req)
+	case errors.Is(err, services.ErrCircuitOpen):
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Upstream service unavailable, try again later", http.StatusServiceUnavailable)
+	default:
+		// Upstream errors describe requests the client never made, so they
+		// are logged for the request ID rather than shown
+		r.logger.ErrorContext(req.Context(), "upstream request failed",
+			"request_id", RequestIDFrom(req.Context()), "path", req.URL.Path, "error", err)
+		http.Error(w, "Upstream request failed", http.StatusInternalServerError)
+	}
 }
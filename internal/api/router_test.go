@@ -0,0 +1,510 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/golden"
+	"movie-discovery-app/internal/services"
+)
+
+// testNow is the router's clock in tests, before the fixtures' upcoming
+// movie and next episode
+var testNow = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// Upstream calls and background workers log to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestRouter returns a router with its own data directory whose movie
+// service calls a fake TMDB and OMDB
+func newTestRouter(t testing.TB) (*Router, *fakeupstream.Server) {
+	t.Helper()
+	return newTestRouterWith(t, fakeupstream.Options{})
+}
+
+// newTestRouterWith is newTestRouter with a fake configured by opts
+func newTestRouterWith(t testing.TB, opts fakeupstream.Options) (*Router, *fakeupstream.Server) {
+	t.Helper()
+	cfg, err := config.Load(config.Sources{Environ: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.DataDir = t.TempDir()
+
+	fake := fakeupstream.New(opts)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:   "test",
+		TMDBBaseURL:  srv.URL + "/3",
+		ImageBaseURL: "https://image.test/t/p/w500",
+		OMDBAPIKey:   "test",
+		OMDBBaseURL:  srv.URL,
+	}, srv.Client())
+
+	router := NewRouter(cfg,
+		WithMovieService(movieService),
+		WithTemplates(template.Must(template.New("index.html").Parse(`<body{{if .Demo}} data-demo="true"{{end}}>`))),
+		WithStatic(fstest.MapFS{"js/app.js": {Data: []byte("// app\n")}}),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithClock(func() time.Time { return testNow }),
+	)
+	t.Cleanup(func() { router.Shutdown(context.Background()) })
+	return router, fake
+}
+
+// handlerTest is one request and what the response must be
+type handlerTest struct {
+	name   string
+	method string
+	target string
+	header map[string]string
+	body   string
+	status int
+	// contentType is the start of the Content-Type header, when set
+	contentType string
+	// want must be in the body, when set
+	want string
+	// allow is the Allow header of a 405, when set
+	allow string
+	// golden names a file under testdata/golden the body must match.
+	// .json files are compared after indenting.
+	golden string
+}
+
+func runHandlerTests(t *testing.T, h http.Handler, tests []handlerTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h, tt.method, tt.target, tt.header, tt.body)
+
+			if rec.Code != tt.status {
+				t.Fatalf("%s %s: status %d, want %d\n%s", tt.method, tt.target, rec.Code, tt.status, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tt.contentType) {
+				t.Errorf("Content-Type %q, want %q", ct, tt.contentType)
+			}
+			if got := rec.Header().Get("Allow"); tt.allow != "" && got != tt.allow {
+				t.Errorf("Allow %q, want %q", got, tt.allow)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body does not contain %q:\n%s", tt.want, rec.Body)
+			}
+			if tt.golden != "" {
+				path := filepath.Join("testdata", "golden", tt.golden)
+				if filepath.Ext(path) == ".json" {
+					golden.AssertJSON(t, path, rec.Body.Bytes())
+				} else {
+					golden.Assert(t, path, rec.Body.Bytes())
+				}
+			}
+		})
+	}
+}
+
+func serve(h http.Handler, method, target string, header map[string]string, body string) *httptest.ResponseRecorder {
+	if method == "" {
+		method = http.MethodGet
+	}
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouter(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "home", target: "/", status: http.StatusOK, contentType: "text/html", want: "<body>"},
+		{name: "home post", method: http.MethodPost, target: "/", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{name: "unknown page", target: "/nope", status: http.StatusNotFound},
+		{name: "unknown api", target: "/api/people/1", status: http.StatusNotFound},
+		{name: "static", target: "/static/js/app.js", status: http.StatusOK, want: "// app"},
+
+		{name: "search", target: "/api/search?q=the", status: http.StatusOK, contentType: "application/json", golden: "search.json"},
+		{name: "search movies", target: "/api/search?q=the&type=movie&page=1", status: http.StatusOK, golden: "search_movie.json"},
+		{name: "search without query", target: "/api/search", status: http.StatusBadRequest, want: "Query parameter 'q' is required"},
+		{name: "search empty query", target: "/api/search?q=&type=tv", status: http.StatusBadRequest, want: "Query parameter 'q' is required"},
+		{name: "search post", method: http.MethodPost, target: "/api/search?q=the", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+
+		{name: "movie", target: "/api/movie/550", status: http.StatusOK, contentType: "application/json", golden: "movie_550.json"},
+		{name: "movie head", method: http.MethodHead, target: "/api/movie/550", status: http.StatusOK},
+		{name: "movie without id", target: "/api/movie/", status: http.StatusNotFound},
+		{name: "movie unknown id", target: "/api/movie/999", status: http.StatusNotFound},
+		{name: "movie delete", method: http.MethodDelete, target: "/api/movie/550", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{name: "movie credits", target: "/api/movie/550/credits", status: http.StatusOK, golden: "movie_550_credits.json"},
+		{name: "movie videos", target: "/api/movie/603/videos", status: http.StatusOK, golden: "movie_603_videos.json"},
+		{name: "movie recommendations", target: "/api/movie/27205/recommendations", status: http.StatusOK, golden: "movie_27205_recommendations.json"},
+		{name: "movie external ids", target: "/api/movie/550/external_ids", status: http.StatusOK, want: `"imdb_id":"tt0137523"`},
+		{name: "movie availability", target: "/api/movie/550/availability?region=us", status: http.StatusOK, golden: "movie_550_availability.json"},
+		{name: "movie release dates", target: "/api/movie/1000001/release_dates", status: http.StatusOK, want: `"release_dates"`},
+		{name: "movie unknown subresource", target: "/api/movie/550/reviews", status: http.StatusNotFound},
+		{name: "movie credits unknown id", target: "/api/movie/999/credits", status: http.StatusNotFound},
+		{name: "movie credits post", method: http.MethodPost, target: "/api/movie/550/credits", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+
+		{name: "tv", target: "/api/tv/1396", status: http.StatusOK, golden: "tv_1396.json"},
+		{name: "tv without id", target: "/api/tv/", status: http.StatusNotFound},
+		{name: "tv unknown id", target: "/api/tv/550", status: http.StatusNotFound},
+		{name: "tv put", method: http.MethodPut, target: "/api/tv/1396", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+		{name: "tv credits", target: "/api/tv/1396/credits", status: http.StatusOK, want: `"cast"`},
+		{name: "tv availability", target: "/api/tv/1396/availability", status: http.StatusOK, want: `"media_type":"tv"`},
+		{name: "tv season", target: "/api/tv/1396/season/5", status: http.StatusOK, golden: "tv_1396_season_5.json"},
+		{name: "tv season unknown", target: "/api/tv/1396/season/9", status: http.StatusNotFound},
+		{name: "tv season not a number", target: "/api/tv/1396/season/last", status: http.StatusBadRequest, want: "Season number must be a non-negative integer"},
+		{name: "tv release dates", target: "/api/tv/1396/release_dates", status: http.StatusNotFound},
+
+		{name: "trending", target: "/api/trending", status: http.StatusOK, golden: "trending_day.json"},
+		{name: "trending week", target: "/api/trending?time_window=week", status: http.StatusOK, golden: "trending_week.json"},
+		{name: "trending post", method: http.MethodPost, target: "/api/trending", status: http.StatusMethodNotAllowed, allow: "GET, HEAD"},
+
+		{name: "genres", target: "/api/genres", status: http.StatusOK, golden: "genres.json"},
+		{name: "genres post", method: http.MethodPost, target: "/api/genres", status: http.StatusMethodNotAllowed},
+
+		{name: "for you empty library", target: "/api/for-you", status: http.StatusOK, golden: "for_you_empty.json"},
+		{name: "for you tv", target: "/api/for-you?type=tv&limit=50", status: http.StatusOK},
+		{name: "for you bad type", target: "/api/for-you?type=person", status: http.StatusBadRequest, want: "'type' must be 'movie' or 'tv'"},
+		{name: "for you limit zero", target: "/api/for-you?limit=0", status: http.StatusBadRequest, want: "'limit' must be between 1 and 50"},
+		{name: "for you limit too big", target: "/api/for-you?limit=51", status: http.StatusBadRequest, want: "'limit' must be between 1 and 50"},
+		{name: "for you limit not a number", target: "/api/for-you?limit=ten", status: http.StatusBadRequest},
+		{name: "for you post", method: http.MethodPost, target: "/api/for-you", status: http.StatusMethodNotAllowed},
+	})
+}
+
+func TestRouterUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		fault   fakeupstream.Fault
+		wantErr string
+	}{
+		{"search server error", "/api/search?q=the", fakeupstream.ServerError, "API request failed with status: 500"},
+		{"movie rate limited", "/api/movie/550", fakeupstream.RateLimited, "API request failed with status: 429"},
+		{"credits server error", "/api/movie/550/credits", fakeupstream.ServerError, "API request failed with status: 500"},
+		{"season malformed", "/api/tv/1396/season/5", fakeupstream.MalformedJSON, "failed to parse response"},
+		{"tv malformed", "/api/tv/1396", fakeupstream.MalformedJSON, "failed to parse response"},
+		{"trending server error", "/api/trending", fakeupstream.ServerError, "API request failed with status: 500"},
+		{"genres rate limited", "/api/genres", fakeupstream.RateLimited, "API request failed with status: 429"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, fake := newTestRouter(t)
+			var logs bytes.Buffer
+			router.logger = slog.New(slog.NewTextHandler(&logs, nil))
+			fake.Fail("/3/", tt.fault, 1)
+
+			rec := serve(router, http.MethodGet, tt.target, nil, "")
+			if rec.Code != http.StatusInternalServerError {
+				t.Fatalf("status %d, want 500", rec.Code)
+			}
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+				t.Errorf("Content-Type %q, want plain text", rec.Header().Get("Content-Type"))
+			}
+			// The cause is logged, not shown
+			if rec.Body.String() != "Upstream request failed\n" {
+				t.Errorf("body %q, want a generic error", rec.Body)
+			}
+			if !strings.Contains(logs.String(), tt.wantErr) {
+				t.Errorf("log %q does not contain %q", logs.String(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouterCircuitOpen(t *testing.T) {
+	router, fake := newTestRouter(t)
+	var logs bytes.Buffer
+	router.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	fake.Fail("/3/", fakeupstream.ServerError, 0)
+
+	var rec *httptest.ResponseRecorder
+	for i := 0; i < 10; i++ {
+		rec = serve(router, http.MethodGet, "/api/search?q=the", nil, "")
+		if rec.Code == http.StatusServiceUnavailable {
+			break
+		}
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503 once the breaker opens", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After")
+	}
+	for _, secret := range []string{"api_key", "test", "/3/search"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("body %q contains %q", rec.Body, secret)
+		}
+	}
+	if strings.Contains(logs.String(), "api_key") {
+		t.Errorf("log contains the API key:\n%s", logs.String())
+	}
+}
+
+func TestWriteJSONLogsEncodeFailure(t *testing.T) {
+	router, _ := newTestRouter(t)
+	var logs bytes.Buffer
+	router.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	router.writeJSON(httptest.NewRecorder(), req, map[string]interface{}{"bad": func() {}})
+
+	if !strings.Contains(logs.String(), "failed to write response") || !strings.Contains(logs.String(), "path=/api/stats") {
+		t.Errorf("log %q does not report the failure", logs.String())
+	}
+}
+
+func TestRouterPassesPathID(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	tests := []struct {
+		target string
+		path   string
+	}{
+		{"/api/movie/603", "/3/movie/603"},
+		{"/api/tv/1000002", "/3/tv/1000002"},
+		{"/api/movie/27205?language=en", "/3/movie/27205"},
+		{"/api/movie/0550/videos", "/3/movie/550/videos"},
+		{"/api/tv/1396/recommendations", "/3/tv/1396/recommendations"},
+		{"/api/tv/1000002/season/02", "/3/tv/1000002/season/2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			if rec := serve(router, http.MethodGet, tt.target, nil, ""); rec.Code != http.StatusOK {
+				t.Fatalf("status %d\n%s", rec.Code, rec.Body)
+			}
+			fake.AssertCallCount(t, tt.path, 1)
+		})
+	}
+}
+
+func TestRouterRejectsInvalidIDs(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	for _, target := range []string{
+		"/api/movie/abc",
+		"/api/movie/-1",
+		"/api/movie/+550",
+		"/api/movie/0",
+		"/api/movie/1e3",
+		"/api/movie/550%20",
+		"/api/movie/550%2F..%2Fsearch",
+		"/api/movie/9999999999",
+		"/api/tv/0x1A",
+		"/api/movie/abc/credits",
+		"/api/tv/abc/season/1",
+		"/api/tv/1396/season/-1",
+	} {
+		t.Run(target, func(t *testing.T) {
+			rec := serve(router, http.MethodGet, target, nil, "")
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400\n%s", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	if requests := fake.Requests(); len(requests) != 0 {
+		t.Errorf("invalid IDs reached TMDB: %+v", requests)
+	}
+}
+
+func TestRouterCleansPaths(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	// The mux redirects to the clean path instead of passing dot segments on
+	rec := serve(router, http.MethodGet, "/api/movie/123/../../search?q=x", nil, "")
+	if rec.Code != http.StatusMovedPermanently && rec.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status %d, want a redirect", rec.Code)
+	}
+	if got := rec.Header().Get("Location"); got != "/api/search?q=x" {
+		t.Errorf("Location %q, want /api/search?q=x", got)
+	}
+	if requests := fake.Requests(); len(requests) != 0 {
+		t.Errorf("requests reached TMDB: %+v", requests)
+	}
+}
+
+func TestRouterSearchParams(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	serve(router, http.MethodGet, "/api/search?q=breaking+bad&type=tv", nil, "")
+	fake.AssertQuery(t, "/3/search/tv", "query", "breaking bad")
+	fake.AssertQuery(t, "/3/search/tv", "page", "1")
+
+	serve(router, http.MethodGet, "/api/search?q=matrix&page=3", nil, "")
+	fake.AssertQuery(t, "/3/search/multi", "page", "3")
+}
+
+func TestRouterDiscover(t *testing.T) {
+	router, fake := newTestRouter(t)
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "genre and year", target: "/api/discover?genre=878&year=1999", status: http.StatusOK, contentType: "application/json", want: `"results":[{"id":603,`},
+		{name: "all genres", target: "/api/discover?genre=878,12", status: http.StatusOK, want: `"title":"Inception"`},
+		{name: "tv", target: "/api/discover?type=tv&sort_by=release_date.asc", status: http.StatusOK, want: `"results":[{"id":1396,`},
+		{name: "bad type", target: "/api/discover?type=person", status: http.StatusBadRequest, want: "'type' must be 'movie' or 'tv'"},
+		{name: "bad genre", target: "/api/discover?genre=sci-fi", status: http.StatusBadRequest, want: "'genre' must be genre IDs"},
+		{name: "empty genre", target: "/api/discover?genre=878,", status: http.StatusBadRequest},
+		{name: "bad year", target: "/api/discover?year=99", status: http.StatusBadRequest, want: "'year' must be a four digit year"},
+		{name: "bad sort", target: "/api/discover?sort_by=title.asc", status: http.StatusBadRequest, want: "'sort_by' must be"},
+		{name: "page too large", target: "/api/discover?page=501", status: http.StatusBadRequest, want: "'page' must be between 1 and 500"},
+	})
+
+	// Release date sorts and years are named per media type at TMDB
+	fake.Reset()
+	serve(router, http.MethodGet, "/api/discover?year=1999&sort_by=release_date.desc&page=2", nil, "")
+	fake.AssertQuery(t, "/3/discover/movie", "primary_release_year", "1999")
+	fake.AssertQuery(t, "/3/discover/movie", "sort_by", "primary_release_date.desc")
+	fake.AssertQuery(t, "/3/discover/movie", "page", "2")
+	serve(router, http.MethodGet, "/api/discover?type=tv&year=2008", nil, "")
+	fake.AssertQuery(t, "/3/discover/tv", "first_air_date_year", "2008")
+	fake.AssertQuery(t, "/3/discover/tv", "sort_by", "popularity.desc")
+}
+
+func TestUserID(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   string
+	}{
+		{"default", "/", "", "default"},
+		{"query", "/?user=alice", "", "alice"},
+		{"header", "/", "bob", "bob"},
+		{"header wins", "/?user=alice", "bob", "bob"},
+		{"header trimmed", "/", "  bob \t", "bob"},
+		{"blank header", "/?user=alice", "   ", "alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-User-ID", tt.header)
+			}
+			if got := userID(req); got != tt.want {
+				t.Errorf("userID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Only routes acting for a user check the user ID, so a bad one does not
+// break probes, metrics, static files, GraphQL or gRPC
+func TestValidUserIDOnlyOnUserRoutes(t *testing.T) {
+	router, _ := newTestRouter(t)
+	bad := map[string]string{"X-User-ID": "../etc"}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "watchlist", target: "/api/watchlist", header: bad, status: http.StatusBadRequest, want: "User ID may only contain"},
+		{name: "watchlist query", target: "/api/v1/watchlist?user=a%2Fb", status: http.StatusBadRequest},
+		{name: "room events", target: "/api/rooms/r1/events", header: bad, status: http.StatusBadRequest},
+	})
+
+	for _, tt := range []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/healthz", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/metrics", ""},
+		{http.MethodGet, "/static/js/app.js", ""},
+		{http.MethodGet, "/", ""},
+		{http.MethodGet, "/api/search?q=matrix", ""},
+		{http.MethodGet, "/api/v1/openapi.json", ""},
+		{http.MethodPost, "/graphql", `{"query":"{ __typename }"}`},
+		{http.MethodPost, "/" + discoveryService + "/GetMovie", ""},
+	} {
+		rec := serve(router, tt.method, tt.target, bad, tt.body)
+		if rec.Code == http.StatusBadRequest || strings.Contains(rec.Body.String(), "User ID may only contain") {
+			t.Errorf("%s %s: status %d\n%s", tt.method, tt.target, rec.Code, rec.Body)
+		}
+	}
+}
+
+// FuzzQuery sends arbitrary query strings to the handlers that parse one.
+// Bad input must be answered with 400, never a panic or a 500.
+func FuzzQuery(f *testing.F) {
+	for _, seed := range []string{
+		"q=matrix",
+		"q=the&type=movie&page=2",
+		"q=%00&page=-1",
+		"type=tv&limit=50",
+		"limit=0",
+		"limit=99999999999999999999",
+		"type=movie&region=gb&with_genres=18|53",
+		"time_window=week&user=alice",
+		"q=a&q=b&type=&type=tv",
+		"%zz=1&;",
+	} {
+		f.Add(seed)
+	}
+
+	router, _ := newTestRouter(f)
+	paths := []string{
+		"/api/search",
+		"/api/for-you",
+		"/api/trending",
+		"/api/calendar/upcoming.ics",
+		"/api/feeds/upcoming.atom",
+	}
+
+	f.Fuzz(func(t *testing.T, rawQuery string) {
+		query, _ := url.ParseQuery(rawQuery)
+		for _, path := range paths {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.URL.RawQuery = rawQuery
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			switch rec.Code {
+			case http.StatusOK, http.StatusBadRequest:
+			default:
+				t.Fatalf("%s?%s: status %d\n%s", path, rawQuery, rec.Code, rec.Body)
+			}
+
+			if path == "/api/for-you" {
+				if want := forYouStatus(query); rec.Code != want {
+					t.Errorf("%s?%s: status %d, want %d", path, rawQuery, rec.Code, want)
+				}
+			}
+		}
+	})
+}
+
+// forYouStatus is what /api/for-you should answer for query
+func forYouStatus(query url.Values) int {
+	if mediaType := query.Get("type"); mediaType != "" && mediaType != "movie" && mediaType != "tv" {
+		return http.StatusBadRequest
+	}
+	if value := query.Get("limit"); value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 50 {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"net/http"
+
+	"movie-discovery-app/internal/importer"
+	"movie-discovery-app/internal/notify"
+	"movie-discovery-app/internal/openapi"
+	"movie-discovery-app/internal/rooms"
+	"movie-discovery-app/pkg/models"
+)
+
+// apiVersion prefixes the versioned API. Its paths are also served under
+// plain /api, where the API started out, for existing clients.
+const apiVersion = "/api/v1"
+
+// route is an API endpoint and its description in the OpenAPI document.
+// The table of routes is the one place endpoints are declared, so the
+// document cannot leave any out.
+type route struct {
+	method string
+	// path is relative to the API's prefix, e.g. /movie/{id}
+	path    string
+	handler http.HandlerFunc
+	// v1Only routes are not served under the unversioned prefix
+	v1Only bool
+
+	id          string
+	tag         string
+	summary     string
+	description string
+	params      []openapi.Parameter
+	// user routes act for the user named in X-User-ID
+	user bool
+	// body is a value of the JSON request body's type, or an
+	// *openapi.Schema for other bodies, sent as bodyType
+	body     interface{}
+	bodyType string
+	// status is the success status, 200 when unset
+	status int
+	// response is a value of the JSON response's type, or an
+	// *openapi.Schema for other responses, sent as contentType
+	response    interface{}
+	contentType string
+	// errors lists the error statuses besides 500 the route answers with
+	errors []int
+}
+
+var tags = []openapi.Tag{
+	{Name: "titles", Description: "Movies and TV shows from TMDB"},
+	{Name: "library", Description: "Importing and exporting a user's library"},
+	{Name: "rooms", Description: "Group movie night rooms"},
+	{Name: "notifications", Description: "Release notifications, calendars and feeds"},
+	{Name: "service", Description: "Server status and this document"},
+}
+
+func (r *Router) routes() []route {
+	id := pathParam("id", "TMDB ID, a positive integer", 550, openapi.Integer().Min(1))
+	tvID := pathParam("id", "TMDB ID, a positive integer", 1396, openapi.Integer().Min(1))
+	region := queryParam("region", "ISO 3166-1 country code, US by default", "US", openapi.String())
+	mediaType := queryParam("type", "movie or tv", nil, enum("movie", "tv"))
+
+	// Movies and TV shows. IDs are checked to be TMDB IDs before they are
+	// put into upstream URLs.
+	var routes []route
+	for _, t := range []struct {
+		mediaType string
+		id        openapi.Parameter
+		details   interface{}
+		name      string
+	}{
+		{"movie", id, &models.MovieDetails{}, "Movie"},
+		{"tv", tvID, &models.TVDetails{}, "TV"},
+	} {
+		base := "/" + t.mediaType + "/{id}"
+		params := []openapi.Parameter{t.id}
+		notFound := []int{http.StatusBadRequest, http.StatusNotFound}
+		details := r.handleMovieDetails
+		if t.mediaType == "tv" {
+			details = r.handleTVDetails
+		}
+
+		routes = append(routes,
+			route{method: "GET", path: base, handler: details,
+				id: "get" + t.name, tag: "titles", summary: "Get a " + t.mediaType + "'s details",
+				description: "Includes credits, external IDs, videos and keywords, and OMDb ratings when an OMDb key is configured.",
+				params:      params, response: t.details, errors: notFound},
+			route{method: "GET", path: base + "/credits", handler: r.handleCredits(t.mediaType),
+				id: "get" + t.name + "Credits", tag: "titles", summary: "Get a " + t.mediaType + "'s cast and crew",
+				params: params, response: &models.Credits{}, errors: notFound},
+			route{method: "GET", path: base + "/videos", handler: r.handleVideos(t.mediaType),
+				id: "get" + t.name + "Videos", tag: "titles", summary: "Get a " + t.mediaType + "'s trailers and clips",
+				params: params, response: &models.VideosResponse{}, errors: notFound},
+			route{method: "GET", path: base + "/recommendations", handler: r.handleRecommendations(t.mediaType),
+				id: "get" + t.name + "Recommendations", tag: "titles", summary: "Get titles like a " + t.mediaType,
+				params: params, response: []models.Media{}, errors: notFound},
+			route{method: "GET", path: base + "/external_ids", handler: r.handleExternalIDs(t.mediaType),
+				id: "get" + t.name + "ExternalIDs", tag: "titles", summary: "Get a " + t.mediaType + "'s IMDb and other external IDs",
+				params: params, response: &models.ExternalIDs{}, errors: notFound},
+			route{method: "GET", path: base + "/availability", handler: r.handleAvailability(t.mediaType),
+				id: "get" + t.name + "Availability", tag: "titles", summary: "Get where a " + t.mediaType + " can be watched",
+				description: "Runtime, age rating and the services streaming, renting or selling the title in a country.",
+				params:      []openapi.Parameter{t.id, region}, response: &models.Availability{}, errors: notFound},
+		)
+	}
+
+	routes = append(routes,
+		route{method: "GET", path: "/search", handler: r.handleSearch,
+			id: "search", tag: "titles", summary: "Search movies and TV shows",
+			params: []openapi.Parameter{
+				required(queryParam("q", "Search text", "matrix", openapi.String())),
+				queryParam("type", "movie, tv, or multi for both, multi by default", nil, enum("multi", "movie", "tv")),
+				queryParam("page", "Page of results, from 1", 1, openapi.Integer().Min(1)),
+			},
+			response: &models.SearchResponse{}, errors: []int{http.StatusBadRequest}},
+		route{method: "GET", path: "/movie/{id}/release_dates", handler: r.handleReleaseDates,
+			id: "getMovieReleaseDates", tag: "titles", summary: "Get a movie's release dates and certifications by country",
+			params: []openapi.Parameter{id}, response: &models.ReleaseDatesResponse{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "GET", path: "/tv/{id}/season/{season}", handler: r.handleSeason,
+			id: "getTVSeason", tag: "titles", summary: "Get a TV season's episodes",
+			params: []openapi.Parameter{
+				tvID,
+				pathParam("season", "Season number, 0 for specials", 5, openapi.Integer().Min(0)),
+			},
+			response: &models.SeasonDetails{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "GET", path: "/trending", handler: r.handleTrending,
+			id: "getTrending", tag: "titles", summary: "Get trending movies and TV shows",
+			params:   []openapi.Parameter{queryParam("time_window", "day or week, day by default", "day", enum("day", "week"))},
+			response: &models.TrendingResponse{}},
+		route{method: "GET", path: "/genres", handler: r.handleGenres,
+			id: "getGenres", tag: "titles", summary: "Get the movie and TV genres",
+			description: "Genres by media type, under the keys movie and tv.",
+			response:    map[string][]models.Genre{}},
+		route{method: "GET", path: "/discover", handler: r.handleDiscover,
+			id: "discover", tag: "titles", summary: "Browse movies or TV shows by genre and year",
+			params: []openapi.Parameter{
+				queryParam("type", "movie or tv, movie by default", nil, enum("movie", "tv")),
+				queryParam("genre", "Genre IDs, separated by commas for titles in all of them", "878", openapi.String()),
+				queryParam("year", "Year of release, or of the first episode", 1999, openapi.Integer().Min(1800).Max(9999)),
+				queryParam("sort_by", "Order of the results, popularity.desc by default", nil,
+					enum("popularity.desc", "vote_average.desc", "release_date.desc", "release_date.asc")),
+				queryParam("page", "Page of results, from 1", 1, openapi.Integer().Min(1).Max(500)),
+			},
+			response: &models.SearchResponse{}, errors: []int{http.StatusBadRequest}},
+		route{method: "GET", path: "/for-you", handler: r.handleForYou,
+			id: "getRecommendations", tag: "titles", summary: "Get recommendations based on the user's library",
+			user: true,
+			params: []openapi.Parameter{
+				queryParam("type", "movie or tv, movie by default", nil, enum("movie", "tv")),
+				queryParam("limit", "Number of recommendations, 20 by default", 20, openapi.Integer().Min(1).Max(50)),
+			},
+			response: &models.RecommendationResponse{}, errors: []int{http.StatusBadRequest}},
+
+		route{method: "GET", path: "/imports", handler: r.handleListImports,
+			id: "listImports", tag: "library", summary: "List the user's imports",
+			description: "Rows are left out; get an import to see them.",
+			user:        true, response: []*importer.Job{}},
+		route{method: "POST", path: "/imports", handler: r.handleCreateImport,
+			id: "createImport", tag: "library", summary: "Import a library export from another service",
+			description: "The import runs in the background; poll the import at the Location header for progress.",
+			user:        true, body: importForm(), bodyType: "multipart/form-data",
+			status: http.StatusAccepted, response: &importer.Job{}, errors: []int{http.StatusBadRequest}},
+		route{method: "GET", path: "/imports/{id}", handler: r.handleImport,
+			id: "getImport", tag: "library", summary: "Get an import and its rows",
+			user: true, params: []openapi.Parameter{importID()}, response: &importer.Job{}, errors: []int{http.StatusNotFound}},
+		route{method: "POST", path: "/imports/{id}/resume", handler: r.handleResumeImport,
+			id: "resumeImport", tag: "library", summary: "Resume a failed or interrupted import",
+			user: true, params: []openapi.Parameter{importID()}, response: &importer.Job{}, errors: []int{http.StatusNotFound}},
+		route{method: "POST", path: "/imports/{id}/resolve", handler: r.handleResolveImport,
+			id: "resolveImport", tag: "library", summary: "Pick the title an ambiguous or unmatched row refers to",
+			user: true, params: []openapi.Parameter{importID()}, body: &resolveImportRequest{},
+			response: &importer.Job{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "GET", path: "/export", handler: r.handleExport,
+			id: "exportLibrary", tag: "library", summary: "Download the user's library",
+			description: "A zip archive of the watchlist, ratings and diary as JSON and CSV, and the diary as Letterboxd CSV.",
+			user:        true, response: binary(), contentType: "application/zip"},
+		route{method: "GET", path: "/watchlist", handler: r.handleWatchlist,
+			id: "getWatchlist", tag: "library", summary: "List the user's watchlist, oldest first",
+			user: true, response: []models.WatchlistItem{}},
+		route{method: "POST", path: "/watchlist", handler: r.handleAddToWatchlist,
+			id: "addToWatchlist", tag: "library", summary: "Add a title to the user's watchlist",
+			description: "Answers 201 with the new item, or 200 with the existing one when the title is already on the watchlist.",
+			user:        true, body: &addToWatchlistRequest{}, status: http.StatusCreated, response: &models.WatchlistItem{},
+			errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "DELETE", path: "/watchlist/{type}/{id}", handler: r.handleRemoveFromWatchlist,
+			id: "removeFromWatchlist", tag: "library", summary: "Remove a title from the user's watchlist",
+			user: true, params: []openapi.Parameter{pathParam("type", "movie or tv", "movie", enum("movie", "tv")), id},
+			status: http.StatusNoContent, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+
+		route{method: "POST", path: "/rooms", handler: r.handleCreateRoom,
+			id: "createRoom", tag: "rooms", summary: "Create a room",
+			user: true, body: &createRoomRequest{}, status: http.StatusCreated, response: &rooms.Room{},
+			errors: []int{http.StatusBadRequest}},
+		route{method: "GET", path: "/rooms/{id}", handler: r.handleRoom,
+			id: "getRoom", tag: "rooms", summary: "Get a room the user is a member of",
+			user: true, params: []openapi.Parameter{roomIDParam()}, response: &rooms.Room{}, errors: []int{http.StatusNotFound}},
+		route{method: "POST", path: "/rooms/{id}/members", handler: r.handleJoinRoom,
+			id: "joinRoom", tag: "rooms", summary: "Join a room",
+			description: "Members join with the invite code. The owner can add anyone by user_id.",
+			user:        true, params: []openapi.Parameter{roomIDParam()}, body: &joinRoomRequest{}, response: &rooms.Room{},
+			errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound}},
+		route{method: "PUT", path: "/rooms/{id}/filters", handler: r.handleRoomFilters,
+			id: "setRoomFilters", tag: "rooms", summary: "Change which titles a room considers",
+			user: true, params: []openapi.Parameter{roomIDParam()}, body: &rooms.Filters{}, response: &rooms.Room{},
+			errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound}},
+		route{method: "POST", path: "/rooms/{id}/candidates", handler: r.handleRoomCandidates,
+			id: "refreshRoomCandidates", tag: "rooms", summary: "Pick new candidates from the members' watchlists",
+			user: true, params: []openapi.Parameter{roomIDParam()}, response: &rooms.Room{}, errors: []int{http.StatusNotFound}},
+		route{method: "POST", path: "/rooms/{id}/votes", handler: r.handleRoomVote,
+			id: "voteInRoom", tag: "rooms", summary: "Vote on a candidate",
+			user: true, params: []openapi.Parameter{roomIDParam()}, body: &voteRequest{}, response: &rooms.Room{},
+			errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "GET", path: "/rooms/{id}/events", handler: r.handleRoomEvents,
+			id: "streamRoomEvents", tag: "rooms", summary: "Follow a room's changes",
+			description: "Server-Sent Events, starting with a room event holding the room. member_joined, candidates and vote events follow as they happen.",
+			user:        true, params: []openapi.Parameter{roomIDParam()}, response: openapi.String(), contentType: "text/event-stream",
+			errors: []int{http.StatusNotFound}},
+
+		route{method: "GET", path: "/notifications", handler: r.handleNotifications,
+			id: "listNotifications", tag: "notifications", summary: "List the user's notifications, newest first",
+			user:     true,
+			params:   []openapi.Parameter{queryParam("unread", "true to list only unread notifications", nil, enum("true", "false"))},
+			response: []notify.Notification{}},
+		route{method: "GET", path: "/notifications/preferences", handler: r.handleNotificationPreferences,
+			id: "getNotificationPreferences", tag: "notifications", summary: "Get the user's notification preferences",
+			user: true, response: &notify.Preferences{}},
+		route{method: "PUT", path: "/notifications/preferences", handler: r.handleNotificationPreferences,
+			id: "setNotificationPreferences", tag: "notifications", summary: "Change the user's notification preferences",
+			user: true, body: &notify.Preferences{}, response: &notify.Preferences{}, errors: []int{http.StatusBadRequest}},
+		route{method: "POST", path: "/notifications/read", handler: r.handleNotificationsRead,
+			id: "markNotificationsRead", tag: "notifications", summary: "Mark a notification, or all of them, as read",
+			user: true, body: &markReadRequest{}, status: http.StatusNoContent,
+			errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+		route{method: "GET", path: "/calendar/token", handler: r.handleCalendarToken,
+			id: "getCalendarToken", tag: "notifications", summary: "Get the user's private calendar and feed URL",
+			user: true, response: &calendarToken{}},
+		route{method: "POST", path: "/calendar/token", handler: r.handleCalendarToken,
+			id: "rotateCalendarToken", tag: "notifications", summary: "Issue a new calendar token, revoking the old one",
+			user: true, response: &calendarToken{}},
+		route{method: "GET", path: "/calendar.ics", handler: r.handleCalendarFeed,
+			id: "getCalendar", tag: "notifications", summary: "Get the user's watchlist release calendar",
+			description: "For calendar apps, which cannot send headers, so the token identifies the user.",
+			params: []openapi.Parameter{
+				required(queryParam("token", "Calendar token", nil, openapi.String())),
+				queryParam("region", "ISO 3166-1 country code for release dates, the notification region by default", nil, openapi.String()),
+			},
+			response: openapi.String(), contentType: "text/calendar",
+			errors: []int{http.StatusUnauthorized, http.StatusNotFound}},
+		route{method: "GET", path: "/calendar/upcoming.ics", handler: r.handleUpcomingCalendar,
+			id: "getUpcomingCalendar", tag: "notifications", summary: "Get a calendar of upcoming releases",
+			description: "TMDB discover filters such as with_genres, with_keywords or with_original_language are passed on to TMDB; others are refused.",
+			params: []openapi.Parameter{
+				queryParam("type", "movie or tv, movie by default", nil, enum("movie", "tv")),
+				region,
+			},
+			response: openapi.String(), contentType: "text/calendar", errors: []int{http.StatusBadRequest}},
+		route{method: "GET", path: "/feeds/{file}", handler: r.handleFeed,
+			id: "getFeed", tag: "notifications", summary: "Get a list as an Atom or RSS feed",
+			description: "The diary feed takes the calendar token to identify the user.",
+			params: []openapi.Parameter{
+				pathParam("file", "The list and the feed format", "trending.atom",
+					enum("trending.atom", "trending.rss", "upcoming.atom", "upcoming.rss", "diary.atom", "diary.rss")),
+				queryParam("time_window", "day or week, for trending", nil, enum("day", "week")),
+				mediaType,
+				queryParam("region", "ISO 3166-1 country code, for upcoming", nil, openapi.String()),
+				queryParam("token", "Calendar token, for diary", nil, openapi.String()),
+			},
+			response: openapi.String(), contentType: "application/atom+xml",
+			errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound}},
+
+		route{method: "GET", path: "/status", handler: r.handleStatus,
+			id: "getStatus", tag: "service", summary: "Get the server's readiness and upstream health",
+			response: &serverStatus{}},
+		route{method: "GET", path: "/openapi.json", handler: r.handleOpenAPI, v1Only: true,
+			id: "getOpenAPI", tag: "service", summary: "Get this document",
+			response: &openapi.Schema{Type: openapi.Types{"object"}}},
+		route{method: "GET", path: "/docs", handler: r.handleAPIDocs, v1Only: true,
+			id: "getAPIDocs", tag: "service", summary: "Browse and try out this document",
+			response: openapi.String(), contentType: "text/html"},
+	)
+	return routes
+}
+
+// register serves the routes under both prefixes, and the rest of the
+// server's endpoints
+func (r *Router) register(mux *http.ServeMux, routes []route) {
+	for _, rt := range routes {
+		var h http.Handler = rt.handler
+		if rt.user {
+			h = ValidUserID()(h)
+		}
+		r.handle(mux, rt.method+" "+apiVersion+rt.path, h)
+		if !rt.v1Only {
+			r.handle(mux, rt.method+" /api"+rt.path, h)
+		}
+	}
+}
+
+// handle registers h on mux, keeping track of the patterns so tests can
+// check them against the OpenAPI document
+func (r *Router) handle(mux *http.ServeMux, pattern string, h http.Handler) {
+	mux.Handle(pattern, h)
+	r.patterns = append(r.patterns, pattern)
+}
+
+func pathParam(name, description string, example interface{}, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: schema, Example: example}
+}
+
+func queryParam(name, description string, example interface{}, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema, Example: example}
+}
+
+func required(p openapi.Parameter) openapi.Parameter {
+	p.Required = true
+	return p
+}
+
+func importID() openapi.Parameter {
+	return pathParam("id", "Import ID", nil, openapi.String())
+}
+
+func roomIDParam() openapi.Parameter {
+	return pathParam("id", "Room ID", nil, openapi.String())
+}
+
+func enum(values ...string) *openapi.Schema {
+	return &openapi.Schema{Type: openapi.Types{"string"}, Enum: values}
+}
+
+func binary() *openapi.Schema {
+	return &openapi.Schema{Type: openapi.Types{"string"}, Format: "binary"}
+}
+
+func importForm() *openapi.Schema {
+	return &openapi.Schema{
+		Type: openapi.Types{"object"},
+		Properties: map[string]*openapi.Schema{
+			"source": enum(importer.SourceLetterboxd, importer.SourceIMDb, importer.SourceTrakt),
+			"kind":   enum(importer.KindWatched, importer.KindRatings, importer.KindDiary, importer.KindWatchlist),
+			"file":   binary(),
+		},
+		Required: []string{"source", "file"},
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+// addToWatchlistRequest names a title to add. MediaType is movie when
+// empty.
+type addToWatchlistRequest struct {
+	ID        int    `json:"id"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+func (r *Router) handleWatchlist(w http.ResponseWriter, req *http.Request) {
+	library, err := r.store.Library(userID(req))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	watchlist := library.Watchlist
+	if watchlist == nil {
+		watchlist = []models.WatchlistItem{}
+	}
+	r.writeJSON(w, req, watchlist)
+}
+
+// handleAddToWatchlist looks the title up and adds it to the watchlist,
+// answering 201 with the new item, or 200 with the item already there
+func (r *Router) handleAddToWatchlist(w http.ResponseWriter, req *http.Request) {
+	var body addToWatchlistRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if body.MediaType == "" {
+		body.MediaType = "movie"
+	}
+	if body.MediaType != "movie" && body.MediaType != "tv" {
+		http.Error(w, "media_type must be 'movie' or 'tv'", http.StatusBadRequest)
+		return
+	}
+	if body.ID < 1 || body.ID > 999999999 {
+		http.Error(w, "id must be a TMDB ID", http.StatusBadRequest)
+		return
+	}
+
+	item, err := r.movieService.WatchlistItem(req.Context(), body.MediaType, strconv.Itoa(body.ID))
+	if err != nil {
+		r.writeServiceError(w, req, err)
+		return
+	}
+	item.AddedDate = r.now().Format("2006-01-02")
+
+	saved, added, err := r.store.AddToWatchlist(userID(req), *item)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if added {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+	}
+	r.writeJSON(w, req, saved)
+}
+
+func (r *Router) handleRemoveFromWatchlist(w http.ResponseWriter, req *http.Request) {
+	mediaType := req.PathValue("type")
+	if mediaType != "movie" && mediaType != "tv" {
+		http.Error(w, "Type must be movie or tv", http.StatusBadRequest)
+		return
+	}
+	id, ok := pathID(w, req, "id")
+	if !ok {
+		return
+	}
+	n, _ := strconv.Atoi(id)
+
+	err := r.store.RemoveFromWatchlist(userID(req), mediaType, n)
+	if errors.Is(err, storage.ErrNotOnWatchlist) {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
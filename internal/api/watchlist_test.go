@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWatchlistHandlers(t *testing.T) {
+	router, _ := newTestRouter(t)
+	alice := map[string]string{"X-User-ID": "alice"}
+	bob := map[string]string{"X-User-ID": "bob"}
+
+	runHandlerTests(t, router, []handlerTest{
+		{name: "empty", target: "/api/watchlist", header: alice, status: http.StatusOK, contentType: "application/json", want: "[]"},
+
+		{name: "add movie", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{"id":550}`, status: http.StatusCreated,
+			want: `{"id":550,"title":"Fight Club","poster_path":"https://image.test/t/p/w500/fake550.jpg","release_date":"1999-10-15"`},
+		{name: "add movie again", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{"id":550,"media_type":"movie"}`, status: http.StatusOK, want: `"added_date":"2026-10-01"`},
+		{name: "add show", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{"id":1396,"media_type":"tv"}`, status: http.StatusCreated, want: `"title":"Breaking Bad"`},
+		{name: "list", target: "/api/watchlist", header: alice, status: http.StatusOK, want: `"imdb_id":"tt0903747"}]`},
+		{name: "other user", target: "/api/watchlist", header: bob, status: http.StatusOK, want: "[]"},
+
+		{name: "add unknown", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{"id":999}`, status: http.StatusNotFound},
+		{name: "add person", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{"id":287,"media_type":"person"}`, status: http.StatusBadRequest, want: "media_type must be"},
+		{name: "add no id", method: http.MethodPost, target: "/api/watchlist", header: alice, body: `{}`, status: http.StatusBadRequest, want: "id must be a TMDB ID"},
+		{name: "add bad JSON", method: http.MethodPost, target: "/api/watchlist", header: alice, body: "{", status: http.StatusBadRequest, want: "Invalid JSON body"},
+
+		{name: "remove movie", method: http.MethodDelete, target: "/api/watchlist/movie/550", header: alice, status: http.StatusNoContent},
+		{name: "remove again", method: http.MethodDelete, target: "/api/watchlist/movie/550", header: alice, status: http.StatusNotFound},
+		{name: "remove show as movie", method: http.MethodDelete, target: "/api/watchlist/movie/1396", header: alice, status: http.StatusNotFound},
+		{name: "after remove", target: "/api/watchlist", header: alice, status: http.StatusOK, want: `[{"id":1396,`},
+		{name: "remove person", method: http.MethodDelete, target: "/api/watchlist/person/287", header: alice, status: http.StatusBadRequest},
+		{name: "remove bad id", method: http.MethodDelete, target: "/api/watchlist/tv/abc", header: alice, status: http.StatusBadRequest},
+		{name: "watchlist put", method: http.MethodPut, target: "/api/watchlist", status: http.StatusMethodNotAllowed, allow: "GET, HEAD, POST"},
+	})
+}
@@ -0,0 +1,181 @@
+// Package assets serves the web UI: static files under content-hash
+// fingerprinted URLs that can be cached forever, and the page templates.
+// In dev mode both are read from disk again on every request, so edits show
+// up on reload without restarting the server.
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Static serves files from an fs.FS. Each file is available under its own
+// name and under a fingerprinted one, e.g. css/styles.3f2a1b9c0d4e.css,
+// which changes whenever the content does.
+type Static struct {
+	fsys fs.FS
+	dev  bool
+
+	mu      sync.RWMutex
+	entries map[string]entry
+	// fingerprinted maps fingerprinted names back to file names
+	fingerprinted map[string]string
+}
+
+type entry struct {
+	hash    string
+	modTime time.Time
+}
+
+// NewStatic indexes every file in fsys. Files that cannot be read are
+// served without a fingerprint.
+func NewStatic(fsys fs.FS, dev bool) *Static {
+	s := &Static{fsys: fsys, dev: dev}
+	s.index()
+	return s
+}
+
+func (s *Static) index() {
+	entries := make(map[string]entry)
+	fingerprinted := make(map[string]string)
+
+	fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(s.fsys, name)
+		if err != nil {
+			return nil
+		}
+		var modTime time.Time
+		if info, err := d.Info(); err == nil {
+			modTime = info.ModTime()
+		}
+
+		sum := sha256.Sum256(data)
+		e := entry{hash: hex.EncodeToString(sum[:6]), modTime: modTime}
+		entries[name] = e
+		fingerprinted[fingerprint(name, e.hash)] = name
+		return nil
+	})
+
+	s.mu.Lock()
+	s.entries, s.fingerprinted = entries, fingerprinted
+	s.mu.Unlock()
+}
+
+// fingerprint puts hash before the file's extension
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// URL returns the fingerprinted URL of a file, e.g. "css/styles.css" gives
+// "/static/css/styles.3f2a1b9c0d4e.css". Unknown files keep their name.
+func (s *Static) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if s.dev {
+		s.index()
+	}
+
+	s.mu.RLock()
+	e, ok := s.entries[name]
+	s.mu.RUnlock()
+	if !ok {
+		return "/static/" + name
+	}
+	return "/static/" + fingerprint(name, e.hash)
+}
+
+// ServeHTTP serves the file named by the request path, which must have the
+// /static/ prefix stripped already
+func (s *Static) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(req.URL.Path, "/")
+	if !fs.ValidPath(name) {
+		http.NotFound(w, req)
+		return
+	}
+	if s.dev {
+		s.index()
+	}
+
+	s.mu.RLock()
+	file, immutable := s.fingerprinted[name]
+	if !immutable {
+		file = name
+	}
+	e, ok := s.entries[file]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	data, err := fs.ReadFile(s.fsys, file)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	// A fingerprinted URL always has the same content. Plain names are
+	// revalidated with the ETag so a deploy is picked up straight away.
+	switch {
+	case s.dev:
+		w.Header().Set("Cache-Control", "no-cache")
+	case immutable:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+	w.Header().Set("ETag", `"`+e.hash+`"`)
+	http.ServeContent(w, req, file, e.modTime, bytes.NewReader(data))
+}
+
+// Templates parses the page templates once, or on every call in dev mode.
+// Templates can call {{asset "css/styles.css"}} for a fingerprinted URL.
+type Templates struct {
+	fsys  fs.FS
+	funcs template.FuncMap
+	dev   bool
+
+	tmpl *template.Template
+	err  error
+}
+
+// NewTemplates parses the .html files at the top of fsys
+func NewTemplates(fsys fs.FS, static *Static, dev bool) *Templates {
+	t := &Templates{
+		fsys:  fsys,
+		funcs: template.FuncMap{"asset": static.URL},
+		dev:   dev,
+	}
+	if !dev {
+		t.tmpl, t.err = t.parse()
+	}
+	return t
+}
+
+func (t *Templates) parse() (*template.Template, error) {
+	return template.New("").Funcs(t.funcs).ParseFS(t.fsys, "*.html")
+}
+
+// Get returns the parsed templates, or why they could not be parsed
+func (t *Templates) Get() (*template.Template, error) {
+	if t.dev {
+		return t.parse()
+	}
+	return t.tmpl, t.err
+}
@@ -0,0 +1,405 @@
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/ical"
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/internal/tracing"
+	"movie-discovery-app/pkg/models"
+)
+
+const (
+	// Calendar apps poll feeds often, so generated feeds are reused for a while
+	cacheTTL = time.Hour
+	// Events this far in the past are still included so a feed is not empty
+	// the day after something airs
+	lookBehind = 30 * 24 * time.Hour
+	lookAhead  = 365 * 24 * time.Hour
+	// discoverPages caps how many pages of a discover query become events
+	discoverPages = 3
+	// maxCachedFeeds bounds the cache, as every distinct query is a feed
+	maxCachedFeeds = 1000
+)
+
+// Release types shown in the feed, see models.ReleaseDate
+var releaseLabels = map[int]string{
+	3: "in cinemas",
+	4: "digital release",
+}
+
+// Token maps a secret calendar URL token to its user
+type Token struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Feeds builds iCalendar feeds of upcoming releases and episode airings
+type Feeds struct {
+	store        *storage.Store
+	movieService *services.MovieService
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedFeed
+}
+
+type cachedFeed struct {
+	calendar *ical.Calendar
+	built    time.Time
+}
+
+func NewFeeds(store *storage.Store, movieService *services.MovieService) *Feeds {
+	return &Feeds{
+		store:        store,
+		movieService: movieService,
+		now:          time.Now,
+		cache:        make(map[string]cachedFeed),
+	}
+}
+
+// SetClock replaces time.Now, so tests can pin the release window
+func (f *Feeds) SetClock(now func() time.Time) {
+	f.now = now
+}
+
+// UserToken returns the user's calendar token, creating one on first use.
+// With rotate set a new token replaces the old one, which stops working.
+func (f *Feeds) UserToken(userID string, rotate bool) (*Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var current Token
+	err := f.store.Load("calendar_users", userID, &current)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && !rotate {
+		return &current, nil
+	}
+
+	if current.Token != "" {
+		if err := f.store.Delete("calendar_tokens", current.Token); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := &Token{Token: hex.EncodeToString(b), UserID: userID, CreatedAt: f.now().UTC()}
+
+	if err := f.store.Save("calendar_tokens", token.Token, token); err != nil {
+		return nil, err
+	}
+	if err := f.store.Save("calendar_users", userID, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// LookupToken returns the user a calendar token belongs to
+func (f *Feeds) LookupToken(token string) (string, error) {
+	if !storage.ValidID(token) {
+		return "", storage.ErrNotFound
+	}
+	var t Token
+	if err := f.store.Load("calendar_tokens", token, &t); err != nil {
+		return "", err
+	}
+	return t.UserID, nil
+}
+
+// UserFeed builds the calendar of a user's watchlist: release dates of
+// watchlisted movies in the region and upcoming episodes of followed shows
+func (f *Feeds) UserFeed(ctx context.Context, token, region string) (*ical.Calendar, error) {
+	userID, err := f.LookupToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token is a secret, and keys end up in traces, so only a hash of it is used
+	sum := sha256.Sum256([]byte(token))
+	key := "user/" + hex.EncodeToString(sum[:8]) + "/" + region
+	if calendar := f.cached(ctx, key); calendar != nil {
+		return calendar, nil
+	}
+
+	library, err := f.store.Library(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &ical.Calendar{Name: "Watchlist releases"}
+	for _, item := range library.Watchlist {
+		if item.Watched {
+			continue
+		}
+
+		var events []ical.Event
+		var err error
+		if item.MediaType == "tv" {
+			events, err = f.showEvents(ctx, item)
+		} else {
+			events, err = f.movieEvents(ctx, item, region)
+		}
+		if err != nil {
+			// One title failing to load should not take the whole feed down
+			continue
+		}
+		calendar.Events = append(calendar.Events, events...)
+	}
+
+	f.remember(key, calendar)
+	return calendar, nil
+}
+
+// DiscoverFeed builds a public calendar of upcoming titles matching TMDB
+// discover filters such as with_genres or with_original_language
+func (f *Feeds) DiscoverFeed(ctx context.Context, mediaType string, filters url.Values) (*ical.Calendar, error) {
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	key := "discover/" + mediaType + "?" + filters.Encode()
+	if calendar := f.cached(ctx, key); calendar != nil {
+		return calendar, nil
+	}
+
+	today := f.today().Format("2006-01-02")
+	query := url.Values{}
+	for k, v := range filters {
+		query[k] = v
+	}
+	if mediaType == "tv" {
+		query.Set("first_air_date.gte", today)
+		query.Set("sort_by", "first_air_date.asc")
+	} else {
+		query.Set("primary_release_date.gte", today)
+		query.Set("sort_by", "primary_release_date.asc")
+	}
+
+	calendar := &ical.Calendar{Name: "Upcoming releases"}
+	for page := 1; page <= discoverPages; page++ {
+		results, err := f.movieService.Discover(ctx, mediaType, query, strconv.Itoa(page))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, media := range results.Results {
+			if event, ok := f.mediaEvent(mediaType, media); ok {
+				calendar.Events = append(calendar.Events, event)
+			}
+		}
+
+		if page >= results.TotalPages {
+			break
+		}
+	}
+
+	f.remember(key, calendar)
+	return calendar, nil
+}
+
+func (f *Feeds) movieEvents(ctx context.Context, item models.WatchlistItem, region string) ([]ical.Event, error) {
+	releaseDates, err := f.movieService.GetReleaseDates(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ical.Event
+	seen := make(map[int]bool)
+	for _, country := range releaseDates.Results {
+		if country.ISO31661 != region {
+			continue
+		}
+		for _, release := range country.ReleaseDates {
+			label, ok := releaseLabels[release.Type]
+			if !ok || seen[release.Type] || len(release.ReleaseDate) < 10 {
+				continue
+			}
+			date, ok := f.inWindow(release.ReleaseDate[:10])
+			if !ok {
+				continue
+			}
+			seen[release.Type] = true
+
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("movie-%d-%s-%d@movie-discovery-app", item.ID, region, release.Type),
+				Summary:     fmt.Sprintf("%s (%s)", item.Title, label),
+				Description: item.Overview,
+				URL:         fmt.Sprintf("https://www.themoviedb.org/movie/%d", item.ID),
+				Start:       date,
+				AllDay:      true,
+				Stamp:       f.now(),
+			})
+		}
+	}
+
+	// Fall back to the primary release date when the region has no dates
+	if len(events) == 0 {
+		if date, ok := f.inWindow(item.ReleaseDate); ok {
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("movie-%d@movie-discovery-app", item.ID),
+				Summary:     item.Title,
+				Description: item.Overview,
+				URL:         fmt.Sprintf("https://www.themoviedb.org/movie/%d", item.ID),
+				Start:       date,
+				AllDay:      true,
+				Stamp:       f.now(),
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// showEvents lists the episodes of the current and next season that air
+// within the feed's window
+func (f *Feeds) showEvents(ctx context.Context, item models.WatchlistItem) ([]ical.Event, error) {
+	show, err := f.movieService.GetTVSchedule(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	title := show.Name
+	if title == "" {
+		title = item.Title
+	}
+
+	seasons := make(map[int]bool)
+	for _, episode := range []*models.Episode{show.LastEpisodeToAir, show.NextEpisodeToAir} {
+		if episode != nil {
+			seasons[episode.SeasonNumber] = true
+		}
+	}
+	for _, season := range show.Seasons {
+		if _, ok := f.inWindow(season.AirDate); ok && season.SeasonNumber > 0 {
+			seasons[season.SeasonNumber] = true
+		}
+	}
+
+	var events []ical.Event
+	for number := range seasons {
+		season, err := f.movieService.GetSeason(ctx, strconv.Itoa(item.ID), number)
+		if err != nil {
+			return nil, err
+		}
+		for _, episode := range season.Episodes {
+			date, ok := f.inWindow(episode.AirDate)
+			if !ok {
+				continue
+			}
+			summary := fmt.Sprintf("%s S%02dE%02d", title, episode.SeasonNumber, episode.EpisodeNumber)
+			if episode.Name != "" {
+				summary += " - " + episode.Name
+			}
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("tv-%d-s%de%d@movie-discovery-app", item.ID, episode.SeasonNumber, episode.EpisodeNumber),
+				Summary:     summary,
+				Description: episode.Overview,
+				URL:         fmt.Sprintf("https://www.themoviedb.org/tv/%d/season/%d/episode/%d", item.ID, episode.SeasonNumber, episode.EpisodeNumber),
+				Start:       date,
+				AllDay:      true,
+				Stamp:       f.now(),
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// mediaEvent turns a discover result into an event. Discover results do not
+// carry a media type, so the caller passes the one it asked for.
+func (f *Feeds) mediaEvent(mediaType string, media models.Media) (ical.Event, bool) {
+	title, date := media.Title, media.ReleaseDate
+	if mediaType == "tv" {
+		title, date = media.Name, media.FirstAirDate
+	}
+
+	start, ok := f.inWindow(date)
+	if !ok {
+		return ical.Event{}, false
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("%s-%d@movie-discovery-app", mediaType, media.ID),
+		Summary:     title,
+		Description: media.Overview,
+		URL:         fmt.Sprintf("https://www.themoviedb.org/%s/%d", mediaType, media.ID),
+		Start:       start,
+		AllDay:      true,
+		Stamp:       f.now(),
+	}, true
+}
+
+// inWindow parses a YYYY-MM-DD date and reports whether the feed covers it
+func (f *Feeds) inWindow(date string) (time.Time, bool) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, false
+	}
+	today := f.today()
+	return day, !day.Before(today.Add(-lookBehind)) && !day.After(today.Add(lookAhead))
+}
+
+func (f *Feeds) today() time.Time {
+	now := f.now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func (f *Feeds) cached(ctx context.Context, key string) *ical.Calendar {
+	_, span := tracing.Start(ctx, "cache.lookup", tracing.WithAttributes(
+		tracing.String("cache.name", "calendar"),
+		tracing.String("cache.key", key),
+	))
+	defer span.End()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c, ok := f.cache[key]; ok && f.now().Sub(c.built) < cacheTTL {
+		metrics.CacheLookup("calendar", true)
+		span.SetAttributes(tracing.Bool("cache.hit", true))
+		return c.calendar
+	}
+	metrics.CacheLookup("calendar", false)
+	span.SetAttributes(tracing.Bool("cache.hit", false))
+	return nil
+}
+
+func (f *Feeds) remember(key string, calendar *ical.Calendar) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	for k, c := range f.cache {
+		if now.Sub(c.built) >= cacheTTL {
+			delete(f.cache, k)
+		}
+	}
+	if len(f.cache) >= maxCachedFeeds {
+		// Still full of fresh feeds, so make room by dropping the oldest
+		oldest := ""
+		for k, c := range f.cache {
+			if oldest == "" || c.built.Before(f.cache[oldest].built) {
+				oldest = k
+			}
+		}
+		delete(f.cache, oldest)
+	}
+	f.cache[key] = cachedFeed{calendar: calendar, built: now}
+}
@@ -0,0 +1,67 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"movie-discovery-app/internal/ical"
+	"movie-discovery-app/internal/storage"
+)
+
+func TestCacheBounded(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFeeds(nil, nil)
+	f.SetClock(func() time.Time { return now })
+
+	f.remember("stale", &ical.Calendar{})
+	now = now.Add(cacheTTL)
+	for i := 0; i < maxCachedFeeds+10; i++ {
+		now = now.Add(time.Second)
+		f.remember(fmt.Sprintf("discover/movie?with_keywords=%d", i), &ical.Calendar{})
+	}
+
+	if len(f.cache) != maxCachedFeeds {
+		t.Errorf("cache has %d feeds, want %d", len(f.cache), maxCachedFeeds)
+	}
+	if _, ok := f.cache["stale"]; ok {
+		t.Error("expired feed kept")
+	}
+	if f.cached(context.Background(), "discover/movie?with_keywords=0") != nil {
+		t.Error("oldest feed kept")
+	}
+	if f.cached(context.Background(), fmt.Sprintf("discover/movie?with_keywords=%d", maxCachedFeeds+9)) == nil {
+		t.Error("newest feed evicted")
+	}
+}
+
+func TestLookupMalformedToken(t *testing.T) {
+	f := NewFeeds(nil, nil)
+	if _, err := f.LookupToken("../libraries/alice"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("error = %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+// Cache keys are recorded on trace spans, so they must not hold the token
+func TestUserFeedCacheKeyHidesToken(t *testing.T) {
+	f := NewFeeds(storage.NewStore(t.TempDir()), nil)
+	token, err := f.UserToken("alice", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.UserFeed(context.Background(), token.Token, "GB"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(f.cache) != 1 {
+		t.Fatalf("cache has %d feeds, want 1", len(f.cache))
+	}
+	for key := range f.cache {
+		if strings.Contains(key, token.Token) || !strings.HasPrefix(key, "user/") || !strings.HasSuffix(key, "/GB") {
+			t.Errorf("cache key %q", key)
+		}
+	}
+}
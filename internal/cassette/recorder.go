@@ -0,0 +1,173 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Mode says whether a Recorder calls the network
+type Mode int
+
+const (
+	// Replay answers from the cassette and never calls the network
+	Replay Mode = iota
+	// Record sends requests on and adds them to the cassette
+	Record
+)
+
+func (m Mode) String() string {
+	if m == Record {
+		return "record"
+	}
+	return "replay"
+}
+
+// ParseMode reads "record" or "replay"
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "record":
+		return Record, nil
+	case "replay", "":
+		return Replay, nil
+	}
+	return Replay, fmt.Errorf("unknown cassette mode %q", s)
+}
+
+// ErrNotRecorded is returned in replay mode for a request the cassette does
+// not have
+var ErrNotRecorded = errors.New("cassette: request not recorded")
+
+// Recorder is an http.RoundTripper that records to or replays from a
+// cassette file
+type Recorder struct {
+	path string
+	mode Mode
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	// played counts the replays of each request, so a request made
+	// several times gets its recorded responses in order
+	played map[string]int
+}
+
+// New returns a Recorder for the cassette at path. In replay mode the file
+// must exist. In record mode it is started afresh and written by Save, and
+// requests go through next, or http.DefaultTransport when nil.
+func New(path string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	r := &Recorder{path: path, mode: mode, next: next, played: make(map[string]int)}
+	if mode == Record {
+		r.cassette = &Cassette{Interactions: []Interaction{}}
+		return r, nil
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	r.cassette = c
+	return r, nil
+}
+
+// RoundTrip records or replays req
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == Record {
+		return r.record(req)
+	}
+	return r.replay(req)
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  Request{Method: req.Method, URL: Sanitize(req.URL)},
+		Response: newResponse(resp, body),
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	key := matchKey(req.Method, Sanitize(req.URL))
+
+	r.mu.Lock()
+	var matches []Interaction
+	for _, in := range r.cassette.Interactions {
+		if matchKey(in.Request.Method, in.Request.URL) == key {
+			matches = append(matches, in)
+		}
+	}
+	n := r.played[key]
+	r.played[key]++
+	r.mu.Unlock()
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, req.Method, Sanitize(req.URL))
+	}
+	// Once every recorded response was played, the last one is repeated
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	recorded := matches[n].Response
+
+	body := recorded.Body()
+	resp := &http.Response{
+		Status:        strconv.Itoa(recorded.Status) + " " + http.StatusText(recorded.Status),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+	for name, value := range recorded.Headers {
+		resp.Header.Set(name, value)
+	}
+	return resp, nil
+}
+
+// Cassette returns what was recorded or loaded so far
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := *r.cassette
+	c.Interactions = append([]Interaction(nil), c.Interactions...)
+	return &c
+}
+
+// Save writes the recorded interactions to the cassette file. It does
+// nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != Record {
+		return nil
+	}
+	return r.Cassette().Save(r.path)
+}
+
+// ModeFromEnv reads the mode from CASSETTE_MODE, so tests replay by default
+// and record with CASSETTE_MODE=record
+func ModeFromEnv() (Mode, error) {
+	return ParseMode(os.Getenv("CASSETTE_MODE"))
+}
@@ -0,0 +1,132 @@
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change is a difference between the shapes of two JSON documents
+type Change struct {
+	// Path is the field's location, with [] for array elements, e.g.
+	// credits.cast[].character
+	Path string
+	// Old and New are the field's JSON types, empty when it is missing
+	Old, New string
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("added %s (%s)", c.Path, c.New)
+	case c.New == "":
+		return fmt.Sprintf("removed %s (%s)", c.Path, c.Old)
+	}
+	return fmt.Sprintf("changed %s from %s to %s", c.Path, c.Old, c.New)
+}
+
+// SchemaDiff compares the fields and types of two JSON documents, ignoring
+// their values. Array elements are merged into one shape, and null is
+// taken to match any type since TMDB sends null for missing values. An
+// empty array says nothing about its elements, so they are not compared
+// when either side's array is empty.
+func SchemaDiff(old, new []byte) ([]Change, error) {
+	var oldDoc, newDoc interface{}
+	if err := json.Unmarshal(old, &oldDoc); err != nil {
+		return nil, fmt.Errorf("old: %w", err)
+	}
+	if err := json.Unmarshal(new, &newDoc); err != nil {
+		return nil, fmt.Errorf("new: %w", err)
+	}
+
+	oldShape, newShape := make(map[string]string), make(map[string]string)
+	oldElems, newElems := make(map[string]int), make(map[string]int)
+	shape(oldDoc, "", oldShape, oldElems)
+	shape(newDoc, "", newShape, newElems)
+
+	unknown := func(path string) bool {
+		return emptyArray(path, oldElems) || emptyArray(path, newElems)
+	}
+	var changes []Change
+	for path, oldType := range oldShape {
+		newType, ok := newShape[path]
+		if ok && (oldType == "null" || newType == "null") {
+			continue
+		}
+		if newType != oldType && !unknown(path) {
+			changes = append(changes, Change{Path: path, Old: oldType, New: newType})
+		}
+	}
+	for path, newType := range newShape {
+		if _, ok := oldShape[path]; !ok && !unknown(path) {
+			changes = append(changes, Change{Path: path, New: newType})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// emptyArray reports whether path is inside an array that is present in
+// the document but never has any elements
+func emptyArray(path string, elems map[string]int) bool {
+	for i := 0; ; i += len("[]") {
+		j := strings.Index(path[i:], "[]")
+		if j == -1 {
+			return false
+		}
+		i += j
+		name := path[:i]
+		if name == "" {
+			name = "."
+		}
+		if n, ok := elems[name]; ok && n == 0 {
+			return true
+		}
+	}
+}
+
+// shape adds the type of v and everything inside it to types, by path, and
+// counts the elements of each array in elems
+func shape(v interface{}, path string, types map[string]string, elems map[string]int) {
+	name := path
+	if name == "" {
+		name = "."
+	}
+
+	var t string
+	switch v := v.(type) {
+	case nil:
+		if _, ok := types[name]; !ok {
+			types[name] = "null"
+		}
+		return
+	case map[string]interface{}:
+		t = "object"
+		for key, child := range v {
+			if path == "" {
+				shape(child, key, types, elems)
+			} else {
+				shape(child, path+"."+key, types, elems)
+			}
+		}
+	case []interface{}:
+		t = "array"
+		elems[name] += len(v)
+		for _, child := range v {
+			shape(child, path+"[]", types, elems)
+		}
+	case string:
+		t = "string"
+	case float64:
+		t = "number"
+	case bool:
+		t = "boolean"
+	}
+
+	// An array whose elements differ in type is recorded as mixed
+	if seen, ok := types[name]; ok && seen != t && seen != "null" {
+		t = "mixed"
+	}
+	types[name] = t
+}
@@ -0,0 +1,433 @@
+// Package config loads the server's settings. Values are read from, in
+// increasing order of precedence:
+//
+//  1. the defaults in the Config struct tags
+//  2. a YAML or TOML config file (--config)
+//  3. a .env file (--env-file, configs/.env by default)
+//  4. environment variables
+//  5. command-line flags such as --port
+//
+// Each setting has a dotted key used in config files, e.g. server.port, and
+// an environment variable, e.g. PORT.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds every setting of the server
+type Config struct {
+	Server  Server  `key:"server"`
+	TMDB    TMDB    `key:"tmdb"`
+	OMDB    OMDB    `key:"omdb"`
+	Storage Storage `key:"storage"`
+	Web     Web     `key:"web"`
+	Log     Log     `key:"log"`
+	Notify  Notify  `key:"notify"`
+	Tracing Tracing `key:"tracing"`
+}
+
+type Server struct {
+	Port int `key:"port" env:"PORT" default:"8080"`
+	// TrustedProxies are the IPs and CIDR ranges of reverse proxies allowed
+	// to set X-Forwarded-For
+	TrustedProxies  []string      `key:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	TLSCertFile     string        `key:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile      string        `key:"tls_key_file" env:"TLS_KEY_FILE"`
+}
+
+type TMDB struct {
+	APIKey       string `key:"api_key" env:"TMDB_API_KEY" secret:"true"`
+	BaseURL      string `key:"base_url" env:"TMDB_BASE_URL" default:"https://api.themoviedb.org/3"`
+	ImageBaseURL string `key:"image_base_url" env:"TMDB_IMAGE_BASE_URL" default:"https://image.tmdb.org/t/p/w500"`
+	// Demo serves a bundled fictional catalogue instead of calling TMDB and
+	// OMDB. It is also used when no API key is set.
+	Demo bool `key:"demo" env:"DEMO_MODE"`
+}
+
+type OMDB struct {
+	APIKey     string `key:"api_key" env:"OMDB_API_KEY" secret:"true"`
+	BaseURL    string `key:"base_url" env:"OMDB_BASE_URL" default:"http://www.omdbapi.com"`
+	DailyLimit int    `key:"daily_limit" env:"OMDB_DAILY_LIMIT" default:"1000"`
+}
+
+type Storage struct {
+	DataDir string `key:"data_dir" env:"DATA_DIR" default:"./data"`
+}
+
+// Web configures the UI. Templates and static files are embedded in the
+// binary, unless Dev is set: then they are read from Dir on every request.
+type Web struct {
+	Dev bool   `key:"dev" env:"DEV_MODE"`
+	Dir string `key:"dir" env:"WEB_DIR" default:"web"`
+}
+
+type Log struct {
+	Level  string `key:"level" env:"LOG_LEVEL" default:"info"`
+	Format string `key:"format" env:"LOG_FORMAT" default:"json"`
+}
+
+type Notify struct {
+	Interval time.Duration `key:"interval" env:"NOTIFY_INTERVAL" default:"1h"`
+	SMTP     SMTP          `key:"smtp"`
+}
+
+// SMTP configures email notifications, which are off while Host is empty
+type SMTP struct {
+	Host     string `key:"host" env:"SMTP_HOST"`
+	Port     string `key:"port" env:"SMTP_PORT" default:"587"`
+	Username string `key:"username" env:"SMTP_USERNAME"`
+	Password string `key:"password" env:"SMTP_PASSWORD" secret:"true"`
+	From     string `key:"from" env:"SMTP_FROM"`
+}
+
+// Tracing uses the standard OpenTelemetry variable names
+type Tracing struct {
+	Endpoint       string `key:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	TracesEndpoint string `key:"traces_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"`
+	// Headers often carry the collector's credentials
+	Headers     string `key:"headers" env:"OTEL_EXPORTER_OTLP_HEADERS" secret:"true"`
+	ServiceName string `key:"service_name" env:"OTEL_SERVICE_NAME" default:"movie-discovery-app"`
+	Sampler     string `key:"sampler" env:"OTEL_TRACES_SAMPLER"`
+	SamplerArg  string `key:"sampler_arg" env:"OTEL_TRACES_SAMPLER_ARG"`
+}
+
+// Sources tells Load where to read settings from
+type Sources struct {
+	// File is a YAML (.yaml, .yml) or TOML (.toml) config file, optional
+	File string
+	// EnvFile is a .env file. It is skipped when missing unless
+	// RequireEnvFile is set.
+	EnvFile        string
+	RequireEnvFile bool
+	// Environ lists KEY=value pairs, os.Environ() when nil
+	Environ []string
+	// Overrides take precedence over everything else and are keyed by
+	// dotted key, e.g. "server.port" for the --port flag
+	Overrides map[string]string
+}
+
+// Load reads and validates the configuration
+func Load(src Sources) (*Config, error) {
+	cfg := &Config{}
+	fields := cfg.fields()
+
+	for _, f := range fields {
+		if f.def == "" {
+			continue
+		}
+		if err := f.set(f.def); err != nil {
+			return nil, fmt.Errorf("invalid default for %s: %w", f.key, err)
+		}
+	}
+
+	if src.File != "" {
+		values, err := readFile(src.File)
+		if err != nil {
+			return nil, err
+		}
+		byKey := make(map[string]field, len(fields))
+		for _, f := range fields {
+			byKey[f.key] = f
+		}
+		for key, value := range values {
+			f, ok := byKey[key]
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown setting %q", src.File, key)
+			}
+			if err := f.set(value); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", src.File, key, err)
+			}
+		}
+	}
+
+	if src.EnvFile != "" {
+		values, err := ReadEnvFile(src.EnvFile)
+		if errors.Is(err, os.ErrNotExist) && !src.RequireEnvFile {
+			values, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := applyEnv(fields, values); err != nil {
+			return nil, fmt.Errorf("%s: %w", src.EnvFile, err)
+		}
+	}
+
+	environ := src.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	env := make(map[string]string, len(environ))
+	for _, pair := range environ {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			env[key] = value
+		}
+	}
+	if err := applyEnv(fields, env); err != nil {
+		return nil, err
+	}
+
+	for _, f := range fields {
+		if value, ok := src.Overrides[f.key]; ok {
+			if err := f.set(value); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.key, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv sets fields from environment variables. Empty values are ignored
+// so a blank line in .env keeps the default.
+func applyEnv(fields []field, env map[string]string) error {
+	for _, f := range fields {
+		value, ok := env[f.env]
+		if !ok || value == "" {
+			continue
+		}
+		if err := f.set(value); err != nil {
+			return fmt.Errorf("%s: %w", f.env, err)
+		}
+	}
+	return nil
+}
+
+func readFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err := parseYAML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return values, nil
+	case ".toml":
+		values, err := parseTOML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%s: config files must be .yaml, .yml or .toml", path)
+}
+
+// Validate checks that settings make sense together, reporting every
+// problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", c.describe(key), fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			invalid("server.trusted_proxies", "%q is not an IP address or CIDR range", proxy)
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		invalid("server.shutdown_timeout", "must be positive")
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		invalid("server.tls_cert_file", "the TLS certificate and key must be set together")
+	}
+
+	for _, key := range []string{"tmdb.base_url", "tmdb.image_base_url", "omdb.base_url"} {
+		if err := checkURL(c.lookup(key).String()); err != nil {
+			invalid(key, "%v", err)
+		}
+	}
+	if c.OMDB.DailyLimit < 1 {
+		invalid("omdb.daily_limit", "must be at least 1")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		invalid("log.format", "must be json or text, got %q", c.Log.Format)
+	}
+
+	if c.Notify.Interval <= 0 {
+		invalid("notify.interval", "must be positive")
+	}
+	if c.Notify.SMTP.Host != "" && c.Notify.SMTP.From == "" {
+		invalid("notify.smtp.from", "is required when an SMTP host is set")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+}
+
+func checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	return nil
+}
+
+// describe names a setting by its key and environment variable
+func (c *Config) describe(key string) string {
+	for _, f := range c.fields() {
+		if f.key == key {
+			return key + " (" + f.env + ")"
+		}
+	}
+	return key
+}
+
+func (c *Config) lookup(key string) reflect.Value {
+	for _, f := range c.fields() {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return reflect.Value{}
+}
+
+// String lists every setting as key = value, with secrets redacted
+func (c *Config) String() string {
+	var b strings.Builder
+	for _, f := range c.fields() {
+		fmt.Fprintf(&b, "%s = %s\n", f.key, f.display())
+	}
+	return b.String()
+}
+
+// LogValue logs the configuration as a group, with secrets redacted
+func (c *Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, f := range c.fields() {
+		attrs = append(attrs, slog.String(f.key, f.display()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// field is one setting, found by walking the Config struct
+type field struct {
+	key    string
+	env    string
+	def    string
+	secret bool
+	value  reflect.Value
+}
+
+func (c *Config) fields() []field {
+	return walk(reflect.ValueOf(c).Elem(), "")
+}
+
+func walk(v reflect.Value, prefix string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := prefix + sf.Tag.Get("key")
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, walk(v.Field(i), key+".")...)
+			continue
+		}
+		fields = append(fields, field{
+			key:    key,
+			env:    sf.Tag.Get("env"),
+			def:    sf.Tag.Get("default"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set parses raw, a string or a []string from a config file list, into the field
+func (f field) set(raw interface{}) error {
+	if f.value.Kind() == reflect.Slice {
+		var items []string
+		switch raw := raw.(type) {
+		case []string:
+			items = raw
+		case string:
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		}
+		f.value.Set(reflect.ValueOf(items))
+		return nil
+	}
+
+	s, ok := raw.(string)
+	if !ok {
+		return errors.New("expected a single value, not a list")
+	}
+
+	switch {
+	case f.value.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use values like 30s or 1h", s)
+		}
+		f.value.SetInt(int64(d))
+	case f.value.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		f.value.SetInt(int64(n))
+	case f.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		f.value.SetBool(b)
+	default:
+		f.value.SetString(s)
+	}
+	return nil
+}
+
+func (f field) display() string {
+	if f.secret {
+		if f.value.String() == "" {
+			return ""
+		}
+		return "[redacted]"
+	}
+	if f.value.Kind() == reflect.Slice {
+		return strings.Join(f.value.Interface().([]string), ",")
+	}
+	return fmt.Sprint(f.value.Interface())
+}
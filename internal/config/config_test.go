@@ -0,0 +1,275 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			name: "nested",
+			data: "server:\n  port: 9090\n  shutdown_timeout: 10s\ntmdb:\n  api_key: abc\n",
+			want: map[string]interface{}{"server.port": "9090", "server.shutdown_timeout": "10s", "tmdb.api_key": "abc"},
+		},
+		{
+			name: "quoting",
+			data: "a: \"x # y\\n\"\nb: 'it''s'\nc: ~\nd: 'a#b' # comment\n",
+			want: map[string]interface{}{"a": "x # y\n", "b": "it's", "c": "", "d": "a#b"},
+		},
+		{
+			name: "comments",
+			data: "---\n# heading\nweb: # section\n  dir: site#1 # the # in site#1 is kept\n",
+			want: map[string]interface{}{"web.dir": "site#1"},
+		},
+		{
+			name: "lists",
+			data: "a:\n  - 10.0.0.0/8\n  - '::1'\nb: [x, \"y\", ]\nc:\n",
+			want: map[string]interface{}{"a": []string{"10.0.0.0/8", "::1"}, "b": []string{"x", "y"}},
+		},
+		{name: "tab indent", data: "server:\n\tport: 1\n", err: "line 2: indent with spaces"},
+		{name: "no colon", data: "server\n", err: "line 1: expected key: value"},
+		{name: "no space after colon", data: "url:http://x\n", err: "line 1: expected key: value"},
+		{name: "stray item", data: "- a\n", err: "line 1: list item without a key"},
+		{name: "block scalar", data: "a: |\n", err: "block scalars"},
+		{name: "unterminated list", data: "a: [x, y\n", err: "unterminated list"},
+		{name: "bad double quote", data: "a: \"x\n", err: "invalid quoted value"},
+		{name: "bad single quote", data: "a: 'x\n", err: "invalid quoted value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.data)
+			checkParse(t, got, err, tt.want, tt.err)
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]interface{}
+		err  string
+	}{
+		{
+			name: "tables",
+			data: "[server]\nport = 9090\n\n[notify.smtp]\nhost = \"mail\"\n",
+			want: map[string]interface{}{"server.port": "9090", "notify.smtp.host": "mail"},
+		},
+		{
+			name: "quoting",
+			data: "a = \"x # y\\t\\\"z\\\"\"\nb = 'C:\\path'\nc = 1_000\nd = true\n",
+			want: map[string]interface{}{"a": "x # y\t\"z\"", "b": `C:\path`, "c": "1000", "d": "true"},
+		},
+		{
+			name: "comments",
+			data: "# heading\n[web] # section\ndir = \"site#1\" # comment\n",
+			want: map[string]interface{}{"web.dir": "site#1"},
+		},
+		{
+			name: "arrays",
+			data: "a = [\"10.0.0.0/8\", 'a,b', ]\nb = []\n",
+			want: map[string]interface{}{"a": []string{"10.0.0.0/8", "a,b"}, "b": []string{}},
+		},
+		{name: "array of tables", data: "[[server]]\n", err: "line 1: invalid table header"},
+		{name: "bad table name", data: "[a b]\n", err: "invalid table name"},
+		{name: "no equals", data: "port 80\n", err: "line 1: expected key = value"},
+		{name: "no value", data: "port =\n", err: "expected key = value"},
+		{name: "duplicate", data: "[server]\nport = 1\nport = 2\n", err: "line 3: server.port is set twice"},
+		{name: "multi-line array", data: "a = [\n", err: "arrays must be on one line"},
+		{name: "multi-line string", data: "a = \"\"\"x\"\"\"\n", err: "multi-line strings"},
+		{name: "inline table", data: "a = {b = 1}\n", err: "inline tables"},
+		{name: "unterminated string", data: "a = \"x\n", err: "unterminated quoted value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.data)
+			checkParse(t, got, err, tt.want, tt.err)
+		})
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]string
+		err  string
+	}{
+		{
+			name: "plain",
+			data: "# comment\n\nPORT=9090\nexport LOG_LEVEL = debug\nEMPTY=\n",
+			want: map[string]string{"PORT": "9090", "LOG_LEVEL": "debug", "EMPTY": ""},
+		},
+		{
+			name: "quoting",
+			data: "A='$HOME \\n' # comment\nB=\"line\\nnext \\\"q\\\"\"\nC=\"a # b\"\n",
+			want: map[string]string{"A": `$HOME \n`, "B": "line\nnext \"q\"", "C": "a # b"},
+		},
+		{
+			name: "comments",
+			data: "URL=http://x/#frag\nD=value # comment\nE=value\t# comment\n",
+			want: map[string]string{"URL": "http://x/#frag", "D": "value", "E": "value"},
+		},
+		{name: "no equals", data: "PORT\n", err: ":1: expected KEY=value"},
+		{name: "bad key", data: "1PORT=1\n", err: ":1: expected KEY=value"},
+		{name: "unterminated", data: "A=1\nB='x\n", err: ":2: unterminated quoted value"},
+		{name: "trailing text", data: "A=\"x\" y\n", err: `unexpected "y" after quoted value`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, ".env", tt.data)
+			got, err := ReadEnvFile(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config.yaml", "server:\n  port: 1001\n  shutdown_timeout: 5s\nlog:\n  level: debug\n  format: text\nweb:\n  dir: file\nstorage:\n  data_dir: file\n")
+	envFile := writeFile(t, ".env", "PORT=1002\nLOG_LEVEL=warn\nDATA_DIR=envfile\nWEB_DIR=\n")
+
+	cfg, err := Load(Sources{
+		File:      file,
+		EnvFile:   envFile,
+		Environ:   []string{"PORT=1003", "LOG_LEVEL=error", "TRUSTED_PROXIES=10.0.0.0/8, ::1"},
+		Overrides: map[string]string{"server.port": "1004"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"default", cfg.OMDB.DailyLimit, 1000},
+		{"file duration over default", cfg.Server.ShutdownTimeout, 5 * time.Second},
+		{"file kept by a blank .env value", cfg.Web.Dir, "file"},
+		{"file over default", cfg.Log.Format, "text"},
+		{".env over file", cfg.Storage.DataDir, "envfile"},
+		{"environment over .env", cfg.Log.Level, "error"},
+		{"environment list", cfg.Server.TrustedProxies, []string{"10.0.0.0/8", "::1"}},
+		{"override over environment", cfg.Server.Port, 1004},
+	} {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  Sources
+		err  string
+	}{
+		{name: "unknown setting", src: Sources{File: writeFile(t, "unknown.toml", "[server]\nhost = \"x\"\n")}, err: `unknown setting "server.host"`},
+		{name: "bad extension", src: Sources{File: writeFile(t, "config.json", "{}")}, err: "must be .yaml, .yml or .toml"},
+		{name: "list for a scalar", src: Sources{File: writeFile(t, "list.yaml", "server:\n  port: [1, 2]\n")}, err: "expected a single value"},
+		{name: "missing required .env", src: Sources{EnvFile: filepath.Join(t.TempDir(), ".env"), RequireEnvFile: true}, err: "no such file"},
+		{name: "bad number", src: Sources{Environ: []string{"PORT=http"}}, err: `PORT: invalid number "http"`},
+		{name: "bad duration", src: Sources{Environ: []string{"NOTIFY_INTERVAL=5"}}, err: "invalid duration"},
+		{
+			name: "every problem at once",
+			src:  Sources{Environ: []string{"PORT=70000", "LOG_FORMAT=xml", "TLS_CERT_FILE=cert.pem", "TMDB_BASE_URL=ftp://x"}},
+			err:  "server.port (PORT): must be between 1 and 65535, got 70000\nserver.tls_cert_file (TLS_CERT_FILE)",
+		},
+		{name: "url", src: Sources{Environ: []string{"TMDB_BASE_URL=ftp://x"}}, err: `tmdb.base_url (TMDB_BASE_URL): "ftp://x" is not an http or https URL`},
+		{name: "log format", src: Sources{Environ: []string{"LOG_FORMAT=xml"}}, err: "log.format (LOG_FORMAT): must be json or text"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// A missing .env that was not asked for is fine
+	if _, err := Load(Sources{EnvFile: filepath.Join(t.TempDir(), ".env"), Environ: []string{}}); err != nil {
+		t.Errorf("missing optional .env: %v", err)
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	cfg, err := Load(Sources{Environ: []string{
+		"TMDB_API_KEY=tmdb-secret",
+		"OMDB_API_KEY=omdb-secret",
+		"SMTP_HOST=mail",
+		"SMTP_FROM=a@example.com",
+		"SMTP_PASSWORD=smtp-secret",
+		"OTEL_EXPORTER_OTLP_HEADERS=authorization=otel-secret",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := cfg.String()
+	if strings.Contains(s, "secret") {
+		t.Errorf("String() shows a secret:\n%s", s)
+	}
+	for _, line := range []string{"tmdb.api_key = [redacted]\n", "notify.smtp.password = [redacted]\n", "notify.smtp.host = mail\n"} {
+		if !strings.Contains(s, line) {
+			t.Errorf("String() lacks %q:\n%s", line, s)
+		}
+	}
+	if v := cfg.LogValue().String(); strings.Contains(v, "secret") {
+		t.Errorf("LogValue() shows a secret: %s", v)
+	}
+
+	// An unset secret shows as empty, so it is clear it was not set
+	empty, err := Load(Sources{Environ: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := empty.String(); !strings.Contains(s, "tmdb.api_key = \n") {
+		t.Errorf("unset secret not shown empty:\n%s", s)
+	}
+}
+
+func checkParse(t *testing.T, got map[string]interface{}, err error, want map[string]interface{}, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("error = %v, want %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
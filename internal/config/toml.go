@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var tomlKey = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// parseTOML reads the subset of TOML a config file needs: [tables],
+// key = value pairs with strings, numbers and booleans, and single-line
+// arrays. Values are returned by dotted key.
+func parseTOML(data string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	var table string
+
+	for n, raw := range strings.Split(data, "\n") {
+		line := n + 1
+		text := strings.TrimSpace(stripTOMLComment(raw))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if strings.HasPrefix(text, "[[") || !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header", line)
+			}
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			if !tomlKey.MatchString(table) {
+				return nil, fmt.Errorf("line %d: invalid table name %q", line, table)
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(text, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || !tomlKey.MatchString(key) || value == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: %s is set twice", line, key)
+		}
+
+		if strings.HasPrefix(value, "[") {
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: arrays must be on one line", line)
+			}
+			list := []string{}
+			for _, item := range splitTOMLArray(value[1 : len(value)-1]) {
+				s, err := tomlValue(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				list = append(list, s)
+			}
+			values[key] = list
+			continue
+		}
+
+		s, err := tomlValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		values[key] = s
+	}
+	return values, nil
+}
+
+func tomlValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return "", fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(s, `"`):
+		// TOML basic strings use the same escapes as a .env double quoted value
+		v, err := parseEnvValue(s)
+		if err != nil {
+			return "", err
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "{"):
+		return "", fmt.Errorf("inline tables are not supported")
+	}
+	// Numbers and booleans, e.g. 8080, 1_000 or true
+	return strings.ReplaceAll(s, "_", ""), nil
+}
+
+// splitTOMLArray splits array items on commas outside strings
+func splitTOMLArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+			if quote != 0 {
+				if c == '\\' && quote == '"' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+			if c != ',' {
+				continue
+			}
+		}
+		if item := strings.TrimSpace(s[start:i]); item != "" {
+			items = append(items, item)
+		}
+		start = i + 1
+	}
+	return items
+}
+
+// stripTOMLComment removes a # comment that is not inside a string
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the subset of YAML a config file needs: nested mappings,
+// scalars (plain, single or double quoted) and lists of scalars, written
+// either as "- item" lines or as [a, b]. Values are returned by dotted key.
+func parseYAML(data string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	type level struct {
+		indent int
+		prefix string
+	}
+	stack := []level{{indent: -1}}
+	// listKey is the key whose "- item" lines are being read
+	var listKey string
+	listIndent := -1
+
+	for n, raw := range strings.Split(data, "\n") {
+		line := n + 1
+		text := stripYAMLComment(strings.TrimRight(raw, " \r"))
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		if strings.Contains(text[:len(text)-len(strings.TrimLeft(text, " \t"))], "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", line)
+		}
+
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		text = strings.TrimSpace(text)
+
+		if strings.HasPrefix(text, "- ") || text == "-" {
+			if listKey == "" || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item without a key", line)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(text, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			list, _ := values[listKey].([]string)
+			values[listKey] = append(list, item)
+			continue
+		}
+		listKey = ""
+
+		for indent <= stack[len(stack)-1].indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		key, value, ok := strings.Cut(text, ":")
+		if !ok || (value != "" && value[0] != ' ') {
+			return nil, fmt.Errorf("line %d: expected key: value", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		fullKey := stack[len(stack)-1].prefix + key
+
+		switch {
+		case value == "":
+			// Either a nested mapping or a list follows
+			stack = append(stack, level{indent: indent, prefix: fullKey + "."})
+			listKey, listIndent = fullKey, indent
+			values[fullKey] = []string{}
+		case value == "|" || value == ">" || strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*"):
+			return nil, fmt.Errorf("line %d: block scalars, anchors and aliases are not supported", line)
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated list", line)
+			}
+			list := []string{}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				s, err := yamlScalar(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				list = append(list, s)
+			}
+			values[fullKey] = list
+		default:
+			s, err := yamlScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			values[fullKey] = s
+		}
+	}
+
+	// A key without list items was a section heading, or empty, which
+	// leaves the setting as it was
+	for key, value := range values {
+		if list, ok := value.([]string); ok && len(list) == 0 {
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+func yamlScalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid quoted value %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s == "~" || s == "null":
+		return "", nil
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes a # comment that is not inside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" [,", line[i-1]) != -1):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
@@ -0,0 +1,566 @@
+// Package demo serves a bundled catalogue of a few hundred fictional movies
+// and shows through MovieService, so the whole API works without API keys
+// or a network, and every client sees the same data.
+//
+// dataset.json is written by gen.go. The demo answers MovieService's TMDB and
+// OMDB requests in process with an upstreamfs.Handler over fixtures built
+// from it. Release and air dates of upcoming titles are stored relative to
+// the day the fixtures are built, so there is always something coming soon.
+package demo
+
+//go:generate go run gen.go
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/upstreamfs"
+)
+
+//go:embed dataset.json
+var datasetJSON []byte
+
+// baseURL is where the demo MovieService sends requests. They never leave
+// the process.
+const baseURL = "http://demo.invalid"
+
+type genre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type person struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Character string `json:"character,omitempty"`
+}
+
+type season struct {
+	Number      int    `json:"number"`
+	Episodes    int    `json:"episodes"`
+	Date        string `json:"date,omitempty"`
+	DaysFromNow int    `json:"days_from_now,omitempty"`
+}
+
+type title struct {
+	ID          int      `json:"id"`
+	MediaType   string   `json:"media_type"`
+	Title       string   `json:"title"`
+	Overview    string   `json:"overview"`
+	Tagline     string   `json:"tagline,omitempty"`
+	Date        string   `json:"date,omitempty"`
+	DaysFromNow int      `json:"days_from_now,omitempty"`
+	Genres      []int    `json:"genres"`
+	Language    string   `json:"language"`
+	VoteAverage float64  `json:"vote_average"`
+	VoteCount   int      `json:"vote_count"`
+	Popularity  float64  `json:"popularity"`
+	Runtime     int      `json:"runtime"`
+	IMDbID      string   `json:"imdb_id"`
+	Rated       string   `json:"rated"`
+	Status      string   `json:"status"`
+	Director    *person  `json:"director,omitempty"`
+	Creator     *person  `json:"creator,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	Cast        []person `json:"cast"`
+	Keywords    []string `json:"keywords"`
+	Providers   []string `json:"providers"`
+	Seasons     []season `json:"seasons,omitempty"`
+}
+
+type dataset struct {
+	MovieGenres []genre `json:"movie_genres"`
+	TVGenres    []genre `json:"tv_genres"`
+	Titles      []title `json:"titles"`
+}
+
+// providerIDs are TMDB's IDs for the streaming services in the dataset
+var providerIDs = map[string]int{
+	"Netflix": 8, "Amazon Prime Video": 9, "Disney Plus": 337, "Max": 1899,
+	"Apple TV Plus": 350, "Hulu": 15,
+}
+
+// object is a JSON object in a fixture
+type object = map[string]interface{}
+
+// NewMovieService returns a MovieService answering from the demo dataset,
+// with upcoming dates counted from now
+func NewMovieService(now time.Time) (*services.MovieService, error) {
+	fixtures, err := Fixtures(now)
+	if err != nil {
+		return nil, err
+	}
+	cfg := services.Config{
+		TMDBAPIKey:  "demo",
+		TMDBBaseURL: baseURL + "/3",
+		OMDBAPIKey:  "demo",
+		OMDBBaseURL: baseURL,
+		Demo:        true,
+	}
+	return services.NewMovieService(cfg, &http.Client{Transport: upstreamfs.Transport(upstreamfs.New(fixtures)), Timeout: 10 * time.Second}), nil
+}
+
+// Select returns the MovieService cfg asks for: the demo in demo mode or
+// without a TMDB key, TMDB and OMDB otherwise. implicit reports that the
+// demo only stands in for a missing key, which the server and moviecli
+// treat as a misconfiguration rather than a choice.
+func Select(cfg *config.Config, now time.Time) (s *services.MovieService, implicit bool, err error) {
+	if !cfg.TMDB.Demo && cfg.TMDB.APIKey != "" {
+		return services.NewMovieService(services.ConfigFrom(cfg), nil), false, nil
+	}
+	s, err = NewMovieService(now)
+	return s, !cfg.TMDB.Demo, err
+}
+
+// Fixtures lays the dataset out as upstreamfs fixtures
+func Fixtures(now time.Time) (fs.FS, error) {
+	var data dataset
+	if err := json.Unmarshal(datasetJSON, &data); err != nil {
+		return nil, fmt.Errorf("demo dataset: %w", err)
+	}
+	b := &builder{
+		now:    now.UTC().Truncate(24 * time.Hour),
+		data:   data,
+		genres: make(map[string]map[int]string),
+		files:  make(upstreamfs.MapFS),
+		people: make(map[int]object),
+	}
+	b.genres["movie"] = genreNames(data.MovieGenres)
+	b.genres["tv"] = genreNames(data.TVGenres)
+	if err := b.build(); err != nil {
+		return nil, err
+	}
+	return b.files, nil
+}
+
+type builder struct {
+	now    time.Time
+	data   dataset
+	genres map[string]map[int]string
+	files  upstreamfs.MapFS
+	// people collects everyone credited while titles are built
+	people map[int]object
+}
+
+func genreNames(genres []genre) map[int]string {
+	names := make(map[int]string)
+	for _, g := range genres {
+		names[g.ID] = g.Name
+	}
+	return names
+}
+
+func (b *builder) build() error {
+	// Resolve the relative dates first, everything else is built from them
+	for i := range b.data.Titles {
+		t := &b.data.Titles[i]
+		if t.DaysFromNow != 0 {
+			t.Date = b.date(t.DaysFromNow)
+		}
+		for j := range t.Seasons {
+			if s := &t.Seasons[j]; s.DaysFromNow != 0 {
+				s.Date = b.date(s.DaysFromNow)
+			}
+		}
+	}
+
+	titles := b.data.Titles
+	sort.SliceStable(titles, func(i, j int) bool { return titles[i].Popularity > titles[j].Popularity })
+
+	var all, released, recent []interface{}
+	discover := map[string][]interface{}{}
+	today := b.date(0)
+	for _, t := range titles {
+		item := b.summary(t)
+		all = append(all, item)
+		if t.Date <= today {
+			released = append(released, item)
+			if t.Date >= b.date(-365*2) {
+				recent = append(recent, item)
+			}
+		}
+		withoutType := copyObject(item)
+		delete(withoutType, "media_type")
+		discover[t.MediaType] = append(discover[t.MediaType], withoutType)
+
+		var err error
+		if t.MediaType == "movie" {
+			err = b.movie(t)
+		} else {
+			err = b.show(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	lists := map[string]interface{}{
+		"tmdb/search/multi":      list(all),
+		"tmdb/trending/all/week": list(first(released, 100)),
+		"tmdb/trending/all/day":  list(first(recent, 40)),
+		"tmdb/discover/movie":    list(discover["movie"]),
+		"tmdb/discover/tv":       list(discover["tv"]),
+		"tmdb/genre/movie/list":  object{"genres": b.data.MovieGenres},
+		"tmdb/genre/tv/list":     object{"genres": b.data.TVGenres},
+	}
+	for name, body := range lists {
+		if err := b.add(name, body); err != nil {
+			return err
+		}
+	}
+	for id, p := range b.people {
+		if err := b.add(fmt.Sprintf("tmdb/person/%d", id), p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// credit lists t in the person's combined credits, under cast when job is
+// empty and under crew otherwise
+func (b *builder) credit(p *person, department string, t title, job string) {
+	record, ok := b.people[p.ID]
+	if !ok {
+		record = object{
+			"id":                   p.ID,
+			"name":                 p.Name,
+			"biography":            fmt.Sprintf("%s is a fictional %s in the demo catalogue.", p.Name, strings.ToLower(department)),
+			"birthday":             "",
+			"deathday":             "",
+			"place_of_birth":       "",
+			"profile_path":         "",
+			"known_for_department": department,
+			"gender":               0,
+			"popularity":           0.0,
+			"imdb_id":              "",
+			"combined_credits":     object{"cast": []interface{}{}, "crew": []interface{}{}},
+		}
+		b.people[p.ID] = record
+	}
+	if t.Popularity > record["popularity"].(float64) {
+		record["popularity"] = t.Popularity
+	}
+
+	item := b.summary(t)
+	credits := record["combined_credits"].(object)
+	if job == "" {
+		item["character"] = p.Character
+		item["credit_id"] = fmt.Sprintf("%d-%d", t.ID, p.ID)
+		credits["cast"] = append(credits["cast"].([]interface{}), item)
+		return
+	}
+	item["job"] = job
+	item["department"] = department
+	item["credit_id"] = fmt.Sprintf("%d-%d-%s", t.ID, p.ID, strings.ToLower(job))
+	credits["crew"] = append(credits["crew"].([]interface{}), item)
+}
+
+func (b *builder) date(days int) string {
+	return b.now.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+// summary is a title as it appears in lists
+func (b *builder) summary(t title) object {
+	item := object{
+		"id":                t.ID,
+		"media_type":        t.MediaType,
+		"overview":          t.Overview,
+		"poster_path":       "",
+		"backdrop_path":     "",
+		"genre_ids":         t.Genres,
+		"vote_average":      t.VoteAverage,
+		"vote_count":        t.VoteCount,
+		"popularity":        t.Popularity,
+		"adult":             false,
+		"original_language": t.Language,
+	}
+	if t.MediaType == "movie" {
+		item["title"], item["original_title"], item["release_date"] = t.Title, t.Title, t.Date
+		item["video"] = false
+	} else {
+		item["name"], item["original_name"], item["first_air_date"] = t.Title, t.Title, t.Date
+	}
+	return item
+}
+
+// details holds the fields movies and shows share
+func (b *builder) details(t title) object {
+	d := b.summary(t)
+	delete(d, "genre_ids")
+	delete(d, "media_type")
+
+	genres := []object{}
+	for _, id := range t.Genres {
+		genres = append(genres, object{"id": id, "name": b.genres[t.MediaType][id]})
+	}
+	d["genres"] = genres
+	d["status"] = t.Status
+	d["tagline"] = t.Tagline
+	d["spoken_languages"] = []object{{"iso_639_1": t.Language, "name": t.Language, "english_name": t.Language}}
+	d["production_companies"] = []object{}
+	d["production_countries"] = []object{}
+
+	cast := []object{}
+	for i, p := range t.Cast {
+		b.credit(&p, "Acting", t, "")
+		cast = append(cast, object{
+			"id": p.ID, "name": p.Name, "character": p.Character, "order": i, "profile_path": "",
+			"credit_id": fmt.Sprintf("%d-%d", t.ID, p.ID), "gender": 0, "known_for_department": "Acting",
+		})
+	}
+	crew := []object{}
+	if t.Director != nil {
+		b.credit(t.Director, "Directing", t, "Director")
+		crew = append(crew, object{
+			"id": t.Director.ID, "name": t.Director.Name, "job": "Director", "department": "Directing",
+			"profile_path": "", "credit_id": fmt.Sprintf("%d-%d-director", t.ID, t.Director.ID), "gender": 0,
+			"known_for_department": "Directing",
+		})
+	}
+	d["credits"] = object{"cast": cast, "crew": crew}
+	d["external_ids"] = object{"imdb_id": t.IMDbID, "facebook_id": "", "instagram_id": "", "twitter_id": ""}
+	d["videos"] = object{"id": t.ID, "results": []object{}}
+	d["recommendations"] = list(b.recommendations(t))
+
+	keywords := []object{}
+	for i, k := range t.Keywords {
+		keywords = append(keywords, object{"id": t.ID*10 + i, "name": k})
+	}
+	if t.MediaType == "movie" {
+		d["keywords"] = object{"keywords": keywords}
+	} else {
+		d["keywords"] = object{"results": keywords}
+	}
+
+	providers := object{}
+	if len(t.Providers) > 0 {
+		flatrate := []object{}
+		for i, name := range t.Providers {
+			flatrate = append(flatrate, object{
+				"provider_id": providerIDs[name], "provider_name": name, "logo_path": "", "display_priority": i + 1,
+			})
+		}
+		providers["US"] = object{
+			"link":     fmt.Sprintf("https://www.themoviedb.org/%s/%d/watch?locale=US", t.MediaType, t.ID),
+			"flatrate": flatrate,
+		}
+	}
+	d["watch/providers"] = object{"results": providers}
+	return d
+}
+
+func (b *builder) movie(t title) error {
+	d := b.details(t)
+	d["imdb_id"] = t.IMDbID
+	d["runtime"] = t.Runtime
+	d["budget"] = 0
+	d["revenue"] = 0
+
+	release := []object{{"certification": t.Rated, "iso_639_1": "", "note": "", "release_date": t.Date + "T00:00:00.000Z", "type": 3}}
+	if digital, err := time.Parse("2006-01-02", t.Date); err == nil {
+		release = append(release, object{
+			"certification": t.Rated, "iso_639_1": "", "note": "",
+			"release_date": digital.AddDate(0, 0, 90).Format("2006-01-02") + "T00:00:00.000Z", "type": 4,
+		})
+	}
+	d["release_dates"] = object{"results": []object{{"iso_3166_1": "US", "release_dates": release}}}
+
+	if err := b.add(fmt.Sprintf("tmdb/movie/%d", t.ID), d); err != nil {
+		return err
+	}
+	return b.omdb(t, "movie", d)
+}
+
+func (b *builder) show(t title) error {
+	d := b.details(t)
+	today := b.date(0)
+
+	var seasons []object
+	var last, next object
+	episodes := 0
+	for _, s := range t.Seasons {
+		seasons = append(seasons, object{
+			"id": t.ID*100 + s.Number, "name": fmt.Sprintf("Season %d", s.Number), "overview": "",
+			"poster_path": "", "season_number": s.Number, "episode_count": s.Episodes, "air_date": s.Date,
+		})
+		episodes += s.Episodes
+
+		list := b.episodes(t, s)
+		for _, e := range list {
+			if e["air_date"].(string) <= today {
+				last = e
+			} else if next == nil {
+				next = e
+			}
+		}
+		err := b.add(fmt.Sprintf("tmdb/tv/%d/season/%d", t.ID, s.Number), object{
+			"id": t.ID*100 + s.Number, "name": fmt.Sprintf("Season %d", s.Number), "overview": "",
+			"poster_path": "", "season_number": s.Number, "air_date": s.Date, "episodes": list,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	d["seasons"] = seasons
+	d["number_of_seasons"] = len(t.Seasons)
+	d["number_of_episodes"] = episodes
+	d["episode_run_time"] = []int{t.Runtime}
+	d["type"] = "Scripted"
+	d["in_production"] = t.Status == "Returning Series"
+	d["networks"] = []object{{"id": 0, "name": t.Network, "logo_path": "", "origin_country": "US"}}
+	d["content_ratings"] = object{"results": []object{{"iso_3166_1": "US", "rating": t.Rated}}}
+	if t.Creator != nil {
+		b.credit(t.Creator, "Writing", t, "Creator")
+		d["created_by"] = []object{{"id": t.Creator.ID, "name": t.Creator.Name, "profile_path": "", "credit_id": fmt.Sprintf("%d-%d-creator", t.ID, t.Creator.ID), "gender": 0}}
+	}
+	if last != nil {
+		d["last_episode_to_air"] = last
+		d["last_air_date"] = last["air_date"]
+	}
+	if next != nil {
+		d["next_episode_to_air"] = next
+	}
+
+	if err := b.add(fmt.Sprintf("tmdb/tv/%d", t.ID), d); err != nil {
+		return err
+	}
+	return b.omdb(t, "series", d)
+}
+
+// episodes airs a season weekly from its first date
+func (b *builder) episodes(t title, s season) []object {
+	start, err := time.Parse("2006-01-02", s.Date)
+	if err != nil {
+		return nil
+	}
+	list := make([]object, 0, s.Episodes)
+	for n := 1; n <= s.Episodes; n++ {
+		list = append(list, object{
+			"id":             t.ID*1000 + s.Number*100 + n,
+			"name":           fmt.Sprintf("Episode %d", n),
+			"overview":       "",
+			"air_date":       start.AddDate(0, 0, 7*(n-1)).Format("2006-01-02"),
+			"episode_number": n,
+			"season_number":  s.Number,
+			"runtime":        t.Runtime,
+			"still_path":     "",
+			"vote_average":   0,
+		})
+	}
+	return list
+}
+
+// recommendations are the most popular other titles sharing t's main genre
+func (b *builder) recommendations(t title) []interface{} {
+	var picks []interface{}
+	for _, other := range b.data.Titles {
+		if other.ID == t.ID || other.MediaType != t.MediaType || len(picks) == 10 {
+			continue
+		}
+		for _, id := range other.Genres {
+			if id == t.Genres[0] {
+				picks = append(picks, b.summary(other))
+				break
+			}
+		}
+	}
+	return picks
+}
+
+// omdb writes the OMDB record, with ratings made up from TMDB's
+func (b *builder) omdb(t title, kind string, d object) error {
+	record := object{
+		"Title":      t.Title,
+		"Rated":      t.Rated,
+		"Plot":       t.Overview,
+		"Language":   t.Language,
+		"Country":    "N/A",
+		"Awards":     "N/A",
+		"Poster":     "N/A",
+		"Type":       kind,
+		"imdbID":     t.IMDbID,
+		"Response":   "True",
+		"Year":       "N/A",
+		"Released":   "N/A",
+		"Runtime":    fmt.Sprintf("%d min", t.Runtime),
+		"Metascore":  "N/A",
+		"imdbRating": "N/A",
+		"imdbVotes":  "N/A",
+		"Ratings":    []object{},
+	}
+
+	var genres, actors []string
+	for _, g := range d["genres"].([]object) {
+		genres = append(genres, g["name"].(string))
+	}
+	for _, p := range t.Cast {
+		actors = append(actors, p.Name)
+	}
+	record["Genre"] = strings.Join(genres, ", ")
+	record["Actors"] = strings.Join(actors, ", ")
+	record["Director"] = "N/A"
+	if t.Director != nil {
+		record["Director"] = t.Director.Name
+	}
+	if kind == "series" {
+		record["totalSeasons"] = fmt.Sprint(len(t.Seasons))
+	}
+
+	if released, err := time.Parse("2006-01-02", t.Date); err == nil {
+		record["Year"] = released.Format("2006")
+		record["Released"] = released.Format("02 Jan 2006")
+	}
+	if t.VoteCount > 0 {
+		imdb := t.VoteAverage + float64(t.ID%5-2)/10
+		critics := int(t.VoteAverage*10) + t.ID%15 - 7
+		metascore := int(t.VoteAverage*10) - 5 + t.ID%11
+		record["imdbRating"] = fmt.Sprintf("%.1f", imdb)
+		record["imdbVotes"] = fmt.Sprintf("%d", t.VoteCount*12)
+		record["Metascore"] = fmt.Sprint(metascore)
+		record["Ratings"] = []object{
+			{"Source": "Internet Movie Database", "Value": fmt.Sprintf("%.1f/10", imdb)},
+			{"Source": "Rotten Tomatoes", "Value": fmt.Sprintf("%d%%", max(0, min(100, critics)))},
+			{"Source": "Metacritic", "Value": fmt.Sprintf("%d/100", metascore)},
+		}
+	}
+	return b.add("omdb/"+t.IMDbID, record)
+}
+
+func (b *builder) add(name string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("demo fixture %s: %w", name, err)
+	}
+	b.files[name+".json"] = data
+	return nil
+}
+
+// list is a TMDB list response holding every result. upstreamfs serves
+// it a page at a time.
+func list(results []interface{}) object {
+	if results == nil {
+		results = []interface{}{}
+	}
+	return object{"page": 1, "results": results, "total_pages": 1, "total_results": len(results)}
+}
+
+func first(items []interface{}, n int) []interface{} {
+	return items[:min(n, len(items))]
+}
+
+func copyObject(o object) object {
+	c := make(object, len(o))
+	for k, v := range o {
+		c[k] = v
+	}
+	return c
+}
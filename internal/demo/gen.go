@@ -0,0 +1,497 @@
+//go:build ignore
+
+// gen writes dataset.json, a fictional catalogue of movies and shows for
+// demo mode. It is seeded, so running it again gives the same file.
+//
+//	go generate ./internal/demo
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	movieCount = 200
+	tvCount    = 100
+	firstID    = 90000001
+	firstTVID  = 90100001
+	firstCast  = 90500001
+)
+
+type genre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var movieGenres = []genre{
+	{28, "Action"}, {12, "Adventure"}, {16, "Animation"}, {35, "Comedy"}, {80, "Crime"},
+	{99, "Documentary"}, {18, "Drama"}, {10751, "Family"}, {14, "Fantasy"}, {36, "History"},
+	{27, "Horror"}, {10402, "Music"}, {9648, "Mystery"}, {10749, "Romance"},
+	{878, "Science Fiction"}, {53, "Thriller"}, {10752, "War"}, {37, "Western"},
+}
+
+var tvGenres = []genre{
+	{10759, "Action & Adventure"}, {16, "Animation"}, {35, "Comedy"}, {80, "Crime"},
+	{99, "Documentary"}, {18, "Drama"}, {10751, "Family"}, {10762, "Kids"}, {9648, "Mystery"},
+	{10764, "Reality"}, {10765, "Sci-Fi & Fantasy"}, {10768, "War & Politics"}, {37, "Western"},
+}
+
+type person struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Character string `json:"character,omitempty"`
+}
+
+type season struct {
+	Number      int    `json:"number"`
+	Episodes    int    `json:"episodes"`
+	Date        string `json:"date,omitempty"`
+	DaysFromNow int    `json:"days_from_now,omitempty"`
+}
+
+type title struct {
+	ID          int      `json:"id"`
+	MediaType   string   `json:"media_type"`
+	Title       string   `json:"title"`
+	Overview    string   `json:"overview"`
+	Tagline     string   `json:"tagline,omitempty"`
+	Date        string   `json:"date,omitempty"`
+	DaysFromNow int      `json:"days_from_now,omitempty"`
+	Genres      []int    `json:"genres"`
+	Language    string   `json:"language"`
+	VoteAverage float64  `json:"vote_average"`
+	VoteCount   int      `json:"vote_count"`
+	Popularity  float64  `json:"popularity"`
+	Runtime     int      `json:"runtime"`
+	IMDbID      string   `json:"imdb_id"`
+	Rated       string   `json:"rated"`
+	Status      string   `json:"status"`
+	Director    *person  `json:"director,omitempty"`
+	Creator     *person  `json:"creator,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	Cast        []person `json:"cast"`
+	Keywords    []string `json:"keywords"`
+	Providers   []string `json:"providers"`
+	Seasons     []season `json:"seasons,omitempty"`
+}
+
+var (
+	firstNames = strings.Fields(`Ada Alex Amara Andre Anika Ari Bea Ben Cara Cole Dana Dev Eli
+		Elena Emeka Esme Farah Felix Gia Hana Hugo Ines Ivan Jade Jonah Kai Kenji Lena Leo Lior
+		Mara Marco Maya Mika Nadia Nico Noor Omar Pia Quinn Rafa Remy Rosa Sami Sana Theo Tova
+		Uma Vera Wes Yara Yusuf Zane Zoe Iris Jonas Priya Tariq Wren Oskar`)
+	lastNames = strings.Fields(`Abara Alvarez Bergström Castell Dubois Eriksen Fontaine Garza
+		Hale Ibsen Jovanovic Kaur Laurent Mbeki Nakamura Okafor Petrov Quill Romano Sato Tanaka
+		Umarov Varga Whitlock Xu Yilmaz Zeller Achebe Brandt Costa Delgado Ferreira Grant Holm
+		Ishikawa Keller Lindqvist Moreau Novak Oyelaran Park Reyes Silva Thorne Valdez Weiss`)
+	places = strings.Fields(`Lisbon Marseille Oslo Detroit Tangier Valparaíso Glasgow Osaka
+		Reykjavík Naples Havana Montreal Tbilisi Kraków Dakar Busan Antwerp Hobart Cusco Trieste`)
+	adjectives = strings.Fields(`Silent Broken Hollow Golden Crimson Distant Last Burning Quiet
+		Midnight Northern Forgotten Velvet Iron Paper Electric Winter Hidden Wild Glass Falling
+		Lonely Bright Salt Second Restless Endless Lucky Stolen Secret`)
+	nouns = strings.Fields(`Harbor Signal Orchard Frontier Garden Tide Ember Lantern Mirror Engine
+		Horizon Archive Meridian Circus Kingdom Echo Compass Current Season River Summer Crown
+		Labyrinth Letter Witness Voyage Ledger Island Canyon Monument`)
+	jobs = strings.Fields(`detective pilot chef cartographer librarian surgeon boxer teacher
+		translator architect smuggler journalist violinist mechanic diplomat botanist`)
+	networks  = []string{"Example One", "Northlight", "Channel Nine Fictional", "Streamline", "Harbor TV"}
+	providers = []string{"Netflix", "Amazon Prime Video", "Disney Plus", "Max", "Apple TV Plus", "Hulu"}
+)
+
+// overviews by the main genre. {a} and {b} are character names, {job},
+// {place} and {thing} fill in the rest.
+var overviews = map[string][]string{
+	"Action": {
+		"When a routine job in {place} goes wrong, {a}, a retired {job}, has one night to stop a heist that would bring down the city's power grid.",
+		"{a} and {b} are the last two agents standing after an ambush, and the only people who know where the {thing} is hidden.",
+	},
+	"Adventure": {
+		"A faded map leads {a}, a restless {job}, from {place} across three continents in search of the legendary {thing}.",
+		"Stranded after a storm, {a} and {b} must cross unknown country with nothing but a compass and a grudge.",
+	},
+	"Animation": {
+		"A small robot who repairs lanterns in {place} sets out to find the {thing} that will keep the lights on for good.",
+		"{a}, a young fox with big ideas, teams up with a grumpy owl to save the forest's oldest {thing}.",
+	},
+	"Comedy": {
+		"{a}, a perfectionist {job}, has a week to plan a wedding in {place} with the help of an ex who remembers everything.",
+		"Two rival {job}s are forced to share a tiny flat in {place}, and neither is willing to move out first.",
+	},
+	"Crime": {
+		"In {place}, {a}, a {job} with debts to the wrong people, is offered a way out: one last job involving the {thing}.",
+		"A detective in {place} reopens a twenty-year-old case when {a} walks into the station claiming to be the victim.",
+	},
+	"Documentary": {
+		"Filmed over five years in {place}, this documentary follows the people fighting to save the {thing}.",
+		"An intimate portrait of {a}, a self-taught {job} whose work changed an industry without anyone noticing.",
+	},
+	"Drama": {
+		"After their father's death, {a} and {b} return to {place} to sell the family {thing}, and find the past will not let go.",
+		"{a}, a {job} at the end of a long career, takes on one last apprentice and one last chance at forgiveness.",
+	},
+	"Family": {
+		"When the town {thing} goes missing the day before the festival, {a} and a mismatched crew of kids take up the search.",
+		"A family road trip from {place} turns into an adventure when {a} adopts a very unusual dog.",
+	},
+	"Fantasy": {
+		"In a kingdom where memories can be traded, {a}, a humble {job}, discovers a stolen memory that could topple the crown.",
+		"{a} inherits a {thing} that opens a door to another world, and something on the other side wants out.",
+	},
+	"History": {
+		"The true-to-life story of the {job}s of {place} who risked everything to protect the {thing} during the war.",
+		"In 1890s {place}, {a} fights to become the first {job} the city has ever licensed.",
+	},
+	"Horror": {
+		"A family moves into an old house outside {place} and finds the {thing} in the cellar was never meant to be opened.",
+		"{a} takes a night shift as a {job} at a remote station, where the radio keeps playing voices from last year.",
+	},
+	"Music": {
+		"{a}, a street violinist in {place}, gets one shot at the conservatory and has to choose between the band and the dream.",
+		"A washed-up producer and a young singer record an album in a week in a converted {thing}.",
+	},
+	"Mystery": {
+		"When a famous {job} vanishes from a locked room in {place}, {a} has until dawn to work out who was lying.",
+		"{a} receives letters from a sender who knows things only the dead should know.",
+	},
+	"Romance": {
+		"{a} and {b} meet on the same train every morning in {place} and never speak, until the day the train does not come.",
+		"A {job} who plans other people's proposals falls for the one person who does not believe in marriage.",
+	},
+	"Science Fiction": {
+		"Aboard a generation ship two centuries from Earth, {a}, the ship's {job}, finds evidence that the journey was never meant to end.",
+		"In a near future {place}, {a} discovers the {thing} can send messages one day into the past.",
+	},
+	"Thriller": {
+		"{a}, a {job} with a perfect memory, witnesses a murder in {place} and becomes the only thing standing between a killer and freedom.",
+		"A hostage negotiator in {place} realises the man on the other end of the line is describing her own apartment.",
+	},
+	"War": {
+		"In the final winter of the war, {a} leads a small unit across enemy lines to bring home the {thing}.",
+		"Based on letters home, the story of {a} and {b}, two friends who enlisted together and came back strangers.",
+	},
+	"Western": {
+		"A bounty hunter and the {job} she was hired to bring in ride together through a drought that has turned the territory lawless.",
+		"{a} returns to the frontier town of {place} to settle an old score over a stolen {thing}.",
+	},
+	"Action & Adventure": {
+		"A crew of specialists led by {a} takes the jobs no government will admit to, from {place} to the end of the world.",
+	},
+	"Kids": {
+		"Every episode, {a} and friends solve a new puzzle in the magical town of {place}.",
+	},
+	"Reality": {
+		"Twelve amateur {job}s compete in {place} for the title of the best in the country.",
+	},
+	"Sci-Fi & Fantasy": {
+		"When the {thing} appears over {place}, {a}, a {job}, is the only one who can read the signal it sends.",
+		"{a} wakes in a city that resets every night, and is the only one who remembers.",
+	},
+	"War & Politics": {
+		"Behind closed doors in {place}, {a}, a young {job}, is drawn into the fight to control the government.",
+	},
+}
+
+var keywordsByGenre = map[string][]string{
+	"Action": {"heist", "chase", "martial arts", "betrayal"}, "Adventure": {"treasure hunt", "expedition", "map"},
+	"Animation": {"talking animals", "robot", "friendship"}, "Comedy": {"wedding", "roommates", "misunderstanding"},
+	"Crime": {"detective", "organized crime", "cold case"}, "Documentary": {"environment", "biography", "archive footage"},
+	"Drama": {"family secrets", "grief", "coming of age"}, "Family": {"road trip", "dog", "festival"},
+	"Fantasy": {"magic", "kingdom", "portal"}, "History": {"based on true story", "19th century", "world war ii"},
+	"Horror": {"haunted house", "isolation", "supernatural"}, "Music": {"musician", "band", "conservatory"},
+	"Mystery": {"locked room", "whodunit", "letters"}, "Romance": {"first love", "second chance", "train"},
+	"Science Fiction": {"space travel", "time travel", "artificial intelligence"}, "Thriller": {"hostage", "witness", "conspiracy"},
+	"War": {"soldier", "resistance", "friendship"}, "Western": {"bounty hunter", "frontier", "revenge"},
+	"Action & Adventure": {"special forces", "mission"}, "Kids": {"puzzle", "magic"}, "Reality": {"competition", "cooking"},
+	"Sci-Fi & Fantasy": {"alien contact", "time loop"}, "War & Politics": {"politics", "power struggle"},
+}
+
+var taglines = []string{
+	"Some doors should stay closed.", "One night. One chance.", "Everyone has a price.",
+	"The truth is only the beginning.", "Home is further than it looks.", "Not all heroes are chosen.",
+	"Every story has two endings.", "Trust no one. Not even yourself.", "", "",
+}
+
+func main() {
+	r := rand.New(rand.NewSource(20261019))
+	used := make(map[string]bool)
+
+	people := make([]person, 0, 400)
+	seen := make(map[string]bool)
+	for len(people) < 400 {
+		name := pick(r, firstNames) + " " + pick(r, lastNames)
+		if !seen[name] {
+			seen[name] = true
+			people = append(people, person{ID: firstCast + len(people), Name: name})
+		}
+	}
+
+	var titles []title
+	for i := 0; i < movieCount; i++ {
+		titles = append(titles, movie(r, firstID+i, people, used))
+	}
+	for i := 0; i < tvCount; i++ {
+		titles = append(titles, show(r, firstTVID+i, people, used))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{\n")
+	writeField(&buf, "movie_genres", movieGenres)
+	writeField(&buf, "tv_genres", tvGenres)
+	buf.WriteString("\"titles\": [\n")
+	for i, t := range titles {
+		buf.Write(marshal(t))
+		if i < len(titles)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("]\n}\n")
+
+	if err := os.WriteFile("dataset.json", buf.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeField(buf *bytes.Buffer, name string, v interface{}) {
+	fmt.Fprintf(buf, "%q: %s,\n", name, marshal(v))
+}
+
+// marshal encodes v on one line, leaving & and < alone
+func marshal(v interface{}) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func movie(r *rand.Rand, id int, people []person, used map[string]bool) title {
+	genres := pickGenres(r, movieGenres)
+	main := genreName(movieGenres, genres[0])
+
+	t := title{
+		ID:        id,
+		MediaType: "movie",
+		Title:     uniqueTitle(r, used),
+		Genres:    genres,
+		Language:  language(r),
+		Runtime:   85 + r.Intn(75),
+		IMDbID:    fmt.Sprintf("tt0%07d", id-firstID+1),
+		Rated:     pick(r, []string{"G", "PG", "PG-13", "PG-13", "R", "R"}),
+		Status:    "Released",
+		Tagline:   pick(r, taglines),
+		Keywords:  keywords(r, main),
+		Providers: pickProviders(r),
+	}
+	if main == "Animation" || main == "Family" {
+		t.Rated = pick(r, []string{"G", "PG"})
+	}
+	if main == "Documentary" {
+		t.Runtime = 80 + r.Intn(30)
+	}
+
+	cast := castOf(r, people, 4+r.Intn(6))
+	director := people[r.Intn(len(people))]
+	t.Director = &person{ID: director.ID, Name: director.Name}
+	t.Cast = cast
+	t.Overview = overview(r, main, cast)
+
+	// A few films are still to come, for the release calendar
+	if r.Intn(100) < 8 {
+		t.DaysFromNow = 3 + r.Intn(240)
+		t.Status = "Post Production"
+		t.Providers = nil
+		t.Popularity = round(20+r.Float64()*60, 1)
+		return t
+	}
+
+	year := 2025 - int(math.Floor(math.Pow(r.Float64(), 2)*50))
+	date := time.Date(year, time.Month(1+r.Intn(12)), 1+r.Intn(28), 0, 0, 0, 0, time.UTC)
+	t.Date = date.Format("2006-01-02")
+	t.VoteAverage, t.VoteCount, t.Popularity = reception(r, year)
+	return t
+}
+
+func show(r *rand.Rand, id int, people []person, used map[string]bool) title {
+	genres := pickGenres(r, tvGenres)
+	main := genreName(tvGenres, genres[0])
+
+	t := title{
+		ID:        id,
+		MediaType: "tv",
+		Title:     uniqueTitle(r, used),
+		Genres:    genres,
+		Language:  language(r),
+		Runtime:   pick(r, []int{22, 30, 45, 50, 55, 60}),
+		IMDbID:    fmt.Sprintf("tt0%07d", id-firstTVID+movieCount+1),
+		Rated:     pick(r, []string{"TV-G", "TV-PG", "TV-14", "TV-14", "TV-MA"}),
+		Network:   pick(r, networks),
+		Keywords:  keywords(r, main),
+		Providers: pickProviders(r),
+	}
+	if main == "Kids" || main == "Animation" || main == "Family" {
+		t.Rated = pick(r, []string{"TV-Y", "TV-G"})
+	}
+
+	cast := castOf(r, people, 3+r.Intn(6))
+	creator := people[r.Intn(len(people))]
+	t.Creator = &person{ID: creator.ID, Name: creator.Name}
+	t.Cast = cast
+	t.Overview = overview(r, main, cast)
+
+	start := 2024 - int(math.Floor(math.Pow(r.Float64(), 2)*28))
+	seasons := 1 + r.Intn(min(8, 2026-start))
+	returning := r.Intn(100) < 40
+	for n := 1; n <= seasons; n++ {
+		s := season{Number: n, Episodes: pick(r, []int{6, 8, 10, 10, 12, 13, 22})}
+		year := start + (n-1)*(2026-start)/seasons
+		s.Date = time.Date(year, time.Month(1+r.Intn(12)), 1+r.Intn(28), 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+		t.Seasons = append(t.Seasons, s)
+	}
+	t.Date = t.Seasons[0].Date
+
+	t.Status = "Ended"
+	if returning {
+		// The latest season is airing now or starts soon, for episode
+		// notifications
+		t.Status = "Returning Series"
+		next := season{Number: seasons + 1, Episodes: pick(r, []int{6, 8, 10}), DaysFromNow: -35 + r.Intn(150)}
+		if next.DaysFromNow == 0 {
+			next.DaysFromNow = 1
+		}
+		t.Seasons = append(t.Seasons, next)
+	}
+	t.VoteAverage, t.VoteCount, t.Popularity = reception(r, start)
+	return t
+}
+
+// reception makes up ratings, with older titles having more votes
+func reception(r *rand.Rand, year int) (float64, int, float64) {
+	average := math.Max(4.5, math.Min(8.9, 6.6+r.NormFloat64()*0.8))
+	votes := int(float64(50+r.Intn(400)) * math.Pow(1.12, float64(min(2025-year, 30))) * (1 + r.Float64()))
+	popularity := 5 + math.Pow(r.Float64(), 3)*150
+	if year >= 2024 {
+		popularity += 40
+	}
+	return round(average, 1), votes, round(popularity, 3)
+}
+
+func uniqueTitle(r *rand.Rand, used map[string]bool) string {
+	for {
+		var t string
+		switch r.Intn(6) {
+		case 0:
+			t = "The " + pick(r, adjectives) + " " + pick(r, nouns)
+		case 1:
+			t = pick(r, nouns) + " of " + pick(r, places)
+		case 2:
+			t = pick(r, firstNames) + "'s " + pick(r, nouns)
+		case 3:
+			t = "The " + pick(r, nouns)
+		case 4:
+			t = pick(r, adjectives) + " " + plural(pick(r, nouns))
+		default:
+			t = "A " + pick(r, nouns) + " in " + pick(r, places)
+		}
+		if !used[t] {
+			used[t] = true
+			return t
+		}
+	}
+}
+
+func plural(noun string) string {
+	if strings.HasSuffix(noun, "s") {
+		return noun + "es"
+	}
+	return noun + "s"
+}
+
+func overview(r *rand.Rand, genre string, cast []person) string {
+	templates := overviews[genre]
+	if len(templates) == 0 {
+		templates = overviews["Drama"]
+	}
+	a, b := cast[0].Character, cast[0].Character
+	if len(cast) > 1 {
+		b = cast[1].Character
+	}
+	return strings.NewReplacer(
+		"{a}", a, "{b}", b,
+		"{job}", pick(r, jobs),
+		"{place}", pick(r, places),
+		"{thing}", strings.ToLower(pick(r, nouns)),
+	).Replace(pick(r, templates))
+}
+
+func castOf(r *rand.Rand, people []person, n int) []person {
+	cast := make([]person, 0, n)
+	seen := make(map[int]bool)
+	for len(cast) < n {
+		p := people[r.Intn(len(people))]
+		if seen[p.ID] {
+			continue
+		}
+		seen[p.ID] = true
+		p.Character = pick(r, firstNames) + " " + pick(r, lastNames)
+		cast = append(cast, p)
+	}
+	return cast
+}
+
+func pickGenres(r *rand.Rand, genres []genre) []int {
+	n := 1 + r.Intn(3)
+	ids := make([]int, 0, n)
+	for _, i := range r.Perm(len(genres))[:n] {
+		ids = append(ids, genres[i].ID)
+	}
+	return ids
+}
+
+func pickProviders(r *rand.Rand) []string {
+	var picked []string
+	for _, i := range r.Perm(len(providers))[:r.Intn(3)] {
+		picked = append(picked, providers[i])
+	}
+	sort.Strings(picked)
+	return picked
+}
+
+func keywords(r *rand.Rand, genre string) []string {
+	words := append([]string(nil), keywordsByGenre[genre]...)
+	r.Shuffle(len(words), func(i, j int) { words[i], words[j] = words[j], words[i] })
+	return words[:min(len(words), 1+r.Intn(3))]
+}
+
+func language(r *rand.Rand) string {
+	return pick(r, []string{"en", "en", "en", "en", "en", "fr", "es", "ja", "ko", "de"})
+}
+
+func genreName(genres []genre, id int) string {
+	for _, g := range genres {
+		if g.ID == id {
+			return g.Name
+		}
+	}
+	return ""
+}
+
+func pick[T any](r *rand.Rand, items []T) T {
+	return items[r.Intn(len(items))]
+}
+
+func round(f float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p
+}
@@ -0,0 +1,352 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/ical"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/pkg/models"
+)
+
+// Record is a single line of the JSON Lines export
+type Record struct {
+	Type        string   `json:"type"` // "watchlist", "rating" or "diary"
+	TMDBID      int      `json:"tmdb_id"`
+	IMDBID      string   `json:"imdb_id,omitempty"`
+	MediaType   string   `json:"media_type"`
+	Title       string   `json:"title"`
+	Year        int      `json:"year,omitempty"`
+	Rating      float64  `json:"rating,omitempty"`
+	Date        string   `json:"date,omitempty"`
+	Watched     bool     `json:"watched,omitempty"`
+	Rewatch     bool     `json:"rewatch,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	PosterPath  string   `json:"poster_path,omitempty"`
+	ReleaseDate string   `json:"release_date,omitempty"`
+}
+
+// lookupConcurrency bounds the IMDb ID lookups running at once
+const lookupConcurrency = 4
+
+// maxCachedIDs bounds the IMDb IDs remembered between exports
+const maxCachedIDs = 10000
+
+// Exporter writes a user's library as a zip archive
+type Exporter struct {
+	movieService *services.MovieService
+
+	// imdbIDs caches looked up IMDb IDs by key, they do not change
+	mu      sync.Mutex
+	imdbIDs map[string]string
+}
+
+func NewExporter(movieService *services.MovieService) *Exporter {
+	return &Exporter{movieService: movieService, imdbIDs: make(map[string]string)}
+}
+
+// WriteZip writes watchlist.csv, ratings.csv and diary.csv in Letterboxd's
+// import format, library.jsonl with every record and diary.ics with watch dates
+func (e *Exporter) WriteZip(ctx context.Context, w io.Writer, library *models.Library, now time.Time) error {
+	imdbIDs := e.lookupIMDBIDs(ctx, library)
+	imdbID := func(id int, mediaType, known string) string {
+		if known != "" {
+			return known
+		}
+		return imdbIDs[key(id, mediaType)]
+	}
+
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"watchlist.csv", func(w io.Writer) error {
+			rows := [][]string{{"tmdbID", "imdbID", "Title", "Year"}}
+			for _, item := range library.Watchlist {
+				if item.MediaType != "movie" {
+					continue
+				}
+				rows = append(rows, []string{
+					strconv.Itoa(item.ID),
+					imdbID(item.ID, item.MediaType, item.IMDBID),
+					item.Title,
+					formatYear(yearOf(item.ReleaseDate)),
+				})
+			}
+			return writeCSV(w, rows)
+		}},
+		{"ratings.csv", func(w io.Writer) error {
+			rows := [][]string{{"tmdbID", "imdbID", "Title", "Year", "Rating10"}}
+			for _, rating := range library.Ratings {
+				if rating.MediaType != "movie" {
+					continue
+				}
+				rows = append(rows, []string{
+					strconv.Itoa(rating.ID),
+					imdbID(rating.ID, rating.MediaType, rating.IMDBID),
+					rating.Title,
+					formatYear(rating.Year),
+					formatRating(rating.Rating),
+				})
+			}
+			return writeCSV(w, rows)
+		}},
+		{"diary.csv", func(w io.Writer) error {
+			rows := [][]string{{"tmdbID", "imdbID", "Title", "Year", "Rating10", "WatchedDate", "Rewatch", "Tags"}}
+			for _, entry := range library.Diary {
+				if entry.MediaType != "movie" {
+					continue
+				}
+				rewatch := ""
+				if entry.Rewatch {
+					rewatch = "Yes"
+				}
+				rows = append(rows, []string{
+					strconv.Itoa(entry.ID),
+					imdbID(entry.ID, entry.MediaType, entry.IMDBID),
+					entry.Title,
+					formatYear(entry.Year),
+					formatRating(entry.Rating),
+					entry.WatchedDate,
+					rewatch,
+					strings.Join(entry.Tags, ", "),
+				})
+			}
+			return writeCSV(w, rows)
+		}},
+		{"library.jsonl", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			for _, item := range library.Watchlist {
+				err := enc.Encode(Record{
+					Type:        "watchlist",
+					TMDBID:      item.ID,
+					IMDBID:      imdbID(item.ID, item.MediaType, item.IMDBID),
+					MediaType:   item.MediaType,
+					Title:       item.Title,
+					Year:        yearOf(item.ReleaseDate),
+					Date:        item.AddedDate,
+					Watched:     item.Watched,
+					PosterPath:  item.PosterPath,
+					ReleaseDate: item.ReleaseDate,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			for _, rating := range library.Ratings {
+				err := enc.Encode(Record{
+					Type:      "rating",
+					TMDBID:    rating.ID,
+					IMDBID:    imdbID(rating.ID, rating.MediaType, rating.IMDBID),
+					MediaType: rating.MediaType,
+					Title:     rating.Title,
+					Year:      rating.Year,
+					Rating:    rating.Rating,
+					Date:      rating.RatedDate,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			for _, entry := range library.Diary {
+				err := enc.Encode(Record{
+					Type:      "diary",
+					TMDBID:    entry.ID,
+					IMDBID:    imdbID(entry.ID, entry.MediaType, entry.IMDBID),
+					MediaType: entry.MediaType,
+					Title:     entry.Title,
+					Year:      entry.Year,
+					Rating:    entry.Rating,
+					Date:      entry.WatchedDate,
+					Rewatch:   entry.Rewatch,
+					Tags:      entry.Tags,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"diary.ics", func(w io.Writer) error {
+			_, err := diaryCalendar(library, now).WriteTo(w)
+			return err
+		}},
+	}
+
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", file.name, err)
+		}
+		if err := file.write(fw); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// lookupIMDBIDs fetches IMDb IDs for titles that were saved without one, a
+// few at a time and from the cache where it can. A failed lookup leaves the
+// ID blank rather than failing the whole export.
+func (e *Exporter) lookupIMDBIDs(ctx context.Context, library *models.Library) map[string]string {
+	ids := make(map[string]string)
+	missing := make(map[string]bool)
+
+	note := func(id int, mediaType, imdbID string) {
+		k := key(id, mediaType)
+		if imdbID != "" {
+			ids[k] = imdbID
+		} else if id > 0 {
+			missing[k] = true
+		}
+	}
+	for _, item := range library.Watchlist {
+		note(item.ID, item.MediaType, item.IMDBID)
+	}
+	for _, rating := range library.Ratings {
+		note(rating.ID, rating.MediaType, rating.IMDBID)
+	}
+	for _, entry := range library.Diary {
+		note(entry.ID, entry.MediaType, entry.IMDBID)
+	}
+
+	e.mu.Lock()
+	for k := range missing {
+		if _, ok := ids[k]; ok {
+			delete(missing, k)
+		} else if id, ok := e.imdbIDs[k]; ok {
+			ids[k] = id
+			delete(missing, k)
+		}
+	}
+	e.mu.Unlock()
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, lookupConcurrency)
+	)
+acquire:
+	for k := range missing {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break acquire
+		}
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			mediaType, id, _ := strings.Cut(k, "/")
+			externalIDs, err := e.movieService.GetExternalIDs(ctx, mediaType, id)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			ids[k] = externalIDs.IMDBID
+			mu.Unlock()
+		}(k)
+	}
+	wg.Wait()
+
+	e.mu.Lock()
+	if len(e.imdbIDs)+len(missing) > maxCachedIDs {
+		e.imdbIDs = make(map[string]string)
+	}
+	for k := range missing {
+		if id, ok := ids[k]; ok {
+			e.imdbIDs[k] = id
+		}
+	}
+	e.mu.Unlock()
+
+	return ids
+}
+
+func diaryCalendar(library *models.Library, now time.Time) *ical.Calendar {
+	calendar := &ical.Calendar{Name: "Watch diary"}
+	for i, entry := range library.Diary {
+		date, err := time.Parse("2006-01-02", entry.WatchedDate)
+		if err != nil {
+			continue
+		}
+
+		summary := entry.Title
+		if entry.Year > 0 {
+			summary = fmt.Sprintf("%s (%d)", entry.Title, entry.Year)
+		}
+		if entry.Rewatch {
+			summary += " (rewatch)"
+		}
+
+		description := ""
+		if entry.Rating > 0 {
+			description = fmt.Sprintf("Rated %s/10", formatRating(entry.Rating))
+		}
+
+		calendar.Events = append(calendar.Events, ical.Event{
+			// The index tells apart two watches of a title on one day
+			UID:         fmt.Sprintf("diary-%d-%s-%d-%s@movie-discovery-app", i, entry.MediaType, entry.ID, entry.WatchedDate),
+			Summary:     summary,
+			Description: description,
+			URL:         fmt.Sprintf("https://www.themoviedb.org/%s/%d", entry.MediaType, entry.ID),
+			Start:       date,
+			AllDay:      true,
+			Stamp:       now,
+		})
+	}
+	return calendar
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func key(id int, mediaType string) string {
+	return fmt.Sprintf("%s/%d", mediaType, id)
+}
+
+func yearOf(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+func formatYear(year int) string {
+	if year == 0 {
+		return ""
+	}
+	return strconv.Itoa(year)
+}
+
+func formatRating(rating float64) string {
+	if rating == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(rating, 'f', -1, 64)
+}
@@ -0,0 +1,60 @@
+package fakeupstream
+
+import "strings"
+
+// TB is the part of testing.TB the assertions use
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertCalled fails t unless path was requested at least once
+func (s *Server) AssertCalled(t TB, path string) {
+	t.Helper()
+	if len(s.Calls(path)) == 0 {
+		t.Errorf("fakeupstream: %s was not requested; got %s", path, s.paths())
+	}
+}
+
+// AssertNotCalled fails t if path was requested
+func (s *Server) AssertNotCalled(t TB, path string) {
+	t.Helper()
+	if n := len(s.Calls(path)); n > 0 {
+		t.Errorf("fakeupstream: %s was requested %d times, want none", path, n)
+	}
+}
+
+// AssertCallCount fails t unless path was requested exactly n times
+func (s *Server) AssertCallCount(t TB, path string, n int) {
+	t.Helper()
+	if got := len(s.Calls(path)); got != n {
+		t.Errorf("fakeupstream: %s was requested %d times, want %d", path, got, n)
+	}
+}
+
+// AssertQuery fails t unless the last request for path had the query
+// parameter key set to value
+func (s *Server) AssertQuery(t TB, path, key, value string) {
+	t.Helper()
+	calls := s.Calls(path)
+	if len(calls) == 0 {
+		t.Errorf("fakeupstream: %s was not requested; got %s", path, s.paths())
+		return
+	}
+	if got := calls[len(calls)-1].Query.Get(key); got != value {
+		t.Errorf("fakeupstream: %s was requested with %s=%q, want %q", path, key, got, value)
+	}
+}
+
+// paths lists the requested paths for failure messages
+func (s *Server) paths() string {
+	requests := s.Requests()
+	if len(requests) == 0 {
+		return "no requests"
+	}
+	paths := make([]string, len(requests))
+	for i, r := range requests {
+		paths[i] = r.Path
+	}
+	return strings.Join(paths, ", ")
+}
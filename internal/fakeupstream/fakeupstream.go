@@ -0,0 +1,318 @@
+// Package fakeupstream is a stand-in for the TMDB and OMDB APIs that serves
+// canned responses from a fixture directory, so the app and its tests run
+// without API keys or a network. Point the app at it with
+//
+//	TMDB_BASE_URL=<server url>/3
+//	OMDB_BASE_URL=<server url>
+//
+// Fixtures are JSON files named after the request path, answered by
+// upstreamfs: tmdb/movie/550.json answers /3/movie/550 and
+// omdb/tt0137523.json answers /?i=tt0137523. The server can be slowed down,
+// made to fail, and asked which requests it got.
+package fakeupstream
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/upstreamfs"
+)
+
+//go:embed fixtures
+var embedded embed.FS
+
+// DefaultFixtures holds a few well known movies and shows plus one movie and
+// one show with dates in the future, for the release calendar and notifications
+var DefaultFixtures fs.FS
+
+func init() {
+	var err error
+	if DefaultFixtures, err = fs.Sub(embedded, "fixtures"); err != nil {
+		panic(err)
+	}
+}
+
+// Fault is a failure the server can answer with instead of a fixture
+type Fault int
+
+const (
+	// RateLimited answers 429 with a Retry-After header
+	RateLimited Fault = iota + 1
+	// ServerError answers 500
+	ServerError
+	// MalformedJSON answers 200 with a body that is cut off halfway
+	MalformedJSON
+)
+
+func (f Fault) String() string {
+	switch f {
+	case RateLimited:
+		return "rate_limited"
+	case ServerError:
+		return "server_error"
+	case MalformedJSON:
+		return "malformed_json"
+	}
+	return "none"
+}
+
+// Options configures a Server. The zero value serves DefaultFixtures to
+// any API key, straight away and without errors.
+type Options struct {
+	// Fixtures defaults to DefaultFixtures
+	Fixtures fs.FS
+	// TMDBAPIKey and OMDBAPIKey are the only keys accepted when set
+	TMDBAPIKey string
+	OMDBAPIKey string
+	// Latency delays every response
+	Latency time.Duration
+	// ErrorRate is the share of requests, from 0 to 1, that get a random fault
+	ErrorRate float64
+	// Seed makes the random faults repeatable when not zero
+	Seed int64
+	// Logger logs every request when set
+	Logger *slog.Logger
+}
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Status int
+	Fault  Fault
+	Time   time.Time
+}
+
+// Server is an http.Handler answering TMDB requests under /3/ and OMDB
+// requests at /
+type Server struct {
+	opts     Options
+	fixtures *upstreamfs.Handler
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	requests []Request
+	// faults are injected by Fail, in the order they were added
+	faults []injected
+}
+
+type injected struct {
+	prefix string
+	fault  Fault
+	times  int
+}
+
+// New returns a Server for opts
+func New(opts Options) *Server {
+	if opts.Fixtures == nil {
+		opts.Fixtures = DefaultFixtures
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Server{opts: opts, fixtures: upstreamfs.New(opts.Fixtures), rand: rand.New(rand.NewSource(seed))}
+}
+
+// Fail makes the next times requests whose path starts with prefix fail
+// with fault. A prefix of "" matches every request and times <= 0 means
+// until Reset.
+func (s *Server) Fail(prefix string, fault Fault, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, injected{prefix: prefix, fault: fault, times: times})
+}
+
+// Reset forgets recorded requests and injected faults
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.faults = nil
+}
+
+// Transport returns an http.RoundTripper that answers from the server in
+// process, whatever host the request is for, without opening a socket
+func (s *Server) Transport() http.RoundTripper {
+	return upstreamfs.Transport(s)
+}
+
+// Requests returns the requests received so far, oldest first
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Calls returns the requests received for path, e.g. "/3/movie/550"
+func (s *Server) Calls(path string) []Request {
+	var calls []Request
+	for _, r := range s.Requests() {
+		if r.Path == path {
+			calls = append(calls, r)
+		}
+	}
+	return calls
+}
+
+// fault picks the fault for a request, if any
+func (s *Server) fault(path string) Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if !strings.HasPrefix(path, f.prefix) {
+			continue
+		}
+		if f.times > 0 {
+			if f.times--; f.times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			} else {
+				s.faults[i] = f
+			}
+		}
+		return f.fault
+	}
+
+	if s.opts.ErrorRate > 0 && s.rand.Float64() < s.opts.ErrorRate {
+		return Fault(s.rand.Intn(3) + 1)
+	}
+	return 0
+}
+
+// maxRequests bounds the requests kept for assertions, so a long running
+// server does not grow without limit
+const maxRequests = 10000
+
+func (s *Server) record(r Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.requests) == maxRequests {
+		s.requests = append(s.requests[:0], s.requests[1:]...)
+	}
+	s.requests = append(s.requests, r)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	entry := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Time:   time.Now(),
+	}
+	defer func() {
+		entry.Status = rec.status
+		s.record(entry)
+		if s.opts.Logger != nil {
+			s.opts.Logger.Info("request", "method", entry.Method, "path", entry.Path,
+				"status", entry.Status, "fault", entry.Fault, "duration", time.Since(entry.Time))
+		}
+	}()
+
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(rec, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmdb := strings.HasPrefix(req.URL.Path, "/3/")
+	if !tmdb && req.URL.Path != "/" {
+		http.NotFound(rec, req)
+		return
+	}
+	if tmdb {
+		if !s.tmdbAuthorized(req) {
+			writeJSON(rec, http.StatusUnauthorized, tmdbError(7, "Invalid API key: You must be granted a valid key."))
+			return
+		}
+	} else if msg := s.omdbUnauthorized(req); msg != "" {
+		writeJSON(rec, http.StatusUnauthorized, map[string]string{"Response": "False", "Error": msg})
+		return
+	}
+
+	if entry.Fault = s.fault(req.URL.Path); entry.Fault != 0 {
+		writeFault(rec, entry.Fault)
+		return
+	}
+
+	if tmdb {
+		s.fixtures.ServeTMDB(rec, req)
+	} else {
+		s.fixtures.ServeOMDB(rec, req)
+	}
+}
+
+func (s *Server) tmdbAuthorized(req *http.Request) bool {
+	if s.opts.TMDBAPIKey == "" {
+		return true
+	}
+	if req.URL.Query().Get("api_key") == s.opts.TMDBAPIKey {
+		return true
+	}
+	return req.Header.Get("Authorization") == "Bearer "+s.opts.TMDBAPIKey
+}
+
+// omdbUnauthorized returns OMDB's error message for a missing or wrong key
+func (s *Server) omdbUnauthorized(req *http.Request) string {
+	key := req.URL.Query().Get("apikey")
+	switch {
+	case s.opts.OMDBAPIKey == "":
+		return ""
+	case key == "":
+		return "No API key provided."
+	case key != s.opts.OMDBAPIKey:
+		return "Invalid API key!"
+	}
+	return ""
+}
+
+func writeFault(w http.ResponseWriter, fault Fault) {
+	switch fault {
+	case RateLimited:
+		w.Header().Set("Retry-After", "1")
+		writeJSON(w, http.StatusTooManyRequests, tmdbError(25, "Your request count (#) is over the allowed limit of (40)."))
+	case ServerError:
+		writeJSON(w, http.StatusInternalServerError, tmdbError(11, "Internal error: Something went wrong, contact TMDb."))
+	case MalformedJSON:
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		fmt.Fprint(w, `{"page":1,"results":[{"id":550,"title":"Fight`)
+	}
+}
+
+func tmdbError(code int, msg string) map[string]interface{} {
+	return map[string]interface{}{"status_code": code, "status_message": msg, "success": false}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
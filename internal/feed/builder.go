@@ -0,0 +1,310 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/internal/tracing"
+	"movie-discovery-app/pkg/models"
+)
+
+const (
+	// Feed readers poll often, TMDB lists do not change that fast
+	cacheTTL = 15 * time.Minute
+	// tagPrefix starts every entry ID (RFC 4151 tag URIs)
+	tagPrefix = "tag:movie-discovery-app,2024:"
+)
+
+// Builder builds feeds of TMDB lists and user diaries
+type Builder struct {
+	store        *storage.Store
+	movieService *services.MovieService
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedFeed
+	// firstSeen remembers when each entry of a list feed first showed up, so
+	// entries keep their timestamps and unchanged lists keep their Updated
+	firstSeen map[string]map[string]time.Time
+}
+
+type cachedFeed struct {
+	feed  *Feed
+	built time.Time
+}
+
+func NewBuilder(store *storage.Store, movieService *services.MovieService) *Builder {
+	return &Builder{
+		store:        store,
+		movieService: movieService,
+		now:          time.Now,
+		cache:        make(map[string]cachedFeed),
+		firstSeen:    make(map[string]map[string]time.Time),
+	}
+}
+
+// SetClock replaces time.Now, so tests get stable feed timestamps
+func (b *Builder) SetClock(now func() time.Time) {
+	b.now = now
+}
+
+// Trending builds the feed of what is trending today or this week
+func (b *Builder) Trending(ctx context.Context, timeWindow string) (*Feed, error) {
+	if timeWindow != "week" {
+		timeWindow = "day"
+	}
+
+	key := "trending/" + timeWindow
+	if feed := b.cached(ctx, key); feed != nil {
+		return feed, nil
+	}
+
+	trending, err := b.movieService.GetTrending(ctx, timeWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	title := "Trending today"
+	if timeWindow == "week" {
+		title = "Trending this week"
+	}
+
+	feed := b.listFeed(key, title, "https://www.themoviedb.org/", trending.Results, "")
+	b.remember(key, feed)
+	return feed, nil
+}
+
+// Upcoming builds the feed of movies or TV shows coming out from today on
+func (b *Builder) Upcoming(ctx context.Context, mediaType, region string) (*Feed, error) {
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	key := "upcoming/" + mediaType + "/" + region
+	if feed := b.cached(ctx, key); feed != nil {
+		return feed, nil
+	}
+
+	today := b.now().UTC().Format("2006-01-02")
+	filters := url.Values{}
+	if mediaType == "tv" {
+		filters.Set("first_air_date.gte", today)
+		filters.Set("sort_by", "first_air_date.asc")
+	} else {
+		filters.Set("primary_release_date.gte", today)
+		filters.Set("sort_by", "primary_release_date.asc")
+		if region != "" {
+			filters.Set("region", region)
+		}
+	}
+	if region != "" {
+		filters.Set("watch_region", region)
+	}
+
+	results, err := b.movieService.Discover(ctx, mediaType, filters, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	title := "Upcoming movies"
+	link := "https://www.themoviedb.org/movie/upcoming"
+	if mediaType == "tv" {
+		title = "Upcoming TV shows"
+		link = "https://www.themoviedb.org/tv/on-the-air"
+	}
+	if region != "" {
+		title += " in " + region
+	}
+
+	feed := b.listFeed(key, title, link, results.Results, mediaType)
+	b.remember(key, feed)
+	return feed, nil
+}
+
+// Diary builds the feed of a user's diary, newest watch first
+func (b *Builder) Diary(userID string) (*Feed, error) {
+	library, err := b.store.Library(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Diary entries do not store posters, watchlist items often do
+	posters := make(map[string]string)
+	for _, item := range library.Watchlist {
+		if item.PosterPath != "" {
+			posters[fmt.Sprintf("%s/%d", item.MediaType, item.ID)] = item.PosterPath
+		}
+	}
+
+	feed := &Feed{
+		ID:    tagPrefix + "diary/" + userID,
+		Title: userID + "'s diary",
+		Link:  "https://www.themoviedb.org/",
+	}
+
+	for i := len(library.Diary) - 1; i >= 0; i-- {
+		entry := library.Diary[i]
+		watched, err := time.Parse("2006-01-02", entry.WatchedDate)
+		if err != nil {
+			continue
+		}
+
+		mediaType := entry.MediaType
+		if mediaType == "" {
+			mediaType = "movie"
+		}
+
+		title := entry.Title
+		if entry.Year > 0 {
+			title = fmt.Sprintf("%s (%d)", title, entry.Year)
+		}
+		if entry.Rewatch {
+			title = "Rewatched " + title
+		} else {
+			title = "Watched " + title
+		}
+
+		var summary []string
+		if entry.Rating > 0 {
+			summary = append(summary, fmt.Sprintf("Rated %g/10", entry.Rating))
+		}
+		if len(entry.Tags) > 0 {
+			summary = append(summary, "Tags: "+strings.Join(entry.Tags, ", "))
+		}
+
+		feed.Entries = append(feed.Entries, Entry{
+			ID:        fmt.Sprintf("%sdiary/%s/%s/%d/%s", tagPrefix, userID, mediaType, entry.ID, entry.WatchedDate),
+			Title:     title,
+			Link:      fmt.Sprintf("https://www.themoviedb.org/%s/%d", mediaType, entry.ID),
+			Summary:   strings.Join(summary, ". "),
+			Published: watched,
+			Updated:   watched,
+			Enclosure: poster(posters[fmt.Sprintf("%s/%d", mediaType, entry.ID)]),
+		})
+	}
+
+	feed.Updated = latest(feed.Entries, b.now())
+	return feed, nil
+}
+
+// listFeed turns a TMDB result list into a feed. mediaType is used for
+// results that do not say what they are, such as discover results.
+func (b *Builder) listFeed(key, title, link string, results []models.Media, mediaType string) *Feed {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now().UTC().Truncate(time.Second)
+	previous := b.firstSeen[key]
+	current := make(map[string]time.Time)
+
+	feed := &Feed{
+		ID:    tagPrefix + key,
+		Title: title,
+		Link:  link,
+	}
+
+	for _, media := range results {
+		kind := media.MediaType
+		if kind == "" {
+			kind = mediaType
+		}
+		if kind != "movie" && kind != "tv" {
+			// Trending also lists people
+			continue
+		}
+
+		name, date := media.Title, media.ReleaseDate
+		if kind == "tv" {
+			name, date = media.Name, media.FirstAirDate
+		}
+		if year := yearOf(date); year != "" {
+			name += " (" + year + ")"
+		}
+
+		id := fmt.Sprintf("%s%s/%d", tagPrefix, kind, media.ID)
+		seen, ok := previous[id]
+		if !ok {
+			seen = now
+		}
+		current[id] = seen
+
+		// An entry is published when it joins the list, not when the title came out
+		entry := Entry{
+			ID:        id,
+			Title:     name,
+			Link:      fmt.Sprintf("https://www.themoviedb.org/%s/%d", kind, media.ID),
+			Summary:   media.Overview,
+			Published: seen,
+			Updated:   seen,
+			Enclosure: poster(media.PosterPath),
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	// Forget entries that dropped off the list so the map does not grow
+	b.firstSeen[key] = current
+	feed.Updated = latest(feed.Entries, now)
+	return feed
+}
+
+func (b *Builder) cached(ctx context.Context, key string) *Feed {
+	_, span := tracing.Start(ctx, "cache.lookup", tracing.WithAttributes(
+		tracing.String("cache.name", "feed"),
+		tracing.String("cache.key", key),
+	))
+	defer span.End()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.cache[key]; ok && b.now().Sub(c.built) < cacheTTL {
+		metrics.CacheLookup("feed", true)
+		span.SetAttributes(tracing.Bool("cache.hit", true))
+		return c.feed
+	}
+	metrics.CacheLookup("feed", false)
+	span.SetAttributes(tracing.Bool("cache.hit", false))
+	return nil
+}
+
+func (b *Builder) remember(key string, feed *Feed) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cache[key] = cachedFeed{feed: feed, built: b.now()}
+}
+
+func poster(url string) *Enclosure {
+	if url == "" {
+		return nil
+	}
+	return &Enclosure{URL: url, Type: "image/jpeg"}
+}
+
+// latest returns the newest entry update, or fallback for an empty feed
+func latest(entries []Entry, fallback time.Time) time.Time {
+	if len(entries) == 0 {
+		return fallback.UTC().Truncate(time.Second)
+	}
+	var t time.Time
+	for _, e := range entries {
+		if e.Updated.After(t) {
+			t = e.Updated
+		}
+	}
+	return t
+}
+
+func yearOf(date string) string {
+	if len(date) >= 4 {
+		return date[:4]
+	}
+	return ""
+}
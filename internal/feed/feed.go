@@ -0,0 +1,209 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Feed is a format independent feed that can be written as Atom or RSS 2.0
+type Feed struct {
+	ID          string
+	Title       string
+	Description string
+	Link        string // the HTML page the feed is about
+	Self        string // the URL of the feed itself
+	Updated     time.Time
+	Entries     []Entry
+}
+
+// Entry is one item of a feed. The ID must stay the same for the same item
+// so feed readers do not show it twice.
+type Entry struct {
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Published time.Time
+	Updated   time.Time
+	Enclosure *Enclosure
+}
+
+// Enclosure is a file attached to an entry, such as a poster
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomPerson  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Summary   string     `xml:"summary,omitempty"`
+}
+
+// WriteAtom writes the feed as an Atom (RFC 4287) document
+func (f *Feed) WriteAtom(w io.Writer) error {
+	doc := atomFeed{
+		ID:       f.ID,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  atomTime(f.Updated),
+		Author:   atomPerson{Name: "Movie Discovery App"},
+	}
+	if f.Link != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.Link, Rel: "alternate", Type: "text/html"})
+	}
+	if f.Self != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.Self, Rel: "self", Type: "application/atom+xml"})
+	}
+
+	for _, e := range f.Entries {
+		entry := atomEntry{
+			ID:      e.ID,
+			Title:   e.Title,
+			Updated: atomTime(e.Updated),
+			Summary: e.Summary,
+		}
+		if !e.Published.IsZero() {
+			entry.Published = atomTime(e.Published)
+		}
+		if e.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Href: e.Link, Rel: "alternate", Type: "text/html"})
+		}
+		if e.Enclosure != nil {
+			entry.Links = append(entry.Links, atomLink{Href: e.Enclosure.URL, Rel: "enclosure", Type: e.Enclosure.Type, Length: e.Enclosure.Length})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return writeXML(w, doc)
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLink      *rssSelf  `xml:"atom:link,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+// WriteRSS writes the feed as an RSS 2.0 document
+func (f *Feed) WriteRSS(w io.Writer) error {
+	description := f.Description
+	if description == "" {
+		description = f.Title
+	}
+
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   description,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	if f.Self != "" {
+		doc.Channel.AtomLink = &rssSelf{Href: f.Self, Rel: "self", Type: "application/rss+xml"}
+	}
+
+	for _, e := range f.Entries {
+		// RSS only has one date, the date the item was published
+		date := e.Published
+		if date.IsZero() {
+			date = e.Updated
+		}
+
+		item := rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			Description: e.Summary,
+			GUID:        rssGUID{Value: e.ID},
+			PubDate:     date.UTC().Format(time.RFC1123Z),
+		}
+		if e.Enclosure != nil {
+			// Length is required in RSS, 0 is the accepted value for unknown
+			item.Enclosure = &rssEnclosure{URL: e.Enclosure.URL, Type: e.Enclosure.Type, Length: e.Enclosure.Length}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,86 @@
+// Package golden compares test output with files under testdata. Run the
+// tests with -update to write the current output to the files instead:
+//
+//	go test ./internal/api -update
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// TB is the part of testing.TB the assertions use
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// Assert fails t unless got matches the file at path
+func Assert(t TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden: %v (run with -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("golden: output differs from %s (run with -update to accept it)\n%s", path, firstDiff(want, got))
+	}
+}
+
+// AssertJSON indents got, a JSON document or a value to encode, and compares
+// it with the file at path
+func AssertJSON(t TB, path string, got interface{}) {
+	t.Helper()
+	var buf bytes.Buffer
+	if raw, ok := got.([]byte); ok {
+		if err := json.Indent(&buf, bytes.TrimSpace(raw), "", "  "); err != nil {
+			t.Fatalf("golden: output is not JSON: %v\n%s", err, raw)
+		}
+		buf.WriteByte('\n')
+	} else {
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(got); err != nil {
+			t.Fatalf("golden: %v", err)
+		}
+	}
+	Assert(t, path, buf.Bytes())
+}
+
+// firstDiff shows the first line where want and got differ
+func firstDiff(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return "line " + strconv.Itoa(i+1) + ":\n  want: " + w + "\n   got: " + g
+		}
+	}
+	return ""
+}
@@ -0,0 +1,532 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// DefaultListSize is the number of items a list field is assumed to return
+// when measuring complexity, unless the field says otherwise or is given a
+// first argument
+const DefaultListSize = 10
+
+// Limits bound the work one query can ask for. Zero means unlimited.
+type Limits struct {
+	// MaxDepth is how deeply fields may nest; { movie { title } } is 2 deep
+	MaxDepth int
+	// MaxComplexity caps the sum of the costs of every field the query
+	// could resolve, where fields under a list count once per item
+	MaxComplexity int
+}
+
+// Response is the result of a query
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Do parses, validates and executes a query
+func (s *Schema) Do(ctx context.Context, query, operationName string, variables map[string]interface{}, limits Limits) *Response {
+	doc, err := Parse(query)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+	if errs := s.Validate(doc); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	return s.Execute(ctx, doc, operationName, variables, limits)
+}
+
+// Execute runs an operation of a validated document. Fields of an object
+// and items of a list are resolved concurrently, so lookups made through a
+// Loader are batched.
+func (s *Schema) Execute(ctx context.Context, doc *Document, operationName string, variables map[string]interface{}, limits Limits) *Response {
+	op, err := operation(doc, operationName)
+	if err != nil {
+		return &Response{Errors: []*Error{err}}
+	}
+
+	e := &executor{schema: s, fragments: doc.Fragments}
+	if errs := e.coerceVariables(op, variables); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	depth, cost := e.measure(s.Query, op.SelectionSet, 1, limits.MaxDepth)
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &Response{Errors: []*Error{limitError(op.Loc, "QUERY_TOO_DEEP",
+			"Query is nested more than %d fields deep.", limits.MaxDepth)}}
+	}
+	if limits.MaxComplexity > 0 && cost > limits.MaxComplexity {
+		return &Response{Errors: []*Error{limitError(op.Loc, "QUERY_TOO_COMPLEX",
+			"Query has a complexity of %d, more than the limit of %d.", cost, limits.MaxComplexity)}}
+	}
+
+	data, ok := e.selectionSet(ctx, s.Query, nil, op.SelectionSet, nil)
+	resp := &Response{Errors: e.errs}
+	if ok {
+		resp.Data = data
+	} else {
+		// data is present, but null, once execution has started
+		resp.Data = json.RawMessage("null")
+	}
+	return resp
+}
+
+func limitError(loc Location, code, format string, args ...interface{}) *Error {
+	err := errorAt(loc, format, args...)
+	err.Extensions = map[string]interface{}{"code": code}
+	return err
+}
+
+// operation picks the operation to run
+func operation(doc *Document, name string) (*Operation, *Error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, &Error{Message: "Must provide operation name if query contains multiple operations."}
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("Unknown operation named %q.", name)}
+}
+
+type executor struct {
+	schema    *Schema
+	fragments map[string]*Fragment
+	vars      map[string]interface{}
+
+	mu   sync.Mutex
+	errs []*Error
+}
+
+func (e *executor) coerceVariables(op *Operation, input map[string]interface{}) []*Error {
+	e.vars = make(map[string]interface{})
+	var errs []*Error
+	for _, def := range op.Variables {
+		t := e.schema.typeOf(def.Type)
+		raw, present := input[def.Name]
+		if !present {
+			if def.Default.Kind != NoValue {
+				e.vars[def.Name], _ = coerceLiteral(t, def.Default, nil)
+			} else if _, required := t.(*NonNull); required {
+				errs = append(errs, errorAt(def.Loc, "Variable \"$%s\" of required type %q was not provided.", def.Name, t))
+			}
+			continue
+		}
+		v, err := coerceInput(t, raw)
+		if err != nil {
+			errs = append(errs, errorAt(def.Loc, "Variable \"$%s\" got invalid value %s; %s", def.Name, describe(raw), err))
+			continue
+		}
+		e.vars[def.Name] = v
+	}
+	return errs
+}
+
+// fieldList is a selection set's fields grouped by response key, in order
+type fieldList struct {
+	keys  []string
+	nodes map[string][]*FieldNode
+}
+
+// collect gathers the fields of set that apply to obj, expanding fragments
+// and dropping what @skip and @include leave out
+func (e *executor) collect(obj *Object, set []Selection, fields *fieldList, visited map[string]bool) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *FieldNode:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			key := sel.ResponseKey()
+			if _, ok := fields.nodes[key]; !ok {
+				fields.keys = append(fields.keys, key)
+			}
+			fields.nodes[key] = append(fields.nodes[key], sel)
+		case *FragmentSpread:
+			if visited[sel.Name] || !e.included(sel.Directives) {
+				continue
+			}
+			visited[sel.Name] = true
+			f := e.fragments[sel.Name]
+			if f == nil || f.TypeCondition != obj.Name {
+				continue
+			}
+			e.collect(obj, f.SelectionSet, fields, visited)
+		case *InlineFragment:
+			if !e.included(sel.Directives) || sel.TypeCondition != "" && sel.TypeCondition != obj.Name {
+				continue
+			}
+			e.collect(obj, sel.SelectionSet, fields, visited)
+		}
+	}
+}
+
+// subfields collects the selections of every node of a field
+func (e *executor) subfields(obj *Object, nodes []*FieldNode) *fieldList {
+	fields := &fieldList{nodes: make(map[string][]*FieldNode)}
+	visited := make(map[string]bool)
+	for _, node := range nodes {
+		e.collect(obj, node.SelectionSet, fields, visited)
+	}
+	return fields
+}
+
+func (e *executor) included(directives []*Directive) bool {
+	for _, d := range directives {
+		if len(d.Arguments) == 0 {
+			continue
+		}
+		v, _ := coerceLiteral(&NonNull{Boolean}, d.Arguments[0].Value, e.vars)
+		cond, _ := v.(bool)
+		if d.Name == "skip" && cond || d.Name == "include" && !cond {
+			return false
+		}
+	}
+	return true
+}
+
+// measure returns how deeply the selections nest and what they cost.
+// Measuring stops once maxDepth is exceeded.
+func (e *executor) measure(obj *Object, set []Selection, depth, maxDepth int) (int, int) {
+	fields := &fieldList{nodes: make(map[string][]*FieldNode)}
+	e.collect(obj, set, fields, make(map[string]bool))
+	return e.measureFields(obj, fields, depth, maxDepth)
+}
+
+func (e *executor) measureFields(obj *Object, fields *fieldList, depth, maxDepth int) (int, int) {
+	deepest, cost := depth, 0
+	if maxDepth > 0 && depth > maxDepth {
+		return depth, 0
+	}
+	for _, key := range fields.keys {
+		nodes := fields.nodes[key]
+		def := obj.Field(nodes[0].Name)
+		if def == nil {
+			continue
+		}
+		own := def.Cost
+		if own == 0 {
+			own = 1
+		}
+		cost = add(cost, own)
+
+		child, ok := namedType(def.Type).(*Object)
+		if !ok {
+			continue
+		}
+		d, c := e.measureFields(child, e.subfields(child, nodes), depth+1, maxDepth)
+		if d > deepest {
+			deepest = d
+		}
+		if isList(def.Type) {
+			c = mul(c, e.listSize(def, nodes[0]))
+		}
+		cost = add(cost, c)
+	}
+	return deepest, cost
+}
+
+// listSize is how many items a list field is expected to return
+func (e *executor) listSize(def *Field, node *FieldNode) int {
+	if findArg(def.Args, "first") != nil {
+		if args, err := e.args(def, node); err == nil {
+			if n, ok := args["first"].(int); ok && n >= 0 {
+				return n
+			}
+		}
+	}
+	if def.ListSize > 0 {
+		return def.ListSize
+	}
+	return DefaultListSize
+}
+
+func isList(t Type) bool {
+	_, ok := nullable(t).(*List)
+	return ok
+}
+
+// add and mul saturate rather than overflow, so a hostile query cannot wrap
+// its cost around to something small
+func add(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func mul(a, b int) int {
+	if b != 0 && a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
+
+// path is where in the response a value goes
+type path struct {
+	prev *path
+	key  interface{}
+}
+
+func (p *path) with(key interface{}) *path {
+	return &path{prev: p, key: key}
+}
+
+func (p *path) slice() []interface{} {
+	var keys []interface{}
+	for ; p != nil; p = p.prev {
+		keys = append([]interface{}{p.key}, keys...)
+	}
+	return keys
+}
+
+func (e *executor) fieldError(at *path, node *FieldNode, err error) {
+	gqlErr := &Error{Message: err.Error(), Locations: []Location{node.Loc}, Path: at.slice()}
+	if ext, ok := err.(interface{ Extensions() map[string]interface{} }); ok {
+		gqlErr.Extensions = ext.Extensions()
+	}
+	e.mu.Lock()
+	e.errs = append(e.errs, gqlErr)
+	e.mu.Unlock()
+}
+
+// selectionSet resolves set on source. It returns false when a non-null
+// field failed, making the whole object null.
+func (e *executor) selectionSet(ctx context.Context, obj *Object, source interface{}, set []Selection, at *path) (*object, bool) {
+	fields := &fieldList{nodes: make(map[string][]*FieldNode)}
+	e.collect(obj, set, fields, make(map[string]bool))
+	return e.fields(ctx, obj, source, fields, at)
+}
+
+func (e *executor) fields(ctx context.Context, obj *Object, source interface{}, fields *fieldList, at *path) (*object, bool) {
+	result := &object{keys: fields.keys, values: make([]interface{}, len(fields.keys))}
+	ok := make([]bool, len(fields.keys))
+
+	// Fields with resolvers may wait on a service or a loader, so they run
+	// alongside each other; struct fields are read in place
+	var wg sync.WaitGroup
+	for i, key := range fields.keys {
+		nodes := fields.nodes[key]
+		if nodes[0].Name == "__typename" {
+			result.values[i], ok[i] = obj.Name, true
+			continue
+		}
+		def := obj.Field(nodes[0].Name)
+		if def.Resolve == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result.values[i], ok[i] = e.field(ctx, def, source, nodes, at.with(fields.keys[i]))
+		}(i)
+	}
+	for i, key := range fields.keys {
+		nodes := fields.nodes[key]
+		if def := obj.Field(nodes[0].Name); def != nil && def.Resolve == nil {
+			result.values[i], ok[i] = e.field(ctx, def, source, nodes, at.with(key))
+		}
+	}
+	wg.Wait()
+
+	for _, fieldOK := range ok {
+		if !fieldOK {
+			return nil, false
+		}
+	}
+	return result, true
+}
+
+// field resolves one field. It returns false when the field is non-null
+// but resolved to null.
+func (e *executor) field(ctx context.Context, def *Field, source interface{}, nodes []*FieldNode, at *path) (interface{}, bool) {
+	value, err := e.resolve(ctx, def, source, nodes[0])
+	if err != nil {
+		e.fieldError(at, nodes[0], err)
+		return nil, !isNonNull(def.Type)
+	}
+	v, ok := e.complete(ctx, def.Type, nodes, value, at)
+	if !ok {
+		return nil, !isNonNull(def.Type)
+	}
+	return v, true
+}
+
+func (e *executor) resolve(ctx context.Context, def *Field, source interface{}, node *FieldNode) (value interface{}, err error) {
+	if def.Resolve == nil {
+		return defaultResolve(source, def.Name), nil
+	}
+	args, err := e.args(def, node)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			slog.ErrorContext(ctx, "graphql resolver panicked", "field", def.Name, "panic", p)
+			value, err = nil, fmt.Errorf("internal error resolving %s", def.Name)
+		}
+	}()
+	return def.Resolve(ctx, source, args)
+}
+
+// args coerces a field's arguments, filling in defaults
+func (e *executor) args(def *Field, node *FieldNode) (Args, error) {
+	args := make(Args, len(def.Args))
+	for _, arg := range def.Args {
+		var given *Argument
+		for _, a := range node.Arguments {
+			if a.Name == arg.Name {
+				given = a
+			}
+		}
+		if given != nil && given.Value.Kind == VariableValue {
+			if _, ok := e.vars[given.Value.Raw]; !ok {
+				given = nil
+			}
+		}
+		if given == nil {
+			if arg.Default != nil {
+				args[arg.Name] = arg.Default
+			} else if isNonNull(arg.Type) {
+				return nil, fmt.Errorf("Argument %q of required type %q was not provided.", arg.Name, arg.Type)
+			}
+			continue
+		}
+
+		v, err := coerceLiteral(arg.Type, given.Value, e.vars)
+		if err != nil {
+			return nil, fmt.Errorf("Argument %q has an invalid value: %s", arg.Name, err)
+		}
+		if v == nil && isNonNull(arg.Type) {
+			return nil, fmt.Errorf("Argument %q of non-null type %q must not be null.", arg.Name, arg.Type)
+		}
+		args[arg.Name] = v
+	}
+	return args, nil
+}
+
+func isNonNull(t Type) bool {
+	_, ok := t.(*NonNull)
+	return ok
+}
+
+// complete turns a resolved value into its response form. It returns false
+// when an error was recorded and the value must be null.
+func (e *executor) complete(ctx context.Context, t Type, nodes []*FieldNode, value interface{}, at *path) (interface{}, bool) {
+	if nn, ok := t.(*NonNull); ok {
+		v, ok := e.complete(ctx, nn.Of, nodes, value, at)
+		if !ok {
+			return nil, false
+		}
+		if v == nil {
+			e.fieldError(at, nodes[0], fmt.Errorf("Cannot return null for non-nullable field %s.", nodes[0].Name))
+			return nil, false
+		}
+		return v, true
+	}
+	if isNil(value) {
+		return nil, true
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		v, err := t.Serialize(value)
+		if err != nil {
+			e.fieldError(at, nodes[0], err)
+			return nil, false
+		}
+		return v, true
+	case *Enum:
+		s, ok := value.(string)
+		if !ok || !t.has(s) {
+			e.fieldError(at, nodes[0], fmt.Errorf("Enum %q cannot represent value: %s", t.Name, describe(value)))
+			return nil, false
+		}
+		return s, true
+	case *Object:
+		v, ok := e.fields(ctx, t, value, e.subfields(t, nodes), at)
+		if !ok {
+			return nil, false
+		}
+		return v, true
+	case *List:
+		return e.list(ctx, t, nodes, value, at)
+	}
+	return nil, false
+}
+
+func (e *executor) list(ctx context.Context, t *List, nodes []*FieldNode, value interface{}, at *path) (interface{}, bool) {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		e.fieldError(at, nodes[0], fmt.Errorf("Expected a list for field %s, got %T.", nodes[0].Name, value))
+		return nil, false
+	}
+
+	items := make([]interface{}, rv.Len())
+	ok := make([]bool, rv.Len())
+	completeItem := func(i int) {
+		v, itemOK := e.complete(ctx, t.Of, nodes, rv.Index(i).Interface(), at.with(i))
+		// A failed nullable item is null; a failed non-null one fails the list
+		items[i], ok[i] = v, itemOK || !isNonNull(t.Of)
+	}
+
+	if isLeaf(t.Of) {
+		for i := range items {
+			completeItem(i)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := range items {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				completeItem(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	for _, itemOK := range ok {
+		if !itemOK {
+			return nil, false
+		}
+	}
+	return items, true
+}
+
+// object is a response object that keeps its fields in query order
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		b.Write(k)
+		b.WriteByte(':')
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
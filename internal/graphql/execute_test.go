@@ -0,0 +1,453 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type testAuthor struct {
+	ID   int
+	Name string
+	Born int
+}
+
+type testBook struct {
+	ID       int
+	Title    string
+	AuthorID int
+	Tags     []string
+	Rating   float64
+	Genre    string
+}
+
+var (
+	testAuthors = map[string]testAuthor{
+		"1": {ID: 1, Name: "Ursula K. Le Guin", Born: 1929},
+		"2": {ID: 2, Name: "Octavia E. Butler", Born: 1947},
+	}
+	testBooks = []testBook{
+		{ID: 10, Title: "A Wizard of Earthsea", AuthorID: 1, Tags: []string{"magic", "coming of age"}, Rating: 4.5, Genre: "FANTASY"},
+		{ID: 11, Title: "The Dispossessed", AuthorID: 1, Tags: []string{"utopia"}, Rating: 4.25, Genre: "SCIENCE_FICTION"},
+		{ID: 12, Title: "Kindred", AuthorID: 2, Rating: 4.75, Genre: "SCIENCE_FICTION"},
+		{ID: 13, Title: "Parable of the Sower", AuthorID: 2, Tags: []string{"dystopia"}, Genre: "SCIENCE_FICTION"},
+	}
+)
+
+type loaderKey struct{}
+
+// testSchema is a small library of books and authors. Authors are loaded
+// through the context's loader, and fetched counts the keys it fetched.
+func testSchema(t *testing.T) (*Schema, func(context.Context) context.Context, *int32) {
+	t.Helper()
+	var fetched int32
+	newContext := func(ctx context.Context) context.Context {
+		loader := NewLoader(func(ctx context.Context, keys []string) []Result {
+			results := make([]Result, len(keys))
+			for i, key := range keys {
+				atomic.AddInt32(&fetched, 1)
+				if a, ok := testAuthors[key]; ok {
+					results[i].Value = a
+				} else {
+					results[i].Err = errors.New("no author " + key)
+				}
+			}
+			return results
+		})
+		return context.WithValue(ctx, loaderKey{}, loader)
+	}
+	loadAuthor := func(ctx context.Context, id string) (interface{}, error) {
+		return ctx.Value(loaderKey{}).(*Loader).Load(ctx, id)
+	}
+
+	genre := &Enum{Name: "Genre", Values: []string{"FANTASY", "SCIENCE_FICTION"}}
+	author := &Object{Name: "Author"}
+	book := &Object{Name: "Book", Description: "A book\nin the library", Fields: []*Field{
+		{Name: "id", Type: &NonNull{ID}},
+		{Name: "title", Type: &NonNull{String}},
+		{Name: "tags", Type: &NonNull{&List{&NonNull{String}}}},
+		{Name: "rating", Type: Float},
+		{Name: "genre", Type: genre},
+		{Name: "author", Type: author, Cost: 5, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return loadAuthor(ctx, itoa(source.(testBook).AuthorID))
+		}},
+		{Name: "broken", Type: String, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return nil, errors.New("broken")
+		}},
+		{Name: "required", Type: &NonNull{String}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return nil, nil
+		}},
+		{Name: "panics", Type: String, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			panic("oops")
+		}},
+	}}
+	author.Fields = []*Field{
+		{Name: "id", Type: &NonNull{ID}},
+		{Name: "name", Type: &NonNull{String}},
+		{Name: "born", Type: Int},
+		{Name: "books", Type: &NonNull{&List{&NonNull{book}}}, Args: []*Arg{{Name: "first", Type: Int}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			var books []testBook
+			for _, b := range testBooks {
+				if b.AuthorID == source.(testAuthor).ID {
+					books = append(books, b)
+				}
+			}
+			return first(books, args), nil
+		}},
+	}
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "hello", Type: &NonNull{String}, Args: []*Arg{{Name: "name", Type: String, Default: "world"}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return "hello " + args.String("name"), nil
+		}},
+		{Name: "book", Type: book, Args: []*Arg{{Name: "id", Type: &NonNull{ID}}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			for _, b := range testBooks {
+				if itoa(b.ID) == args.String("id") {
+					return b, nil
+				}
+			}
+			return nil, nil
+		}},
+		{Name: "books", Type: &NonNull{&List{&NonNull{book}}}, Args: []*Arg{{Name: "first", Type: Int, Default: 10}, {Name: "genre", Type: genre}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			var books []testBook
+			for _, b := range testBooks {
+				if g := args.String("genre"); g == "" || b.Genre == g {
+					books = append(books, b)
+				}
+			}
+			return first(books, args), nil
+		}},
+		{Name: "author", Type: author, Args: []*Arg{{Name: "id", Type: &NonNull{ID}}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return loadAuthor(ctx, args.String("id"))
+		}},
+		{Name: "ids", Type: &List{ID}, Args: []*Arg{{Name: "of", Type: &List{&NonNull{ID}}}}, Resolve: func(ctx context.Context, source interface{}, args Args) (interface{}, error) {
+			return args["of"], nil
+		}},
+	}}
+
+	schema, err := NewSchema(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema, newContext, &fetched
+}
+
+func first(books []testBook, args Args) []testBook {
+	if n, ok := args["first"].(int); ok && n < len(books) {
+		return books[:n]
+	}
+	return books
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func TestExecute(t *testing.T) {
+	schema, newContext, _ := testSchema(t)
+
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]interface{}
+		want      string
+	}{
+		{
+			name:  "fields in query order",
+			query: `{ book(id: 12) { title id rating genre tags } }`,
+			want:  `{"data":{"book":{"title":"Kindred","id":"12","rating":4.75,"genre":"SCIENCE_FICTION","tags":[]}}}`,
+		},
+		{
+			name:  "aliases and defaults",
+			query: `{ a: hello b: hello(name: "you") }`,
+			want:  `{"data":{"a":"hello world","b":"hello you"}}`,
+		},
+		{
+			name:  "nested lists",
+			query: `{ author(id: "2") { name books { title author { born } } } }`,
+			want:  `{"data":{"author":{"name":"Octavia E. Butler","books":[{"title":"Kindred","author":{"born":1947}},{"title":"Parable of the Sower","author":{"born":1947}}]}}}`,
+		},
+		{
+			name: "fragments merge",
+			query: `{ book(id: 10) { ...Names ... on Book { id } ... { title } } }
+				fragment Names on Book { title author { name } }`,
+			want: `{"data":{"book":{"title":"A Wizard of Earthsea","author":{"name":"Ursula K. Le Guin"},"id":"10"}}}`,
+		},
+		{
+			name:      "variables and directives",
+			query:     `query Q($id: ID!, $withTags: Boolean = false, $skip: Boolean!) { book(id: $id) { title tags @include(if: $withTags) rating @skip(if: $skip) } }`,
+			variables: map[string]interface{}{"id": 11, "skip": true},
+			want:      `{"data":{"book":{"title":"The Dispossessed"}}}`,
+		},
+		{
+			name:      "enum and list variables",
+			query:     `query($genre: Genre, $n: Int) { books(genre: $genre, first: $n) { id } ids(of: "7") }`,
+			variables: map[string]interface{}{"genre": "SCIENCE_FICTION", "n": 2},
+			want:      `{"data":{"books":[{"id":"11"},{"id":"12"}],"ids":["7"]}}`,
+		},
+		{
+			name:  "typename",
+			query: `{ __typename book(id: 10) { __typename } }`,
+			want:  `{"data":{"__typename":"Query","book":{"__typename":"Book"}}}`,
+		},
+		{
+			name:      "named operation",
+			query:     `query A { hello } query B { b: hello }`,
+			operation: "B",
+			want:      `{"data":{"b":"hello world"}}`,
+		},
+		{
+			name:  "null result",
+			query: `{ book(id: 99) { title } }`,
+			want:  `{"data":{"book":null}}`,
+		},
+		{
+			name:  "field error",
+			query: `{ book(id: 10) { title broken } }`,
+			want:  `{"data":{"book":{"title":"A Wizard of Earthsea","broken":null}},"errors":[{"message":"broken","locations":[{"line":1,"column":24}],"path":["book","broken"]}]}`,
+		},
+		{
+			name:  "non-null propagates to the nearest nullable field",
+			query: `{ book(id: 10) { title required } }`,
+			want:  `{"data":{"book":null},"errors":[{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":24}],"path":["book","required"]}]}`,
+		},
+		{
+			name:  "non-null list item fails the list",
+			query: `{ hello books(first: 1) { required } }`,
+			want:  `{"data":null,"errors":[{"message":"Cannot return null for non-nullable field required.","locations":[{"line":1,"column":27}],"path":["books",0,"required"]}]}`,
+		},
+		{
+			name:  "panic",
+			query: `{ book(id: 10) { panics } }`,
+			want:  `{"data":{"book":{"panics":null}},"errors":[{"message":"internal error resolving panics","locations":[{"line":1,"column":18}],"path":["book","panics"]}]}`,
+		},
+		{
+			name:  "loader error",
+			query: `{ author(id: 3) { name } }`,
+			want:  `{"data":{"author":null},"errors":[{"message":"no author 3","locations":[{"line":1,"column":3}],"path":["author"]}]}`,
+		},
+		{
+			name:      "missing required variable",
+			query:     `query($id: ID!) { book(id: $id) { title } }`,
+			variables: map[string]interface{}{},
+			want:      `{"errors":[{"message":"Variable \"$id\" of required type \"ID!\" was not provided.","locations":[{"line":1,"column":7}]}]}`,
+		},
+		{
+			name:      "invalid variable",
+			query:     `query($n: Int) { books(first: $n) { id } }`,
+			variables: map[string]interface{}{"n": 1.5},
+			want:      `{"errors":[{"message":"Variable \"$n\" got invalid value 1.5; Int cannot represent 1.5","locations":[{"line":1,"column":7}]}]}`,
+		},
+		{
+			name:  "ambiguous operation",
+			query: `query A { hello } query B { hello }`,
+			want:  `{"errors":[{"message":"Must provide operation name if query contains multiple operations."}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if errs := schema.Validate(doc); len(errs) > 0 {
+				t.Fatalf("invalid query: %v", errs)
+			}
+			resp := schema.Execute(newContext(context.Background()), doc, tt.operation, tt.variables, Limits{})
+			got, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, _, _ := testSchema(t)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{ nope }`, `1:3: Cannot query field "nope" on type "Query".`},
+		{`{ book(id: 1) { Title } }`, `1:17: Cannot query field "Title" on type "Book". Did you mean "title"?`},
+		{`{ book { title } }`, `1:3: Argument "id" of type "ID!" is required, but it was not provided.`},
+		{`{ book(id: 1, isbn: 2) { title } }`, `1:15: Unknown argument "isbn" on field "Query.book".`},
+		{`{ book(id: 1) }`, `1:3: Field "book" of type "Book" must have a selection of subfields. Did you mean "book { ... }"?`},
+		{`{ hello { length } }`, `1:3: Field "hello" must not have a selection since type "String!" has no subfields.`},
+		{`{ book(id: 1.5) { title } }`, `1:12: ID cannot represent a non-integer value: 1.5`},
+		{`{ book(id: null) { title } }`, `1:12: Expected value of type "ID!", found null.`},
+		{`{ books(genre: HORROR) { id } }`, `1:16: Value HORROR does not exist in "Genre" enum.`},
+		{`{ books(first: 3000000000) { id } }`, `1:16: Int cannot represent non 32-bit signed integer value: 3000000000`},
+		{`{ hello(name: 5) }`, `1:15: String cannot represent 5`},
+		{`{ a: hello b: hello a: hello(name: "x") }`, `1:21: Fields "a" conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.`},
+		{`{ hello: book(id: 1) { id } hello }`, `1:29: Fields "hello" conflict because "book" and "hello" are different fields. Use different aliases on the fields to fetch both if this was intentional.`},
+		{`{ ...Missing }`, `1:3: Unknown fragment "Missing".`},
+		{`{ hello } fragment F on Book { title }`, `1:11: Fragment "F" is never used.`},
+		{`{ book(id: 1) { ...A } } fragment A on Book { ...B } fragment B on Book { ...A }`, `1:26: Cannot spread fragment "A" within itself via A, B, A.`},
+		{`{ ...F } fragment F on Book { title }`, `1:3: Fragment "F" cannot be spread here as objects of type "Query" can never be of type "Book".`},
+		{`{ book(id: 1) { ... on Author { name } } }`, `1:17: Fragment cannot be spread here as objects of type "Book" can never be of type "Author".`},
+		{`{ ... on Shelf { hello } }`, `1:3: Unknown type "Shelf".`},
+		{`query($id: ID) { book(id: $id) { title } }`, `1:27: Variable "$id" of type "ID" used in position expecting type "ID!".`},
+		{`query Q { book(id: $id) { title } }`, `1:20: Variable "$id" is not defined by operation "Q".`},
+		{`query($id: ID!, $n: Int) { book(id: $id) { title } }`, `1:17: Variable "$n" is never used.`},
+		{`query($b: Book) { hello }`, `1:7: Variable "$b" cannot be non-input type "Book".`},
+		{`query($n: Int = "x") { books(first: $n) { id } }`, `1:17: Int cannot represent "x"`},
+		{`{ hello @deprecated }`, `1:9: Unknown directive "@deprecated".`},
+		{`{ hello @skip }`, `1:9: Argument "if" of type "Boolean!" is required, but it was not provided.`},
+		{`query @skip(if: true) { hello }`, `1:7: Directive "@skip" may not be used on QUERY.`},
+		{`mutation { hello }`, `1:1: Schema is not configured for mutations.`},
+		{`{ hello } { hello }`, `1:1: This anonymous operation must be the only defined operation.`},
+	}
+
+	for _, tt := range tests {
+		doc, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		errs := schema.Validate(doc)
+		if len(errs) == 0 {
+			t.Errorf("%s: valid, want %s", tt.query, tt.want)
+			continue
+		}
+		if errs[0].Error() != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.query, errs[0], tt.want)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	schema, newContext, _ := testSchema(t)
+
+	tests := []struct {
+		name   string
+		query  string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "within limits",
+			query:  `{ author(id: 1) { books { author { name } } } }`,
+			limits: Limits{MaxDepth: 4, MaxComplexity: 200},
+		},
+		{
+			name:   "too deep",
+			query:  `{ author(id: 1) { books { author { books { title } } } } }`,
+			limits: Limits{MaxDepth: 4},
+			want:   "Query is nested more than 4 fields deep.",
+		},
+		{
+			name:   "fragments count towards depth",
+			query:  `{ author(id: 1) { ...A } } fragment A on Author { books { author { books { title } } } }`,
+			limits: Limits{MaxDepth: 4},
+			want:   "Query is nested more than 4 fields deep.",
+		},
+		{
+			// author 1 + books 1 + 10 books * (author 5 + name 1)
+			name:   "lists multiply",
+			query:  `{ author(id: 1) { books { author { name } } } }`,
+			limits: Limits{MaxComplexity: 61},
+			want:   "Query has a complexity of 62, more than the limit of 61.",
+		},
+		{
+			name:   "first bounds lists",
+			query:  `{ author(id: 1) { books(first: 2) { author { name } } } }`,
+			limits: Limits{MaxComplexity: 15},
+		},
+		{
+			name:   "first from variables",
+			query:  `query($n: Int) { author(id: 1) { books(first: $n) { author { name } } } }`,
+			limits: Limits{MaxComplexity: 15},
+		},
+		{
+			name:   "skipped fields are free",
+			query:  `{ hello author(id: 1) @skip(if: true) { books { author { name } } } }`,
+			limits: Limits{MaxComplexity: 1},
+		},
+		{
+			name:   "huge first",
+			query:  `{ books(first: 2147483647) { author { books(first: 2147483647) { author { name } } } } }`,
+			limits: Limits{MaxComplexity: 1000},
+			want:   "Query has a complexity of 2147483647, more than the limit of 1000.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := schema.Do(newContext(context.Background()), tt.query, "", map[string]interface{}{"n": 2}, tt.limits)
+			if tt.want == "" {
+				if len(resp.Errors) > 0 {
+					t.Fatalf("errors: %v", resp.Errors[0])
+				}
+				return
+			}
+			if len(resp.Errors) != 1 || resp.Errors[0].Message != tt.want {
+				t.Fatalf("errors %v, want %s", resp.Errors, tt.want)
+			}
+			if resp.Data != nil {
+				t.Errorf("data %v, want none", resp.Data)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesLoads(t *testing.T) {
+	schema, newContext, fetched := testSchema(t)
+
+	ctx := newContext(context.Background())
+	resp := schema.Do(ctx, `{ books { author { name books { author { id } } } } a: author(id: 1) { id } }`, "", nil, Limits{})
+	if len(resp.Errors) > 0 {
+		t.Fatal(resp.Errors[0])
+	}
+	if *fetched != 2 {
+		t.Errorf("fetched %d authors, want each of the 2 once", *fetched)
+	}
+	// The top-level author and the books' authors arrive together, then the
+	// books' authors' books' authors are all cached
+	if batches := ctx.Value(loaderKey{}).(*Loader).Batches(); batches > 2 {
+		t.Errorf("%d batches, want at most 2", batches)
+	}
+}
+
+func TestSDL(t *testing.T) {
+	schema, _, _ := testSchema(t)
+
+	sdl := schema.SDL()
+	for _, want := range []string{
+		"type Query {\n  hello(name: String = \"world\"): String!\n",
+		"  books(first: Int = 10, genre: Genre): [Book!]!\n",
+		"\"\"\"\nA book\nin the library\n\"\"\"\ntype Book {\n",
+		"enum Genre {\n  FANTASY\n  SCIENCE_FICTION\n}\n",
+		"type Author {\n  id: ID!\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("SDL lacks %q:\n%s", want, sdl)
+		}
+	}
+	if !strings.HasPrefix(sdl, "type Query {") {
+		t.Errorf("SDL does not start with the query type:\n%s", sdl)
+	}
+}
+
+func TestNewSchemaRejectsDuplicates(t *testing.T) {
+	a := &Object{Name: "Thing", Fields: []*Field{{Name: "id", Type: ID}}}
+	b := &Object{Name: "Thing", Fields: []*Field{{Name: "id", Type: ID}}}
+	query := &Object{Name: "Query", Fields: []*Field{{Name: "a", Type: a}, {Name: "b", Type: b}}}
+	if _, err := NewSchema(query); err == nil {
+		t.Error("two types named Thing were accepted")
+	}
+
+	query = &Object{Name: "Query", Fields: []*Field{{Name: "a", Type: ID}, {Name: "a", Type: String}}}
+	if _, err := NewSchema(query); err == nil {
+		t.Error("two fields named a were accepted")
+	}
+}
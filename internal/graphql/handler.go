@@ -0,0 +1,196 @@
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// MaxBodySize caps the size of a POSTed request
+const MaxBodySize = 1 << 20
+
+// Request is a GraphQL request as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Handler serves a schema over HTTP. Queries are accepted as GET
+// parameters or a POSTed JSON body, and answered with JSON. GraphQL errors,
+// including invalid queries, are answered 200 in the response's errors;
+// 400 means the HTTP request itself could not be understood.
+type Handler struct {
+	Schema *Schema
+	Limits Limits
+	// Persisted holds queries clients may send by hash alone. When nil,
+	// persisted queries are refused.
+	Persisted *PersistedQueries
+	// Context, when set, derives each request's context, e.g. to give it
+	// fresh loaders
+	Context func(ctx context.Context) context.Context
+}
+
+// NewHandler serves schema with no limits and no persisted queries
+func NewHandler(schema *Schema) *Handler {
+	return &Handler{Schema: schema}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var gqlReq Request
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		q := req.URL.Query()
+		gqlReq.Query = q.Get("query")
+		gqlReq.OperationName = q.Get("operationName")
+		for param, dst := range map[string]*map[string]interface{}{"variables": &gqlReq.Variables, "extensions": &gqlReq.Extensions} {
+			if raw := q.Get(param); raw != "" {
+				if err := json.Unmarshal([]byte(raw), dst); err != nil {
+					writeErrors(w, http.StatusBadRequest, &Error{Message: "The " + param + " parameter is not a JSON object."})
+					return
+				}
+			}
+		}
+	case http.MethodPost:
+		body := http.MaxBytesReader(w, req.Body, MaxBodySize)
+		if err := json.NewDecoder(body).Decode(&gqlReq); err != nil {
+			writeErrors(w, http.StatusBadRequest, &Error{Message: "The request body is not a GraphQL request: " + err.Error()})
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, status := h.serve(req.Context(), &gqlReq)
+	writeJSON(w, status, resp)
+}
+
+// serve runs a request, resolving a persisted query first when it names one
+func (h *Handler) serve(ctx context.Context, req *Request) (*Response, int) {
+	hash, persisted := persistedQueryHash(req.Extensions)
+	if persisted {
+		if h.Persisted == nil {
+			return errorResponse("PersistedQueryNotSupported", "PERSISTED_QUERY_NOT_SUPPORTED"), http.StatusOK
+		}
+		if req.Query == "" {
+			query, ok := h.Persisted.Get(hash)
+			if !ok {
+				return errorResponse("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND"), http.StatusOK
+			}
+			req.Query = query
+		} else if Hash(req.Query) != hash {
+			return errorResponse("provided sha does not match query", "INVALID_PERSISTED_QUERY"), http.StatusBadRequest
+		}
+	}
+	if req.Query == "" {
+		return &Response{Errors: []*Error{{Message: "Must provide query string."}}}, http.StatusBadRequest
+	}
+
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}, http.StatusOK
+	}
+	if errs := h.Schema.Validate(doc); len(errs) > 0 {
+		return &Response{Errors: errs}, http.StatusOK
+	}
+	// Only queries that parse and validate are worth keeping
+	if persisted {
+		h.Persisted.Put(hash, req.Query)
+	}
+
+	if h.Context != nil {
+		ctx = h.Context(ctx)
+	}
+	return h.Schema.Execute(ctx, doc, req.OperationName, req.Variables, h.Limits), http.StatusOK
+}
+
+// persistedQueryHash reads the hash from Apollo's persistedQuery extension
+func persistedQueryHash(extensions map[string]interface{}) (string, bool) {
+	ext, ok := extensions["persistedQuery"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	hash, _ := ext["sha256Hash"].(string)
+	return hash, true
+}
+
+func errorResponse(message, code string) *Response {
+	return &Response{Errors: []*Error{{Message: message, Extensions: map[string]interface{}{"code": code}}}}
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...*Error) {
+	writeJSON(w, status, &Response{Errors: errs})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp *Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Hash is the hex SHA-256 of a query, the key clients persist it under
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// PersistedQueries maps query hashes to query text, holding at most a fixed
+// number of queries and forgetting the oldest first. Clients send a hash
+// alone, and the full query only when told the hash is not found, as in
+// Apollo's automatic persisted queries.
+type PersistedQueries struct {
+	mu      sync.Mutex
+	max     int
+	queries map[string]string
+	order   []string
+}
+
+// NewPersistedQueries creates a store holding up to max queries, or any
+// number when max is zero
+func NewPersistedQueries(max int) *PersistedQueries {
+	return &PersistedQueries{max: max, queries: make(map[string]string)}
+}
+
+// Add stores query under its hash, which it returns. Use it to preload the
+// queries a client is known to send.
+func (p *PersistedQueries) Add(query string) string {
+	hash := Hash(query)
+	p.Put(hash, query)
+	return hash
+}
+
+// Put stores query under hash, which must be its Hash
+func (p *PersistedQueries) Put(hash, query string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.queries[hash]; ok {
+		return
+	}
+	for p.max > 0 && len(p.order) >= p.max {
+		delete(p.queries, p.order[0])
+		p.order = p.order[1:]
+	}
+	p.queries[hash] = query
+	p.order = append(p.order, hash)
+}
+
+// Get returns the query stored under hash
+func (p *PersistedQueries) Get(hash string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	query, ok := p.queries[hash]
+	return query, ok
+}
+
+// Len reports how many queries are stored
+func (p *PersistedQueries) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queries)
+}
@@ -0,0 +1,200 @@
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func serveGraphQL(h http.Handler, method, target, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+// errorCode returns the first error's message and extensions code
+func errorCode(resp map[string]interface{}) (string, string) {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return "", ""
+	}
+	first := errs[0].(map[string]interface{})
+	ext, _ := first["extensions"].(map[string]interface{})
+	code, _ := ext["code"].(string)
+	return first["message"].(string), code
+}
+
+func TestHandler(t *testing.T) {
+	schema, newContext, _ := testSchema(t)
+	h := NewHandler(schema)
+	h.Context = newContext
+	h.Limits = Limits{MaxDepth: 3}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		status  int
+		want    string
+		message string
+	}{
+		{
+			name:   "post",
+			method: http.MethodPost,
+			body:   `{"query":"query($id: ID!) { book(id: $id) { title author { name } } }","variables":{"id":"11"}}`,
+			status: http.StatusOK,
+			want:   `{"data":{"book":{"title":"The Dispossessed","author":{"name":"Ursula K. Le Guin"}}}}`,
+		},
+		{
+			name:   "get",
+			method: http.MethodGet,
+			target: "/graphql?" + url.Values{"query": {"query($n: Int) { books(first: $n) { id } }"}, "variables": {`{"n":1}`}}.Encode(),
+			status: http.StatusOK,
+			want:   `{"data":{"books":[{"id":"10"}]}}`,
+		},
+		{
+			name:   "operation name",
+			method: http.MethodPost,
+			body:   `{"query":"query A { a: hello } query B { b: hello }","operationName":"A"}`,
+			status: http.StatusOK,
+			want:   `{"data":{"a":"hello world"}}`,
+		},
+		{
+			name:    "invalid query",
+			method:  http.MethodPost,
+			body:    `{"query":"{ nope }"}`,
+			status:  http.StatusOK,
+			message: `Cannot query field "nope" on type "Query".`,
+		},
+		{
+			name:    "syntax error",
+			method:  http.MethodPost,
+			body:    `{"query":"{ book("}`,
+			status:  http.StatusOK,
+			message: "Syntax Error: Expected Name, found <EOF>.",
+		},
+		{
+			name:    "too deep",
+			method:  http.MethodPost,
+			body:    `{"query":"{ author(id: 1) { books { author { name } } } }"}`,
+			status:  http.StatusOK,
+			message: "Query is nested more than 3 fields deep.",
+		},
+		{
+			name:    "no query",
+			method:  http.MethodPost,
+			body:    `{}`,
+			status:  http.StatusBadRequest,
+			message: "Must provide query string.",
+		},
+		{
+			name:   "malformed body",
+			method: http.MethodPost,
+			body:   `{"query":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "malformed variables",
+			method: http.MethodGet,
+			target: "/graphql?query=%7Bhello%7D&variables=%5B",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:    "persisted queries disabled",
+			method:  http.MethodPost,
+			body:    `{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"abc"}}}`,
+			status:  http.StatusOK,
+			message: "PersistedQueryNotSupported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/graphql"
+			}
+			rec, resp := serveGraphQL(h, tt.method, target, tt.body)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d\n%s", rec.Code, tt.status, rec.Body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type %q", ct)
+			}
+			if tt.want != "" && strings.TrimSpace(rec.Body.String()) != tt.want {
+				t.Errorf("body %s\nwant %s", rec.Body, tt.want)
+			}
+			if message, _ := errorCode(resp); tt.message != "" && message != tt.message {
+				t.Errorf("error %q, want %q", message, tt.message)
+			}
+			if tt.want == "" && resp["errors"] == nil {
+				t.Errorf("no errors in %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandlerPersistedQueries(t *testing.T) {
+	schema, newContext, _ := testSchema(t)
+	h := NewHandler(schema)
+	h.Context = newContext
+	h.Persisted = NewPersistedQueries(2)
+
+	query := "{ book(id: 12) { title } }"
+	hash := Hash(query)
+	extensions := `"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`
+	want := `{"data":{"book":{"title":"Kindred"}}}`
+
+	// The client tries the hash alone first, and is told to send the query
+	_, resp := serveGraphQL(h, http.MethodPost, "/graphql", `{`+extensions+`}`)
+	if message, code := errorCode(resp); message != "PersistedQueryNotFound" || code != "PERSISTED_QUERY_NOT_FOUND" {
+		t.Fatalf("error %q %q, want PersistedQueryNotFound", message, code)
+	}
+
+	body, _ := json.Marshal(query)
+	rec, _ := serveGraphQL(h, http.MethodPost, "/graphql", `{"query":`+string(body)+`,`+extensions+`}`)
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("with query: %s, want %s", got, want)
+	}
+
+	// From then on the hash is enough, over GET too
+	rec, _ = serveGraphQL(h, http.MethodPost, "/graphql", `{`+extensions+`}`)
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("by hash: %s, want %s", got, want)
+	}
+	get := "/graphql?" + url.Values{"extensions": {`{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}`}}.Encode()
+	rec, _ = serveGraphQL(h, http.MethodGet, get, "")
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("by hash over GET: %s, want %s", got, want)
+	}
+
+	// A hash must match its query
+	rec, resp = serveGraphQL(h, http.MethodPost, "/graphql", `{"query":"{ hello }",`+extensions+`}`)
+	if message, _ := errorCode(resp); rec.Code != http.StatusBadRequest || message != "provided sha does not match query" {
+		t.Errorf("mismatched hash: status %d, error %q", rec.Code, message)
+	}
+
+	// Invalid queries are not stored
+	bad := "{ nope }"
+	serveGraphQL(h, http.MethodPost, "/graphql", `{"query":"`+bad+`","extensions":{"persistedQuery":{"version":1,"sha256Hash":"`+Hash(bad)+`"}}}`)
+	if _, ok := h.Persisted.Get(Hash(bad)); ok {
+		t.Error("an invalid query was persisted")
+	}
+
+	// The store forgets the oldest query once full
+	h.Persisted.Add("{ a: hello }")
+	h.Persisted.Add("{ b: hello }")
+	if _, ok := h.Persisted.Get(hash); ok || h.Persisted.Len() != 2 {
+		t.Errorf("%d queries stored, the first still among them: %v", h.Persisted.Len(), ok)
+	}
+}
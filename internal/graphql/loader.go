@@ -0,0 +1,177 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultWait is how long a Loader collects keys before fetching them.
+// Sibling fields and list items resolve concurrently, so their keys arrive
+// well within it.
+const DefaultWait = time.Millisecond
+
+// Result is the outcome of loading one key
+type Result struct {
+	Value interface{}
+	Err   error
+}
+
+// BatchFunc fetches keys, returning one result per key in the same order
+type BatchFunc func(ctx context.Context, keys []string) []Result
+
+// Loader batches and caches lookups by key, in the manner of Facebook's
+// dataloader. Keys requested while a batch is collecting are fetched
+// together, and each key is fetched once however many fields ask for it.
+// Create one per request, so nothing is cached between users or for longer
+// than the request takes.
+type Loader struct {
+	fetch BatchFunc
+	// Wait is how long to collect keys before fetching, DefaultWait when zero
+	Wait time.Duration
+	// MaxBatch fetches a batch as soon as it has this many keys, when above
+	// zero
+	MaxBatch int
+
+	mu      sync.Mutex
+	cache   map[string]*pending
+	batch   *batch
+	batches int
+}
+
+type pending struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+type batch struct {
+	ctx  context.Context
+	keys []string
+	out  []*pending
+}
+
+// NewLoader creates a loader that fetches with fetch
+func NewLoader(fetch BatchFunc) *Loader {
+	return &Loader{fetch: fetch, cache: make(map[string]*pending)}
+}
+
+// Load returns the value for key, waiting for the batch it joins. The batch
+// is fetched with the context of the Load that started it.
+func (l *Loader) Load(ctx context.Context, key string) (interface{}, error) {
+	l.mu.Lock()
+	p, ok := l.cache[key]
+	if !ok {
+		p = &pending{done: make(chan struct{})}
+		l.cache[key] = p
+		l.enqueue(ctx, key, p)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return p.value, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// enqueue adds key to the collecting batch, starting one if needed. l.mu
+// must be held.
+func (l *Loader) enqueue(ctx context.Context, key string, p *pending) {
+	if l.batch == nil {
+		b := &batch{ctx: ctx}
+		l.batch = b
+		wait := l.Wait
+		if wait <= 0 {
+			wait = DefaultWait
+		}
+		time.AfterFunc(wait, func() { l.dispatch(b) })
+	}
+	l.batch.keys = append(l.batch.keys, key)
+	l.batch.out = append(l.batch.out, p)
+	if l.MaxBatch > 0 && len(l.batch.keys) >= l.MaxBatch {
+		b := l.batch
+		l.batch = nil
+		l.batches++
+		go l.run(b)
+	}
+}
+
+// dispatch fetches b unless it was already fetched for being full
+func (l *Loader) dispatch(b *batch) {
+	l.mu.Lock()
+	if l.batch != b {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.batches++
+	l.mu.Unlock()
+	l.run(b)
+}
+
+func (l *Loader) run(b *batch) {
+	results := l.call(b)
+	for i, p := range b.out {
+		p.value, p.err = results[i].Value, results[i].Err
+		close(p.done)
+	}
+}
+
+// call runs the batch function, turning a panic or a short answer into an
+// error for every key
+func (l *Loader) call(b *batch) (results []Result) {
+	defer func() {
+		if p := recover(); p != nil {
+			results = failAll(len(b.keys), fmt.Errorf("loading %v: %v", b.keys, p))
+		}
+	}()
+	results = l.fetch(b.ctx, b.keys)
+	if len(results) != len(b.keys) {
+		return failAll(len(b.keys), fmt.Errorf("loader returned %d results for %d keys", len(results), len(b.keys)))
+	}
+	return results
+}
+
+func failAll(n int, err error) []Result {
+	results := make([]Result, n)
+	for i := range results {
+		results[i].Err = err
+	}
+	return results
+}
+
+// Batches reports how many batches the loader has fetched
+func (l *Loader) Batches() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.batches
+}
+
+// Concurrently makes a BatchFunc for services that look keys up one at a
+// time, fetching a batch's keys in parallel with at most limit in flight
+func Concurrently(limit int, fetch func(ctx context.Context, key string) (interface{}, error)) BatchFunc {
+	return func(ctx context.Context, keys []string) []Result {
+		results := make([]Result, len(keys))
+		sem := make(chan struct{}, max(limit, 1))
+		var wg sync.WaitGroup
+		for i, key := range keys {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, key string) {
+				defer func() {
+					if p := recover(); p != nil {
+						results[i].Err = fmt.Errorf("loading %s: %v", key, p)
+					}
+					<-sem
+					wg.Done()
+				}()
+				results[i].Value, results[i].Err = fetch(ctx, key)
+			}(i, key)
+		}
+		wg.Wait()
+		return results
+	}
+}
@@ -0,0 +1,165 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recordingLoader echoes keys back and records the batches it was asked for
+func recordingLoader() (*Loader, func() []string) {
+	var mu sync.Mutex
+	var batches []string
+	loader := NewLoader(func(ctx context.Context, keys []string) []Result {
+		sorted := append([]string(nil), keys...)
+		sort.Strings(sorted)
+		mu.Lock()
+		batches = append(batches, strings.Join(sorted, ","))
+		mu.Unlock()
+
+		results := make([]Result, len(keys))
+		for i, key := range keys {
+			if key == "bad" {
+				results[i].Err = errors.New("bad key")
+				continue
+			}
+			results[i].Value = "value " + key
+		}
+		return results
+	})
+	loader.Wait = 20 * time.Millisecond
+	return loader, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		sort.Strings(batches)
+		return append([]string(nil), batches...)
+	}
+}
+
+// loadAll loads keys concurrently, as sibling fields do
+func loadAll(l *Loader, keys ...string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			values[i], errs[i] = l.Load(context.Background(), key)
+		}(i, key)
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func TestLoaderBatchesAndCaches(t *testing.T) {
+	loader, batches := recordingLoader()
+
+	values, errs := loadAll(loader, "a", "b", "a", "bad", "c")
+	for i, want := range []interface{}{"value a", "value b", "value a", nil, "value c"} {
+		if values[i] != want {
+			t.Errorf("value %d = %v, want %v", i, values[i], want)
+		}
+	}
+	if errs[3] == nil || errs[3].Error() != "bad key" {
+		t.Errorf("error %v, want bad key", errs[3])
+	}
+	if got := batches(); fmt.Sprint(got) != "[a,b,bad,c]" {
+		t.Errorf("batches %v, want one of each key", got)
+	}
+
+	// Cached keys, including failures, are not fetched again
+	loadAll(loader, "a", "bad", "d")
+	if got := batches(); fmt.Sprint(got) != "[a,b,bad,c d]" {
+		t.Errorf("batches %v, want only d fetched", got)
+	}
+	if loader.Batches() != 2 {
+		t.Errorf("Batches() = %d, want 2", loader.Batches())
+	}
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	loader, batches := recordingLoader()
+	loader.MaxBatch = 2
+	loader.Wait = time.Hour
+
+	// A full batch goes at once; the rest would wait an hour
+	values, _ := loadAll(loader, "a", "b")
+	if values[0] != "value a" || values[1] != "value b" {
+		t.Errorf("values %v", values)
+	}
+	if got := batches(); fmt.Sprint(got) != "[a,b]" {
+		t.Errorf("batches %v", got)
+	}
+}
+
+func TestLoaderCancel(t *testing.T) {
+	loader := NewLoader(func(ctx context.Context, keys []string) []Result {
+		return make([]Result, len(keys))
+	})
+	loader.Wait = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loader.Load(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+}
+
+func TestLoaderBadBatchFunc(t *testing.T) {
+	short := NewLoader(func(ctx context.Context, keys []string) []Result {
+		return nil
+	})
+	if _, err := short.Load(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "0 results for 1 keys") {
+		t.Errorf("error %v, want a count mismatch", err)
+	}
+
+	panics := NewLoader(func(ctx context.Context, keys []string) []Result {
+		panic("boom")
+	})
+	if _, err := panics.Load(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("error %v, want the panic", err)
+	}
+}
+
+func TestConcurrently(t *testing.T) {
+	var inFlight, most int32
+	fetch := Concurrently(2, func(ctx context.Context, key string) (interface{}, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		if key == "panic" {
+			panic("boom")
+		}
+		return strings.ToUpper(key), nil
+	})
+
+	results := fetch(context.Background(), []string{"a", "b", "bad", "c", "panic"})
+	if len(results) != 5 {
+		t.Fatalf("%d results, want 5", len(results))
+	}
+	if results[0].Value != "A" || results[3].Value != "C" {
+		t.Errorf("results %+v", results)
+	}
+	if results[2].Err == nil || results[4].Err == nil {
+		t.Errorf("bad and panic keys did not fail: %+v", results)
+	}
+	if most > 2 {
+		t.Errorf("%d fetches in flight, want at most 2", most)
+	}
+}
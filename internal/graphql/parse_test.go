@@ -0,0 +1,127 @@
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# Everything a detail page needs
+		query Details($id: ID!, $first: Int = 5, $ids: [ID!]) @skip(if: false) {
+			movie(id: $id) {
+				heading: title
+				cast(first: $first) { ...Person }
+				... on Movie @include(if: true) { overview }
+				note(text: """
+					Block strings
+					  keep relative "indentation"
+				""", other: "tab\tand \u00e9", n: -1.5e3, list: [1, 2], obj: {a: ENUM, b: null})
+			}
+		}
+
+		fragment Person on CastMember { name }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Operations) != 1 || len(doc.Fragments) != 1 {
+		t.Fatalf("%d operations and %d fragments, want 1 each", len(doc.Operations), len(doc.Fragments))
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Details" || len(op.Directives) != 1 {
+		t.Errorf("operation %s %s with %d directives", op.Type, op.Name, len(op.Directives))
+	}
+	if op.Loc != (Location{Line: 3, Column: 3}) {
+		t.Errorf("operation at %+v, want 3:3", op.Loc)
+	}
+
+	vars := op.Variables
+	if len(vars) != 3 || vars[0].Type.String() != "ID!" || vars[1].Default.Raw != "5" || vars[2].Type.String() != "[ID!]" {
+		t.Errorf("variables %+v", vars)
+	}
+
+	movie := op.SelectionSet[0].(*FieldNode)
+	heading := movie.SelectionSet[0].(*FieldNode)
+	if heading.Alias != "heading" || heading.Name != "title" || heading.ResponseKey() != "heading" {
+		t.Errorf("aliased field %+v", heading)
+	}
+	if spread := movie.SelectionSet[1].(*FieldNode).SelectionSet[0].(*FragmentSpread); spread.Name != "Person" {
+		t.Errorf("spread of %s, want Person", spread.Name)
+	}
+	if inline := movie.SelectionSet[2].(*InlineFragment); inline.TypeCondition != "Movie" || len(inline.Directives) != 1 {
+		t.Errorf("inline fragment %+v", inline)
+	}
+
+	args := movie.SelectionSet[3].(*FieldNode).Arguments
+	if len(args) != 5 {
+		t.Fatalf("%d arguments, want 5", len(args))
+	}
+	if want := "Block strings\n  keep relative \"indentation\""; args[0].Value.Raw != want {
+		t.Errorf("block string %q, want %q", args[0].Value.Raw, want)
+	}
+	if want := "tab\tand é"; args[1].Value.Raw != want {
+		t.Errorf("string %q, want %q", args[1].Value.Raw, want)
+	}
+	if args[2].Value.Kind != FloatValue || args[2].Value.Raw != "-1.5e3" {
+		t.Errorf("float %+v", args[2].Value)
+	}
+	if args[3].Value.Kind != ListValue || len(args[3].Value.List) != 2 {
+		t.Errorf("list %+v", args[3].Value)
+	}
+	if obj := args[4].Value; obj.Kind != ObjectValue || obj.Fields[0].Value.Kind != EnumValue || obj.Fields[1].Value.Kind != NullValue {
+		t.Errorf("object %+v", obj)
+	}
+
+	if f := doc.Fragments["Person"]; f.TypeCondition != "CastMember" || f.Loc.Line != 15 {
+		t.Errorf("fragment %+v", f)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := Parse(`{ a, b }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := doc.Operations[0]; op.Type != "query" || op.Name != "" || len(op.SelectionSet) != 2 {
+		t.Errorf("operation %+v", op)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{``, `1:1: The document has no operation.`},
+		{`fragment F on T { a }`, `1:22: The document has no operation.`},
+		{`{`, `1:2: Syntax Error: Expected Name, found <EOF>.`},
+		{`{ }`, `1:3: Syntax Error: Unexpected "}".`},
+		{`{ a(b: ) }`, `1:8: Syntax Error: Unexpected ")".`},
+		{`{ a(b: $) }`, `1:9: Syntax Error: Expected Name, found ")".`},
+		{`{ a }}`, `1:6: Syntax Error: Unexpected "}".`},
+		{"{\n  a(b: \"open\n}", `2:8: Syntax Error: Unterminated string.`},
+		{`{ a(b: "\q") }`, `1:8: Syntax Error: Invalid character escape sequence \q.`},
+		{`{ a(b: 01) }`, `1:8: Syntax Error: Invalid number, unexpected digit after 0.`},
+		{`{ a(b: 1.) }`, `1:8: Syntax Error: Invalid number "1.".`},
+		{`{ a(b: 1x) }`, `1:8: Syntax Error: Invalid number "1x".`},
+		{`{ a ; }`, `1:5: Syntax Error: Unexpected character ';'.`},
+		{`{ .. }`, `1:3: Syntax Error: Unexpected character '.'.`},
+		{`query Q($a: Int = $b) { a }`, `1:19: Syntax Error: Unexpected "$".`},
+		{`fragment on on T { a } { a }`, `1:1: Syntax Error: Unexpected Name "on".`},
+		{`fragment F T { a } { a }`, `1:12: Syntax Error: Expected "on", found "T".`},
+		{`{ a } fragment F on T { a } fragment F on T { b }`, `1:29: There can be only one fragment named "F".`},
+		{`schema { query: Q }`, `1:1: Syntax Error: Unexpected "schema".`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		if err == nil {
+			t.Errorf("%q parsed, want %s", tt.query, tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%q:\ngot  %s\nwant %s", tt.query, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+// Package graphql is a small GraphQL server: a query parser, a schema of
+// object, scalar and enum types, validation with depth and complexity
+// limits, a concurrent executor, request-scoped loaders that batch lookups,
+// and an HTTP handler with automatic persisted queries.
+//
+// Only queries are supported. There are no interfaces, unions, input objects
+// or introspection; Schema.SDL describes the schema instead.
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Type is a *Scalar, *Enum, *Object, *List or *NonNull
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type. Serialize turns a resolved Go value into its JSON
+// form; Parse turns an argument or variable into the Go value resolvers get.
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(v interface{}) (interface{}, error)
+	Parse       func(v interface{}) (interface{}, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Enum is a leaf type whose values are names. Resolvers return and receive
+// them as strings.
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+func (e *Enum) String() string { return e.Name }
+
+func (e *Enum) has(v string) bool {
+	for _, value := range e.Values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Object is a type with fields. Fields may be added after the object is
+// created, so types can refer to each other.
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// Field returns the field called name, or nil
+func (o *Object) Field(name string) *Field {
+	for _, f := range o.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// List is a list of another type
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// NonNull is a type whose values are never null
+type NonNull struct {
+	Of Type
+}
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+// Field is a field of an object type
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*Arg
+	// Resolve returns the field's value. When nil, the value is the source's
+	// struct field or map entry whose name matches case-insensitively.
+	Resolve ResolveFunc
+	// Cost is what resolving the field counts towards a query's complexity,
+	// 1 when zero. Fields that call an upstream service should cost more.
+	Cost int
+	// ListSize is the number of items a list field is assumed to return when
+	// it has no first argument, DefaultListSize when zero
+	ListSize int
+}
+
+// Arg is an argument of a field
+type Arg struct {
+	Name        string
+	Description string
+	Type        Type
+	// Default is used when the argument is not given. It is in the form
+	// resolvers receive, e.g. an int for Int.
+	Default interface{}
+}
+
+// ResolveFunc resolves a field of source. Returning nil, a nil pointer or a
+// nil map resolves to null; a nil slice is an empty list.
+type ResolveFunc func(ctx context.Context, source interface{}, args Args) (interface{}, error)
+
+// Args holds a field's arguments after coercion
+type Args map[string]interface{}
+
+// String returns the String, ID or enum argument name, or ""
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Int returns the Int argument name, or 0
+func (a Args) Int(name string) int {
+	n, _ := a[name].(int)
+	return n
+}
+
+// Schema is a set of types rooted at a query type
+type Schema struct {
+	Query *Object
+	types map[string]Type
+}
+
+// NewSchema collects the types reachable from query. Type names must be
+// unique.
+func NewSchema(query *Object) (*Schema, error) {
+	s := &Schema{Query: query, types: make(map[string]Type)}
+	for _, scalar := range []*Scalar{Int, Float, String, Boolean, ID} {
+		s.types[scalar.Name] = scalar
+	}
+	if err := s.add(query); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) add(t Type) error {
+	named := namedType(t)
+	if existing, ok := s.types[named.String()]; ok {
+		if existing != named {
+			return fmt.Errorf("graphql: two types are named %s", named)
+		}
+		return nil
+	}
+	s.types[named.String()] = named
+
+	obj, ok := named.(*Object)
+	if !ok {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, f := range obj.Fields {
+		if names[f.Name] {
+			return fmt.Errorf("graphql: %s has two fields named %s", obj.Name, f.Name)
+		}
+		names[f.Name] = true
+		if err := s.add(f.Type); err != nil {
+			return err
+		}
+		for _, arg := range f.Args {
+			if _, ok := namedType(arg.Type).(*Object); ok {
+				return fmt.Errorf("graphql: argument %s.%s(%s) cannot be an object", obj.Name, f.Name, arg.Name)
+			}
+			if err := s.add(arg.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Type returns the named type, or nil
+func (s *Schema) Type(name string) Type {
+	return s.types[name]
+}
+
+// SDL describes the schema in the GraphQL schema definition language
+func (s *Schema) SDL() string {
+	names := make([]string, 0, len(s.types))
+	for name := range s.types {
+		names = append(names, name)
+	}
+	// The query type first, then the rest by name
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == s.Query.Name) != (names[j] == s.Query.Name) {
+			return names[i] == s.Query.Name
+		}
+		return names[i] < names[j]
+	})
+
+	var b strings.Builder
+	for _, name := range names {
+		switch t := s.types[name].(type) {
+		case *Scalar:
+			if builtin(t) {
+				continue
+			}
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "scalar %s\n\n", t.Name)
+		case *Enum:
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "enum %s {\n", t.Name)
+			for _, v := range t.Values {
+				fmt.Fprintf(&b, "  %s\n", v)
+			}
+			b.WriteString("}\n\n")
+		case *Object:
+			writeDescription(&b, "", t.Description)
+			fmt.Fprintf(&b, "type %s {\n", t.Name)
+			for _, f := range t.Fields {
+				writeDescription(&b, "  ", f.Description)
+				fmt.Fprintf(&b, "  %s%s: %s\n", f.Name, sdlArgs(f.Args), f.Type)
+			}
+			b.WriteString("}\n\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func sdlArgs(args []*Arg) string {
+	if len(args) == 0 {
+		return ""
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Name + ": " + arg.Type.String()
+		if arg.Default != nil {
+			parts[i] += " = " + sdlValue(arg.Type, arg.Default)
+		}
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func sdlValue(t Type, v interface{}) string {
+	if s, ok := v.(string); ok {
+		if _, enum := namedType(t).(*Enum); !enum {
+			return strconv.Quote(s)
+		}
+	}
+	return fmt.Sprint(v)
+}
+
+func writeDescription(b *strings.Builder, indent, description string) {
+	if description == "" {
+		return
+	}
+	if !strings.Contains(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, strconv.Quote(description))
+		return
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+	for _, line := range strings.Split(description, "\n") {
+		fmt.Fprintf(b, "%s%s\n", indent, line)
+	}
+	fmt.Fprintf(b, "%s\"\"\"\n", indent)
+}
+
+// namedType strips List and NonNull from t
+func namedType(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *List:
+			t = w.Of
+		case *NonNull:
+			t = w.Of
+		default:
+			return t
+		}
+	}
+}
+
+func isLeaf(t Type) bool {
+	switch namedType(t).(type) {
+	case *Scalar, *Enum:
+		return true
+	}
+	return false
+}
+
+func builtin(s *Scalar) bool {
+	return s == Int || s == Float || s == String || s == Boolean || s == ID
+}
+
+// The built-in scalars
+var (
+	Int = &Scalar{
+		Name:        "Int",
+		Description: "A signed 32-bit integer",
+		Serialize: func(v interface{}) (interface{}, error) {
+			n, ok := toInt(v)
+			if !ok {
+				return nil, fmt.Errorf("Int cannot represent %v", v)
+			}
+			return n, nil
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			n, ok := toInt(v)
+			if !ok {
+				return nil, fmt.Errorf("Int cannot represent %s", describe(v))
+			}
+			return n, nil
+		},
+	}
+	Float = &Scalar{
+		Name:        "Float",
+		Description: "A double-precision floating point number",
+		Serialize: func(v interface{}) (interface{}, error) {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("Float cannot represent %v", v)
+			}
+			return f, nil
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			f, ok := toFloat(v)
+			if !ok {
+				return nil, fmt.Errorf("Float cannot represent %s", describe(v))
+			}
+			return f, nil
+		},
+	}
+	String = &Scalar{
+		Name:        "String",
+		Description: "UTF-8 text",
+		Serialize: func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("String cannot represent %v", v)
+			}
+			return s, nil
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("String cannot represent %s", describe(v))
+			}
+			return s, nil
+		},
+	}
+	Boolean = &Scalar{
+		Name:        "Boolean",
+		Description: "true or false",
+		Serialize: func(v interface{}) (interface{}, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("Boolean cannot represent %v", v)
+			}
+			return b, nil
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("Boolean cannot represent %s", describe(v))
+			}
+			return b, nil
+		},
+	}
+	// ID is serialized as a string. Integers are accepted as input and
+	// resolvers receive them as strings.
+	ID = &Scalar{
+		Name:        "ID",
+		Description: "A unique identifier",
+		Serialize: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			if n, ok := toInt(v); ok {
+				return strconv.Itoa(n), nil
+			}
+			return nil, fmt.Errorf("ID cannot represent %v", v)
+		},
+		Parse: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			if n, ok := toInt(v); ok {
+				return strconv.Itoa(n), nil
+			}
+			return nil, fmt.Errorf("ID cannot represent %s", describe(v))
+		},
+	}
+)
+
+// toInt accepts Go integers and whole float64s, as JSON decodes numbers, in
+// the 32-bit range
+func toInt(v interface{}) (int, bool) {
+	var n int64
+	switch v := v.(type) {
+	case int:
+		n = int64(v)
+	case int8:
+		n = int64(v)
+	case int16:
+		n = int64(v)
+	case int32:
+		n = int64(v)
+	case int64:
+		n = v
+	case uint8:
+		n = int64(v)
+	case uint16:
+		n = int64(v)
+	case uint32:
+		n = int64(v)
+	case float64:
+		if v != math.Trunc(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return 0, false
+		}
+		n = int64(v)
+	default:
+		return 0, false
+	}
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, !math.IsInf(v, 0) && !math.IsNaN(v)
+	case float32:
+		return float64(v), true
+	}
+	if n, ok := toInt(v); ok {
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func describe(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// defaultResolve returns the struct field or map entry of source called
+// name, ignoring case. Embedded structs are searched too.
+func defaultResolve(source interface{}, name string) interface{} {
+	v := reflect.ValueOf(source)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		if item := v.MapIndex(reflect.ValueOf(name)); item.IsValid() {
+			return item.Interface()
+		}
+	case reflect.Struct:
+		field := v.FieldByNameFunc(func(field string) bool {
+			return strings.EqualFold(field, name)
+		})
+		if field.IsValid() && field.CanInterface() {
+			return field.Interface()
+		}
+	}
+	return nil
+}
+
+// isNil reports whether v is nil or a nil pointer, map or interface. Nil
+// slices are not null but empty, as Go code rarely tells the two apart.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
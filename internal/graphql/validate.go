@@ -0,0 +1,600 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validate checks a parsed document against the schema. It is what lets the
+// executor trust that every field, argument, fragment and variable it meets
+// exists and is used in the right place.
+func (s *Schema) Validate(doc *Document) []*Error {
+	v := &validator{
+		schema:    s,
+		doc:       doc,
+		fragments: make(map[string]*fragmentInfo),
+	}
+
+	// Fragments are checked once, against their own type, and operations
+	// then take on the variables and spreads of the fragments they reach
+	names := make([]string, 0, len(doc.Fragments))
+	for name := range doc.Fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := doc.Fragments[name]
+		info := &fragmentInfo{}
+		v.fragments[name] = info
+		v.directives(f.Directives, "FRAGMENT_DEFINITION")
+		obj, ok := s.types[f.TypeCondition].(*Object)
+		if !ok {
+			v.errorf(f.Loc, "Unknown type %q.", f.TypeCondition)
+			continue
+		}
+		v.selectionSet(obj, f.SelectionSet, &info.usage)
+	}
+	v.fragmentCycles(names)
+
+	reached := make(map[string]bool)
+	opNames := make(map[string]bool)
+	for _, op := range doc.Operations {
+		if op.Name == "" && len(doc.Operations) > 1 {
+			v.errorf(op.Loc, "This anonymous operation must be the only defined operation.")
+		}
+		if op.Name != "" {
+			if opNames[op.Name] {
+				v.errorf(op.Loc, "There can be only one operation named %q.", op.Name)
+			}
+			opNames[op.Name] = true
+		}
+		if op.Type != "query" {
+			v.errorf(op.Loc, "Schema is not configured for %ss.", op.Type)
+			continue
+		}
+		v.directives(op.Directives, "QUERY")
+
+		var use usage
+		v.selectionSet(s.Query, op.SelectionSet, &use)
+		for _, name := range v.spreadClosure(use.spreads) {
+			reached[name] = true
+			use.variables = append(use.variables, v.fragments[name].usage.variables...)
+		}
+		v.variables(op, use.variables)
+	}
+
+	for _, name := range names {
+		if !reached[name] {
+			v.errorf(doc.Fragments[name].Loc, "Fragment %q is never used.", name)
+		}
+	}
+	return v.errs
+}
+
+type validator struct {
+	schema    *Schema
+	doc       *Document
+	fragments map[string]*fragmentInfo
+	errs      []*Error
+}
+
+type fragmentInfo struct {
+	usage usage
+}
+
+// usage records what a selection set refers to outside itself
+type usage struct {
+	spreads   []string
+	variables []variableUsage
+}
+
+type variableUsage struct {
+	name string
+	// typ is the type expected where the variable is used
+	typ        Type
+	hasDefault bool
+	loc        Location
+}
+
+func (v *validator) errorf(loc Location, format string, args ...interface{}) {
+	v.errs = append(v.errs, errorAt(loc, format, args...))
+}
+
+func (v *validator) selectionSet(obj *Object, set []Selection, use *usage) {
+	for _, sel := range set {
+		switch sel := sel.(type) {
+		case *FieldNode:
+			v.field(obj, sel, use)
+		case *FragmentSpread:
+			v.directives(sel.Directives, "FRAGMENT_SPREAD")
+			f, ok := v.doc.Fragments[sel.Name]
+			if !ok {
+				v.errorf(sel.Loc, "Unknown fragment %q.", sel.Name)
+				continue
+			}
+			use.spreads = append(use.spreads, sel.Name)
+			if _, ok := v.schema.types[f.TypeCondition].(*Object); ok && f.TypeCondition != obj.Name {
+				v.errorf(sel.Loc, "Fragment %q cannot be spread here as objects of type %q can never be of type %q.", sel.Name, obj.Name, f.TypeCondition)
+			}
+		case *InlineFragment:
+			v.directives(sel.Directives, "INLINE_FRAGMENT")
+			if sel.TypeCondition != "" && sel.TypeCondition != obj.Name {
+				if _, ok := v.schema.types[sel.TypeCondition].(*Object); !ok {
+					v.errorf(sel.Loc, "Unknown type %q.", sel.TypeCondition)
+				} else {
+					v.errorf(sel.Loc, "Fragment cannot be spread here as objects of type %q can never be of type %q.", obj.Name, sel.TypeCondition)
+				}
+				continue
+			}
+			v.selectionSet(obj, sel.SelectionSet, use)
+		}
+	}
+	v.overlapping(obj, set)
+}
+
+func (v *validator) field(obj *Object, f *FieldNode, use *usage) {
+	v.directives(f.Directives, "FIELD")
+	for _, d := range f.Directives {
+		v.arguments(d.Arguments, directiveArgs, "directive @"+d.Name, d.Loc, use)
+	}
+
+	if f.Name == "__typename" {
+		if len(f.Arguments) > 0 {
+			v.errorf(f.Arguments[0].Loc, "Unknown argument %q on field \"%s.__typename\".", f.Arguments[0].Name, obj.Name)
+		}
+		if f.SelectionSet != nil {
+			v.errorf(f.Loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields.")
+		}
+		return
+	}
+
+	def := obj.Field(f.Name)
+	if def == nil {
+		v.errorf(f.Loc, "Cannot query field %q on type %q.%s", f.Name, obj.Name, suggest(f.Name, obj))
+		return
+	}
+	v.arguments(f.Arguments, def.Args, fmt.Sprintf("field \"%s.%s\"", obj.Name, f.Name), f.Loc, use)
+
+	if isLeaf(def.Type) {
+		if f.SelectionSet != nil {
+			v.errorf(f.Loc, "Field %q must not have a selection since type %q has no subfields.", f.Name, def.Type)
+		}
+		return
+	}
+	if f.SelectionSet == nil {
+		v.errorf(f.Loc, "Field %q of type %q must have a selection of subfields. Did you mean \"%s { ... }\"?", f.Name, def.Type, f.Name)
+		return
+	}
+	v.selectionSet(namedType(def.Type).(*Object), f.SelectionSet, use)
+}
+
+// suggest names the fields of obj that differ from name only in case or by
+// a prefix, a common mistake when guessing at a schema
+func suggest(name string, obj *Object) string {
+	var matches []string
+	for _, f := range obj.Fields {
+		lower, other := strings.ToLower(name), strings.ToLower(f.Name)
+		if lower == other || strings.HasPrefix(other, lower) || strings.HasPrefix(lower, other) {
+			matches = append(matches, strconv.Quote(f.Name))
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	return " Did you mean " + strings.Join(matches, " or ") + "?"
+}
+
+// directiveArgs are the arguments of @skip and @include
+var directiveArgs = []*Arg{{Name: "if", Type: &NonNull{Boolean}}}
+
+func (v *validator) directives(directives []*Directive, location string) {
+	seen := make(map[string]bool)
+	for _, d := range directives {
+		if d.Name != "skip" && d.Name != "include" {
+			v.errorf(d.Loc, "Unknown directive \"@%s\".", d.Name)
+			continue
+		}
+		switch location {
+		case "FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT":
+		default:
+			v.errorf(d.Loc, "Directive \"@%s\" may not be used on %s.", d.Name, location)
+		}
+		if seen[d.Name] {
+			v.errorf(d.Loc, "The directive \"@%s\" can only be used once at this location.", d.Name)
+		}
+		seen[d.Name] = true
+	}
+}
+
+// arguments checks given against the definitions: each is known, given
+// once and of the right type, and required ones are present
+func (v *validator) arguments(given []*Argument, defs []*Arg, owner string, loc Location, use *usage) {
+	seen := make(map[string]bool)
+	for _, arg := range given {
+		if seen[arg.Name] {
+			v.errorf(arg.Loc, "There can be only one argument named %q.", arg.Name)
+		}
+		seen[arg.Name] = true
+
+		def := findArg(defs, arg.Name)
+		if def == nil {
+			v.errorf(arg.Loc, "Unknown argument %q on %s.", arg.Name, owner)
+			continue
+		}
+		v.value(def.Type, def.Default != nil, arg.Value, use)
+	}
+	for _, def := range defs {
+		if _, required := def.Type.(*NonNull); required && def.Default == nil && !seen[def.Name] {
+			v.errorf(loc, "Argument %q of type %q is required, but it was not provided.", def.Name, def.Type)
+		}
+	}
+}
+
+func findArg(defs []*Arg, name string) *Arg {
+	for _, def := range defs {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// value checks a literal against t, recording the variables it uses
+func (v *validator) value(t Type, hasDefault bool, value Value, use *usage) {
+	if value.Kind == VariableValue {
+		use.variables = append(use.variables, variableUsage{name: value.Raw, typ: t, hasDefault: hasDefault, loc: value.Loc})
+		return
+	}
+	if l, ok := nullable(t).(*List); ok && value.Kind == ListValue {
+		for _, item := range value.List {
+			v.value(l.Of, false, item, use)
+		}
+		return
+	}
+	// Variables cannot hide inside values that fail to coerce, so coercion
+	// with no variables is a complete check
+	if _, err := coerceLiteral(t, value, nil); err != nil {
+		v.errs = append(v.errs, errorAt(value.Loc, "%s", err))
+	}
+}
+
+// variables checks an operation's variable definitions against where the
+// operation and the fragments it reaches use them
+func (v *validator) variables(op *Operation, used []variableUsage) {
+	defined := make(map[string]*VariableDefinition)
+	types := make(map[string]Type)
+	for _, def := range op.Variables {
+		if defined[def.Name] != nil {
+			v.errorf(def.Loc, "There can be only one variable named \"$%s\".", def.Name)
+		}
+		defined[def.Name] = def
+
+		t := v.schema.typeOf(def.Type)
+		if t == nil {
+			v.errorf(def.Loc, "Unknown type %q.", typeRefName(def.Type))
+			continue
+		}
+		if !isLeaf(t) {
+			v.errorf(def.Loc, "Variable \"$%s\" cannot be non-input type %q.", def.Name, t)
+			continue
+		}
+		types[def.Name] = t
+		if def.Default.Kind != NoValue {
+			if _, err := coerceLiteral(t, def.Default, nil); err != nil {
+				v.errorf(def.Default.Loc, "%s", err)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range used {
+		seen[u.name] = true
+		def := defined[u.name]
+		if def == nil {
+			if op.Name != "" {
+				v.errorf(u.loc, "Variable \"$%s\" is not defined by operation %q.", u.name, op.Name)
+			} else {
+				v.errorf(u.loc, "Variable \"$%s\" is not defined.", u.name)
+			}
+			continue
+		}
+		t, ok := types[u.name]
+		if !ok {
+			continue
+		}
+		// A nullable variable may fill a non-null position when either has
+		// a default
+		if !fits(t, u.typ) && !((def.Default.Kind != NoValue || u.hasDefault) && fits(t, nullable(u.typ))) {
+			v.errorf(u.loc, "Variable \"$%s\" of type %q used in position expecting type %q.", u.name, t, u.typ)
+		}
+	}
+	for _, def := range op.Variables {
+		if !seen[def.Name] {
+			v.errorf(def.Loc, "Variable \"$%s\" is never used.", def.Name)
+		}
+	}
+}
+
+// fits reports whether a value of type t can be used where want is expected
+func fits(t, want Type) bool {
+	if nn, ok := want.(*NonNull); ok {
+		tn, ok := t.(*NonNull)
+		return ok && fits(tn.Of, nn.Of)
+	}
+	if tn, ok := t.(*NonNull); ok {
+		return fits(tn.Of, want)
+	}
+	if wl, ok := want.(*List); ok {
+		tl, ok := t.(*List)
+		return ok && fits(tl.Of, wl.Of)
+	}
+	if _, ok := t.(*List); ok {
+		return false
+	}
+	return t == want
+}
+
+func nullable(t Type) Type {
+	if nn, ok := t.(*NonNull); ok {
+		return nn.Of
+	}
+	return t
+}
+
+// typeOf resolves a variable's declared type, or returns nil when it names
+// an unknown type
+func (s *Schema) typeOf(ref TypeRef) Type {
+	var t Type
+	if ref.Elem != nil {
+		elem := s.typeOf(*ref.Elem)
+		if elem == nil {
+			return nil
+		}
+		t = &List{elem}
+	} else {
+		t = s.types[ref.Name]
+		if t == nil {
+			return nil
+		}
+	}
+	if ref.NonNull {
+		t = &NonNull{t}
+	}
+	return t
+}
+
+func typeRefName(ref TypeRef) string {
+	for ref.Elem != nil {
+		ref = *ref.Elem
+	}
+	return ref.Name
+}
+
+// spreadClosure lists the fragments reachable from spreads
+func (v *validator) spreadClosure(spreads []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	var visit func(string)
+	visit = func(name string) {
+		info, ok := v.fragments[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		names = append(names, name)
+		for _, next := range info.usage.spreads {
+			visit(next)
+		}
+	}
+	for _, name := range spreads {
+		visit(name)
+	}
+	return names
+}
+
+// fragmentCycles reports fragments that spread themselves, which would
+// expand forever
+func (v *validator) fragmentCycles(names []string) {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string)
+	visit = func(name string, path []string) {
+		state[name] = visiting
+		for _, next := range v.fragments[name].usage.spreads {
+			if _, ok := v.fragments[next]; !ok {
+				continue
+			}
+			switch state[next] {
+			case visiting:
+				cycle := append(path[indexOf(path, next):], next)
+				v.errorf(v.doc.Fragments[next].Loc, "Cannot spread fragment %q within itself via %s.", next, strings.Join(cycle, ", "))
+			case 0:
+				visit(next, append(path, next))
+			}
+		}
+		state[name] = done
+	}
+	for _, name := range names {
+		if state[name] == 0 {
+			visit(name, []string{name})
+		}
+	}
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// overlapping reports response keys in one selection set that would need
+// two different fields, which the response cannot hold. Fields inside
+// fragments are not compared.
+func (v *validator) overlapping(obj *Object, set []Selection) {
+	byKey := make(map[string]*FieldNode)
+	for _, sel := range set {
+		f, ok := sel.(*FieldNode)
+		if !ok {
+			continue
+		}
+		other, ok := byKey[f.ResponseKey()]
+		if !ok {
+			byKey[f.ResponseKey()] = f
+			continue
+		}
+		if other.Name != f.Name {
+			v.errorf(f.Loc, "Fields %q conflict because %q and %q are different fields. Use different aliases on the fields to fetch both if this was intentional.", f.ResponseKey(), other.Name, f.Name)
+		} else if argumentsString(other.Arguments) != argumentsString(f.Arguments) {
+			v.errorf(f.Loc, "Fields %q conflict because they have differing arguments. Use different aliases on the fields to fetch both if this was intentional.", f.ResponseKey())
+		}
+	}
+}
+
+func argumentsString(args []*Argument) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Name + ":" + valueString(arg.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func valueString(v Value) string {
+	switch v.Kind {
+	case VariableValue:
+		return "$" + v.Raw
+	case StringValue:
+		return strconv.Quote(v.Raw)
+	case NullValue:
+		return "null"
+	case ListValue:
+		items := make([]string, len(v.List))
+		for i, item := range v.List {
+			items[i] = valueString(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case ObjectValue:
+		return "{" + argumentsString(v.Fields) + "}"
+	}
+	return v.Raw
+}
+
+// coerceLiteral turns a query literal into the Go value resolvers receive.
+// Variables are looked up in vars, which holds coerced values.
+func coerceLiteral(t Type, v Value, vars map[string]interface{}) (interface{}, error) {
+	if v.Kind == VariableValue {
+		return vars[v.Raw], nil
+	}
+	if nn, ok := t.(*NonNull); ok {
+		if v.Kind == NullValue {
+			return nil, fmt.Errorf("Expected value of type %q, found null.", t)
+		}
+		return coerceLiteral(nn.Of, v, vars)
+	}
+	if v.Kind == NullValue {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		if v.Kind != ListValue {
+			item, err := coerceLiteral(t.Of, v, vars)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		items := make([]interface{}, len(v.List))
+		for i, item := range v.List {
+			var err error
+			if items[i], err = coerceLiteral(t.Of, item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case *Enum:
+		if v.Kind != EnumValue || !t.has(v.Raw) {
+			return nil, fmt.Errorf("Value %s does not exist in %q enum.", valueString(v), t.Name)
+		}
+		return v.Raw, nil
+	case *Scalar:
+		var raw interface{}
+		switch v.Kind {
+		case IntValue:
+			n, err := strconv.ParseInt(v.Raw, 10, 64)
+			if err != nil || n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("Int cannot represent non 32-bit signed integer value: %s", v.Raw)
+			}
+			raw = int(n)
+		case FloatValue:
+			if t != Float {
+				return nil, fmt.Errorf("%s cannot represent a non-integer value: %s", t.Name, v.Raw)
+			}
+			f, err := strconv.ParseFloat(v.Raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Float cannot represent value: %s", v.Raw)
+			}
+			raw = f
+		case StringValue:
+			raw = v.Raw
+		case BooleanValue:
+			raw = v.Raw == "true"
+		default:
+			return nil, fmt.Errorf("%s cannot represent value: %s", t.Name, valueString(v))
+		}
+		return t.Parse(raw)
+	}
+	return nil, fmt.Errorf("%q is not an input type.", t)
+}
+
+// coerceInput turns a JSON-decoded variable into the Go value resolvers
+// receive
+func coerceInput(t Type, v interface{}) (interface{}, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("Expected non-nullable type %q not to be null.", t)
+		}
+		return coerceInput(nn.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		list, ok := v.([]interface{})
+		if !ok {
+			item, err := coerceInput(t.Of, v)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+		items := make([]interface{}, len(list))
+		for i, item := range list {
+			var err error
+			if items[i], err = coerceInput(t.Of, item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case *Enum:
+		s, ok := v.(string)
+		if !ok || !t.has(s) {
+			return nil, fmt.Errorf("Value %s does not exist in %q enum.", describe(v), t.Name)
+		}
+		return s, nil
+	case *Scalar:
+		return t.Parse(v)
+	}
+	return nil, fmt.Errorf("%q is not an input type.", t)
+}
@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the gRPC methods of one server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient returns a Client for the server at baseURL, such as
+// http://localhost:8080. A nil httpClient speaks HTTP/2 without TLS to
+// http URLs, as gRPC servers expect.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		httpClient = &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// Invoke calls a unary method, such as "discovery.v1.Discovery/Search",
+// and returns its reply. Failed calls return an *Error.
+func (c *Client) Invoke(ctx context.Context, method string, req []byte) ([]byte, error) {
+	var reply []byte
+	n := 0
+	err := c.Stream(ctx, method, req, func(msg []byte) error {
+		reply = msg
+		n++
+		return nil
+	})
+	if err == nil && n != 1 {
+		err = Errorf(Internal, "%d replies to a unary call", n)
+	}
+	return reply, err
+}
+
+// Stream calls a server streaming method, passing each reply to recv as it
+// arrives. An error from recv cancels the call and is returned.
+func (c *Client) Stream(ctx context.Context, method string, req []byte, recv func(msg []byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/"+strings.TrimPrefix(method, "/"), bytes.NewReader(frame(req)))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set("Grpc-Timeout", formatTimeout(time.Until(deadline)))
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Errorf(CodeOf(ctxErr), "%v", err)
+		}
+		return Errorf(Unavailable, "%v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Errorf(httpCode(resp.StatusCode), "HTTP status %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/grpc") {
+		return Errorf(Unknown, "unexpected Content-Type %q", ct)
+	}
+
+	for {
+		msg, err := readMessage(resp.Body)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return Errorf(CodeOf(ctxErr), "%v", err)
+			}
+			return err
+		}
+		if err := recv(msg); err != nil {
+			return err
+		}
+	}
+
+	// A call that fails before replying may put its status in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.ParseUint(status, 10, 32)
+	if err != nil {
+		return Errorf(Internal, "missing or invalid grpc-status %q", status)
+	}
+	if Code(code) != OK {
+		return &Error{Code: Code(code), Message: decodeMessage(message)}
+	}
+	return nil
+}
+
+// httpCode maps the HTTP status of a response that is not gRPC to a code,
+// as the gRPC spec does
+func httpCode(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Unavailable
+	}
+	return Unknown
+}
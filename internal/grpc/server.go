@@ -0,0 +1,238 @@
+// Package grpc serves and calls gRPC methods over net/http's HTTP/2, with
+// hand-written protocol buffer encoding in place of generated code.
+//
+// It covers what the discovery service needs: unary and server streaming
+// calls, deadlines and status codes. Client streaming, compression and
+// metadata beyond the standard headers are not supported.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxMessageSize is the largest request message a Server reads, the same
+// as grpc-go's default
+const MaxMessageSize = 4 << 20
+
+// streamWriteTimeout bounds each reply of a call. Streams may outlive the
+// server's WriteTimeout, so the deadline is pushed back before every reply
+// and again for the trailers.
+const streamWriteTimeout = 30 * time.Second
+
+// Handler answers a call with its request message, calling send once for
+// each reply. An error ends the call with the error's code, see CodeOf.
+type Handler func(ctx context.Context, req []byte, send func(msg []byte) error) error
+
+// Server is an http.Handler answering gRPC calls at /<service>/<method>.
+// It must be served over HTTP/2.
+type Server struct {
+	handlers map[string]Handler
+}
+
+// NewServer returns a Server with no methods
+func NewServer() *Server {
+	return &Server{handlers: make(map[string]Handler)}
+}
+
+// HandleUnary answers calls to name, a full method name such as
+// "discovery.v1.Discovery/Search", with h's reply
+func (s *Server) HandleUnary(name string, h func(ctx context.Context, req []byte) ([]byte, error)) {
+	s.HandleStream(name, func(ctx context.Context, req []byte, send func([]byte) error) error {
+		resp, err := h(ctx, req)
+		if err != nil {
+			return err
+		}
+		return send(resp)
+	})
+}
+
+// HandleStream answers server streaming calls to name with h
+func (s *Server) HandleStream(name string, h Handler) {
+	s.handlers["/"+strings.TrimPrefix(name, "/")] = h
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "gRPC calls must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if ct := req.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "Content-Type must be application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	extendDeadline := func() {
+		// httptest's recorder has no deadline to extend
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.WarnContext(req.Context(), "failed to extend write deadline", "error", err)
+		}
+	}
+
+	// The status goes in trailers, after any replies
+	w.Header().Set("Content-Type", "application/grpc")
+	finish := func(err error) {
+		extendDeadline()
+		code := CodeOf(err)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(code)))
+		if err != nil {
+			message := err.Error()
+			var e *Error
+			if errors.As(err, &e) {
+				message = e.Message
+			}
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(message))
+		}
+	}
+
+	ctx := req.Context()
+	if timeout := req.Header.Get("Grpc-Timeout"); timeout != "" {
+		d, err := parseTimeout(timeout)
+		if err != nil {
+			finish(Errorf(InvalidArgument, "%v", err))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	h, ok := s.handlers[req.URL.Path]
+	if !ok {
+		finish(Errorf(Unimplemented, "unknown method %s", strings.TrimPrefix(req.URL.Path, "/")))
+		return
+	}
+	if enc := req.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		w.Header().Set("Grpc-Accept-Encoding", "identity")
+		finish(Errorf(Unimplemented, "compression %q is not supported", enc))
+		return
+	}
+
+	msg, err := readMessage(req.Body)
+	if errors.Is(err, io.EOF) {
+		err = Errorf(Internal, "no request message")
+	}
+	if err != nil {
+		finish(err)
+		return
+	}
+
+	send := func(msg []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		extendDeadline()
+		if _, err := w.Write(frame(msg)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	finish(call(ctx, req.URL.Path, h, msg, send))
+}
+
+// call runs h, turning a panic into an Internal error
+func call(ctx context.Context, name string, h Handler, req []byte, send func([]byte) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(ctx, "panic in gRPC handler", "method", name, "panic", v, "stack", string(debug.Stack()))
+			err = Errorf(Internal, "internal error")
+		}
+	}()
+	return h(ctx, req, send)
+}
+
+// frame prefixes msg with its gRPC message header: an uncompressed flag
+// and the length
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readMessage reads one length-prefixed message, returning io.EOF when the
+// stream has none
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, Errorf(Internal, "truncated message header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxMessageSize {
+		return nil, Errorf(ResourceExhausted, "message of %d bytes is larger than %d", length, MaxMessageSize)
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, Errorf(Internal, "truncated message: %v", err)
+	}
+	return msg, nil
+}
+
+var timeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseTimeout parses a grpc-timeout header: up to 8 digits and a unit
+func parseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	n, err := strconv.ParseUint(s[:len(s)-1], 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid grpc-timeout %q", s)
+	}
+	// 99999999 hours overflows a Duration
+	if unit == time.Hour && n > uint64(time.Duration(1<<63-1)/time.Hour) {
+		return 1<<63 - 1, nil
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatTimeout writes d as a grpc-timeout header, rounding up to keep it
+// within 8 digits
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+	units := []struct {
+		d      time.Duration
+		suffix string
+	}{{time.Nanosecond, "n"}, {time.Microsecond, "u"}, {time.Millisecond, "m"}, {time.Second, "S"}, {time.Minute, "M"}, {time.Hour, "H"}}
+	for _, unit := range units {
+		n := d / unit.d
+		if d%unit.d != 0 {
+			n++
+		}
+		if n < 1e8 {
+			return strconv.FormatInt(int64(n), 10) + unit.suffix
+		}
+	}
+	// Durations of more than 99999999 hours do not fit in a Duration
+	panic("unreachable")
+}
@@ -0,0 +1,226 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Panicking handlers log to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newTestClient serves h over HTTP/2 without TLS and returns a client for it
+func newTestClient(t *testing.T, h http.Handler) (*Client, string) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL, nil), srv.URL
+}
+
+func echoServer() *Server {
+	s := NewServer()
+	s.HandleUnary("test.Echo/Echo", func(ctx context.Context, req []byte) ([]byte, error) {
+		return req, nil
+	})
+	s.HandleUnary("test.Echo/Fail", func(ctx context.Context, req []byte) ([]byte, error) {
+		return nil, Errorf(NotFound, "no %s here: 100%%, café", req)
+	})
+	s.HandleUnary("test.Echo/Panic", func(ctx context.Context, req []byte) ([]byte, error) {
+		panic("boom")
+	})
+	s.HandleUnary("test.Echo/Wait", func(ctx context.Context, req []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	s.HandleStream("test.Echo/Count", func(ctx context.Context, req []byte, send func([]byte) error) error {
+		for i := 0; i < len(req); i++ {
+			if err := send(req[:i+1]); err != nil {
+				return err
+			}
+		}
+		if string(req) == "fail" {
+			return Errorf(Unavailable, "gave up")
+		}
+		return nil
+	})
+	return s
+}
+
+func TestServerUnary(t *testing.T) {
+	client, _ := newTestClient(t, echoServer())
+	ctx := context.Background()
+
+	reply, err := client.Invoke(ctx, "test.Echo/Echo", []byte("hello"))
+	if err != nil || string(reply) != "hello" {
+		t.Errorf("Echo = %q, %v", reply, err)
+	}
+	// An empty message is still a message
+	if reply, err := client.Invoke(ctx, "test.Echo/Echo", nil); err != nil || len(reply) != 0 {
+		t.Errorf("empty Echo = %q, %v", reply, err)
+	}
+
+	tests := []struct {
+		method  string
+		code    Code
+		message string
+	}{
+		{"test.Echo/Fail", NotFound, "no x here: 100%, café"},
+		{"test.Echo/Panic", Internal, "internal error"},
+		{"test.Echo/Nope", Unimplemented, "unknown method test.Echo/Nope"},
+	}
+	for _, tt := range tests {
+		_, err := client.Invoke(ctx, tt.method, []byte("x"))
+		var e *Error
+		if !errors.As(err, &e) || e.Code != tt.code || e.Message != tt.message {
+			t.Errorf("%s: error %v, want %s: %s", tt.method, err, tt.code, tt.message)
+		}
+	}
+}
+
+func TestServerStream(t *testing.T) {
+	client, _ := newTestClient(t, echoServer())
+
+	var got []string
+	err := client.Stream(context.Background(), "test.Echo/Count", []byte("abc"), func(msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	})
+	if err != nil || strings.Join(got, ",") != "a,ab,abc" {
+		t.Errorf("Count = %v, %v", got, err)
+	}
+
+	// A stream may fail after sending replies
+	got = nil
+	err = client.Stream(context.Background(), "test.Echo/Count", []byte("fail"), func(msg []byte) error {
+		got = append(got, string(msg))
+		return nil
+	})
+	if CodeOf(err) != Unavailable || len(got) != 4 {
+		t.Errorf("failing Count: %d replies, %v", len(got), err)
+	}
+
+	// Unary calls want exactly one reply
+	if _, err := client.Invoke(context.Background(), "test.Echo/Count", []byte("ab")); CodeOf(err) != Internal {
+		t.Errorf("Invoke of a stream: %v", err)
+	}
+}
+
+// A stream lasts longer than the server's WriteTimeout as long as it keeps
+// sending
+func TestServerStreamOutlivesWriteTimeout(t *testing.T) {
+	s := NewServer()
+	s.HandleStream("test.Slow/Count", func(ctx context.Context, req []byte, send func([]byte) error) error {
+		for i := 0; i < 6; i++ {
+			time.Sleep(100 * time.Millisecond)
+			if err := send([]byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	srv := httptest.NewUnstartedServer(s)
+	srv.Config.WriteTimeout = 250 * time.Millisecond
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	replies := 0
+	err := NewClient(srv.URL, nil).Stream(context.Background(), "test.Slow/Count", nil, func(msg []byte) error {
+		replies++
+		return nil
+	})
+	if err != nil || replies != 6 {
+		t.Errorf("Count = %d replies, %v", replies, err)
+	}
+}
+
+func TestServerDeadline(t *testing.T) {
+	client, _ := newTestClient(t, echoServer())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Invoke(ctx, "test.Echo/Wait", nil)
+	if CodeOf(err) != DeadlineExceeded {
+		t.Errorf("error %v, want DEADLINE_EXCEEDED", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call took %v", elapsed)
+	}
+}
+
+func TestServerRejectsNonGRPC(t *testing.T) {
+	_, url := newTestClient(t, echoServer())
+
+	// HTTP/1.1
+	resp, err := http.Post(url+"/test.Echo/Echo", "application/grpc", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Errorf("HTTP/1.1: status %d", resp.StatusCode)
+	}
+
+	// HTTP/2 but JSON
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	h2c := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp, err = h2c.Post(url+"/test.Echo/Echo", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("JSON: status %d", resp.StatusCode)
+	}
+}
+
+func TestTimeouts(t *testing.T) {
+	for _, d := range []time.Duration{time.Nanosecond, 1500 * time.Millisecond, 3 * time.Hour, 1<<63 - 1} {
+		s := formatTimeout(d)
+		if len(s) > 9 {
+			t.Errorf("formatTimeout(%v) = %q, longer than 8 digits", d, s)
+		}
+		got, err := parseTimeout(s)
+		if err != nil || got < d {
+			t.Errorf("parseTimeout(%q) = %v, %v, want at least %v", s, got, err, d)
+		}
+	}
+	for _, s := range []string{"", "S", "10", "10x", "-1S", "123456789S"} {
+		if _, err := parseTimeout(s); err == nil {
+			t.Errorf("parseTimeout(%q) succeeded", s)
+		}
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	for _, s := range []string{"plain", "100%", "café\n", "%zz"} {
+		encoded := encodeMessage(s)
+		for i := 0; i < len(encoded); i++ {
+			if encoded[i] < ' ' || encoded[i] > '~' {
+				t.Errorf("encodeMessage(%q) = %q", s, encoded)
+				break
+			}
+		}
+		if got := decodeMessage(encoded); got != s {
+			t.Errorf("decodeMessage(%q) = %q, want %q", encoded, got, s)
+		}
+	}
+}
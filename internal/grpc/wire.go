@@ -0,0 +1,253 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Protocol buffer wire types
+const (
+	varintType  = 0
+	fixed64Type = 1
+	bytesType   = 2
+	fixed32Type = 5
+)
+
+// Encoder writes a protocol buffer message field by field. Like proto3, it
+// leaves out scalars with their zero value; nested messages are always
+// written.
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the message written so far
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) tag(field, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+// Int writes an int32, int64 or enum field
+func (e *Encoder) Int(field int, v int64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, varintType)
+	e.buf = binary.AppendUvarint(e.buf, uint64(v))
+}
+
+// Bool writes a bool field
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.tag(field, varintType)
+		e.buf = append(e.buf, 1)
+	}
+}
+
+// Double writes a double field
+func (e *Encoder) Double(field int, v float64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, fixed64Type)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+// String writes a string field
+func (e *Encoder) String(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, bytesType)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// Ints writes a repeated int32 or int64 field, packed
+func (e *Encoder) Ints(field int, vs []int) {
+	if len(vs) == 0 {
+		return
+	}
+	var packed []byte
+	for _, v := range vs {
+		packed = binary.AppendUvarint(packed, uint64(int64(v)))
+	}
+	e.tag(field, bytesType)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(packed)))
+	e.buf = append(e.buf, packed...)
+}
+
+// Message writes a nested message field, whose fields write adds. Call it
+// once per item of a repeated field.
+func (e *Encoder) Message(field int, write func(*Encoder)) {
+	var nested Encoder
+	write(&nested)
+	e.tag(field, bytesType)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(nested.buf)))
+	e.buf = append(e.buf, nested.buf...)
+}
+
+var errTruncated = errors.New("grpc: truncated protocol buffer")
+
+// Decoder reads a protocol buffer message a field at a time:
+//
+//	d := grpc.NewDecoder(msg)
+//	for d.Next() {
+//		switch d.Field() {
+//		case 1:
+//			query = d.String()
+//		}
+//	}
+//	if err := d.Err(); err != nil { ... }
+//
+// Fields the caller does not ask for are skipped. Reading a field as the
+// wrong type is an error.
+type Decoder struct {
+	buf      []byte
+	field    int
+	wireType int
+	// value is a varint or fixed field's value
+	value uint64
+	// bytes is a length-delimited field's contents
+	bytes []byte
+	err   error
+}
+
+// NewDecoder returns a Decoder for msg
+func NewDecoder(msg []byte) *Decoder {
+	return &Decoder{buf: msg}
+}
+
+// Next reads the next field, returning false at the end of the message or
+// on an error
+func (d *Decoder) Next() bool {
+	if d.err != nil || len(d.buf) == 0 {
+		return false
+	}
+	tag, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		return d.fail(errTruncated)
+	}
+	d.buf = d.buf[n:]
+	if tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+		return d.fail(fmt.Errorf("grpc: invalid field number %d", tag>>3))
+	}
+	d.field, d.wireType = int(tag>>3), int(tag&7)
+
+	switch d.wireType {
+	case varintType:
+		d.value, n = binary.Uvarint(d.buf)
+		if n <= 0 {
+			return d.fail(errTruncated)
+		}
+	case fixed64Type:
+		if len(d.buf) < 8 {
+			return d.fail(errTruncated)
+		}
+		d.value, n = binary.LittleEndian.Uint64(d.buf), 8
+	case fixed32Type:
+		if len(d.buf) < 4 {
+			return d.fail(errTruncated)
+		}
+		d.value, n = uint64(binary.LittleEndian.Uint32(d.buf)), 4
+	case bytesType:
+		length, m := binary.Uvarint(d.buf)
+		if m <= 0 || length > uint64(len(d.buf)-m) {
+			return d.fail(errTruncated)
+		}
+		d.bytes, n = d.buf[m:m+int(length)], m+int(length)
+	default:
+		// Groups were deprecated before proto3
+		return d.fail(fmt.Errorf("grpc: unsupported wire type %d", d.wireType))
+	}
+	d.buf = d.buf[n:]
+	return true
+}
+
+func (d *Decoder) fail(err error) bool {
+	d.err = err
+	return false
+}
+
+// Field returns the number of the field Next read
+func (d *Decoder) Field() int {
+	return d.field
+}
+
+// Err returns the error that stopped Next, if any
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) want(wireType int) bool {
+	if d.wireType != wireType && d.err == nil {
+		d.err = fmt.Errorf("grpc: field %d has wire type %d, want %d", d.field, d.wireType, wireType)
+	}
+	return d.err == nil
+}
+
+// Int returns an int32, int64 or enum field's value
+func (d *Decoder) Int() int64 {
+	if !d.want(varintType) {
+		return 0
+	}
+	return int64(d.value)
+}
+
+// Bool returns a bool field's value
+func (d *Decoder) Bool() bool {
+	if !d.want(varintType) {
+		return false
+	}
+	return d.value != 0
+}
+
+// Double returns a double field's value
+func (d *Decoder) Double() float64 {
+	if !d.want(fixed64Type) {
+		return 0
+	}
+	return math.Float64frombits(d.value)
+}
+
+// String returns a string field's value
+func (d *Decoder) String() string {
+	if !d.want(bytesType) {
+		return ""
+	}
+	return string(d.bytes)
+}
+
+// Ints returns a repeated integer field's values, packed or not. Unpacked
+// fields come one value per call.
+func (d *Decoder) Ints() []int64 {
+	if d.wireType == varintType {
+		return []int64{int64(d.value)}
+	}
+	if !d.want(bytesType) {
+		return nil
+	}
+	var vs []int64
+	for packed := d.bytes; len(packed) > 0; {
+		v, n := binary.Uvarint(packed)
+		if n <= 0 {
+			d.err = errTruncated
+			return nil
+		}
+		vs = append(vs, int64(v))
+		packed = packed[n:]
+	}
+	return vs
+}
+
+// Message returns a Decoder for a nested message field
+func (d *Decoder) Message() *Decoder {
+	if !d.want(bytesType) {
+		return &Decoder{err: d.err}
+	}
+	return NewDecoder(d.bytes)
+}
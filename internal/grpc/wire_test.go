@@ -0,0 +1,135 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	// The examples from the protocol buffer encoding guide
+	var e Encoder
+	e.Int(1, 150)
+	e.String(2, "testing")
+	e.Ints(4, []int{3, 270, 86942})
+	if got, want := hex.EncodeToString(e.Bytes()), "089601"+"120774657374696e67"+"2206038e029ea705"; got != want {
+		t.Errorf("encoded %s, want %s", got, want)
+	}
+
+	// Zero scalars are left out, nested messages are not
+	var zero Encoder
+	zero.Int(1, 0)
+	zero.String(2, "")
+	zero.Double(3, 0)
+	zero.Bool(4, false)
+	zero.Ints(5, nil)
+	zero.Message(6, func(*Encoder) {})
+	if got := hex.EncodeToString(zero.Bytes()); got != "3200" {
+		t.Errorf("zero values encoded as %s, want 3200", got)
+	}
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	var e Encoder
+	e.Int(1, -5)
+	e.String(2, "Fight Club")
+	e.Double(3, 8.4)
+	e.Bool(4, true)
+	e.Ints(5, []int{18, 53})
+	e.Message(6, func(e *Encoder) { e.String(1, "nested") })
+	e.Message(6, func(e *Encoder) { e.String(1, "again") })
+	// Unpacked repeated ints, as older encoders write them
+	e.Int(5, 80)
+	// A field the reader does not know
+	e.String(99, "skipped")
+
+	var (
+		n      int64
+		s      string
+		f      float64
+		b      bool
+		ints   []int64
+		nested []string
+	)
+	d := NewDecoder(e.Bytes())
+	for d.Next() {
+		switch d.Field() {
+		case 1:
+			n = d.Int()
+		case 2:
+			s = d.String()
+		case 3:
+			f = d.Double()
+		case 4:
+			b = d.Bool()
+		case 5:
+			ints = append(ints, d.Ints()...)
+		case 6:
+			m := d.Message()
+			for m.Next() {
+				nested = append(nested, m.String())
+			}
+		}
+	}
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != -5 || s != "Fight Club" || f != 8.4 || !b {
+		t.Errorf("scalars %d %q %v %v", n, s, f, b)
+	}
+	if len(ints) != 3 || ints[0] != 18 || ints[1] != 53 || ints[2] != 80 {
+		t.Errorf("ints %v", ints)
+	}
+	if strings.Join(nested, ",") != "nested,again" {
+		t.Errorf("nested %v", nested)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"truncated tag", "80", "truncated"},
+		{"truncated varint", "0896", "truncated"},
+		{"truncated string", "1207746573", "truncated"},
+		{"truncated double", "190000", "truncated"},
+		{"field zero", "0001", "invalid field number 0"},
+		{"group", "0b", "unsupported wire type 3"},
+		{"wrong type", "0a0161", "wire type 2, want 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, _ := hex.DecodeString(tt.msg)
+			d := NewDecoder(msg)
+			for d.Next() {
+				// Field 1 is read as an int
+				if d.Field() == 1 {
+					d.Int()
+				}
+			}
+			if d.Err() == nil || !strings.Contains(d.Err().Error(), tt.want) {
+				t.Errorf("error %v, want %q", d.Err(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFrame(t *testing.T) {
+	framed := frame([]byte("hi"))
+	if !bytes.Equal(framed, []byte{0, 0, 0, 0, 2, 'h', 'i'}) {
+		t.Errorf("framed %v", framed)
+	}
+	msg, err := readMessage(bytes.NewReader(framed))
+	if err != nil || string(msg) != "hi" {
+		t.Errorf("read %q, %v", msg, err)
+	}
+	if _, err := readMessage(bytes.NewReader([]byte{1, 0, 0, 0, 0})); CodeOf(err) != Unimplemented {
+		t.Errorf("compressed message: %v", err)
+	}
+	if _, err := readMessage(bytes.NewReader([]byte{0, 0xff, 0, 0, 0})); CodeOf(err) != ResourceExhausted {
+		t.Errorf("huge message: %v", err)
+	}
+}
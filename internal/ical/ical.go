@@ -0,0 +1,126 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calendar represents an iCalendar (RFC 5545) document
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// Event represents a VEVENT. All-day events only use the date part of Start.
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Stamp       time.Time
+}
+
+// WriteTo serialises the calendar with CRLF line endings and folded lines
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	prodID := c.ProdID
+	if prodID == "" {
+		prodID = "-//Movie Discovery App//EN"
+	}
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:"+prodID)
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(bw, "X-WR-CALNAME:"+escapeText(c.Name))
+	}
+
+	for _, event := range c.Events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+event.UID)
+
+		stamp := event.Stamp
+		if stamp.IsZero() {
+			stamp = time.Now()
+		}
+		writeLine(bw, "DTSTAMP:"+stamp.UTC().Format("20060102T150405Z"))
+
+		if event.AllDay {
+			writeLine(bw, "DTSTART;VALUE=DATE:"+event.Start.Format("20060102"))
+			end := event.End
+			if end.IsZero() || !end.After(event.Start) {
+				end = event.Start.AddDate(0, 0, 1)
+			}
+			writeLine(bw, "DTEND;VALUE=DATE:"+end.Format("20060102"))
+		} else {
+			writeLine(bw, "DTSTART:"+event.Start.UTC().Format("20060102T150405Z"))
+			if !event.End.IsZero() {
+				writeLine(bw, "DTEND:"+event.End.UTC().Format("20060102T150405Z"))
+			}
+		}
+
+		writeLine(bw, "SUMMARY:"+escapeText(event.Summary))
+		if event.Description != "" {
+			writeLine(bw, "DESCRIPTION:"+escapeText(event.Description))
+		}
+		if event.URL != "" {
+			writeLine(bw, "URL:"+event.URL)
+		}
+		writeLine(bw, "TRANSP:TRANSPARENT")
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// escapeText escapes a TEXT value as described in RFC 5545 section 3.3.11
+func escapeText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+	return r.Replace(s)
+}
+
+// writeLine writes a content line, folding it so no line exceeds 75 octets
+func writeLine(w *bufio.Writer, line string) {
+	const limit = 75
+
+	width := limit
+	for len(line) > width {
+		cut := width
+		// Never split a multi-byte character across lines
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		width = limit - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
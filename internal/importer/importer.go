@@ -0,0 +1,640 @@
+package importer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+const maxCandidates = 5
+
+// A running job is saved after this many rows or this long, whichever is first
+const (
+	saveEvery    = 25
+	saveInterval = 2 * time.Second
+)
+
+// Row represents a single title from an export file
+type Row struct {
+	Line       int            `json:"line"`
+	Title      string         `json:"title"`
+	Year       int            `json:"year,omitempty"`
+	MediaType  string         `json:"media_type,omitempty"`
+	IMDBID     string         `json:"imdb_id,omitempty"`
+	TMDBID     int            `json:"tmdb_id,omitempty"`
+	Rating     float64        `json:"rating,omitempty"`
+	Date       string         `json:"date,omitempty"`
+	Rewatch    bool           `json:"rewatch,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Match      *models.Media  `json:"match,omitempty"`
+	Candidates []models.Media `json:"candidates,omitempty"`
+}
+
+// Progress summarises how far an import job has got
+type Progress struct {
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Matched   int `json:"matched"`
+	Unmatched int `json:"unmatched"`
+	Ambiguous int `json:"ambiguous"`
+	Skipped   int `json:"skipped"`
+}
+
+// Job represents an import running in the background. Next is the index of the
+// first row still to be resolved, so an interrupted job can pick up where it
+// stopped.
+type Job struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Source    string    `json:"source"`
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Next      int       `json:"next"`
+	Progress  Progress  `json:"progress"`
+	Rows      []Row     `json:"rows"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Manager creates import jobs and runs them in the background
+type Manager struct {
+	store        *storage.Store
+	movieService *services.MovieService
+
+	mu      sync.Mutex
+	running map[string]bool
+
+	// ctx is cancelled by Shutdown to stop the workers
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+}
+
+func NewManager(store *storage.Store, movieService *services.MovieService) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		store:        store,
+		movieService: movieService,
+		running:      make(map[string]bool),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Shutdown stops the running jobs and waits for them to save their progress.
+// Stopped jobs stay queued or running, so ResumeAll picks them up after a
+// restart.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Create parses an export file, saves it as a new job and starts processing it
+func (m *Manager) Create(userID, source, kind string, r io.Reader) (*Job, error) {
+	switch kind {
+	case "", KindWatched, KindRatings, KindDiary, KindWatchlist:
+	default:
+		return nil, fmt.Errorf("unsupported kind: %q", kind)
+	}
+
+	rows, kind, err := Parse(source, kind, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("export contains no titles")
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:        id,
+		UserID:    userID,
+		Source:    source,
+		Kind:      kind,
+		Status:    JobQueued,
+		Rows:      rows,
+		Progress:  Progress{Total: len(rows)},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := m.store.Save("imports", job.ID, job); err != nil {
+		return nil, err
+	}
+
+	m.start(job.ID)
+	return job, nil
+}
+
+// Get returns a job by ID
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.load(id)
+}
+
+// List returns every job belonging to a user, newest first
+func (m *Manager) List(userID string) ([]*Job, error) {
+	ids, err := m.store.List("imports")
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []*Job
+	for _, id := range ids {
+		job, err := m.load(id)
+		if err != nil {
+			return nil, err
+		}
+		if job.UserID == userID {
+			jobs = append(jobs, job)
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs, nil
+}
+
+// Resume restarts a failed or interrupted job from the first unprocessed row
+func (m *Manager) Resume(id string) (*Job, error) {
+	m.mu.Lock()
+	job, err := m.load(id)
+	if err == nil && job.Status != JobCompleted {
+		job.Status = JobQueued
+		job.Error = ""
+		err = m.save(job)
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.start(id)
+	return job, nil
+}
+
+// ResumeAll restarts every job that was queued or running when the server stopped
+func (m *Manager) ResumeAll() error {
+	ids, err := m.store.List("imports")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		job, err := m.Get(id)
+		if err != nil {
+			return err
+		}
+		if job.Status == JobQueued || job.Status == JobRunning {
+			m.start(id)
+		}
+	}
+	return nil
+}
+
+// Resolve manually matches an unmatched or ambiguous row to a TMDB title.
+// A zero tmdbID marks the row as skipped instead.
+func (m *Manager) Resolve(id string, line, tmdbID int, mediaType string) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i := range job.Rows {
+		if job.Rows[i].Line == line {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("no row on line %d", line)
+	}
+
+	row := &job.Rows[index]
+	if row.Status != RowUnmatched && row.Status != RowAmbiguous {
+		return nil, fmt.Errorf("row on line %d is %s", line, row.Status)
+	}
+
+	if tmdbID == 0 {
+		row.Status = RowSkipped
+	} else {
+		match := findCandidate(row.Candidates, tmdbID, mediaType)
+		if match == nil {
+			if mediaType != "tv" {
+				mediaType = "movie"
+			}
+			match = &models.Media{ID: tmdbID, MediaType: mediaType}
+		}
+		row.Status = RowMatched
+		row.Match = match
+		row.Candidates = nil
+		row.Error = ""
+
+		if err := m.apply(job, *row); err != nil {
+			return nil, err
+		}
+	}
+
+	job.Progress = countProgress(job)
+	if err := m.save(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (m *Manager) start(id string) {
+	m.mu.Lock()
+	// Jobs created while shutting down stay queued until the next start
+	if m.running[id] || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.running[id] = true
+	m.workers.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.workers.Done()
+		if err := m.run(m.ctx, id); err != nil {
+			slog.Error("import failed", "import_id", id, "error", err)
+		}
+	}()
+}
+
+// run resolves the rows of a job one by one. Progress is kept in memory and
+// saved every saveEvery rows or saveInterval, whichever comes first, so long
+// exports are not rewritten for every row.
+func (m *Manager) run(ctx context.Context, id string) error {
+	m.mu.Lock()
+	job, err := m.load(id)
+	if err == nil {
+		job.Status = JobRunning
+		job.Error = ""
+		err = m.save(job)
+	}
+	if err != nil {
+		delete(m.running, id)
+		m.mu.Unlock()
+		return err
+	}
+	m.mu.Unlock()
+
+	saved, savedAt := job.Next, time.Now()
+	for job.Next < len(job.Rows) {
+		row := job.Rows[job.Next]
+
+		// Look the title up without holding the lock, upstream calls can be slow
+		resolved, lookupErr := m.match(ctx, row)
+		if lookupErr != nil {
+			// Shutting down is not the row's fault, it is looked up again on resume
+			if ctx.Err() != nil {
+				break
+			}
+			// One failed lookup should not stop the import, the row is left
+			// for the user to resolve by hand
+			slog.Warn("import lookup failed", "import_id", id, "line", row.Line, "error", lookupErr)
+			resolved = row
+			resolved.Status = RowUnmatched
+			resolved.Error = lookupErr.Error()
+		}
+
+		m.mu.Lock()
+		if resolved.Status == RowMatched {
+			if err := m.apply(job, resolved); err != nil {
+				return m.fail(job, saved, err)
+			}
+		}
+		job.Rows[job.Next] = resolved
+		job.Next++
+		if job.Next-saved >= saveEvery || time.Since(savedAt) >= saveInterval {
+			if err := m.flush(job, saved); err != nil {
+				return m.fail(job, saved, err)
+			}
+			saved, savedAt = job.Next, time.Now()
+		}
+		m.mu.Unlock()
+	}
+
+	// The final save and clearing running happen under one lock, so a Resume
+	// right after sees either a running job or one it can start again
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.running, id)
+	if job.Next >= len(job.Rows) {
+		job.Status = JobCompleted
+	}
+	return m.flush(job, saved)
+}
+
+// flush saves the rows resolved since index from into the stored job, keeping
+// any earlier rows resolved by hand in the meantime. The caller holds m.mu.
+func (m *Manager) flush(job *Job, from int) error {
+	stored, err := m.load(job.ID)
+	if err != nil {
+		return err
+	}
+	copy(stored.Rows[from:job.Next], job.Rows[from:job.Next])
+	stored.Next = job.Next
+	stored.Status = job.Status
+	stored.Error = job.Error
+	stored.Progress = countProgress(stored)
+	if err := m.save(stored); err != nil {
+		return err
+	}
+	*job = *stored
+	return nil
+}
+
+// fail marks a job failed after an error it cannot carry on from. The caller
+// holds m.mu, which fail releases.
+func (m *Manager) fail(job *Job, from int, err error) error {
+	defer m.mu.Unlock()
+	delete(m.running, job.ID)
+	job.Status = JobFailed
+	job.Error = err.Error()
+	if saveErr := m.flush(job, from); saveErr != nil {
+		slog.Error("failed to save import", "import_id", job.ID, "error", saveErr)
+	}
+	return err
+}
+
+// match resolves a row to a TMDB title, by ID when the export has one and
+// by title and year otherwise
+func (m *Manager) match(ctx context.Context, row Row) (Row, error) {
+	if row.Status == RowSkipped {
+		return row, nil
+	}
+	if row.TMDBID > 0 && row.MediaType != "" {
+		row.Status = RowMatched
+		row.Match = &models.Media{ID: row.TMDBID, MediaType: row.MediaType, Title: row.Title}
+		return row, nil
+	}
+
+	if row.IMDBID != "" {
+		media, err := m.movieService.FindByIMDBID(ctx, row.IMDBID)
+		if err != nil {
+			return row, err
+		}
+		if media != nil {
+			row.Status = RowMatched
+			row.Match = media
+			return row, nil
+		}
+	}
+
+	if row.Title == "" {
+		row.Status = RowUnmatched
+		return row, nil
+	}
+
+	mediaTypes := []string{row.MediaType}
+	if row.MediaType == "" {
+		mediaTypes = []string{"movie", "tv"}
+	}
+
+	var results []models.Media
+	for _, mediaType := range mediaTypes {
+		found, err := m.movieService.SearchByTitle(ctx, row.Title, mediaType, row.Year)
+		if err != nil {
+			return row, err
+		}
+		results = append(results, found...)
+	}
+
+	var exact []models.Media
+	for _, media := range results {
+		if titleMatches(row.Title, media) && (row.Year == 0 || releaseYear(media) == row.Year) {
+			exact = append(exact, media)
+		}
+	}
+
+	switch {
+	case len(exact) == 1:
+		row.Status = RowMatched
+		row.Match = &exact[0]
+	case len(exact) > 1:
+		row.Status = RowAmbiguous
+		row.Candidates = limit(exact)
+	case len(results) == 1 && (row.Year == 0 || releaseYear(results[0]) == row.Year):
+		row.Status = RowMatched
+		row.Match = &results[0]
+	case len(results) == 0:
+		row.Status = RowUnmatched
+	default:
+		row.Status = RowAmbiguous
+		row.Candidates = limit(results)
+	}
+
+	return row, nil
+}
+
+// apply records a matched row in the owner's library according to the job kind
+func (m *Manager) apply(job *Job, row Row) error {
+	media := row.Match
+	title := media.Title
+	if title == "" {
+		title = media.Name
+	}
+	if title == "" {
+		title = row.Title
+	}
+	year := releaseYear(*media)
+	if year == 0 {
+		year = row.Year
+	}
+	imdbID := row.IMDBID
+
+	return m.store.UpdateLibrary(job.UserID, func(library *models.Library) error {
+		switch job.Kind {
+		case KindWatchlist:
+			library.AddToWatchlist(models.WatchlistItem{
+				ID:          media.ID,
+				Title:       title,
+				PosterPath:  media.PosterPath,
+				ReleaseDate: releaseDate(*media),
+				VoteAverage: media.VoteAverage,
+				Overview:    media.Overview,
+				MediaType:   media.MediaType,
+				AddedDate:   row.Date,
+				IMDBID:      imdbID,
+			})
+		case KindRatings:
+			if row.Rating > 0 {
+				library.SetRating(models.Rating{
+					ID:        media.ID,
+					Title:     title,
+					Year:      year,
+					MediaType: media.MediaType,
+					Rating:    row.Rating,
+					RatedDate: row.Date,
+					IMDBID:    imdbID,
+				})
+			}
+		case KindDiary, KindWatched:
+			library.AddDiaryEntry(models.DiaryEntry{
+				ID:          media.ID,
+				Title:       title,
+				Year:        year,
+				MediaType:   media.MediaType,
+				WatchedDate: row.Date,
+				Rating:      row.Rating,
+				Rewatch:     row.Rewatch,
+				Tags:        row.Tags,
+				IMDBID:      imdbID,
+			})
+			if i := library.FindWatchlistItem(media.ID, media.MediaType); i != -1 {
+				library.Watchlist[i].Watched = true
+			}
+		}
+		return nil
+	})
+}
+
+func (m *Manager) load(id string) (*Job, error) {
+	var job Job
+	if err := m.store.Load("imports", id, &job); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("import %s not found: %w", id, err)
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (m *Manager) save(job *Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	return m.store.Save("imports", job.ID, job)
+}
+
+func countProgress(job *Job) Progress {
+	progress := Progress{Total: len(job.Rows), Processed: job.Next}
+	for _, row := range job.Rows {
+		switch row.Status {
+		case RowMatched:
+			progress.Matched++
+		case RowUnmatched:
+			progress.Unmatched++
+		case RowAmbiguous:
+			progress.Ambiguous++
+		case RowSkipped:
+			progress.Skipped++
+		}
+	}
+	return progress
+}
+
+func findCandidate(candidates []models.Media, id int, mediaType string) *models.Media {
+	for i := range candidates {
+		if candidates[i].ID == id && (mediaType == "" || candidates[i].MediaType == mediaType) {
+			return &candidates[i]
+		}
+	}
+	return nil
+}
+
+func limit(results []models.Media) []models.Media {
+	if len(results) > maxCandidates {
+		return results[:maxCandidates]
+	}
+	return results
+}
+
+func titleMatches(title string, media models.Media) bool {
+	want := normalizeTitle(title)
+	for _, candidate := range []string{media.Title, media.Name, media.OriginalTitle, media.OriginalName} {
+		if candidate != "" && normalizeTitle(candidate) == want {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeTitle lowercases a title and drops punctuation so "Se7en" and "se7en." compare equal
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func releaseDate(media models.Media) string {
+	if media.ReleaseDate != "" {
+		return media.ReleaseDate
+	}
+	return media.FirstAirDate
+}
+
+func releaseYear(media models.Media) int {
+	date := releaseDate(media)
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate job ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,380 @@
+package importer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+)
+
+func TestMain(m *testing.M) {
+	// Failed lookups are logged to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testFixtures holds titles that match, clash and only nearly match
+var testFixtures = fstest.MapFS{
+	"tmdb/search/multi.json": {Data: []byte(`{"page": 1, "results": [
+		{"id": 550, "media_type": "movie", "title": "Fight Club", "release_date": "1999-10-15"},
+		{"id": 949, "media_type": "movie", "title": "Heat", "release_date": "1995-12-15"},
+		{"id": 11000, "media_type": "movie", "title": "Heat", "release_date": "1986-03-14"},
+		{"id": 603, "media_type": "movie", "title": "The Matrix", "release_date": "1999-03-30"},
+		{"id": 11, "media_type": "movie", "title": "Star Wars", "release_date": "1977-05-25"},
+		{"id": 13475, "media_type": "movie", "title": "Star Trek", "release_date": "2009-05-06"},
+		{"id": 1396, "media_type": "tv", "name": "Breaking Bad", "first_air_date": "2008-01-20"},
+		{"id": 2316, "media_type": "tv", "name": "The Office", "first_air_date": "2005-03-24"},
+		{"id": 2996, "media_type": "tv", "name": "The Office", "first_air_date": "2001-07-09"}
+	]}`)},
+	"tmdb/movie/550.json": {Data: []byte(`{"id": 550, "title": "Fight Club", "release_date": "1999-10-15", "imdb_id": "tt0137523"}`)},
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeupstream.Server) {
+	t.Helper()
+	fake := fakeupstream.New(fakeupstream.Options{Fixtures: testFixtures})
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:  "test-key",
+		TMDBBaseURL: "https://api.themoviedb.test/3",
+	}, &http.Client{Transport: fake.Transport()})
+
+	m := NewManager(storage.NewStore(t.TempDir()), movieService)
+	t.Cleanup(func() { m.Shutdown(context.Background()) })
+	return m, fake
+}
+
+// wait polls a job until it stops running
+func wait(t *testing.T, m *Manager, id string) *Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.mu.Lock()
+		running := m.running[id]
+		m.mu.Unlock()
+		if !running && job.Status != JobQueued && job.Status != JobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("import still %s after 5s", job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		kind     string
+		data     string
+		wantKind string
+		want     []Row
+		err      string
+	}{
+		{
+			name:     "letterboxd diary",
+			source:   SourceLetterboxd,
+			data:     "\ufeffDate,Name,Year,Rating,Rewatch,Tags,Watched Date\n2024-01-06,Fight Club,1999,4.5,Yes,\"cinema, 35mm\",2024-01-05\n",
+			wantKind: KindDiary,
+			want:     []Row{{Line: 2, Title: "Fight Club", Year: 1999, MediaType: "movie", Rating: 9, Date: "2024-01-05", Rewatch: true, Tags: []string{"cinema", "35mm"}, Status: RowPending}},
+		},
+		{
+			name:     "letterboxd ratings",
+			source:   SourceLetterboxd,
+			data:     "Date,Name,Year,Rating\n2024-02-01,Heat,1995,5\n",
+			wantKind: KindRatings,
+			want:     []Row{{Line: 2, Title: "Heat", Year: 1995, MediaType: "movie", Rating: 10, Date: "2024-02-01", Status: RowPending}},
+		},
+		{
+			name:     "letterboxd watchlist by kind",
+			source:   SourceLetterboxd,
+			kind:     KindWatchlist,
+			data:     "Date,Name,Year\n2024-02-01,Heat,\n",
+			wantKind: KindWatchlist,
+			want:     []Row{{Line: 2, Title: "Heat", MediaType: "movie", Date: "2024-02-01", Status: RowPending}},
+		},
+		{name: "letterboxd without kind", source: SourceLetterboxd, data: "Date,Name,Year\n2024-02-01,Heat,1995\n", err: "please specify kind"},
+		{name: "letterboxd without name", source: SourceLetterboxd, data: "Date,Title\n", err: "missing Name column"},
+		{
+			name:     "imdb ratings",
+			source:   SourceIMDb,
+			data:     "Const,Your Rating,Date Rated,Title,Title Type,Year\ntt0137523,9,2024-03-01,Fight Club,Movie,1999\ntt0903747,10,2024-03-02,Breaking Bad,TV Series,2008\ntt0959621,8,2024-03-03,Pilot,TV Episode,2008\n",
+			wantKind: KindRatings,
+			want: []Row{
+				{Line: 2, Title: "Fight Club", Year: 1999, MediaType: "movie", IMDBID: "tt0137523", Rating: 9, Date: "2024-03-01", Status: RowPending},
+				{Line: 3, Title: "Breaking Bad", Year: 2008, MediaType: "tv", IMDBID: "tt0903747", Rating: 10, Date: "2024-03-02", Status: RowPending},
+				{Line: 4, Title: "Pilot", Year: 2008, MediaType: "tv", IMDBID: "tt0959621", Rating: 8, Date: "2024-03-03", Status: RowSkipped},
+			},
+		},
+		{
+			name:     "imdb watchlist",
+			source:   SourceIMDb,
+			data:     "Position,Const,Created,Title,Title Type,Year\n1,tt0113277,2024-04-01,Heat,movie,1995\n2,tt0306414,2024-04-02,The Wire,tvMiniSeries,2002\n",
+			wantKind: KindWatchlist,
+			want: []Row{
+				{Line: 2, Title: "Heat", Year: 1995, MediaType: "movie", IMDBID: "tt0113277", Date: "2024-04-01", Status: RowPending},
+				{Line: 3, Title: "The Wire", Year: 2002, MediaType: "tv", IMDBID: "tt0306414", Date: "2024-04-02", Status: RowPending},
+			},
+		},
+		{name: "imdb without const", source: SourceIMDb, data: "Title,Year\n", err: "missing Const column"},
+		{
+			name:   "trakt history",
+			source: SourceTrakt,
+			data: `[
+				{"type": "movie", "watched_at": "2024-05-01T20:00:00.000Z", "movie": {"title": "Fight Club", "year": 1999, "ids": {"trakt": 1, "imdb": "tt0137523", "tmdb": 550}}},
+				{"type": "episode", "watched_at": "2024-05-02T20:00:00.000Z", "show": {"title": "Breaking Bad", "year": 2008, "ids": {"trakt": 2, "tmdb": 1396}}},
+				{"type": "episode", "watched_at": "2024-05-02T21:00:00.000Z", "show": {"title": "Breaking Bad", "year": 2008, "ids": {"trakt": 2, "tmdb": 1396}}},
+				{"type": "season"}
+			]`,
+			wantKind: KindDiary,
+			want: []Row{
+				{Line: 1, Title: "Fight Club", Year: 1999, MediaType: "movie", IMDBID: "tt0137523", TMDBID: 550, Date: "2024-05-01", Status: RowPending},
+				{Line: 2, Title: "Breaking Bad", Year: 2008, MediaType: "tv", TMDBID: 1396, Date: "2024-05-02", Status: RowPending},
+			},
+		},
+		{
+			name:     "trakt ratings",
+			source:   SourceTrakt,
+			data:     `[{"type": "movie", "rating": 8, "rated_at": "2024-06-01T10:00:00Z", "movie": {"title": "Heat", "year": 1995, "ids": {"trakt": 3}}}]`,
+			wantKind: KindRatings,
+			want:     []Row{{Line: 1, Title: "Heat", Year: 1995, MediaType: "movie", Rating: 8, Date: "2024-06-01", Status: RowPending}},
+		},
+		{name: "trakt not json", source: SourceTrakt, data: "Date,Name\n", err: "not a Trakt export"},
+		{name: "unknown source", source: "netflix", data: "", err: "unsupported source"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, kind, err := Parse(tt.source, tt.kind, strings.NewReader(tt.data))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind != tt.wantKind {
+				t.Errorf("kind = %q, want %q", kind, tt.wantKind)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %+v\nwant %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	tests := []struct {
+		name       string
+		row        Row
+		status     string
+		match      int
+		candidates []int
+	}{
+		{name: "tmdb id", row: Row{Title: "Anything", TMDBID: 27205, MediaType: "movie"}, status: RowMatched, match: 27205},
+		{name: "imdb id", row: Row{Title: "Fight Club", IMDBID: "tt0137523"}, status: RowMatched, match: 550},
+		{name: "unknown imdb id falls back to title", row: Row{Title: "Heat", Year: 1995, IMDBID: "tt0113277"}, status: RowMatched, match: 949},
+		{name: "title and year", row: Row{Title: "HEAT", Year: 1986, MediaType: "movie"}, status: RowMatched, match: 11000},
+		{name: "same title in two years", row: Row{Title: "Heat", MediaType: "movie"}, status: RowAmbiguous, candidates: []int{949, 11000}},
+		{name: "show without a media type", row: Row{Title: "The Office", Year: 2005}, status: RowMatched, match: 2316},
+		{name: "single near match", row: Row{Title: "Matrix", Year: 1999, MediaType: "movie"}, status: RowMatched, match: 603},
+		{name: "several near matches", row: Row{Title: "Star", MediaType: "movie"}, status: RowAmbiguous, candidates: []int{11, 13475}},
+		{name: "wrong year", row: Row{Title: "Fight Club", Year: 2001, MediaType: "movie"}, status: RowUnmatched},
+		{name: "no results", row: Row{Title: "Nonexistent Film", MediaType: "movie"}, status: RowUnmatched},
+		{name: "no title", row: Row{}, status: RowUnmatched},
+		{name: "skipped", row: Row{Title: "Pilot", Status: RowSkipped}, status: RowSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row, err := m.match(context.Background(), tt.row)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if row.Status != tt.status {
+				t.Errorf("status = %q, want %q", row.Status, tt.status)
+			}
+			match := 0
+			if row.Match != nil {
+				match = row.Match.ID
+			}
+			if match != tt.match {
+				t.Errorf("match = %d, want %d", match, tt.match)
+			}
+			var candidates []int
+			for _, c := range row.Candidates {
+				candidates = append(candidates, c.ID)
+			}
+			if !reflect.DeepEqual(candidates, tt.candidates) {
+				t.Errorf("candidates = %v, want %v", candidates, tt.candidates)
+			}
+		})
+	}
+}
+
+func TestImportRun(t *testing.T) {
+	m, fake := newTestManager(t)
+
+	// The first search fails once, which leaves its row for the user
+	fake.Fail("/3/search/movie", fakeupstream.ServerError, 1)
+	data := "Date,Name,Year,Watched Date\n" +
+		"2024-01-01,Star Wars,1977,2024-01-01\n" +
+		"2024-01-02,Fight Club,1999,2024-01-02\n" +
+		"2024-01-03,Heat,,2024-01-03\n" +
+		"2024-01-04,Nonexistent Film,2020,2024-01-04\n"
+	job, err := m.Create("alice", SourceLetterboxd, "", strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job = wait(t, m, job.ID)
+	if job.Status != JobCompleted {
+		t.Fatalf("status = %q (%s), want %q", job.Status, job.Error, JobCompleted)
+	}
+	want := Progress{Total: 4, Processed: 4, Matched: 1, Unmatched: 2, Ambiguous: 1}
+	if job.Progress != want {
+		t.Errorf("progress = %+v, want %+v", job.Progress, want)
+	}
+	if row := job.Rows[0]; row.Status != RowUnmatched || row.Error == "" {
+		t.Errorf("failed lookup: status %q, error %q", row.Status, row.Error)
+	}
+
+	library, err := m.store.Library("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(library.Diary) != 1 || library.Diary[0].ID != 550 || library.Diary[0].WatchedDate != "2024-01-02" {
+		t.Errorf("diary = %+v", library.Diary)
+	}
+
+	// Resolving picks a candidate, or skips the row
+	job, err = m.Resolve(job.ID, 4, 949, "movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := job.Rows[2]; row.Status != RowMatched || row.Match.Title != "Heat" || row.Candidates != nil {
+		t.Errorf("resolved row = %+v", row)
+	}
+	job, err = m.Resolve(job.ID, 2, 11, "movie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := job.Rows[0]; row.Status != RowMatched || row.Error != "" {
+		t.Errorf("resolved failed row = %+v", row)
+	}
+	if job, err = m.Resolve(job.ID, 5, 0, ""); err != nil || job.Rows[3].Status != RowSkipped {
+		t.Errorf("skip: %v", err)
+	}
+	want = Progress{Total: 4, Processed: 4, Matched: 3, Skipped: 1}
+	if job.Progress != want {
+		t.Errorf("progress = %+v, want %+v", job.Progress, want)
+	}
+
+	library, err = m.store.Library("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(library.Diary) != 3 {
+		t.Errorf("diary has %d entries, want 3", len(library.Diary))
+	}
+
+	for _, tt := range []struct {
+		line int
+		err  string
+	}{
+		{3, "row on line 3 is matched"},
+		{9, "no row on line 9"},
+	} {
+		if _, err := m.Resolve(job.ID, tt.line, 550, "movie"); err == nil || err.Error() != tt.err {
+			t.Errorf("Resolve line %d: error = %v, want %q", tt.line, err, tt.err)
+		}
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	m, fake := newTestManager(t)
+
+	// A job stopped after its first row, as a shutdown leaves it
+	job := &Job{
+		ID:     "0123456789abcdef",
+		UserID: "alice",
+		Source: SourceLetterboxd,
+		Kind:   KindWatchlist,
+		Status: JobRunning,
+		Next:   1,
+		Rows: []Row{
+			{Line: 2, Title: "Heat", MediaType: "movie", Status: RowAmbiguous},
+			{Line: 3, Title: "Fight Club", Year: 1999, MediaType: "movie", Status: RowPending},
+		},
+	}
+	if err := m.store.Save("imports", job.ID, job); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.ResumeAll(); err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, m, job.ID)
+	if job.Status != JobCompleted || job.Rows[0].Status != RowAmbiguous || job.Rows[1].Status != RowMatched {
+		t.Errorf("resumed job = %+v", job)
+	}
+	if calls := len(fake.Calls("/3/search/movie")); calls != 1 {
+		t.Errorf("%d searches, want only the unprocessed row's", calls)
+	}
+
+	library, err := m.store.Library("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(library.Watchlist) != 1 || library.Watchlist[0].ID != 550 {
+		t.Errorf("watchlist = %+v", library.Watchlist)
+	}
+
+	// Resuming while a job runs, or just as it finishes, leaves it completed
+	job, err = m.Create("bob", SourceLetterboxd, KindWatchlist, strings.NewReader("Date,Name,Year\n2024-01-01,Heat,1995\n2024-01-02,Star Wars,1977\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := m.Resume(job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if job = wait(t, m, job.ID); job.Status != JobCompleted {
+		t.Errorf("status after resume = %q", job.Status)
+	}
+}
+
+func TestImportManyRows(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	var b strings.Builder
+	b.WriteString("Date,Name,Year\n")
+	for i := 0; i < saveEvery*2+3; i++ {
+		b.WriteString("2024-01-01,Nonexistent Film,2020\n")
+	}
+	job, err := m.Create("alice", SourceLetterboxd, KindWatchlist, strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job = wait(t, m, job.ID)
+	if job.Status != JobCompleted || job.Progress.Unmatched != saveEvery*2+3 {
+		t.Errorf("job = %s, progress %+v", job.Status, job.Progress)
+	}
+}
@@ -0,0 +1,321 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported export sources
+const (
+	SourceLetterboxd = "letterboxd"
+	SourceIMDb       = "imdb"
+	SourceTrakt      = "trakt"
+)
+
+// Supported kinds of export
+const (
+	KindWatched   = "watched"
+	KindRatings   = "ratings"
+	KindDiary     = "diary"
+	KindWatchlist = "watchlist"
+)
+
+// Row statuses
+const (
+	RowPending   = "pending"
+	RowMatched   = "matched"
+	RowUnmatched = "unmatched"
+	RowAmbiguous = "ambiguous"
+	RowSkipped   = "skipped"
+)
+
+// Parse reads an export file and returns one row per title. When kind is empty
+// it is detected from the file where possible.
+func Parse(source, kind string, r io.Reader) ([]Row, string, error) {
+	switch source {
+	case SourceLetterboxd:
+		return parseLetterboxd(kind, r)
+	case SourceIMDb:
+		return parseIMDb(kind, r)
+	case SourceTrakt:
+		return parseTrakt(kind, r)
+	default:
+		return nil, "", fmt.Errorf("unsupported source: %q", source)
+	}
+}
+
+// readCSV reads a CSV file with a header row into maps keyed by column name
+func readCSV(r io.Reader) ([]string, []map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	var records []map[string]string
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		record := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(fields) {
+				record[name] = strings.TrimSpace(fields[i])
+			}
+		}
+		records = append(records, record)
+	}
+
+	return header, records, nil
+}
+
+func hasColumn(header []string, name string) bool {
+	for _, h := range header {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLetterboxd(kind string, r io.Reader) ([]Row, string, error) {
+	header, records, err := readCSV(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if !hasColumn(header, "Name") {
+		return nil, "", fmt.Errorf("not a Letterboxd export: missing Name column")
+	}
+
+	if kind == "" {
+		switch {
+		case hasColumn(header, "Watched Date"):
+			kind = KindDiary
+		case hasColumn(header, "Rating"):
+			kind = KindRatings
+		default:
+			return nil, "", fmt.Errorf("cannot tell watched from watchlist export, please specify kind")
+		}
+	}
+
+	rows := make([]Row, 0, len(records))
+	for i, record := range records {
+		row := Row{
+			Line:      i + 2,
+			Title:     record["Name"],
+			Year:      parseYear(record["Year"]),
+			MediaType: "movie",
+			Date:      parseDate(record["Date"]),
+			Status:    RowPending,
+		}
+
+		if rating, err := strconv.ParseFloat(record["Rating"], 64); err == nil {
+			// Letterboxd rates out of five stars in half-star steps
+			row.Rating = rating * 2
+		}
+		if watched := parseDate(record["Watched Date"]); watched != "" {
+			row.Date = watched
+		}
+		row.Rewatch = strings.EqualFold(record["Rewatch"], "yes")
+		if tags := record["Tags"]; tags != "" {
+			for _, tag := range strings.Split(tags, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					row.Tags = append(row.Tags, tag)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, kind, nil
+}
+
+func parseIMDb(kind string, r io.Reader) ([]Row, string, error) {
+	header, records, err := readCSV(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if !hasColumn(header, "Const") {
+		return nil, "", fmt.Errorf("not an IMDb export: missing Const column")
+	}
+
+	if kind == "" {
+		if hasColumn(header, "Position") {
+			kind = KindWatchlist
+		} else {
+			kind = KindRatings
+		}
+	}
+
+	rows := make([]Row, 0, len(records))
+	for i, record := range records {
+		row := Row{
+			Line:      i + 2,
+			Title:     record["Title"],
+			Year:      parseYear(record["Year"]),
+			MediaType: imdbMediaType(record["Title Type"]),
+			IMDBID:    record["Const"],
+			Status:    RowPending,
+		}
+		// Single episodes have no TMDB title of their own to match
+		if strings.EqualFold(strings.ReplaceAll(record["Title Type"], " ", ""), "tvEpisode") {
+			row.Status = RowSkipped
+		}
+
+		if rating, err := strconv.ParseFloat(record["Your Rating"], 64); err == nil {
+			row.Rating = rating
+		}
+
+		switch kind {
+		case KindWatchlist:
+			row.Date = parseDate(record["Created"])
+		default:
+			row.Date = parseDate(record["Date Rated"])
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, kind, nil
+}
+
+// imdbMediaType maps IMDb title types such as "TV Series" or "tvMiniSeries"
+func imdbMediaType(titleType string) string {
+	t := strings.ToLower(strings.ReplaceAll(titleType, " ", ""))
+	switch {
+	case t == "":
+		return ""
+	case strings.HasPrefix(t, "tvseries"), strings.HasPrefix(t, "tvminiseries"), strings.HasPrefix(t, "tvepisode"):
+		return "tv"
+	default:
+		return "movie"
+	}
+}
+
+type traktIDs struct {
+	Trakt int    `json:"trakt"`
+	IMDB  string `json:"imdb"`
+	TMDB  int    `json:"tmdb"`
+}
+
+type traktTitle struct {
+	Title string   `json:"title"`
+	Year  int      `json:"year"`
+	IDs   traktIDs `json:"ids"`
+}
+
+type traktItem struct {
+	Type          string      `json:"type"`
+	Movie         *traktTitle `json:"movie"`
+	Show          *traktTitle `json:"show"`
+	Rating        float64     `json:"rating"`
+	RatedAt       string      `json:"rated_at"`
+	WatchedAt     string      `json:"watched_at"`
+	LastWatchedAt string      `json:"last_watched_at"`
+	ListedAt      string      `json:"listed_at"`
+	Plays         int         `json:"plays"`
+}
+
+func parseTrakt(kind string, r io.Reader) ([]Row, string, error) {
+	var items []traktItem
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, "", fmt.Errorf("not a Trakt export: %w", err)
+	}
+
+	if kind == "" && len(items) > 0 {
+		first := items[0]
+		switch {
+		case first.RatedAt != "":
+			kind = KindRatings
+		case first.ListedAt != "":
+			kind = KindWatchlist
+		case first.WatchedAt != "":
+			kind = KindDiary
+		default:
+			kind = KindWatched
+		}
+	}
+
+	rows := make([]Row, 0, len(items))
+	seen := make(map[string]bool)
+	for i, item := range items {
+		title, mediaType := item.Movie, "movie"
+		if title == nil {
+			// Episodes and seasons are imported as the show they belong to
+			title, mediaType = item.Show, "tv"
+		}
+		if title == nil {
+			continue
+		}
+
+		row := Row{
+			Line:      i + 1,
+			Title:     title.Title,
+			Year:      title.Year,
+			MediaType: mediaType,
+			IMDBID:    title.IDs.IMDB,
+			TMDBID:    title.IDs.TMDB,
+			Rating:    item.Rating,
+			Status:    RowPending,
+		}
+
+		for _, date := range []string{item.WatchedAt, item.LastWatchedAt, item.RatedAt, item.ListedAt} {
+			if date != "" {
+				row.Date = parseDate(date)
+				break
+			}
+		}
+
+		// History exports list every episode; keep one row per show and date
+		key := fmt.Sprintf("%s/%d/%s/%s", mediaType, title.IDs.Trakt, title.Title, row.Date)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		rows = append(rows, row)
+	}
+
+	return rows, kind, nil
+}
+
+func parseYear(value string) int {
+	year, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// parseDate normalises the date formats used by the supported exports to YYYY-MM-DD
+func parseDate(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+
+	layouts := []string{"2006-01-02", time.RFC3339, "2006-01-02T15:04:05.000Z", "01/02/2006"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return ""
+}
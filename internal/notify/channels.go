@@ -0,0 +1,246 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Channel delivers notifications somewhere outside the in-app inbox
+type Channel interface {
+	// Name identifies the channel in delivery records
+	Name() string
+	// Enabled reports whether the user's preferences ask for this channel
+	Enabled(prefs Preferences) bool
+	// Deliver sends one notification
+	Deliver(ctx context.Context, prefs Preferences, n Notification) error
+}
+
+// WebhookChannel posts notifications as JSON to the URL in the user's preferences
+type WebhookChannel struct {
+	client *http.Client
+}
+
+// NewWebhookChannel posts with client, or by default with one that refuses
+// to connect to loopback, link-local and private addresses, since anyone can
+// set a user's webhook
+func NewWebhookChannel(client *http.Client) *WebhookChannel {
+	if client == nil {
+		dialer := &net.Dialer{Timeout: 5 * time.Second, Control: checkDialAddress}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	}
+	return &WebhookChannel{client: client}
+}
+
+// checkWebhookURL accepts absolute http and https URLs whose host is not
+// known to be internal. Names are checked again when dialled, as they may
+// resolve to anything.
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("webhook must be an absolute http or https URL")
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("webhook must not point at an internal address")
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && internalAddr(ip) {
+		return fmt.Errorf("webhook must not point at an internal address")
+	}
+	return nil
+}
+
+// checkDialAddress is a net.Dialer Control function that refuses
+// connections to internal addresses, after names have been resolved
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if internalAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is internal", addrPort.Addr())
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, which reaches hosts
+// inside providers' networks
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func internalAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip)
+}
+
+func (c *WebhookChannel) Name() string {
+	return "webhook"
+}
+
+func (c *WebhookChannel) Enabled(prefs Preferences) bool {
+	return prefs.Webhook != ""
+}
+
+func (c *WebhookChannel) Deliver(ctx context.Context, prefs Preferences, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, prefs.Webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "movie-discovery-app")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SMTPConfig holds the settings for sending email
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailChannel sends notifications by email to the address in the user's preferences
+type EmailChannel struct {
+	config SMTPConfig
+	send   func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewEmailChannel(config SMTPConfig) *EmailChannel {
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return &EmailChannel{config: config, send: sendMail}
+}
+
+func (c *EmailChannel) Name() string {
+	return "email"
+}
+
+func (c *EmailChannel) Enabled(prefs Preferences) bool {
+	return prefs.Email != ""
+}
+
+func (c *EmailChannel) Deliver(ctx context.Context, prefs Preferences, n Notification) error {
+	if strings.ContainsAny(prefs.Email, "\r\n") {
+		return fmt.Errorf("invalid email address")
+	}
+
+	var auth smtp.Auth
+	if c.config.Username != "" {
+		auth = smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)
+	}
+
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Message)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", prefs.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&msg, "\r\n%s\r\n\r\nhttps://www.themoviedb.org/%s/%d\r\n", n.Message, n.MediaType, n.TMDBID)
+
+	addr := net.JoinHostPort(c.config.Host, c.config.Port)
+	if err := c.send(ctx, addr, auth, c.config.From, []string{prefs.Email}, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// sendMail works like smtp.SendMail, but the connection is closed when ctx
+// is done, so a stalled server cannot hold a delivery past its timeout
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) (err error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer func() {
+		stop()
+		// Errors from the closed connection are down to ctx
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := client.Auth(a); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
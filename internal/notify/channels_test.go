@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A host name can resolve to an internal address whatever SetPreferences
+// saw, so the default client checks addresses again when it dials
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	err := NewWebhookChannel(nil).Deliver(context.Background(), Preferences{Webhook: srv.URL}, Notification{})
+	if err == nil || !strings.Contains(err.Error(), "is internal") {
+		t.Errorf("error = %v, want the address refused", err)
+	}
+	if called {
+		t.Error("webhook was called")
+	}
+}
+
+func TestWebhookWithClient(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	err := NewWebhookChannel(srv.Client()).Deliver(context.Background(), Preferences{Webhook: srv.URL}, Notification{})
+	if err != nil || !called {
+		t.Errorf("error = %v, called = %v", err, called)
+	}
+}
+
+func TestInternalAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"192.168.0.1":     true,
+		"169.254.169.254": true,
+		"100.64.0.1":      true,
+		"100.127.255.254": true,
+		"::ffff:10.0.0.1": true,
+		"::1":             true,
+		"fd00::1":         true,
+		"100.128.0.1":     false,
+		"8.8.8.8":         false,
+		"2001:4860::8888": false,
+	}
+	for addr, want := range tests {
+		if got := internalAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("internalAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestEmailDeliver(t *testing.T) {
+	addr, received := smtpServer(t, true)
+	host, port, _ := net.SplitHostPort(addr)
+	channel := NewEmailChannel(SMTPConfig{Host: host, Port: port, From: "app@example.com"})
+
+	n := Notification{Message: "Amélie is released today\r\nBcc: x@example.com", MediaType: "movie", TMDBID: 194}
+	if err := channel.Deliver(context.Background(), Preferences{Email: "alice@example.com"}, n); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-received
+	for _, want := range []string{
+		"MAIL FROM:<app@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"Subject: =?utf-8?q?Am=C3=A9lie_is_released_today__Bcc:_x@example.com?=\r\n",
+		"https://www.themoviedb.org/movie/194",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("session lacks %q:\n%s", want, msg)
+		}
+	}
+}
+
+// A server that never answers holds a delivery only until its context ends
+func TestEmailDeliverStalled(t *testing.T) {
+	addr, _ := smtpServer(t, false)
+	host, port, _ := net.SplitHostPort(addr)
+	channel := NewEmailChannel(SMTPConfig{Host: host, Port: port, From: "app@example.com"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := channel.Deliver(ctx, Preferences{Email: "alice@example.com"}, Notification{Message: "x"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("delivery took %v", elapsed)
+	}
+}
+
+// smtpServer accepts one SMTP session and sends everything the client wrote
+// to received. A server that does not answer only accepts the connection.
+func smtpServer(t *testing.T, answer bool) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if !answer {
+			io.Copy(io.Discard, conn)
+			return
+		}
+
+		var session strings.Builder
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 test ESMTP\r\n")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			session.WriteString(line)
+			switch {
+			case inData:
+				if line == ".\r\n" {
+					inData = false
+					fmt.Fprint(conn, "250 OK\r\n")
+				}
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(conn, "250-test\r\n250 8BITMIME\r\n")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				fmt.Fprint(conn, "354 go ahead\r\n")
+			case strings.HasPrefix(line, "QUIT"):
+				fmt.Fprint(conn, "221 bye\r\n")
+				received <- session.String()
+				return
+			default:
+				fmt.Fprint(conn, "250 OK\r\n")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Notification types
+const (
+	TypeRelease = "release"
+	TypeEpisode = "episode"
+	TypeSeason  = "season"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	maxInboxSize     = 200
+	maxDeliveryTries = 3
+)
+
+// Notification represents something a user should hear about. The ID is
+// derived from what happened, so the same release is never reported twice.
+type Notification struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Type       string     `json:"type"`
+	TMDBID     int        `json:"tmdb_id"`
+	MediaType  string     `json:"media_type"`
+	Title      string     `json:"title"`
+	Message    string     `json:"message"`
+	Date       string     `json:"date"`
+	Season     int        `json:"season,omitempty"`
+	Episode    int        `json:"episode,omitempty"`
+	PosterPath string     `json:"poster_path,omitempty"`
+	Read       bool       `json:"read"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Deliveries []Delivery `json:"deliveries,omitempty"`
+}
+
+// Delivery records how sending a notification through one channel went
+type Delivery struct {
+	Channel  string `json:"channel"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErrInvalidPreferences is returned for preferences that cannot be saved
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// Preferences control which notifications a user gets and where they go
+type Preferences struct {
+	UserID   string `json:"user_id"`
+	Region   string `json:"region"`
+	Releases bool   `json:"releases"`
+	Episodes bool   `json:"episodes"`
+	LeadDays int    `json:"lead_days"` // notify this many days before the date
+	Email    string `json:"email,omitempty"`
+	Webhook  string `json:"webhook,omitempty"`
+}
+
+// DefaultPreferences returns the preferences of a user who has not set any
+func DefaultPreferences(userID string) Preferences {
+	return Preferences{
+		UserID:   userID,
+		Region:   "US",
+		Releases: true,
+		Episodes: true,
+	}
+}
+
+// Inbox holds a user's notifications. Sent maps every notification ID
+// generated to the date it is about, so trimming old notifications does not
+// cause repeats. IDs are forgotten once their date is too old to be reported.
+type Inbox struct {
+	UserID        string            `json:"user_id"`
+	Notifications []Notification    `json:"notifications"`
+	Sent          map[string]string `json:"sent"`
+}
+
+// UnmarshalJSON also reads inboxes saved when Sent mapped IDs to true. Those
+// IDs take the date of their notification, or none once it was trimmed.
+func (inbox *Inbox) UnmarshalJSON(data []byte) error {
+	type plain Inbox
+	var v struct {
+		plain
+		Sent map[string]interface{} `json:"sent"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*inbox = Inbox(v.plain)
+	if v.Sent == nil {
+		return nil
+	}
+	inbox.Sent = make(map[string]string, len(v.Sent))
+	for id, value := range v.Sent {
+		date, ok := value.(string)
+		if !ok {
+			for _, n := range inbox.Notifications {
+				if n.ID == id {
+					date = n.Date
+				}
+			}
+		}
+		inbox.Sent[id] = date
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+// How far back a release or air date may be and still be worth a notification,
+// so a newly watchlisted title does not report something from months ago
+const staleAfter = 3 * 24 * time.Hour
+
+// Release types worth a notification, see models.ReleaseDate
+var releaseTypes = map[int]string{
+	3: "is out in cinemas",
+	4: "is available to stream or buy",
+}
+
+// Scheduler periodically checks watchlisted titles for releases and new
+// episodes, and keeps every user's notification inbox
+type Scheduler struct {
+	store        *storage.Store
+	movieService *services.MovieService
+	channels     []Channel
+	interval     time.Duration
+	now          func() time.Time
+
+	mu   sync.Mutex
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+func NewScheduler(store *storage.Store, movieService *services.MovieService, interval time.Duration, channels ...Channel) *Scheduler {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &Scheduler{
+		store:        store,
+		movieService: movieService,
+		channels:     channels,
+		interval:     interval,
+		now:          time.Now,
+	}
+}
+
+// SetClock replaces time.Now, so tests can decide what has been released.
+// Call it before Start.
+func (s *Scheduler) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Start runs a check straight away and then every interval until Stop is called
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+				slog.Error("notification check failed", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the running check and waits for it to finish
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	s.stop()
+	<-s.done
+}
+
+// RunOnce checks every user's watchlist, records new notifications and
+// retries deliveries that failed last time
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	users, err := s.store.List("libraries")
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.checkUser(ctx, userID); err != nil {
+			slog.Error("notification check failed", "user_id", userID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) checkUser(ctx context.Context, userID string) error {
+	library, err := s.store.Library(userID)
+	if err != nil {
+		return err
+	}
+	prefs, err := s.Preferences(userID)
+	if err != nil {
+		return err
+	}
+
+	var found []Notification
+	for _, item := range library.Watchlist {
+		if item.Watched {
+			continue
+		}
+
+		var notifications []Notification
+		var err error
+		switch {
+		case item.MediaType == "movie" && prefs.Releases:
+			notifications, err = s.checkMovie(ctx, item, prefs)
+		case item.MediaType == "tv" && prefs.Episodes:
+			notifications, err = s.checkShow(ctx, item, prefs)
+		}
+		if err != nil {
+			slog.Warn("failed to check title", "media_type", item.MediaType, "tmdb_id", item.ID, "error", err)
+			continue
+		}
+		found = append(found, notifications...)
+	}
+
+	s.mu.Lock()
+	inbox, err := s.loadInbox(userID)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	for id, date := range inbox.Sent {
+		if s.expired(date) {
+			delete(inbox.Sent, id)
+		}
+	}
+	for _, n := range found {
+		if _, ok := inbox.Sent[n.ID]; ok {
+			continue
+		}
+		n.UserID = userID
+		n.CreatedAt = s.now().UTC()
+		for _, channel := range s.channels {
+			if channel.Enabled(prefs) {
+				n.Deliveries = append(n.Deliveries, Delivery{Channel: channel.Name(), Status: DeliveryPending})
+			}
+		}
+		inbox.Sent[n.ID] = n.Date
+		inbox.Notifications = append(inbox.Notifications, n)
+	}
+	pending := pendingDeliveries(inbox)
+	err = s.saveInbox(inbox)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.deliver(ctx, userID, prefs, pending)
+	return nil
+}
+
+// checkMovie reports theatrical and digital releases in the user's region,
+// falling back to the primary release date when TMDB has none for the region
+func (s *Scheduler) checkMovie(ctx context.Context, item models.WatchlistItem, prefs Preferences) ([]Notification, error) {
+	releaseDates, err := s.movieService.GetReleaseDates(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	var notifications []Notification
+	for _, country := range releaseDates.Results {
+		if country.ISO31661 != prefs.Region {
+			continue
+		}
+		for _, release := range country.ReleaseDates {
+			verb, ok := releaseTypes[release.Type]
+			if !ok || len(release.ReleaseDate) < 10 {
+				continue
+			}
+			date := release.ReleaseDate[:10]
+			if !s.due(date, prefs.LeadDays) {
+				continue
+			}
+			notifications = append(notifications, Notification{
+				ID:         fmt.Sprintf("release-movie-%d-%s-%d", item.ID, prefs.Region, release.Type),
+				Type:       TypeRelease,
+				TMDBID:     item.ID,
+				MediaType:  "movie",
+				Title:      item.Title,
+				Message:    s.message(item.Title, verb, date),
+				Date:       date,
+				PosterPath: item.PosterPath,
+			})
+		}
+	}
+
+	if len(notifications) == 0 && item.ReleaseDate != "" && s.due(item.ReleaseDate, prefs.LeadDays) {
+		notifications = append(notifications, Notification{
+			ID:         fmt.Sprintf("release-movie-%d", item.ID),
+			Type:       TypeRelease,
+			TMDBID:     item.ID,
+			MediaType:  "movie",
+			Title:      item.Title,
+			Message:    s.message(item.Title, "is released", item.ReleaseDate),
+			Date:       item.ReleaseDate,
+			PosterPath: item.PosterPath,
+		})
+	}
+
+	return notifications, nil
+}
+
+// checkShow reports the next episode and newly scheduled seasons of a followed show
+func (s *Scheduler) checkShow(ctx context.Context, item models.WatchlistItem, prefs Preferences) ([]Notification, error) {
+	show, err := s.movieService.GetTVSchedule(ctx, strconv.Itoa(item.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	title := show.Name
+	if title == "" {
+		title = item.Title
+	}
+
+	var notifications []Notification
+	for _, season := range show.Seasons {
+		// Season 0 holds specials
+		if season.SeasonNumber == 0 || season.AirDate == "" || !s.due(season.AirDate, prefs.LeadDays) {
+			continue
+		}
+		notifications = append(notifications, Notification{
+			ID:         fmt.Sprintf("season-tv-%d-s%d", item.ID, season.SeasonNumber),
+			Type:       TypeSeason,
+			TMDBID:     item.ID,
+			MediaType:  "tv",
+			Title:      title,
+			Message:    s.message(fmt.Sprintf("%s season %d", title, season.SeasonNumber), "premieres", season.AirDate),
+			Date:       season.AirDate,
+			Season:     season.SeasonNumber,
+			PosterPath: item.PosterPath,
+		})
+	}
+
+	for _, episode := range []*models.Episode{show.LastEpisodeToAir, show.NextEpisodeToAir} {
+		if episode == nil || episode.AirDate == "" || !s.due(episode.AirDate, prefs.LeadDays) {
+			continue
+		}
+		// The season premiere already has its own notification
+		if episode.EpisodeNumber == 1 {
+			continue
+		}
+		label := fmt.Sprintf("%s S%02dE%02d", title, episode.SeasonNumber, episode.EpisodeNumber)
+		if episode.Name != "" {
+			label += fmt.Sprintf(" %q", episode.Name)
+		}
+		notifications = append(notifications, Notification{
+			ID:         fmt.Sprintf("episode-tv-%d-s%de%d", item.ID, episode.SeasonNumber, episode.EpisodeNumber),
+			Type:       TypeEpisode,
+			TMDBID:     item.ID,
+			MediaType:  "tv",
+			Title:      title,
+			Message:    s.message(label, "airs", episode.AirDate),
+			Date:       episode.AirDate,
+			Season:     episode.SeasonNumber,
+			Episode:    episode.EpisodeNumber,
+			PosterPath: item.PosterPath,
+		})
+	}
+
+	return notifications, nil
+}
+
+// due reports whether a date is within the lead time and not yet stale
+func (s *Scheduler) due(date string, leadDays int) bool {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+	today := s.today()
+	return !day.After(today.AddDate(0, 0, leadDays)) && today.Sub(day) <= staleAfter
+}
+
+// expired reports whether a date is too old for due to accept again. Dates
+// that cannot be read count as expired.
+func (s *Scheduler) expired(date string) bool {
+	day, err := time.Parse("2006-01-02", date)
+	return err != nil || s.today().Sub(day) > staleAfter
+}
+
+func (s *Scheduler) message(subject, verb, date string) string {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return subject + " " + verb
+	}
+	switch days := int(day.Sub(s.today()).Hours() / 24); {
+	case days == 0:
+		return subject + " " + verb + " today"
+	case days == 1:
+		return subject + " " + verb + " tomorrow"
+	case days > 1:
+		return fmt.Sprintf("%s %s on %s", subject, verb, day.Format("Mon 2 Jan"))
+	default:
+		return fmt.Sprintf("%s %s (since %s)", subject, verb, day.Format("Mon 2 Jan"))
+	}
+}
+
+func (s *Scheduler) today() time.Time {
+	now := s.now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type pendingDelivery struct {
+	notification Notification
+	channel      string
+}
+
+func pendingDeliveries(inbox *Inbox) []pendingDelivery {
+	var pending []pendingDelivery
+	for _, n := range inbox.Notifications {
+		for _, d := range n.Deliveries {
+			if d.Status != DeliveryDelivered && d.Attempts < maxDeliveryTries {
+				pending = append(pending, pendingDelivery{notification: n, channel: d.Channel})
+			}
+		}
+	}
+	return pending
+}
+
+// deliver sends pending notifications through their channels and records the outcome
+func (s *Scheduler) deliver(ctx context.Context, userID string, prefs Preferences, pending []pendingDelivery) {
+	if len(pending) == 0 {
+		return
+	}
+
+	type outcome struct {
+		id, channel string
+		err         error
+	}
+	var outcomes []outcome
+	for _, p := range pending {
+		channel := s.channel(p.channel)
+		if channel == nil {
+			continue
+		}
+		deliverCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := channel.Deliver(deliverCtx, prefs, p.notification)
+		cancel()
+		outcomes = append(outcomes, outcome{id: p.notification.ID, channel: p.channel, err: err})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inbox, err := s.loadInbox(userID)
+	if err != nil {
+		slog.Error("failed to record deliveries", "user_id", userID, "error", err)
+		return
+	}
+	for _, o := range outcomes {
+		for i := range inbox.Notifications {
+			n := &inbox.Notifications[i]
+			if n.ID != o.id {
+				continue
+			}
+			for j := range n.Deliveries {
+				d := &n.Deliveries[j]
+				if d.Channel != o.channel {
+					continue
+				}
+				d.Attempts++
+				if o.err != nil {
+					d.Status = DeliveryFailed
+					d.Error = o.err.Error()
+				} else {
+					d.Status = DeliveryDelivered
+					d.Error = ""
+				}
+			}
+		}
+	}
+	if err := s.saveInbox(inbox); err != nil {
+		slog.Error("failed to record deliveries", "user_id", userID, "error", err)
+	}
+}
+
+func (s *Scheduler) channel(name string) Channel {
+	for _, channel := range s.channels {
+		if channel.Name() == name {
+			return channel
+		}
+	}
+	return nil
+}
+
+// Preferences returns a user's notification preferences
+func (s *Scheduler) Preferences(userID string) (Preferences, error) {
+	prefs := DefaultPreferences(userID)
+	if err := s.store.Load("notification_preferences", userID, &prefs); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return prefs, err
+	}
+	return prefs, nil
+}
+
+// SetPreferences validates and stores a user's notification preferences
+func (s *Scheduler) SetPreferences(prefs Preferences) error {
+	if prefs.Region == "" {
+		prefs.Region = "US"
+	}
+	if len(prefs.Region) != 2 {
+		return fmt.Errorf("%w: region must be a two-letter country code", ErrInvalidPreferences)
+	}
+	if prefs.LeadDays < 0 || prefs.LeadDays > 30 {
+		return fmt.Errorf("%w: lead_days must be between 0 and 30", ErrInvalidPreferences)
+	}
+	if prefs.Email != "" {
+		addr, err := mail.ParseAddress(prefs.Email)
+		if err != nil {
+			return fmt.Errorf("%w: email must be an email address", ErrInvalidPreferences)
+		}
+		prefs.Email = addr.Address
+	}
+	if prefs.Webhook != "" {
+		if err := checkWebhookURL(prefs.Webhook); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+		}
+	}
+	return s.store.Save("notification_preferences", prefs.UserID, prefs)
+}
+
+// Inbox returns a user's notifications, newest first
+func (s *Scheduler) Inbox(userID string) ([]Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inbox, err := s.loadInbox(userID)
+	if err != nil {
+		return nil, err
+	}
+	return inbox.Notifications, nil
+}
+
+// MarkRead marks one notification, or all of them when id is empty, as read
+func (s *Scheduler) MarkRead(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inbox, err := s.loadInbox(userID)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range inbox.Notifications {
+		if id == "" || inbox.Notifications[i].ID == id {
+			inbox.Notifications[i].Read = true
+			found = true
+		}
+	}
+	if id != "" && !found {
+		return storage.ErrNotFound
+	}
+
+	return s.saveInbox(inbox)
+}
+
+func (s *Scheduler) loadInbox(userID string) (*Inbox, error) {
+	inbox := &Inbox{UserID: userID}
+	if err := s.store.Load("inboxes", userID, inbox); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if inbox.Notifications == nil {
+		inbox.Notifications = []Notification{}
+	}
+	if inbox.Sent == nil {
+		inbox.Sent = make(map[string]string)
+	}
+	return inbox, nil
+}
+
+// saveInbox stores an inbox, dropping the oldest notifications beyond the cap
+func (s *Scheduler) saveInbox(inbox *Inbox) error {
+	sort.SliceStable(inbox.Notifications, func(i, j int) bool {
+		return inbox.Notifications[i].CreatedAt.After(inbox.Notifications[j].CreatedAt)
+	})
+	if len(inbox.Notifications) > maxInboxSize {
+		inbox.Notifications = inbox.Notifications[:maxInboxSize]
+	}
+	return s.store.Save("inboxes", inbox.UserID, inbox)
+}
@@ -0,0 +1,281 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+func TestMain(m *testing.M) {
+	// Failed checks and deliveries are logged to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// testNow is a Thursday, with releases and episodes either side of it
+var testNow = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+var testFixtures = fstest.MapFS{
+	"tmdb/movie/1.json": {Data: []byte(`{"id": 1, "release_dates": {"results": [
+		{"iso_3166_1": "US", "release_dates": [
+			{"type": 1, "release_date": "2026-09-01T00:00:00.000Z"},
+			{"type": 3, "release_date": "2026-10-03T00:00:00.000Z"},
+			{"type": 4, "release_date": "2026-12-01T00:00:00.000Z"}
+		]},
+		{"iso_3166_1": "GB", "release_dates": [{"type": 3, "release_date": "2026-10-01T00:00:00.000Z"}]}
+	]}}`)},
+	"tmdb/movie/2.json": {Data: []byte(`{"id": 2, "release_dates": {"results": []}}`)},
+	"tmdb/tv/4.json": {Data: []byte(`{"id": 4, "name": "Show",
+		"seasons": [
+			{"season_number": 0, "air_date": "2026-10-01"},
+			{"season_number": 1, "air_date": "2025-01-01"},
+			{"season_number": 2, "air_date": "2026-10-05"}
+		],
+		"last_episode_to_air": {"season_number": 1, "episode_number": 8, "name": "Finale", "air_date": "2026-09-30"},
+		"next_episode_to_air": {"season_number": 2, "episode_number": 1, "air_date": "2026-10-05"}}`)},
+}
+
+// testChannel fails its first fail deliveries
+type testChannel struct {
+	name  string
+	fail  int
+	calls int
+}
+
+func (c *testChannel) Name() string                   { return c.name }
+func (c *testChannel) Enabled(prefs Preferences) bool { return true }
+
+func (c *testChannel) Deliver(ctx context.Context, prefs Preferences, n Notification) error {
+	c.calls++
+	if c.calls <= c.fail {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func newTestScheduler(t *testing.T, channels ...Channel) (*Scheduler, *time.Time) {
+	t.Helper()
+	fake := fakeupstream.New(fakeupstream.Options{Fixtures: testFixtures})
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:  "test-key",
+		TMDBBaseURL: "https://api.themoviedb.test/3",
+	}, &http.Client{Transport: fake.Transport()})
+
+	now := testNow
+	s := NewScheduler(storage.NewStore(t.TempDir()), movieService, time.Hour, channels...)
+	s.SetClock(func() time.Time { return now })
+	return s, &now
+}
+
+func TestCheckMovie(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	tests := []struct {
+		name  string
+		item  models.WatchlistItem
+		prefs Preferences
+		want  []string
+	}{
+		{
+			name:  "cinema release in the lead time",
+			item:  models.WatchlistItem{ID: 1, Title: "Film"},
+			prefs: Preferences{Region: "US", LeadDays: 7},
+			want:  []string{"release-movie-1-US-3: Film is out in cinemas on Sat 3 Oct"},
+		},
+		{
+			name:  "not yet in the lead time",
+			item:  models.WatchlistItem{ID: 1, Title: "Film"},
+			prefs: Preferences{Region: "US", LeadDays: 1},
+		},
+		{
+			name:  "other region",
+			item:  models.WatchlistItem{ID: 1, Title: "Film"},
+			prefs: Preferences{Region: "GB"},
+			want:  []string{"release-movie-1-GB-3: Film is out in cinemas today"},
+		},
+		{
+			name:  "primary release date",
+			item:  models.WatchlistItem{ID: 2, Title: "Other", ReleaseDate: "2026-10-02"},
+			prefs: Preferences{Region: "US", LeadDays: 1},
+			want:  []string{"release-movie-2: Other is released tomorrow"},
+		},
+		{
+			name:  "stale primary release date",
+			item:  models.WatchlistItem{ID: 2, Title: "Other", ReleaseDate: "2026-09-20"},
+			prefs: Preferences{Region: "US"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifications, err := s.checkMovie(context.Background(), tt.item, tt.prefs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarize(notifications); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notifications %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.checkMovie(context.Background(), models.WatchlistItem{ID: 9}, Preferences{Region: "US"}); err == nil {
+		t.Error("missing movie checked without an error")
+	}
+}
+
+func TestCheckShow(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	notifications, err := s.checkShow(context.Background(), models.WatchlistItem{ID: 4, Title: "Old Name"}, Preferences{Region: "US", LeadDays: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Specials, stale seasons and the premiere episode are left out
+	want := []string{
+		"season-tv-4-s2: Show season 2 premieres on Mon 5 Oct",
+		`episode-tv-4-s1e8: Show S01E08 "Finale" airs (since Wed 30 Sep)`,
+	}
+	if got := summarize(notifications); !reflect.DeepEqual(got, want) {
+		t.Errorf("notifications %q, want %q", got, want)
+	}
+	if n := notifications[1]; n.Type != TypeEpisode || n.Season != 1 || n.Episode != 8 || n.Date != "2026-09-30" {
+		t.Errorf("episode notification %+v", n)
+	}
+}
+
+func TestDue(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	tests := []struct {
+		date     string
+		leadDays int
+		due      bool
+		expired  bool
+	}{
+		{"2026-10-01", 0, true, false},
+		{"2026-10-02", 0, false, false},
+		{"2026-10-08", 7, true, false},
+		{"2026-10-09", 7, false, false},
+		{"2026-09-28", 0, true, false},
+		{"2026-09-27", 0, false, true},
+		{"not a date", 7, false, true},
+	}
+	for _, tt := range tests {
+		if got := s.due(tt.date, tt.leadDays); got != tt.due {
+			t.Errorf("due(%s, %d) = %v, want %v", tt.date, tt.leadDays, got, tt.due)
+		}
+		if got := s.expired(tt.date); got != tt.expired {
+			t.Errorf("expired(%s) = %v, want %v", tt.date, got, tt.expired)
+		}
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	flaky := &testChannel{name: "flaky", fail: 1}
+	broken := &testChannel{name: "broken", fail: 100}
+	s, now := newTestScheduler(t, flaky, broken)
+
+	err := s.store.UpdateLibrary("alice", func(library *models.Library) error {
+		library.Watchlist = []models.WatchlistItem{
+			{ID: 1, Title: "Film", MediaType: "movie"},
+			{ID: 4, Title: "Show", MediaType: "tv"},
+			{ID: 2, Title: "Seen", MediaType: "movie", ReleaseDate: "2026-10-01", Watched: true},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs := DefaultPreferences("alice")
+	prefs.LeadDays = 7
+	if err := s.SetPreferences(prefs); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < maxDeliveryTries+1; i++ {
+		if err := s.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every run finds the same three titles, but they are only added once
+	inbox, err := s.loadInbox("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox.Notifications) != 3 {
+		t.Fatalf("inbox has %d notifications, want 3", len(inbox.Notifications))
+	}
+	want := map[string]string{
+		"release-movie-1-US-3": "2026-10-03",
+		"season-tv-4-s2":       "2026-10-05",
+		"episode-tv-4-s1e8":    "2026-09-30",
+	}
+	if !reflect.DeepEqual(inbox.Sent, want) {
+		t.Errorf("sent = %v, want %v", inbox.Sent, want)
+	}
+
+	// The flaky channel fails the first delivery once and then succeeds, the
+	// broken one gives up after maxDeliveryTries
+	for _, n := range inbox.Notifications {
+		wantDeliveries := []Delivery{
+			{Channel: "flaky", Status: DeliveryDelivered},
+			{Channel: "broken", Status: DeliveryFailed, Attempts: maxDeliveryTries, Error: "unavailable"},
+		}
+		if n.ID == "release-movie-1-US-3" {
+			wantDeliveries[0].Attempts = 2
+		} else {
+			wantDeliveries[0].Attempts = 1
+		}
+		if !reflect.DeepEqual(n.Deliveries, wantDeliveries) {
+			t.Errorf("%s deliveries %+v, want %+v", n.ID, n.Deliveries, wantDeliveries)
+		}
+	}
+	if broken.calls != 3*maxDeliveryTries {
+		t.Errorf("broken channel called %d times, want %d", broken.calls, 3*maxDeliveryTries)
+	}
+
+	// Once their dates are too old to come up again, the IDs are forgotten
+	*now = now.AddDate(0, 1, 0)
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if inbox, err = s.loadInbox("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox.Sent) != 0 || len(inbox.Notifications) != 3 {
+		t.Errorf("after a month: sent %v, %d notifications", inbox.Sent, len(inbox.Notifications))
+	}
+}
+
+func TestInboxReadsSentFlags(t *testing.T) {
+	var inbox Inbox
+	data := `{"user_id": "alice", "notifications": [{"id": "a", "date": "2026-09-30"}], "sent": {"a": true, "b": true, "c": "2026-10-01"}}`
+	if err := json.Unmarshal([]byte(data), &inbox); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "2026-09-30", "b": "", "c": "2026-10-01"}
+	if inbox.UserID != "alice" || len(inbox.Notifications) != 1 || !reflect.DeepEqual(inbox.Sent, want) {
+		t.Errorf("inbox = %+v", inbox)
+	}
+}
+
+func summarize(notifications []Notification) []string {
+	var got []string
+	for _, n := range notifications {
+		got = append(got, n.ID+": "+n.Message)
+	}
+	return got
+}
@@ -0,0 +1,10 @@
+package openapi
+
+import _ "embed"
+
+// Viewer is a page that lists the operations of the document at
+// openapi.json, relative to the page, and can send requests to them. It
+// loads nothing else, so it works offline.
+//
+//go:embed viewer.html
+var Viewer []byte
@@ -0,0 +1,58 @@
+package rooms
+
+import "sync"
+
+// Event represents a change to a room pushed to subscribers
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Hub fans room events out to every subscriber of that room
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events for a room and a function to stop
+// receiving them
+func (h *Hub) Subscribe(roomID string) (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	h.mu.Lock()
+	if h.subscribers[roomID] == nil {
+		h.subscribers[roomID] = make(map[chan Event]struct{})
+	}
+	h.subscribers[roomID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[roomID], ch)
+			if len(h.subscribers[roomID]) == 0 {
+				delete(h.subscribers, roomID)
+			}
+			h.mu.Unlock()
+		})
+	}
+}
+
+// Publish sends an event to every subscriber of a room. Subscribers that
+// have fallen behind miss the event rather than blocking the publisher.
+func (h *Hub) Publish(roomID string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[roomID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,567 @@
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+// Votes a member can cast on a candidate
+const (
+	VoteYes = "yes"
+	VoteNo  = "no"
+)
+
+// maxEnriched caps how many shared titles are checked for runtime, rating
+// and providers, as each one costs an upstream call
+const maxEnriched = 60
+
+// enrichConcurrency bounds the shared titles checked at once
+const enrichConcurrency = 4
+
+var (
+	// ErrNotMember is returned when a user acts on a room they have not joined
+	ErrNotMember = errors.New("not a member of this room")
+	// ErrForbidden is returned when a member tries something only the owner may do
+	ErrForbidden = errors.New("only the room owner can do this")
+	// ErrInvalidVote is returned for a vote that cannot be counted
+	ErrInvalidVote = errors.New("invalid vote")
+)
+
+// Room represents a group deciding what to watch together
+type Room struct {
+	ID         string               `json:"id"`
+	Name       string               `json:"name"`
+	Owner      string               `json:"owner"`
+	InviteCode string               `json:"invite_code,omitempty"`
+	Members    []Member             `json:"members"`
+	Filters    Filters              `json:"filters"`
+	Candidates []Candidate          `json:"candidates"`
+	Votes      map[string]VoteTally `json:"votes"`
+	Match      *Candidate           `json:"match,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+}
+
+// Member represents a user who has joined a room
+type Member struct {
+	UserID   string    `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Filters narrow down which shared titles are worth voting on. MinOverlap is
+// the share of members who must have a title on their watchlist, so 1 means
+// everyone. Titles without an age rating in Region are dropped when
+// Certifications is set.
+type Filters struct {
+	MaxRuntime     int      `json:"max_runtime,omitempty"`
+	Region         string   `json:"region,omitempty"`
+	Providers      []int    `json:"providers,omitempty"`
+	Certifications []string `json:"certifications,omitempty"`
+	MinOverlap     float64  `json:"min_overlap,omitempty"`
+}
+
+// Candidate represents a title members can vote on
+type Candidate struct {
+	models.Media
+	Runtime       int      `json:"runtime"`
+	Certification string   `json:"certification,omitempty"`
+	Providers     []string `json:"providers,omitempty"`
+	WantedBy      []string `json:"wanted_by"`
+	Overlap       float64  `json:"overlap"`
+}
+
+// VoteTally records each member's vote on one candidate
+type VoteTally struct {
+	Yes []string `json:"yes"`
+	No  []string `json:"no"`
+}
+
+// Key identifies a candidate in Votes
+func (c Candidate) Key() string {
+	return candidateKey(c.MediaType, c.ID)
+}
+
+func candidateKey(mediaType string, id int) string {
+	return mediaType + "/" + strconv.Itoa(id)
+}
+
+// IsMember reports whether a user has joined the room
+func (r *Room) IsMember(userID string) bool {
+	for _, m := range r.Members {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager stores rooms and notifies subscribers when they change
+type Manager struct {
+	store        *storage.Store
+	movieService *services.MovieService
+	hub          *Hub
+
+	mu sync.Mutex
+}
+
+func NewManager(store *storage.Store, movieService *services.MovieService) *Manager {
+	return &Manager{
+		store:        store,
+		movieService: movieService,
+		hub:          NewHub(),
+	}
+}
+
+// Hub returns the event hub used for live updates
+func (m *Manager) Hub() *Hub {
+	return m.hub
+}
+
+// Create opens a new room with the owner as its first member
+func (m *Manager) Create(owner, name string, filters Filters) (*Room, error) {
+	id, err := randomID(8)
+	if err != nil {
+		return nil, err
+	}
+	code, err := randomID(4)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = "Movie night"
+	}
+
+	now := time.Now().UTC()
+	room := &Room{
+		ID:         id,
+		Name:       name,
+		Owner:      owner,
+		InviteCode: code,
+		Members:    []Member{{UserID: owner, JoinedAt: now}},
+		Filters:    normalizeFilters(filters),
+		Candidates: []Candidate{},
+		Votes:      make(map[string]VoteTally),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.store.Save("rooms", room.ID, room); err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+// Get returns a room as seen by one of its members
+func (m *Manager) Get(id, userID string) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if !room.IsMember(userID) {
+		return nil, ErrNotMember
+	}
+	return room, nil
+}
+
+// Join adds a user to a room. Anyone with the invite code can join, and the
+// owner can add members directly.
+func (m *Manager) Join(id, userID, inviteCode, addedBy string) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if addedBy != room.Owner && (userID != addedBy || inviteCode != room.InviteCode) {
+		return nil, ErrForbidden
+	}
+	if room.IsMember(userID) {
+		return room, nil
+	}
+
+	room.Members = append(room.Members, Member{UserID: userID, JoinedAt: time.Now().UTC()})
+	if err := m.save(room); err != nil {
+		return nil, err
+	}
+
+	m.hub.Publish(room.ID, Event{Type: "member_joined", Data: map[string]string{"user_id": userID}})
+	return room, nil
+}
+
+// SetFilters replaces the room's filters
+func (m *Manager) SetFilters(id, userID string, filters Filters) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if room.Owner != userID {
+		return nil, ErrForbidden
+	}
+
+	room.Filters = normalizeFilters(filters)
+	if err := m.save(room); err != nil {
+		return nil, err
+	}
+
+	m.hub.Publish(room.ID, Event{Type: "filters_changed", Data: room.Filters})
+	return room, nil
+}
+
+// Refresh recomputes the candidates from every member's watchlist
+func (m *Manager) Refresh(ctx context.Context, id, userID string) (*Room, error) {
+	room, err := m.Get(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := m.computeCandidates(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Reload, members may have voted while the candidates were computed
+	room, err = m.load(id)
+	if err != nil {
+		return nil, err
+	}
+	room.Candidates = candidates
+
+	// Votes on titles that are no longer candidates are dropped, and so is
+	// a match that is no longer a candidate everyone wants
+	votes := make(map[string]VoteTally)
+	for _, c := range candidates {
+		if tally, ok := room.Votes[c.Key()]; ok {
+			votes[c.Key()] = tally
+		}
+	}
+	room.Votes = votes
+	previous := room.Match
+	room.Match = findMatch(room, previous)
+
+	if err := m.save(room); err != nil {
+		return nil, err
+	}
+
+	m.hub.Publish(room.ID, Event{Type: "candidates", Data: room.Candidates})
+	if room.Match != nil && (previous == nil || previous.Key() != room.Match.Key()) {
+		m.hub.Publish(room.ID, Event{Type: "match", Data: room.Match})
+	}
+	return room, nil
+}
+
+// findMatch returns the candidate every member voted yes on, preferring the
+// previous match when it still qualifies, or nil when there is none
+func findMatch(room *Room, previous *Candidate) *Candidate {
+	var match *Candidate
+	for i := range room.Candidates {
+		c := room.Candidates[i]
+		if len(room.Votes[c.Key()].Yes) != len(room.Members) {
+			continue
+		}
+		if previous != nil && c.Key() == previous.Key() {
+			return &c
+		}
+		if match == nil {
+			match = &c
+		}
+	}
+	return match
+}
+
+// Vote records a member's swipe on a candidate. When every member has voted
+// yes on the same title the room has a match.
+func (m *Manager) Vote(id, userID string, tmdbID int, mediaType, vote string) (*Room, error) {
+	if vote != VoteYes && vote != VoteNo {
+		return nil, fmt.Errorf("%w: vote must be %q or %q", ErrInvalidVote, VoteYes, VoteNo)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room, err := m.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if !room.IsMember(userID) {
+		return nil, ErrNotMember
+	}
+
+	var candidate *Candidate
+	for i := range room.Candidates {
+		if room.Candidates[i].ID == tmdbID && room.Candidates[i].MediaType == mediaType {
+			candidate = &room.Candidates[i]
+			break
+		}
+	}
+	if candidate == nil {
+		return nil, fmt.Errorf("%w: %s %d is not a candidate in this room", ErrInvalidVote, mediaType, tmdbID)
+	}
+
+	key := candidate.Key()
+	tally := room.Votes[key]
+	tally.Yes = without(tally.Yes, userID)
+	tally.No = without(tally.No, userID)
+	if vote == VoteYes {
+		tally.Yes = append(tally.Yes, userID)
+	} else {
+		tally.No = append(tally.No, userID)
+	}
+	room.Votes[key] = tally
+
+	matched := room.Match == nil && len(tally.Yes) == len(room.Members)
+	if matched {
+		match := *candidate
+		room.Match = &match
+	}
+
+	if err := m.save(room); err != nil {
+		return nil, err
+	}
+
+	m.hub.Publish(room.ID, Event{Type: "vote", Data: map[string]interface{}{
+		"key":     key,
+		"user_id": userID,
+		"vote":    vote,
+		"tally":   tally,
+	}})
+	if matched {
+		m.hub.Publish(room.ID, Event{Type: "match", Data: room.Match})
+	}
+	return room, nil
+}
+
+// computeCandidates finds titles on enough members' watchlists and keeps the
+// ones that pass the room's filters
+func (m *Manager) computeCandidates(ctx context.Context, room *Room) ([]Candidate, error) {
+	type shared struct {
+		media    models.Media
+		wantedBy []string
+	}
+
+	byKey := make(map[string]*shared)
+	var order []string
+	for _, member := range room.Members {
+		library, err := m.store.Library(member.UserID)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range library.Watchlist {
+			if item.Watched {
+				continue
+			}
+			key := candidateKey(item.MediaType, item.ID)
+			s := byKey[key]
+			if s == nil {
+				s = &shared{media: models.Media{
+					ID:          item.ID,
+					Title:       item.Title,
+					Overview:    item.Overview,
+					PosterPath:  item.PosterPath,
+					VoteAverage: item.VoteAverage,
+					MediaType:   item.MediaType,
+				}}
+				if item.MediaType == "tv" {
+					s.media.FirstAirDate = item.ReleaseDate
+				} else {
+					s.media.ReleaseDate = item.ReleaseDate
+				}
+				byKey[key] = s
+				order = append(order, key)
+			}
+			if !contains(s.wantedBy, member.UserID) {
+				s.wantedBy = append(s.wantedBy, member.UserID)
+			}
+		}
+	}
+
+	var pool []Candidate
+	for _, key := range order {
+		s := byKey[key]
+		overlap := float64(len(s.wantedBy)) / float64(len(room.Members))
+		if overlap+1e-9 < room.Filters.MinOverlap {
+			continue
+		}
+		pool = append(pool, Candidate{Media: s.media, WantedBy: s.wantedBy, Overlap: overlap})
+	}
+
+	sort.SliceStable(pool, func(i, j int) bool {
+		if pool[i].Overlap != pool[j].Overlap {
+			return pool[i].Overlap > pool[j].Overlap
+		}
+		return pool[i].VoteAverage > pool[j].VoteAverage
+	})
+	if len(pool) > maxEnriched {
+		pool = pool[:maxEnriched]
+	}
+
+	// Titles are checked a few at a time, and one that cannot be checked is
+	// left out rather than failing the refresh
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		firstErr     error
+		availability = make([]*models.Availability, len(pool))
+		sem          = make(chan struct{}, enrichConcurrency)
+	)
+acquire:
+	for i := range pool {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			mu.Unlock()
+			break acquire
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			a, err := m.movieService.GetAvailability(ctx, pool[i].MediaType, strconv.Itoa(pool[i].ID), room.Filters.Region)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			availability[i] = a
+		}(i)
+	}
+	wg.Wait()
+
+	candidates := []Candidate{}
+	checked := 0
+	for i, c := range pool {
+		a := availability[i]
+		if a == nil {
+			continue
+		}
+		checked++
+
+		c.Runtime = a.Runtime
+		c.Certification = a.Certification
+		for _, provider := range a.Providers {
+			c.Providers = append(c.Providers, provider.ProviderName)
+		}
+
+		if passes(room.Filters, c, a) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if checked == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return candidates, nil
+}
+
+func passes(filters Filters, c Candidate, availability *models.Availability) bool {
+	if filters.MaxRuntime > 0 && (c.Runtime == 0 || c.Runtime > filters.MaxRuntime) {
+		return false
+	}
+
+	if len(filters.Certifications) > 0 && !contains(filters.Certifications, c.Certification) {
+		return false
+	}
+
+	if len(filters.Providers) > 0 {
+		found := false
+		for _, provider := range availability.Providers {
+			for _, id := range filters.Providers {
+				if provider.ProviderID == id {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func normalizeFilters(filters Filters) Filters {
+	if filters.Region == "" {
+		filters.Region = "US"
+	}
+	if filters.MinOverlap <= 0 || filters.MinOverlap > 1 {
+		filters.MinOverlap = 1
+	}
+	return filters
+}
+
+func (m *Manager) load(id string) (*Room, error) {
+	var room Room
+	if err := m.store.Load("rooms", id, &room); err != nil {
+		return nil, err
+	}
+	if room.Votes == nil {
+		room.Votes = make(map[string]VoteTally)
+	}
+	return &room, nil
+}
+
+func (m *Manager) save(room *Room) error {
+	room.UpdatedAt = time.Now().UTC()
+	return m.store.Save("rooms", room.ID, room)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func without(values []string, value string) []string {
+	result := values[:0]
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
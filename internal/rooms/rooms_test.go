@@ -0,0 +1,280 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/services"
+	"movie-discovery-app/internal/storage"
+	"movie-discovery-app/pkg/models"
+)
+
+// testFixtures are titles with different runtimes, age ratings and providers
+var testFixtures = fstest.MapFS{
+	"tmdb/movie/1.json": {Data: []byte(`{"id": 1, "runtime": 90,
+		"release_dates": {"results": [{"iso_3166_1": "US", "release_dates": [{"certification": "PG-13", "type": 3}]}]},
+		"watch/providers": {"results": {"US": {"flatrate": [{"provider_id": 8, "provider_name": "Netflix"}]}}}}`)},
+	"tmdb/movie/2.json": {Data: []byte(`{"id": 2, "runtime": 170,
+		"release_dates": {"results": [{"iso_3166_1": "US", "release_dates": [{"certification": "R", "type": 3}]}]},
+		"watch/providers": {"results": {"US": {"flatrate": [{"provider_id": 9, "provider_name": "Prime Video"}]}}}}`)},
+	"tmdb/movie/3.json": {Data: []byte(`{"id": 3, "runtime": 100,
+		"release_dates": {"results": [{"iso_3166_1": "US", "release_dates": [{"certification": "PG", "type": 3}]}]}}`)},
+	"tmdb/tv/4.json": {Data: []byte(`{"id": 4, "episode_run_time": [45],
+		"content_ratings": {"results": [{"iso_3166_1": "US", "rating": "TV-14"}]},
+		"watch/providers": {"results": {"US": {"free": [{"provider_id": 8, "provider_name": "Netflix"}]}}}}`)},
+}
+
+// watchlists are what each test user wants to watch
+var watchlists = map[string][]models.WatchlistItem{
+	"alice": {
+		{ID: 1, Title: "Short Comedy", MediaType: "movie", VoteAverage: 7},
+		{ID: 2, Title: "Long Epic", MediaType: "movie", VoteAverage: 8},
+		{ID: 3, Title: "Family Film", MediaType: "movie", VoteAverage: 6},
+		{ID: 4, Title: "Show", MediaType: "tv", VoteAverage: 9},
+		{ID: 5, Title: "Seen It", MediaType: "movie", Watched: true},
+	},
+	"bob": {
+		{ID: 4, Title: "Show", MediaType: "tv", VoteAverage: 9},
+		{ID: 2, Title: "Long Epic", MediaType: "movie", VoteAverage: 8},
+		{ID: 1, Title: "Short Comedy", MediaType: "movie", VoteAverage: 7},
+		{ID: 5, Title: "Seen It", MediaType: "movie"},
+	},
+}
+
+func newTestManager(t *testing.T) (*Manager, *fakeupstream.Server) {
+	t.Helper()
+	fake := fakeupstream.New(fakeupstream.Options{Fixtures: testFixtures})
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:  "test-key",
+		TMDBBaseURL: "https://api.themoviedb.test/3",
+	}, &http.Client{Transport: fake.Transport()})
+
+	store := storage.NewStore(t.TempDir())
+	for user, items := range watchlists {
+		err := store.UpdateLibrary(user, func(library *models.Library) error {
+			library.Watchlist = items
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewManager(store, movieService), fake
+}
+
+// newRoom opens a room for alice and bob
+func newRoom(t *testing.T, m *Manager, filters Filters) *Room {
+	t.Helper()
+	room, err := m.Create("alice", "", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room, err = m.Join(room.ID, "bob", "", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	return room
+}
+
+func keys(candidates []Candidate) []string {
+	var keys []string
+	for _, c := range candidates {
+		keys = append(keys, c.Key())
+	}
+	return keys
+}
+
+func TestRefreshCandidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters Filters
+		want    []string
+	}{
+		{name: "everyone's watchlist", want: []string{"tv/4", "movie/2", "movie/1"}},
+		{name: "half the members", filters: Filters{MinOverlap: 0.5}, want: []string{"tv/4", "movie/2", "movie/1", "movie/3"}},
+		{name: "max runtime", filters: Filters{MaxRuntime: 120}, want: []string{"tv/4", "movie/1"}},
+		{name: "certifications", filters: Filters{Certifications: []string{"PG", "PG-13"}, MinOverlap: 0.5}, want: []string{"movie/1", "movie/3"}},
+		{name: "providers", filters: Filters{Providers: []int{8}}, want: []string{"tv/4", "movie/1"}},
+		{name: "no age ratings elsewhere", filters: Filters{Region: "GB", Certifications: []string{"PG"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t)
+			room, err := m.Refresh(context.Background(), newRoom(t, m, tt.filters).ID, "bob")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := keys(room.Candidates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidates = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	m, _ := newTestManager(t)
+	room, err := m.Refresh(context.Background(), newRoom(t, m, Filters{MinOverlap: 0.5}).ID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Candidate{
+		Media:         models.Media{ID: 3, Title: "Family Film", MediaType: "movie", VoteAverage: 6},
+		Runtime:       100,
+		Certification: "PG",
+		WantedBy:      []string{"alice"},
+		Overlap:       0.5,
+	}
+	if got := room.Candidates[3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("candidate = %+v, want %+v", got, want)
+	}
+	if got := room.Candidates[0].Providers; !reflect.DeepEqual(got, []string{"Netflix"}) {
+		t.Errorf("providers = %q", got)
+	}
+
+	if _, err := m.Refresh(context.Background(), room.ID, "carol"); !errors.Is(err, ErrNotMember) {
+		t.Errorf("refresh by a stranger: error = %v, want %v", err, ErrNotMember)
+	}
+}
+
+func TestRefreshSkipsFailedTitles(t *testing.T) {
+	m, fake := newTestManager(t)
+	room := newRoom(t, m, Filters{})
+
+	fake.Fail("/3/movie/2", fakeupstream.ServerError, 1)
+	room, err := m.Refresh(context.Background(), room.ID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(room.Candidates), []string{"tv/4", "movie/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates = %q, want %q", got, want)
+	}
+
+	// With nothing checked there is nothing to offer, so the error is returned
+	fake.Fail("/3/", fakeupstream.ServerError, 3)
+	if _, err := m.Refresh(context.Background(), room.ID, "alice"); err == nil {
+		t.Error("refresh with every lookup failing succeeded")
+	}
+}
+
+func TestVoteAndMatch(t *testing.T) {
+	m, _ := newTestManager(t)
+	room := newRoom(t, m, Filters{})
+	room, err := m.Refresh(context.Background(), room.ID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, stop := m.Hub().Subscribe(room.ID)
+	defer stop()
+
+	for _, tt := range []struct {
+		name  string
+		user  string
+		id    int
+		media string
+		vote  string
+		err   error
+	}{
+		{"bad vote", "alice", 2, "movie", "maybe", ErrInvalidVote},
+		{"not a candidate", "alice", 3, "movie", VoteYes, ErrInvalidVote},
+		{"wrong media type", "alice", 2, "tv", VoteYes, ErrInvalidVote},
+		{"stranger", "carol", 2, "movie", VoteYes, ErrNotMember},
+	} {
+		if _, err := m.Vote(room.ID, tt.user, tt.id, tt.media, tt.vote); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	vote := func(user string, id int, mediaType, vote string) *Room {
+		t.Helper()
+		room, err := m.Vote(room.ID, user, id, mediaType, vote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return room
+	}
+
+	vote("alice", 2, "movie", VoteYes)
+	vote("bob", 2, "movie", VoteNo)
+	vote("alice", 1, "movie", VoteYes)
+	if room = vote("bob", 2, "movie", VoteYes); room.Match == nil || room.Match.Key() != "movie/2" {
+		t.Fatalf("match = %+v, want movie/2", room.Match)
+	}
+	if tally := room.Votes["movie/2"]; !reflect.DeepEqual(tally, VoteTally{Yes: []string{"alice", "bob"}, No: []string{}}) {
+		t.Errorf("tally = %+v", tally)
+	}
+
+	var types []string
+	for len(events) > 0 {
+		types = append(types, (<-events).Type)
+	}
+	if want := []string{"vote", "vote", "vote", "vote", "match"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("events %q, want %q", types, want)
+	}
+
+	// The matched title leaves bob's watchlist, taking its votes and the
+	// match with it, while other votes stand
+	if err := m.store.RemoveFromWatchlist("bob", "movie", 2); err != nil {
+		t.Fatal(err)
+	}
+	if room, err = m.Refresh(context.Background(), room.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if room.Match != nil {
+		t.Errorf("match = %+v after it stopped being a candidate", room.Match)
+	}
+	if _, ok := room.Votes["movie/2"]; ok || len(room.Votes["movie/1"].Yes) != 1 {
+		t.Errorf("votes = %+v", room.Votes)
+	}
+
+	if room = vote("bob", 1, "movie", VoteYes); room.Match == nil || room.Match.Key() != "movie/1" {
+		t.Errorf("match = %+v, want movie/1", room.Match)
+	}
+
+	// A refresh that keeps the match keeps it without announcing it again
+	for len(events) > 0 {
+		<-events
+	}
+	if room, err = m.Refresh(context.Background(), room.ID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if room.Match == nil || room.Match.Key() != "movie/1" {
+		t.Errorf("match = %+v, want movie/1", room.Match)
+	}
+	if e := <-events; e.Type != "candidates" || len(events) != 0 {
+		t.Errorf("refresh published %q and %d more", e.Type, len(events))
+	}
+}
+
+func TestFindMatch(t *testing.T) {
+	room := &Room{
+		Members:    []Member{{UserID: "alice"}, {UserID: "bob"}},
+		Candidates: []Candidate{{Media: models.Media{ID: 1, MediaType: "movie"}}, {Media: models.Media{ID: 2, MediaType: "movie"}}, {Media: models.Media{ID: 3, MediaType: "movie"}}},
+		Votes: map[string]VoteTally{
+			"movie/1": {Yes: []string{"alice"}, No: []string{"bob"}},
+			"movie/2": {Yes: []string{"alice", "bob"}},
+			"movie/3": {Yes: []string{"bob", "alice"}},
+		},
+	}
+	tests := []struct {
+		name     string
+		previous *Candidate
+		want     string
+	}{
+		{"first unanimous", nil, "movie/2"},
+		{"previous kept", &room.Candidates[2], "movie/3"},
+		{"previous no longer unanimous", &room.Candidates[0], "movie/2"},
+	}
+	for _, tt := range tests {
+		if got := findMatch(room, tt.previous); got == nil || got.Key() != tt.want {
+			t.Errorf("%s: match = %+v, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	room.Votes = map[string]VoteTally{}
+	if got := findMatch(room, &room.Candidates[1]); got != nil {
+		t.Errorf("match = %+v without votes", got)
+	}
+}
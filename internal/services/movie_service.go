@@ -1,17 +1,37 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"movie-discovery-app/internal/models"
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/pkg/models"
 )
 
+// ErrNotFound is returned when TMDB has no movie, TV show or season with the
+// requested ID
+var ErrNotFound = errors.New("not found")
+
+// statusError reports an unexpected status code from TMDB. A 404 is
+// ErrNotFound.
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("API request failed with status: %d", int(e))
+}
+
+func (e statusError) Is(target error) bool {
+	return target == ErrNotFound && e == http.StatusNotFound
+}
+
 type MovieService struct {
 	tmdbAPIKey   string
 	omdbAPIKey   string
@@ -19,30 +39,108 @@ type MovieService struct {
 	omdbBaseURL  string
 	imageBaseURL string
 	httpClient   *http.Client
+	upstreams    *upstreamTransport
+	omdbQuota    *dailyQuota
+	demo         bool
+}
+
+// Config holds the API keys and endpoints MovieService talks to
+type Config struct {
+	TMDBAPIKey     string
+	TMDBBaseURL    string
+	ImageBaseURL   string
+	OMDBAPIKey     string
+	OMDBBaseURL    string
+	OMDBDailyLimit int
+	// Demo marks a service answering from the bundled demo dataset
+	Demo bool
 }
 
-func NewMovieService() *MovieService {
-	return &MovieService{
-		tmdbAPIKey:   getEnvOrDefault("TMDB_API_KEY", ""),
-		omdbAPIKey:   getEnvOrDefault("OMDB_API_KEY", ""),
-		tmdbBaseURL:  getEnvOrDefault("TMDB_BASE_URL", "https://api.themoviedb.org/3"),
-		omdbBaseURL:  getEnvOrDefault("OMDB_BASE_URL", "http://www.omdbapi.com"),
-		imageBaseURL: getEnvOrDefault("TMDB_IMAGE_BASE_URL", "https://image.tmdb.org/t/p/w500"),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// ConfigFrom picks MovieService's settings out of the server configuration
+func ConfigFrom(cfg *config.Config) Config {
+	return Config{
+		TMDBAPIKey:     cfg.TMDB.APIKey,
+		TMDBBaseURL:    cfg.TMDB.BaseURL,
+		ImageBaseURL:   cfg.TMDB.ImageBaseURL,
+		OMDBAPIKey:     cfg.OMDB.APIKey,
+		OMDBBaseURL:    cfg.OMDB.BaseURL,
+		OMDBDailyLimit: cfg.OMDB.DailyLimit,
 	}
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// defaultOMDBDailyLimit is OMDB's free tier allowance
+const defaultOMDBDailyLimit = 1000
+
+// NewMovieService creates a service that calls TMDB and OMDB through client,
+// or a client with a 10 second timeout when nil. Tests can pass a client
+// whose transport answers from a fake server.
+func NewMovieService(cfg Config, client *http.Client) *MovieService {
+	s := &MovieService{
+		tmdbAPIKey:   cfg.TMDBAPIKey,
+		omdbAPIKey:   cfg.OMDBAPIKey,
+		tmdbBaseURL:  cfg.TMDBBaseURL,
+		omdbBaseURL:  cfg.OMDBBaseURL,
+		imageBaseURL: cfg.ImageBaseURL,
+		demo:         cfg.Demo,
 	}
-	return defaultValue
+	limit := cfg.OMDBDailyLimit
+	if limit <= 0 {
+		limit = defaultOMDBDailyLimit
+	}
+	s.omdbQuota = newDailyQuota(limit)
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	s.upstreams = newUpstreamTransport(client.Transport, map[string]string{
+		"tmdb": s.tmdbBaseURL,
+		"omdb": s.omdbBaseURL,
+	})
+	s.upstreams.omdbQuota = s.omdbQuota
+
+	// Copy the client so wrapping its transport leaves the caller's alone
+	c := *client
+	c.Transport = s.upstreams
+	s.httpClient = &c
+	return s
+}
+
+// TMDBConfigured reports whether a TMDB API key is set. Nearly every
+// feature needs TMDB, so the server is not ready without one.
+func (s *MovieService) TMDBConfigured() bool {
+	return s.tmdbAPIKey != ""
+}
+
+// Demo reports whether the service serves demo data instead of TMDB's
+func (s *MovieService) Demo() bool {
+	return s.demo
+}
+
+// UpstreamStatus reports the recent health of TMDB and OMDB
+func (s *MovieService) UpstreamStatus() []UpstreamStatus {
+	return s.upstreams.status()
+}
+
+// get sends a GET request that is cancelled along with ctx
+func (s *MovieService) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, errors.New("invalid upstream URL")
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		// The query holds the API key, so errors only name the endpoint
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = (&url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}).String()
+		}
+		return nil, err
+	}
+	return resp, nil
 }
 
 // Search searches for movies and TV shows
-func (s *MovieService) Search(query, contentType, page string) (*models.SearchResponse, error) {
+func (s *MovieService) Search(ctx context.Context, query, contentType, page string) (*models.SearchResponse, error) {
 	if s.tmdbAPIKey == "" {
 		return nil, fmt.Errorf("TMDB API key not configured")
 	}
@@ -62,14 +160,14 @@ func (s *MovieService) Search(query, contentType, page string) (*models.SearchRe
 
 	url := fmt.Sprintf("%s/%s?%s", s.tmdbBaseURL, endpoint, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -96,25 +194,43 @@ func (s *MovieService) Search(query, contentType, page string) (*models.SearchRe
 }
 
 // GetMovieDetails gets detailed information about a movie
-func (s *MovieService) GetMovieDetails(id string) (*models.MovieDetails, error) {
+func (s *MovieService) GetMovieDetails(ctx context.Context, id string) (*models.MovieDetails, error) {
+	movieDetails, err := s.fetchMovieDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get additional data from OMDB if IMDB ID is available
+	if movieDetails.ExternalIDs != nil && movieDetails.ExternalIDs.IMDBID != "" && s.omdbAPIKey != "" {
+		omdbData, err := s.getOMDBData(ctx, movieDetails.ExternalIDs.IMDBID)
+		if err == nil {
+			movieDetails.OMDBData = omdbData
+		}
+	}
+
+	return movieDetails, nil
+}
+
+// fetchMovieDetails gets a movie from TMDB without the OMDB enrichment
+func (s *MovieService) fetchMovieDetails(ctx context.Context, id string) (*models.MovieDetails, error) {
 	if s.tmdbAPIKey == "" {
 		return nil, fmt.Errorf("TMDB API key not configured")
 	}
 
 	params := url.Values{}
 	params.Add("api_key", s.tmdbAPIKey)
-	params.Add("append_to_response", "credits,external_ids,videos")
+	params.Add("append_to_response", "credits,external_ids,videos,keywords")
 
 	url := fmt.Sprintf("%s/movie/%s?%s", s.tmdbBaseURL, id, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get movie details: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -144,37 +260,92 @@ func (s *MovieService) GetMovieDetails(id string) (*models.MovieDetails, error)
 		}
 	}
 
+	return &movieDetails, nil
+}
+
+// GetTVDetails gets detailed information about a TV show
+func (s *MovieService) GetTVDetails(ctx context.Context, id string) (*models.TVDetails, error) {
+	tvDetails, err := s.fetchTVDetails(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get additional data from OMDB if IMDB ID is available
-	if movieDetails.ExternalIDs != nil && movieDetails.ExternalIDs.IMDBID != "" && s.omdbAPIKey != "" {
-		omdbData, err := s.getOMDBData(movieDetails.ExternalIDs.IMDBID)
+	if tvDetails.ExternalIDs != nil && tvDetails.ExternalIDs.IMDBID != "" && s.omdbAPIKey != "" {
+		omdbData, err := s.getOMDBData(ctx, tvDetails.ExternalIDs.IMDBID)
 		if err == nil {
-			movieDetails.OMDBData = omdbData
+			tvDetails.OMDBData = omdbData
 		}
 	}
 
-	return &movieDetails, nil
+	return tvDetails, nil
 }
 
-// GetTVDetails gets detailed information about a TV show
-func (s *MovieService) GetTVDetails(id string) (*models.TVDetails, error) {
+// WatchlistItem looks up a movie or TV show and describes it as a watchlist
+// item. AddedDate is left for the caller to set.
+func (s *MovieService) WatchlistItem(ctx context.Context, mediaType, id string) (*models.WatchlistItem, error) {
+	var item models.WatchlistItem
+	var externalIDs *models.ExternalIDs
+	switch mediaType {
+	case "movie":
+		details, err := s.fetchMovieDetails(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		item = models.WatchlistItem{
+			ID:          details.ID,
+			Title:       details.Title,
+			PosterPath:  details.PosterPath,
+			ReleaseDate: details.ReleaseDate,
+			VoteAverage: details.VoteAverage,
+			Overview:    details.Overview,
+		}
+		externalIDs = details.ExternalIDs
+	case "tv":
+		details, err := s.fetchTVDetails(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		item = models.WatchlistItem{
+			ID:          details.ID,
+			Title:       details.Name,
+			PosterPath:  details.PosterPath,
+			ReleaseDate: details.FirstAirDate,
+			VoteAverage: details.VoteAverage,
+			Overview:    details.Overview,
+		}
+		externalIDs = details.ExternalIDs
+	default:
+		return nil, fmt.Errorf("unknown media type %q", mediaType)
+	}
+
+	item.MediaType = mediaType
+	if externalIDs != nil {
+		item.IMDBID = externalIDs.IMDBID
+	}
+	return &item, nil
+}
+
+// fetchTVDetails gets a TV show from TMDB without the OMDB enrichment
+func (s *MovieService) fetchTVDetails(ctx context.Context, id string) (*models.TVDetails, error) {
 	if s.tmdbAPIKey == "" {
 		return nil, fmt.Errorf("TMDB API key not configured")
 	}
 
 	params := url.Values{}
 	params.Add("api_key", s.tmdbAPIKey)
-	params.Add("append_to_response", "credits,external_ids,videos")
+	params.Add("append_to_response", "credits,external_ids,videos,keywords")
 
 	url := fmt.Sprintf("%s/tv/%s?%s", s.tmdbBaseURL, id, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get TV details: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -204,19 +375,11 @@ func (s *MovieService) GetTVDetails(id string) (*models.TVDetails, error) {
 		}
 	}
 
-	// Get additional data from OMDB if IMDB ID is available
-	if tvDetails.ExternalIDs != nil && tvDetails.ExternalIDs.IMDBID != "" && s.omdbAPIKey != "" {
-		omdbData, err := s.getOMDBData(tvDetails.ExternalIDs.IMDBID)
-		if err == nil {
-			tvDetails.OMDBData = omdbData
-		}
-	}
-
 	return &tvDetails, nil
 }
 
 // GetTrending gets trending movies and TV shows
-func (s *MovieService) GetTrending(timeWindow string) (*models.TrendingResponse, error) {
+func (s *MovieService) GetTrending(ctx context.Context, timeWindow string) (*models.TrendingResponse, error) {
 	if s.tmdbAPIKey == "" {
 		return nil, fmt.Errorf("TMDB API key not configured")
 	}
@@ -230,14 +393,14 @@ func (s *MovieService) GetTrending(timeWindow string) (*models.TrendingResponse,
 
 	url := fmt.Sprintf("%s/trending/all/%s?%s", s.tmdbBaseURL, timeWindow, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get trending: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -264,7 +427,7 @@ func (s *MovieService) GetTrending(timeWindow string) (*models.TrendingResponse,
 }
 
 // GetGenres gets available genres for movies and TV shows
-func (s *MovieService) GetGenres() (map[string][]models.Genre, error) {
+func (s *MovieService) GetGenres(ctx context.Context) (map[string][]models.Genre, error) {
 	if s.tmdbAPIKey == "" {
 		return nil, fmt.Errorf("TMDB API key not configured")
 	}
@@ -272,14 +435,14 @@ func (s *MovieService) GetGenres() (map[string][]models.Genre, error) {
 	result := make(map[string][]models.Genre)
 
 	// Get movie genres
-	movieGenres, err := s.getGenresByType("movie")
+	movieGenres, err := s.getGenresByType(ctx, "movie")
 	if err != nil {
 		return nil, err
 	}
 	result["movie"] = movieGenres
 
 	// Get TV genres
-	tvGenres, err := s.getGenresByType("tv")
+	tvGenres, err := s.getGenresByType(ctx, "tv")
 	if err != nil {
 		return nil, err
 	}
@@ -288,20 +451,20 @@ func (s *MovieService) GetGenres() (map[string][]models.Genre, error) {
 	return result, nil
 }
 
-func (s *MovieService) getGenresByType(mediaType string) ([]models.Genre, error) {
+func (s *MovieService) getGenresByType(ctx context.Context, mediaType string) ([]models.Genre, error) {
 	params := url.Values{}
 	params.Add("api_key", s.tmdbAPIKey)
 
 	url := fmt.Sprintf("%s/genre/%s/list?%s", s.tmdbBaseURL, mediaType, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get %s genres: %w", mediaType, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
@@ -317,7 +480,7 @@ func (s *MovieService) getGenresByType(mediaType string) ([]models.Genre, error)
 	return genreResponse.Genres, nil
 }
 
-func (s *MovieService) getOMDBData(imdbID string) (*models.OMDBResponse, error) {
+func (s *MovieService) getOMDBData(ctx context.Context, imdbID string) (*models.OMDBResponse, error) {
 	params := url.Values{}
 	params.Add("apikey", s.omdbAPIKey)
 	params.Add("i", imdbID)
@@ -325,7 +488,7 @@ func (s *MovieService) getOMDBData(imdbID string) (*models.OMDBResponse, error)
 
 	url := fmt.Sprintf("%s/?%s", s.omdbBaseURL, params.Encode())
 
-	resp, err := s.httpClient.Get(url)
+	resp, err := s.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get OMDB data: %w", err)
 	}
@@ -346,8 +509,669 @@ func (s *MovieService) getOMDBData(imdbID string) (*models.OMDBResponse, error)
 	}
 
 	if omdbResponse.Response == "False" {
+		if omdbResponse.Error == "Request limit reached!" {
+			s.omdbQuota.exhaust(time.Now())
+		}
 		return nil, fmt.Errorf("OMDB error: %s", omdbResponse.Error)
 	}
 
 	return &omdbResponse, nil
 }
+
+// SearchByTitle searches for a movie or TV show by title, narrowed to a release year when known
+func (s *MovieService) SearchByTitle(ctx context.Context, title, mediaType string, year int) ([]models.Media, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+	params.Add("query", title)
+	params.Add("include_adult", "false")
+	if year > 0 {
+		if mediaType == "tv" {
+			params.Add("first_air_date_year", strconv.Itoa(year))
+		} else {
+			params.Add("year", strconv.Itoa(year))
+		}
+	}
+
+	url := fmt.Sprintf("%s/search/%s?%s", s.tmdbBaseURL, mediaType, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var searchResponse models.SearchResponse
+	if err := json.Unmarshal(body, &searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	for i := range searchResponse.Results {
+		searchResponse.Results[i].MediaType = mediaType
+		if searchResponse.Results[i].PosterPath != "" {
+			searchResponse.Results[i].PosterPath = s.imageBaseURL + searchResponse.Results[i].PosterPath
+		}
+		if searchResponse.Results[i].BackdropPath != "" {
+			searchResponse.Results[i].BackdropPath = s.imageBaseURL + searchResponse.Results[i].BackdropPath
+		}
+	}
+
+	return searchResponse.Results, nil
+}
+
+// FindByIMDBID looks up the TMDB movie or TV show for an IMDb ID
+func (s *MovieService) FindByIMDBID(ctx context.Context, imdbID string) (*models.Media, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+	params.Add("external_source", "imdb_id")
+
+	url := fmt.Sprintf("%s/find/%s?%s", s.tmdbBaseURL, url.PathEscape(imdbID), params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", imdbID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var findResponse models.FindResponse
+	if err := json.Unmarshal(body, &findResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	var media models.Media
+	switch {
+	case len(findResponse.MovieResults) > 0:
+		media = findResponse.MovieResults[0]
+		media.MediaType = "movie"
+	case len(findResponse.TVResults) > 0:
+		media = findResponse.TVResults[0]
+		media.MediaType = "tv"
+	default:
+		return nil, nil
+	}
+
+	if media.PosterPath != "" {
+		media.PosterPath = s.imageBaseURL + media.PosterPath
+	}
+	if media.BackdropPath != "" {
+		media.BackdropPath = s.imageBaseURL + media.BackdropPath
+	}
+
+	return &media, nil
+}
+
+// GetExternalIDs gets the IMDb and social media IDs of a movie or TV show
+func (s *MovieService) GetExternalIDs(ctx context.Context, mediaType, id string) (*models.ExternalIDs, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/%s/%s/external_ids?%s", s.tmdbBaseURL, mediaType, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get external IDs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var externalIDs models.ExternalIDs
+	if err := json.Unmarshal(body, &externalIDs); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &externalIDs, nil
+}
+
+// GetCredits gets the cast and crew of a movie or TV show
+func (s *MovieService) GetCredits(ctx context.Context, mediaType, id string) (*models.Credits, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/%s/%s/credits?%s", s.tmdbBaseURL, mediaType, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credits: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var credits models.Credits
+	if err := json.Unmarshal(body, &credits); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Add full profile image URLs for cast
+	for i := range credits.Cast {
+		if credits.Cast[i].ProfilePath != "" {
+			credits.Cast[i].ProfilePath = s.imageBaseURL + credits.Cast[i].ProfilePath
+		}
+	}
+
+	return &credits, nil
+}
+
+// GetVideos gets the trailers, teasers and clips of a movie or TV show
+func (s *MovieService) GetVideos(ctx context.Context, mediaType, id string) (*models.VideosResponse, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/%s/%s/videos?%s", s.tmdbBaseURL, mediaType, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get videos: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var videos models.VideosResponse
+	if err := json.Unmarshal(body, &videos); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &videos, nil
+}
+
+// GetPerson gets an actor or crew member and the titles they worked on
+func (s *MovieService) GetPerson(ctx context.Context, id string) (*models.Person, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+	params.Add("append_to_response", "combined_credits")
+
+	url := fmt.Sprintf("%s/person/%s?%s", s.tmdbBaseURL, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get person: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var person models.Person
+	if err := json.Unmarshal(body, &person); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Add full image URLs
+	if person.ProfilePath != "" {
+		person.ProfilePath = s.imageBaseURL + person.ProfilePath
+	}
+	if person.CombinedCredits != nil {
+		for i := range person.CombinedCredits.Cast {
+			s.mediaImageURLs(&person.CombinedCredits.Cast[i].Media)
+		}
+		for i := range person.CombinedCredits.Crew {
+			s.mediaImageURLs(&person.CombinedCredits.Crew[i].Media)
+		}
+	}
+
+	return &person, nil
+}
+
+// mediaImageURLs turns a search result's image paths into full URLs
+func (s *MovieService) mediaImageURLs(m *models.Media) {
+	if m.PosterPath != "" {
+		m.PosterPath = s.imageBaseURL + m.PosterPath
+	}
+	if m.BackdropPath != "" {
+		m.BackdropPath = s.imageBaseURL + m.BackdropPath
+	}
+}
+
+// GetRecommendations gets TMDB's recommendations for a movie or TV show
+func (s *MovieService) GetRecommendations(ctx context.Context, mediaType, id string) ([]models.Media, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/%s/%s/recommendations?%s", s.tmdbBaseURL, mediaType, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recommendations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var searchResponse models.SearchResponse
+	if err := json.Unmarshal(body, &searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	for i := range searchResponse.Results {
+		searchResponse.Results[i].MediaType = mediaType
+		if searchResponse.Results[i].PosterPath != "" {
+			searchResponse.Results[i].PosterPath = s.imageBaseURL + searchResponse.Results[i].PosterPath
+		}
+		if searchResponse.Results[i].BackdropPath != "" {
+			searchResponse.Results[i].BackdropPath = s.imageBaseURL + searchResponse.Results[i].BackdropPath
+		}
+	}
+
+	return searchResponse.Results, nil
+}
+
+// discoverSorts maps the sort orders DiscoverFilters takes to TMDB's, by
+// media type, as TMDB names release dates differently for movies and shows
+var discoverSorts = map[string]map[string]string{
+	"movie": {
+		"popularity.desc":   "popularity.desc",
+		"vote_average.desc": "vote_average.desc",
+		"release_date.desc": "primary_release_date.desc",
+		"release_date.asc":  "primary_release_date.asc",
+	},
+	"tv": {
+		"popularity.desc":   "popularity.desc",
+		"vote_average.desc": "vote_average.desc",
+		"release_date.desc": "first_air_date.desc",
+		"release_date.asc":  "first_air_date.asc",
+	},
+}
+
+// ErrInvalidSort is returned for a DiscoverOptions.SortBy that is not one
+// of the supported orders
+var ErrInvalidSort = errors.New("sort must be popularity.desc, vote_average.desc, release_date.desc or release_date.asc")
+
+// DiscoverFilters returns the TMDB discover filters for opts and
+// mediaType, "movie" or "tv". The page is left to Discover.
+func DiscoverFilters(mediaType string, opts models.DiscoverOptions) (url.Values, error) {
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+	filters := url.Values{}
+	if len(opts.Genres) > 0 {
+		ids := make([]string, len(opts.Genres))
+		for i, id := range opts.Genres {
+			ids[i] = strconv.Itoa(id)
+		}
+		// A comma asks TMDB for titles in all of the genres
+		filters.Set("with_genres", strings.Join(ids, ","))
+	}
+	if opts.Year > 0 {
+		if mediaType == "movie" {
+			filters.Set("primary_release_year", strconv.Itoa(opts.Year))
+		} else {
+			filters.Set("first_air_date_year", strconv.Itoa(opts.Year))
+		}
+	}
+	sortBy := opts.SortBy
+	if sortBy == "" {
+		sortBy = "popularity.desc"
+	}
+	tmdbSort, ok := discoverSorts[mediaType][sortBy]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	filters.Set("sort_by", tmdbSort)
+	return filters, nil
+}
+
+// Discover finds movies or TV shows matching TMDB discover filters such as
+// with_genres, primary_release_year or sort_by
+func (s *MovieService) Discover(ctx context.Context, mediaType string, filters url.Values, page string) (*models.SearchResponse, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+	if page == "" {
+		page = "1"
+	}
+
+	params := url.Values{}
+	for key, values := range filters {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+	params.Set("api_key", s.tmdbAPIKey)
+	params.Set("page", page)
+	params.Set("include_adult", "false")
+
+	url := fmt.Sprintf("%s/discover/%s?%s", s.tmdbBaseURL, mediaType, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var searchResponse models.SearchResponse
+	if err := json.Unmarshal(body, &searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	for i := range searchResponse.Results {
+		searchResponse.Results[i].MediaType = mediaType
+		if searchResponse.Results[i].PosterPath != "" {
+			searchResponse.Results[i].PosterPath = s.imageBaseURL + searchResponse.Results[i].PosterPath
+		}
+		if searchResponse.Results[i].BackdropPath != "" {
+			searchResponse.Results[i].BackdropPath = s.imageBaseURL + searchResponse.Results[i].BackdropPath
+		}
+	}
+
+	return &searchResponse, nil
+}
+
+// GetAvailability gets the runtime, age rating and streaming services of a
+// movie or TV show in a country
+func (s *MovieService) GetAvailability(ctx context.Context, mediaType, id, region string) (*models.Availability, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+	if region == "" {
+		region = "US"
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+	if mediaType == "tv" {
+		params.Add("append_to_response", "content_ratings,watch/providers")
+	} else {
+		params.Add("append_to_response", "release_dates,watch/providers")
+	}
+
+	url := fmt.Sprintf("%s/%s/%s?%s", s.tmdbBaseURL, mediaType, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get availability: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var details struct {
+		ID             int                            `json:"id"`
+		Runtime        int                            `json:"runtime"`
+		EpisodeRunTime []int                          `json:"episode_run_time"`
+		ReleaseDates   *models.ReleaseDatesResponse   `json:"release_dates"`
+		ContentRatings *models.ContentRatingsResponse `json:"content_ratings"`
+		WatchProviders *models.WatchProvidersResponse `json:"watch/providers"`
+	}
+	if err := json.Unmarshal(body, &details); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	availability := &models.Availability{
+		ID:        details.ID,
+		MediaType: mediaType,
+		Runtime:   details.Runtime,
+		Providers: []models.WatchProvider{},
+	}
+	if mediaType == "tv" && len(details.EpisodeRunTime) > 0 {
+		availability.Runtime = details.EpisodeRunTime[0]
+	}
+
+	if details.ReleaseDates != nil {
+		for _, country := range details.ReleaseDates.Results {
+			if country.ISO31661 != region {
+				continue
+			}
+			for _, release := range country.ReleaseDates {
+				if release.Certification != "" {
+					availability.Certification = release.Certification
+					break
+				}
+			}
+		}
+	}
+	if details.ContentRatings != nil {
+		for _, rating := range details.ContentRatings.Results {
+			if rating.ISO31661 == region {
+				availability.Certification = rating.Rating
+			}
+		}
+	}
+
+	if details.WatchProviders != nil {
+		if providers, ok := details.WatchProviders.Results[region]; ok {
+			availability.Providers = append(availability.Providers, providers.Flatrate...)
+			availability.Providers = append(availability.Providers, providers.Free...)
+			availability.Providers = append(availability.Providers, providers.Ads...)
+		}
+	}
+
+	return availability, nil
+}
+
+// GetReleaseDates gets a movie's release dates and age ratings in every country
+func (s *MovieService) GetReleaseDates(ctx context.Context, id string) (*models.ReleaseDatesResponse, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/movie/%s/release_dates?%s", s.tmdbBaseURL, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release dates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var releaseDates models.ReleaseDatesResponse
+	if err := json.Unmarshal(body, &releaseDates); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &releaseDates, nil
+}
+
+// GetTVSchedule gets a TV show's seasons and next episode without credits,
+// videos or OMDB data, so it is cheap enough to poll
+func (s *MovieService) GetTVSchedule(ctx context.Context, id string) (*models.TVDetails, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/tv/%s?%s", s.tmdbBaseURL, id, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TV details: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var tvDetails models.TVDetails
+	if err := json.Unmarshal(body, &tvDetails); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &tvDetails, nil
+}
+
+// GetSeason gets a TV season with all of its episodes
+func (s *MovieService) GetSeason(ctx context.Context, tvID string, seasonNumber int) (*models.SeasonDetails, error) {
+	if s.tmdbAPIKey == "" {
+		return nil, fmt.Errorf("TMDB API key not configured")
+	}
+
+	params := url.Values{}
+	params.Add("api_key", s.tmdbAPIKey)
+
+	url := fmt.Sprintf("%s/tv/%s/season/%d?%s", s.tmdbBaseURL, tvID, seasonNumber, params.Encode())
+
+	resp, err := s.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get season: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var season models.SeasonDetails
+	if err := json.Unmarshal(body, &season); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Add full image URLs
+	if season.PosterPath != "" {
+		season.PosterPath = s.imageBaseURL + season.PosterPath
+	}
+	for i := range season.Episodes {
+		if season.Episodes[i].StillPath != "" {
+			season.Episodes[i].StillPath = s.imageBaseURL + season.Episodes[i].StillPath
+		}
+	}
+
+	return &season, nil
+}
@@ -0,0 +1,772 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"movie-discovery-app/internal/cassette"
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/golden"
+)
+
+const (
+	testTMDBKey   = "tmdb-test-key"
+	testOMDBKey   = "omdb-test-key"
+	testImageBase = "https://image.test/t/p/w500"
+)
+
+func TestMain(m *testing.M) {
+	// Upstream calls are logged to the default logger
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// newFake starts a fake TMDB and OMDB that only accept the test keys
+func newFake(t *testing.T, fixtures fs.FS) (*fakeupstream.Server, *httptest.Server) {
+	t.Helper()
+	fake := fakeupstream.New(fakeupstream.Options{
+		Fixtures:   fixtures,
+		TMDBAPIKey: testTMDBKey,
+		OMDBAPIKey: testOMDBKey,
+	})
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return fake, srv
+}
+
+// newTestService returns a service calling tmdb for TMDB and omdb for OMDB
+func newTestService(tmdb, omdb *httptest.Server, cfg Config) *MovieService {
+	cfg.TMDBBaseURL = tmdb.URL + "/3"
+	cfg.OMDBBaseURL = omdb.URL
+	cfg.ImageBaseURL = testImageBase
+	return NewMovieService(cfg, tmdb.Client())
+}
+
+var testConfig = Config{TMDBAPIKey: testTMDBKey, OMDBAPIKey: testOMDBKey}
+
+// call is one MovieService method with its arguments
+type call struct {
+	name string
+	do   func(s *MovieService) (interface{}, error)
+}
+
+var calls = []call{
+	{"search_multi", func(s *MovieService) (interface{}, error) {
+		return s.Search(context.Background(), "the", "", "1")
+	}},
+	{"search_movie", func(s *MovieService) (interface{}, error) {
+		return s.Search(context.Background(), "matrix", "movie", "1")
+	}},
+	{"search_tv", func(s *MovieService) (interface{}, error) {
+		return s.Search(context.Background(), "breaking", "tv", "1")
+	}},
+	{"movie_details", func(s *MovieService) (interface{}, error) {
+		return s.GetMovieDetails(context.Background(), "550")
+	}},
+	{"tv_details", func(s *MovieService) (interface{}, error) {
+		return s.GetTVDetails(context.Background(), "1396")
+	}},
+	{"trending_week", func(s *MovieService) (interface{}, error) {
+		return s.GetTrending(context.Background(), "week")
+	}},
+	{"genres", func(s *MovieService) (interface{}, error) {
+		return s.GetGenres(context.Background())
+	}},
+	{"search_by_title_movie", func(s *MovieService) (interface{}, error) {
+		return s.SearchByTitle(context.Background(), "Fight Club", "movie", 1999)
+	}},
+	{"search_by_title_tv", func(s *MovieService) (interface{}, error) {
+		return s.SearchByTitle(context.Background(), "Breaking Bad", "tv", 2008)
+	}},
+	{"find_by_imdb_id", func(s *MovieService) (interface{}, error) {
+		return s.FindByIMDBID(context.Background(), "tt0903747")
+	}},
+	{"external_ids", func(s *MovieService) (interface{}, error) {
+		return s.GetExternalIDs(context.Background(), "movie", "603")
+	}},
+	{"credits_movie", func(s *MovieService) (interface{}, error) {
+		return s.GetCredits(context.Background(), "movie", "550")
+	}},
+	{"credits_tv", func(s *MovieService) (interface{}, error) {
+		return s.GetCredits(context.Background(), "tv", "1396")
+	}},
+	{"videos", func(s *MovieService) (interface{}, error) {
+		return s.GetVideos(context.Background(), "movie", "603")
+	}},
+	{"recommendations", func(s *MovieService) (interface{}, error) {
+		return s.GetRecommendations(context.Background(), "movie", "27205")
+	}},
+	{"discover_movie", func(s *MovieService) (interface{}, error) {
+		return s.Discover(context.Background(), "movie", url.Values{"with_genres": {"878"}, "sort_by": {"vote_average.desc"}}, "")
+	}},
+	{"availability_movie", func(s *MovieService) (interface{}, error) {
+		return s.GetAvailability(context.Background(), "movie", "550", "")
+	}},
+	{"availability_tv", func(s *MovieService) (interface{}, error) {
+		return s.GetAvailability(context.Background(), "tv", "1396", "US")
+	}},
+	{"release_dates", func(s *MovieService) (interface{}, error) {
+		return s.GetReleaseDates(context.Background(), "1000001")
+	}},
+	{"tv_schedule", func(s *MovieService) (interface{}, error) {
+		return s.GetTVSchedule(context.Background(), "1000002")
+	}},
+	{"season", func(s *MovieService) (interface{}, error) {
+		return s.GetSeason(context.Background(), "1396", 5)
+	}},
+	{"person", func(s *MovieService) (interface{}, error) {
+		return s.GetPerson(context.Background(), "287")
+	}},
+}
+
+func TestMovieServiceGolden(t *testing.T) {
+	for _, c := range calls {
+		t.Run(c.name, func(t *testing.T) {
+			_, srv := newFake(t, nil)
+			got, err := c.do(newTestService(srv, srv, testConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden.AssertJSON(t, filepath.Join("testdata", "golden", c.name+".json"), got)
+		})
+	}
+}
+
+func TestMovieServiceRequests(t *testing.T) {
+	tests := []struct {
+		name  string
+		do    func(s *MovieService) error
+		path  string
+		query url.Values
+	}{
+		{
+			name: "search multi",
+			do: func(s *MovieService) error {
+				_, err := s.Search(context.Background(), "fight club", "", "2")
+				return err
+			},
+			path:  "/3/search/multi",
+			query: url.Values{"query": {"fight club"}, "page": {"2"}, "include_adult": {"false"}},
+		},
+		{
+			name: "search unknown type",
+			do: func(s *MovieService) error {
+				_, err := s.Search(context.Background(), "fight", "person", "1")
+				return err
+			},
+			path:  "/3/search/multi",
+			query: url.Values{"query": {"fight"}},
+		},
+		{
+			name: "search tv",
+			do: func(s *MovieService) error {
+				_, err := s.Search(context.Background(), "bad", "tv", "1")
+				return err
+			},
+			path: "/3/search/tv",
+		},
+		{
+			name: "movie details",
+			do: func(s *MovieService) error {
+				_, err := s.GetMovieDetails(context.Background(), "550")
+				return err
+			},
+			path:  "/3/movie/550",
+			query: url.Values{"append_to_response": {"credits,external_ids,videos,keywords"}},
+		},
+		{
+			name: "tv details",
+			do: func(s *MovieService) error {
+				_, err := s.GetTVDetails(context.Background(), "1396")
+				return err
+			},
+			path:  "/3/tv/1396",
+			query: url.Values{"append_to_response": {"credits,external_ids,videos,keywords"}},
+		},
+		{
+			name: "trending defaults to day",
+			do: func(s *MovieService) error {
+				_, err := s.GetTrending(context.Background(), "month")
+				return err
+			},
+			path: "/3/trending/all/day",
+		},
+		{
+			name: "search by title movie year",
+			do: func(s *MovieService) error {
+				_, err := s.SearchByTitle(context.Background(), "Fight Club", "", 1999)
+				return err
+			},
+			path:  "/3/search/movie",
+			query: url.Values{"query": {"Fight Club"}, "year": {"1999"}, "include_adult": {"false"}},
+		},
+		{
+			name: "search by title tv year",
+			do: func(s *MovieService) error {
+				_, err := s.SearchByTitle(context.Background(), "Breaking Bad", "tv", 2008)
+				return err
+			},
+			path:  "/3/search/tv",
+			query: url.Values{"first_air_date_year": {"2008"}, "year": {""}},
+		},
+		{
+			name: "find by imdb id",
+			do: func(s *MovieService) error {
+				_, err := s.FindByIMDBID(context.Background(), "tt0137523")
+				return err
+			},
+			path:  "/3/find/tt0137523",
+			query: url.Values{"external_source": {"imdb_id"}},
+		},
+		{
+			name: "external ids tv",
+			do: func(s *MovieService) error {
+				_, err := s.GetExternalIDs(context.Background(), "tv", "1396")
+				return err
+			},
+			path: "/3/tv/1396/external_ids",
+		},
+		{
+			name: "credits tv",
+			do: func(s *MovieService) error {
+				_, err := s.GetCredits(context.Background(), "tv", "1396")
+				return err
+			},
+			path: "/3/tv/1396/credits",
+		},
+		{
+			name: "videos default to movie",
+			do: func(s *MovieService) error {
+				_, err := s.GetVideos(context.Background(), "", "603")
+				return err
+			},
+			path: "/3/movie/603/videos",
+		},
+		{
+			name: "recommendations default to movie",
+			do: func(s *MovieService) error {
+				_, err := s.GetRecommendations(context.Background(), "", "550")
+				return err
+			},
+			path: "/3/movie/550/recommendations",
+		},
+		{
+			name: "discover keeps filters",
+			do: func(s *MovieService) error {
+				filters := url.Values{"with_genres": {"18"}, "api_key": {"other"}, "page": {"9"}}
+				_, err := s.Discover(context.Background(), "tv", filters, "")
+				return err
+			},
+			path:  "/3/discover/tv",
+			query: url.Values{"with_genres": {"18"}, "page": {"1"}, "include_adult": {"false"}},
+		},
+		{
+			name: "availability tv",
+			do: func(s *MovieService) error {
+				_, err := s.GetAvailability(context.Background(), "tv", "1396", "")
+				return err
+			},
+			path:  "/3/tv/1396",
+			query: url.Values{"append_to_response": {"content_ratings,watch/providers"}},
+		},
+		{
+			name: "availability movie",
+			do: func(s *MovieService) error {
+				_, err := s.GetAvailability(context.Background(), "movie", "550", "GB")
+				return err
+			},
+			path:  "/3/movie/550",
+			query: url.Values{"append_to_response": {"release_dates,watch/providers"}},
+		},
+		{
+			name: "release dates",
+			do: func(s *MovieService) error {
+				_, err := s.GetReleaseDates(context.Background(), "550")
+				return err
+			},
+			path: "/3/movie/550/release_dates",
+		},
+		{
+			name: "tv schedule skips appended data",
+			do: func(s *MovieService) error {
+				_, err := s.GetTVSchedule(context.Background(), "1396")
+				return err
+			},
+			path:  "/3/tv/1396",
+			query: url.Values{"append_to_response": {""}},
+		},
+		{
+			name: "season",
+			do: func(s *MovieService) error {
+				_, err := s.GetSeason(context.Background(), "1000002", 2)
+				return err
+			},
+			path: "/3/tv/1000002/season/2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, srv := newFake(t, nil)
+			if err := tt.do(newTestService(srv, srv, testConfig)); err != nil {
+				t.Fatal(err)
+			}
+			fake.AssertCallCount(t, tt.path, 1)
+			fake.AssertQuery(t, tt.path, "api_key", testTMDBKey)
+			for key := range tt.query {
+				fake.AssertQuery(t, tt.path, key, tt.query.Get(key))
+			}
+		})
+	}
+}
+
+func TestGetGenresRequestsBothTypes(t *testing.T) {
+	fake, srv := newFake(t, nil)
+	genres, err := newTestService(srv, srv, testConfig).GetGenres(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.AssertCallCount(t, "/3/genre/movie/list", 1)
+	fake.AssertCallCount(t, "/3/genre/tv/list", 1)
+	if len(genres["movie"]) == 0 || len(genres["tv"]) == 0 {
+		t.Errorf("genres = %v, want movie and tv genres", genres)
+	}
+}
+
+func TestImageURLs(t *testing.T) {
+	_, srv := newFake(t, nil)
+	s := newTestService(srv, srv, testConfig)
+	ctx := context.Background()
+
+	var paths []string
+	add := func(p ...string) { paths = append(paths, p...) }
+
+	search, err := s.Search(ctx, "the", "", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range search.Results {
+		add(r.PosterPath, r.BackdropPath)
+	}
+
+	movie, err := s.GetMovieDetails(ctx, "550")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(movie.PosterPath, movie.BackdropPath)
+	for _, c := range movie.Credits.Cast {
+		add(c.ProfilePath)
+	}
+
+	tv, err := s.GetTVDetails(ctx, "1396")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(tv.PosterPath, tv.BackdropPath)
+	for _, c := range tv.Credits.Cast {
+		add(c.ProfilePath)
+	}
+
+	season, err := s.GetSeason(ctx, "1396", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(season.PosterPath)
+	for _, e := range season.Episodes {
+		add(e.StillPath)
+	}
+
+	found, err := s.FindByIMDBID(ctx, "tt1375666")
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(found.PosterPath)
+
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, testImageBase+"/") || strings.Count(p, testImageBase) != 1 {
+			t.Errorf("image path %q does not have the image base URL exactly once", p)
+		}
+	}
+}
+
+func TestImageURLsLeaveMissingImagesEmpty(t *testing.T) {
+	fixtures := withFixtures(t, map[string]string{
+		"tmdb/search/multi.json": `{"page":1,"total_pages":1,"total_results":1,"results":[
+			{"id":1,"media_type":"movie","title":"No Art","poster_path":null,"backdrop_path":""}]}`,
+	})
+	_, srv := newFake(t, fixtures)
+	search, err := newTestService(srv, srv, testConfig).Search(context.Background(), "art", "", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(search.Results) != 1 {
+		t.Fatalf("got %d results, want 1", len(search.Results))
+	}
+	if r := search.Results[0]; r.PosterPath != "" || r.BackdropPath != "" {
+		t.Errorf("poster %q, backdrop %q, want both empty", r.PosterPath, r.BackdropPath)
+	}
+}
+
+func TestOMDBMerge(t *testing.T) {
+	details := readFixture(t, "tmdb/movie/550.json")
+	delete(details, "external_ids")
+	withoutIMDB, err := json.Marshal(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		omdbKey  string
+		fixtures map[string]string
+		fault    fakeupstream.Fault
+		// wantCall is whether OMDB should be asked at all
+		wantCall bool
+		wantOMDB bool
+	}{
+		{name: "merged", omdbKey: testOMDBKey, wantCall: true, wantOMDB: true},
+		{name: "no OMDB key", omdbKey: "", wantCall: false},
+		{name: "wrong OMDB key", omdbKey: "wrong", wantCall: true},
+		{
+			name:     "no IMDb ID",
+			omdbKey:  testOMDBKey,
+			fixtures: map[string]string{"tmdb/movie/550.json": string(withoutIMDB)},
+			wantCall: false,
+		},
+		{
+			name:     "response false",
+			omdbKey:  testOMDBKey,
+			fixtures: map[string]string{"omdb/tt0137523.json": ""},
+			wantCall: true,
+		},
+		{name: "server error", omdbKey: testOMDBKey, fault: fakeupstream.ServerError, wantCall: true},
+		{name: "rate limited", omdbKey: testOMDBKey, fault: fakeupstream.RateLimited, wantCall: true},
+		{name: "malformed JSON", omdbKey: testOMDBKey, fault: fakeupstream.MalformedJSON, wantCall: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixtures := withFixtures(t, tt.fixtures)
+			_, tmdb := newFake(t, fixtures)
+			omdb, omdbSrv := newFake(t, fixtures)
+			if tt.fault != 0 {
+				omdb.Fail("", tt.fault, 0)
+			}
+			cfg := testConfig
+			cfg.OMDBAPIKey = tt.omdbKey
+			s := newTestService(tmdb, omdbSrv, cfg)
+
+			movie, err := s.GetMovieDetails(context.Background(), "550")
+			if err != nil {
+				t.Fatalf("OMDB failures must not fail the details: %v", err)
+			}
+
+			if tt.wantCall {
+				omdb.AssertCallCount(t, "/", 1)
+				omdb.AssertQuery(t, "/", "i", "tt0137523")
+				omdb.AssertQuery(t, "/", "plot", "full")
+				omdb.AssertQuery(t, "/", "apikey", tt.omdbKey)
+			} else {
+				omdb.AssertNotCalled(t, "/")
+			}
+
+			switch {
+			case tt.wantOMDB && movie.OMDBData == nil:
+				t.Fatal("OMDB data was not merged")
+			case tt.wantOMDB:
+				if movie.OMDBData.Title != "Fight Club" || movie.OMDBData.IMDBRating == "" || len(movie.OMDBData.Ratings) == 0 {
+					t.Errorf("OMDB data = %+v", movie.OMDBData)
+				}
+			case movie.OMDBData != nil:
+				t.Errorf("OMDB data = %+v, want none", movie.OMDBData)
+			}
+		})
+	}
+}
+
+func TestOMDBMergeTV(t *testing.T) {
+	_, srv := newFake(t, nil)
+	tv, err := newTestService(srv, srv, testConfig).GetTVDetails(context.Background(), "1396")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tv.OMDBData == nil || tv.OMDBData.IMDBID != "tt0903747" {
+		t.Errorf("OMDB data = %+v, want Breaking Bad's", tv.OMDBData)
+	}
+}
+
+func TestOMDBResponseFalse(t *testing.T) {
+	tests := []struct {
+		name      string
+		record    string
+		wantErr   string
+		exhausted bool
+	}{
+		{name: "unknown ID", record: "", wantErr: "OMDB error: Incorrect IMDb ID."},
+		{
+			name:    "movie not found",
+			record:  `{"Response":"False","Error":"Movie not found!"}`,
+			wantErr: "OMDB error: Movie not found!",
+		},
+		{
+			name:      "daily limit",
+			record:    `{"Response":"False","Error":"Request limit reached!"}`,
+			wantErr:   "OMDB error: Request limit reached!",
+			exhausted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newFake(t, withFixtures(t, map[string]string{"omdb/tt0137523.json": tt.record}))
+			s := newTestService(srv, srv, testConfig)
+
+			data, err := s.getOMDBData(context.Background(), "tt0137523")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if data != nil {
+				t.Errorf("data = %+v, want nil", data)
+			}
+			if exhausted := s.omdbQuota.remaining(time.Now()) == 0; exhausted != tt.exhausted {
+				t.Errorf("quota exhausted = %v, want %v", exhausted, tt.exhausted)
+			}
+			// Each service keeps its own count
+			if other := newTestService(srv, srv, testConfig); other.omdbQuota.remaining(time.Now()) != defaultOMDBDailyLimit {
+				t.Errorf("another service's quota was used")
+			}
+		})
+	}
+}
+
+func TestMovieServiceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fault   fakeupstream.Fault
+		wantErr string
+	}{
+		{"server error", fakeupstream.ServerError, "API request failed with status: 500"},
+		{"rate limited", fakeupstream.RateLimited, "API request failed with status: 429"},
+		{"malformed JSON", fakeupstream.MalformedJSON, "failed to parse response"},
+	}
+
+	for _, c := range calls {
+		for _, tt := range tests {
+			t.Run(c.name+"/"+tt.name, func(t *testing.T) {
+				fake, srv := newFake(t, nil)
+				fake.Fail("/3/", tt.fault, 0)
+
+				got, err := c.do(newTestService(srv, srv, testConfig))
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				assertNil(t, got)
+			})
+		}
+	}
+}
+
+// Transport errors quote the request URL, whose query holds the API keys
+func TestMovieServiceErrorsHideKeys(t *testing.T) {
+	fake, srv := newFake(t, nil)
+	fake.Fail("", fakeupstream.ServerError, 0)
+	s := newTestService(srv, srv, testConfig)
+
+	var err error
+	for i := 0; i <= breakerThreshold; i++ {
+		_, err = s.Search(context.Background(), "fight", "", "1")
+	}
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error = %v, want %v", err, ErrCircuitOpen)
+	}
+	if strings.Contains(err.Error(), testTMDBKey) || strings.Contains(err.Error(), "api_key") {
+		t.Errorf("error %q contains the API key", err)
+	}
+	if !strings.Contains(err.Error(), "/3/search/multi") {
+		t.Errorf("error %q does not name the endpoint", err)
+	}
+}
+
+func TestMovieServiceNotFound(t *testing.T) {
+	_, srv := newFake(t, nil)
+	s := newTestService(srv, srv, testConfig)
+
+	_, err := s.GetMovieDetails(context.Background(), "999")
+	if err == nil || err.Error() != "API request failed with status: 404" {
+		t.Errorf("movie error = %v", err)
+	}
+	_, err = s.GetSeason(context.Background(), "1396", 99)
+	if err == nil || err.Error() != "API request failed with status: 404" {
+		t.Errorf("season error = %v", err)
+	}
+	_, err = s.GetCredits(context.Background(), "movie", "999")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("credits error = %v, want ErrNotFound", err)
+	}
+
+	// Find answers with empty lists rather than 404
+	media, err := s.FindByIMDBID(context.Background(), "tt0000000")
+	if err != nil || media != nil {
+		t.Errorf("FindByIMDBID = %+v, %v, want nil, nil", media, err)
+	}
+}
+
+func TestMovieServiceWithoutTMDBKey(t *testing.T) {
+	for _, c := range calls {
+		t.Run(c.name, func(t *testing.T) {
+			fake, srv := newFake(t, nil)
+			cfg := testConfig
+			cfg.TMDBAPIKey = ""
+
+			got, err := c.do(newTestService(srv, srv, cfg))
+			if err == nil || err.Error() != "TMDB API key not configured" {
+				t.Fatalf("error = %v", err)
+			}
+			assertNil(t, got)
+			if n := len(fake.Requests()); n != 0 {
+				t.Errorf("made %d requests without a key", n)
+			}
+		})
+	}
+}
+
+func TestMovieServiceWrongTMDBKey(t *testing.T) {
+	_, srv := newFake(t, nil)
+	cfg := testConfig
+	cfg.TMDBAPIKey = "wrong"
+
+	_, err := newTestService(srv, srv, cfg).Search(context.Background(), "fight", "", "1")
+	if err == nil || err.Error() != "API request failed with status: 401" {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestMovieServiceCancelled(t *testing.T) {
+	_, srv := newFake(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := newTestService(srv, srv, testConfig).GetTrending(ctx, "day")
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("error = %v, want a cancellation", err)
+	}
+}
+
+// assertNil fails unless v is nil or a nil pointer, slice or map
+func assertNil(t *testing.T, v interface{}) {
+	t.Helper()
+	if v != nil && !reflect.ValueOf(v).IsNil() {
+		t.Errorf("got %+v, want nil", v)
+	}
+}
+
+// withFixtures returns the default fixtures with some files replaced. An
+// empty content removes the file.
+func withFixtures(t *testing.T, files map[string]string) fs.FS {
+	t.Helper()
+	if len(files) == 0 {
+		return fakeupstream.DefaultFixtures
+	}
+	o := overlay{base: fakeupstream.DefaultFixtures, files: fstest.MapFS{}, removed: map[string]bool{}}
+	for name, content := range files {
+		if content == "" {
+			o.removed[name] = true
+			continue
+		}
+		o.files[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return o
+}
+
+// overlay serves files over base. It only implements Open, so fs.ReadFile
+// and fs.Glob go through it.
+type overlay struct {
+	base    fs.FS
+	files   fstest.MapFS
+	removed map[string]bool
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	if o.removed[name] {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if _, ok := o.files[name]; ok {
+		return o.files.Open(name)
+	}
+	return o.base.Open(name)
+}
+
+func readFixture(t *testing.T, name string) map[string]interface{} {
+	t.Helper()
+	data, err := fs.ReadFile(fakeupstream.DefaultFixtures, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// TestMovieDetailsCassette replays TMDB and OMDB responses for Fight Club.
+// With CASSETTE_MODE=record and the API keys set it records them afresh.
+func TestMovieDetailsCassette(t *testing.T) {
+	mode, err := cassette.ModeFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := cassette.New("testdata/cassettes/movie_550.json", mode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		TMDBAPIKey:   testTMDBKey,
+		TMDBBaseURL:  "https://api.themoviedb.org/3",
+		ImageBaseURL: testImageBase,
+		OMDBAPIKey:   testOMDBKey,
+		OMDBBaseURL:  "http://www.omdbapi.com",
+	}
+	if mode == cassette.Record {
+		cfg.TMDBAPIKey, cfg.OMDBAPIKey = os.Getenv("TMDB_API_KEY"), os.Getenv("OMDB_API_KEY")
+		if cfg.TMDBAPIKey == "" || cfg.OMDBAPIKey == "" {
+			t.Skip("recording needs TMDB_API_KEY and OMDB_API_KEY")
+		}
+	}
+
+	movie, err := NewMovieService(cfg, &http.Client{Transport: rec}).GetMovieDetails(context.Background(), "550")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if movie.Title != "Fight Club" || movie.ExternalIDs == nil || movie.ExternalIDs.IMDBID != "tt0137523" {
+		t.Errorf("movie = %q, external IDs %+v", movie.Title, movie.ExternalIDs)
+	}
+	if movie.Credits == nil || len(movie.Credits.Cast) == 0 {
+		t.Error("no cast")
+	}
+	if movie.OMDBData == nil || movie.OMDBData.Title != "Fight Club" {
+		t.Errorf("OMDB data = %+v", movie.OMDBData)
+	}
+}
@@ -0,0 +1,656 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/tracing"
+	"movie-discovery-app/pkg/models"
+)
+
+const (
+	maxSeeds          = 25 // library titles used to build the profile
+	maxSeedSources    = 6  // liked titles whose TMDB recommendations become candidates
+	maxDetailedScores = 25 // candidates scored on keywords, cast and crew
+	featureCacheTTL   = 24 * time.Hour
+	maxCachedFeatures = 5000 // titles whose features are kept at once
+	fetchConcurrency  = 4
+)
+
+// How much each kind of shared feature counts towards a candidate's score
+var featureWeights = map[string]float64{
+	"genre":    1.0,
+	"keyword":  0.6,
+	"cast":     0.8,
+	"director": 1.5,
+	"lang":     0.4,
+	"decade":   0.3,
+}
+
+// RecommendationService suggests titles based on a user's ratings and watchlist
+type RecommendationService struct {
+	movieService *MovieService
+
+	mu    sync.Mutex
+	cache map[string]cachedFeatures
+}
+
+// titleFeatures are the parts of a title the taste profile is built from
+type titleFeatures struct {
+	ID        int
+	MediaType string
+	Title     string
+	Genres    []models.Genre
+	Keywords  []models.Keyword
+	Cast      []models.CastMember
+	Directors []string // directors for movies, creators for TV shows
+	Language  string
+	Decade    int
+}
+
+type cachedFeatures struct {
+	features *titleFeatures
+	fetched  time.Time
+}
+
+// seed is a library title and how much the user liked it, from -1 to 1
+type seed struct {
+	id     int
+	title  string
+	weight float64
+}
+
+// profileFeature accumulates the user's affinity for one feature and remembers
+// which liked title contributed most to it, for explanations
+type profileFeature struct {
+	weight   float64
+	label    string
+	bestSeed string
+	bestLift float64
+}
+
+type candidate struct {
+	media         models.Media
+	score         float64
+	recommendedBy []seed
+	reasons       []reason
+}
+
+type reason struct {
+	text   string
+	weight float64
+}
+
+func NewRecommendationService(movieService *MovieService) *RecommendationService {
+	return &RecommendationService{
+		movieService: movieService,
+		cache:        make(map[string]cachedFeatures),
+	}
+}
+
+// Recommend builds a taste profile from the library and scores candidate
+// titles pulled from TMDB recommendations and discover against it
+func (s *RecommendationService) Recommend(ctx context.Context, library *models.Library, mediaType string, limit int) (*models.RecommendationResponse, error) {
+	if mediaType != "tv" {
+		mediaType = "movie"
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	seeds := collectSeeds(library, mediaType)
+	if len(seeds) == 0 {
+		return &models.RecommendationResponse{Results: []models.Recommendation{}}, nil
+	}
+
+	ids := make([]int, len(seeds))
+	for i, sd := range seeds {
+		ids[i] = sd.id
+	}
+	seedFeatures, err := s.fetchFeatures(ctx, mediaType, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := make(map[string]*profileFeature)
+	basedOn := 0
+	for i := range seeds {
+		features := seedFeatures[seeds[i].id]
+		if features == nil {
+			continue
+		}
+		if seeds[i].title == "" {
+			seeds[i].title = features.Title
+		}
+		addToProfile(profile, features, seeds[i])
+		basedOn++
+	}
+
+	candidates, err := s.gatherCandidates(ctx, library, mediaType, seeds, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Score everything on the cheap features first, then fetch details only
+	// for the most promising candidates
+	for _, c := range candidates {
+		scoreBasic(c, profile)
+	}
+	sortCandidates(candidates)
+	if len(candidates) > maxDetailedScores {
+		candidates = candidates[:maxDetailedScores]
+	}
+
+	ids = ids[:0]
+	for _, c := range candidates {
+		ids = append(ids, c.media.ID)
+	}
+	details, err := s.fetchFeatures(ctx, mediaType, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		if features := details[c.media.ID]; features != nil {
+			scoreDetailed(c, features, profile, mediaType)
+		}
+	}
+	sortCandidates(candidates)
+
+	response := &models.RecommendationResponse{Results: []models.Recommendation{}, BasedOn: basedOn}
+	for _, c := range candidates {
+		if len(response.Results) == limit {
+			break
+		}
+		if c.score <= 0 {
+			continue
+		}
+
+		sort.SliceStable(c.reasons, func(i, j int) bool {
+			return c.reasons[i].weight > c.reasons[j].weight
+		})
+		var reasons []string
+		for _, r := range c.reasons {
+			if len(reasons) == 3 {
+				break
+			}
+			reasons = append(reasons, r.text)
+		}
+
+		explanation := "Highly rated in the genres you watch"
+		if len(reasons) > 0 {
+			explanation = reasons[0]
+		}
+
+		response.Results = append(response.Results, models.Recommendation{
+			Media:       c.media,
+			Score:       math.Round(c.score*100) / 100,
+			Explanation: explanation,
+			Reasons:     reasons,
+		})
+	}
+
+	return response, nil
+}
+
+// collectSeeds turns ratings, diary entries and watchlist items into weighted
+// seeds. Ratings above 5.5/10 count as likes and below as dislikes.
+func collectSeeds(library *models.Library, mediaType string) []seed {
+	weights := make(map[int]float64)
+	titles := make(map[int]string)
+
+	for _, item := range library.Watchlist {
+		if item.MediaType == mediaType {
+			weights[item.ID] = 0.4
+			titles[item.ID] = item.Title
+		}
+	}
+	for _, entry := range library.Diary {
+		if entry.MediaType != mediaType {
+			continue
+		}
+		titles[entry.ID] = entry.Title
+		if entry.Rating > 0 {
+			weights[entry.ID] = ratingWeight(entry.Rating)
+		} else if _, ok := weights[entry.ID]; !ok {
+			weights[entry.ID] = 0.3
+		}
+	}
+	for _, rating := range library.Ratings {
+		if rating.MediaType == mediaType {
+			weights[rating.ID] = ratingWeight(rating.Rating)
+			titles[rating.ID] = rating.Title
+		}
+	}
+
+	seeds := make([]seed, 0, len(weights))
+	for id, weight := range weights {
+		if weight != 0 {
+			seeds = append(seeds, seed{id: id, title: titles[id], weight: weight})
+		}
+	}
+
+	sort.Slice(seeds, func(i, j int) bool {
+		if math.Abs(seeds[i].weight) != math.Abs(seeds[j].weight) {
+			return math.Abs(seeds[i].weight) > math.Abs(seeds[j].weight)
+		}
+		return seeds[i].id < seeds[j].id
+	})
+	if len(seeds) > maxSeeds {
+		seeds = seeds[:maxSeeds]
+	}
+	return seeds
+}
+
+func ratingWeight(rating float64) float64 {
+	return math.Max(-1, math.Min(1, (rating-5.5)/4.5))
+}
+
+func addToProfile(profile map[string]*profileFeature, features *titleFeatures, sd seed) {
+	add := func(kind string, id, label string) {
+		key := kind + ":" + id
+		f := profile[key]
+		if f == nil {
+			f = &profileFeature{label: label}
+			profile[key] = f
+		}
+		lift := sd.weight * featureWeights[kind]
+		f.weight += lift
+		if lift > f.bestLift {
+			f.bestLift = lift
+			f.bestSeed = sd.title
+		}
+	}
+
+	for _, genre := range features.Genres {
+		add("genre", strconv.Itoa(genre.ID), genre.Name)
+	}
+	for _, keyword := range features.Keywords {
+		add("keyword", strconv.Itoa(keyword.ID), keyword.Name)
+	}
+	for _, member := range features.Cast {
+		add("cast", strconv.Itoa(member.ID), member.Name)
+	}
+	for _, name := range features.Directors {
+		add("director", name, name)
+	}
+	if features.Language != "" {
+		add("lang", features.Language, features.Language)
+	}
+	if features.Decade > 0 {
+		add("decade", strconv.Itoa(features.Decade), fmt.Sprintf("%ds", features.Decade))
+	}
+}
+
+func (s *RecommendationService) gatherCandidates(ctx context.Context, library *models.Library, mediaType string, seeds []seed, profile map[string]*profileFeature) ([]*candidate, error) {
+	owned := make(map[int]bool)
+	for _, item := range library.Watchlist {
+		if item.MediaType == mediaType {
+			owned[item.ID] = true
+		}
+	}
+	for _, rating := range library.Ratings {
+		if rating.MediaType == mediaType {
+			owned[rating.ID] = true
+		}
+	}
+	for _, entry := range library.Diary {
+		if entry.MediaType == mediaType {
+			owned[entry.ID] = true
+		}
+	}
+
+	byID := make(map[int]*candidate)
+	var candidates []*candidate
+	add := func(media models.Media, from *seed) {
+		if owned[media.ID] || media.Adult {
+			return
+		}
+		c := byID[media.ID]
+		if c == nil {
+			c = &candidate{media: media}
+			byID[media.ID] = c
+			candidates = append(candidates, c)
+		}
+		if from != nil {
+			c.recommendedBy = append(c.recommendedBy, *from)
+		}
+	}
+
+	var firstErr error
+	sources := 0
+	for i := range seeds {
+		if sources == maxSeedSources || seeds[i].weight <= 0.5 {
+			break
+		}
+		sources++
+
+		results, err := s.movieService.GetRecommendations(ctx, mediaType, strconv.Itoa(seeds[i].id))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, media := range results {
+			add(media, &seeds[i])
+		}
+	}
+
+	// Fill the pool with well-rated titles from the user's favourite genres
+	var genres []string
+	for _, key := range topFeatures(profile, "genre", 2) {
+		genres = append(genres, strings.TrimPrefix(key, "genre:"))
+	}
+	if len(genres) > 0 {
+		filters := url.Values{}
+		filters.Set("with_genres", strings.Join(genres, "|"))
+		filters.Set("sort_by", "vote_average.desc")
+		filters.Set("vote_count.gte", "300")
+
+		discovered, err := s.movieService.Discover(ctx, mediaType, filters, "1")
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		} else {
+			for _, media := range discovered.Results {
+				add(media, nil)
+			}
+		}
+	}
+
+	if len(candidates) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return candidates, nil
+}
+
+// scoreBasic scores a candidate on the features available in list results
+func scoreBasic(c *candidate, profile map[string]*profileFeature) {
+	c.score = 0
+	c.reasons = nil
+
+	for _, sd := range c.recommendedBy {
+		c.score += sd.weight
+		c.reasons = append(c.reasons, reason{
+			text:   fmt.Sprintf("Because you liked %s", sd.title),
+			weight: sd.weight,
+		})
+	}
+
+	for _, id := range c.media.GenreIDs {
+		if f := profile["genre:"+strconv.Itoa(id)]; f != nil {
+			c.score += f.weight / 4
+			if f.weight > 0 && f.label != "" {
+				c.reasons = append(c.reasons, reason{
+					text:   fmt.Sprintf("Because you enjoy %s", f.label),
+					weight: f.weight / 8,
+				})
+			}
+		}
+	}
+	if f := profile["lang:"+c.media.OriginalLanguage]; f != nil {
+		c.score += f.weight / 4
+	}
+	if decade := decadeOf(releaseDateOf(c.media)); decade > 0 {
+		if f := profile["decade:"+strconv.Itoa(decade)]; f != nil {
+			c.score += f.weight / 4
+		}
+	}
+
+	// Break ties in favour of titles other viewers rate well
+	c.score += c.media.VoteAverage / 20
+}
+
+// scoreDetailed adds keyword, cast and crew overlap once full details are known
+func scoreDetailed(c *candidate, features *titleFeatures, profile map[string]*profileFeature, mediaType string) {
+	verb := "directed by"
+	if mediaType == "tv" {
+		verb = "created by"
+	}
+
+	for _, name := range features.Directors {
+		if f := profile["director:"+name]; f != nil {
+			c.score += f.weight
+			if f.weight > 0 && f.bestSeed != "" {
+				c.reasons = append(c.reasons, reason{
+					text:   fmt.Sprintf("Because you liked %s, %s %s", f.bestSeed, verb, name),
+					weight: f.weight + 1,
+				})
+			}
+		}
+	}
+	for _, member := range features.Cast {
+		if f := profile["cast:"+strconv.Itoa(member.ID)]; f != nil {
+			c.score += f.weight / 2
+			if f.weight > 0 && f.bestSeed != "" {
+				c.reasons = append(c.reasons, reason{
+					text:   fmt.Sprintf("Because you liked %s, starring %s", f.bestSeed, member.Name),
+					weight: f.weight/2 + 0.5,
+				})
+			}
+		}
+	}
+	for _, keyword := range features.Keywords {
+		if f := profile["keyword:"+strconv.Itoa(keyword.ID)]; f != nil {
+			c.score += f.weight / 3
+			if f.weight > 0 && f.bestSeed != "" {
+				c.reasons = append(c.reasons, reason{
+					text:   fmt.Sprintf("Because you liked %s, also about %s", f.bestSeed, keyword.Name),
+					weight: f.weight / 3,
+				})
+			}
+		}
+	}
+}
+
+func sortCandidates(candidates []*candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].media.ID < candidates[j].media.ID
+	})
+}
+
+// topFeatures returns the keys of the most liked features of one kind
+func topFeatures(profile map[string]*profileFeature, kind string, n int) []string {
+	var keys []string
+	for key, f := range profile {
+		if strings.HasPrefix(key, kind+":") && f.weight > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if profile[keys[i]].weight != profile[keys[j]].weight {
+			return profile[keys[i]].weight > profile[keys[j]].weight
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// fetchFeatures gets the features of several titles, a few at a time, from
+// the cache or TMDB. Titles that fail to load are left out of the result.
+func (s *RecommendationService) fetchFeatures(ctx context.Context, mediaType string, ids []int) (map[int]*titleFeatures, error) {
+	result := make(map[int]*titleFeatures)
+	var missing []int
+
+	_, span := tracing.Start(ctx, "cache.lookup", tracing.WithAttributes(
+		tracing.String("cache.name", "recommendation_features"),
+		tracing.Int("cache.keys", len(ids)),
+	))
+	s.mu.Lock()
+	for _, id := range ids {
+		key := fmt.Sprintf("%s/%d", mediaType, id)
+		if cached, ok := s.cache[key]; ok && time.Since(cached.fetched) < featureCacheTTL {
+			metrics.CacheLookup("recommendation_features", true)
+			result[id] = cached.features
+		} else {
+			metrics.CacheLookup("recommendation_features", false)
+			missing = append(missing, id)
+		}
+	}
+	s.mu.Unlock()
+	span.SetAttributes(tracing.Int("cache.misses", len(missing)))
+	span.End()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, fetchConcurrency)
+	)
+acquire:
+	for _, id := range missing {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			mu.Unlock()
+			break acquire
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			features, err := s.loadFeatures(ctx, mediaType, id)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			result[id] = features
+		}(id)
+	}
+	wg.Wait()
+
+	if len(result) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	s.pruneCache(now, len(missing))
+	for _, id := range missing {
+		if features := result[id]; features != nil {
+			s.cache[fmt.Sprintf("%s/%d", mediaType, id)] = cachedFeatures{features: features, fetched: now}
+		}
+	}
+	s.mu.Unlock()
+
+	return result, nil
+}
+
+// pruneCache drops expired features, then the oldest ones until n more fit
+// under maxCachedFeatures. s.mu must be held.
+func (s *RecommendationService) pruneCache(now time.Time, n int) {
+	for key, cached := range s.cache {
+		if now.Sub(cached.fetched) >= featureCacheTTL {
+			delete(s.cache, key)
+		}
+	}
+	excess := len(s.cache) + n - maxCachedFeatures
+	if excess <= 0 {
+		return
+	}
+	keys := make([]string, 0, len(s.cache))
+	for key := range s.cache {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.cache[keys[i]].fetched.Before(s.cache[keys[j]].fetched)
+	})
+	for _, key := range keys[:min(excess, len(keys))] {
+		delete(s.cache, key)
+	}
+}
+
+func (s *RecommendationService) loadFeatures(ctx context.Context, mediaType string, id int) (*titleFeatures, error) {
+	features := &titleFeatures{ID: id, MediaType: mediaType}
+
+	if mediaType == "tv" {
+		details, err := s.movieService.fetchTVDetails(ctx, strconv.Itoa(id))
+		if err != nil {
+			return nil, err
+		}
+		features.Title = details.Name
+		features.Genres = details.Genres
+		features.Keywords = details.Keywords.All()
+		features.Language = details.OriginalLanguage
+		features.Decade = decadeOf(details.FirstAirDate)
+		for _, creator := range details.CreatedBy {
+			features.Directors = append(features.Directors, creator.Name)
+		}
+		if details.Credits != nil {
+			features.Cast = topBilled(details.Credits.Cast)
+		}
+	} else {
+		details, err := s.movieService.fetchMovieDetails(ctx, strconv.Itoa(id))
+		if err != nil {
+			return nil, err
+		}
+		features.Title = details.Title
+		features.Genres = details.Genres
+		features.Keywords = details.Keywords.All()
+		features.Language = details.OriginalLanguage
+		features.Decade = decadeOf(details.ReleaseDate)
+		if details.Credits != nil {
+			features.Cast = topBilled(details.Credits.Cast)
+			for _, member := range details.Credits.Crew {
+				if member.Job == "Director" {
+					features.Directors = append(features.Directors, member.Name)
+				}
+			}
+		}
+	}
+
+	if len(features.Keywords) > 10 {
+		features.Keywords = features.Keywords[:10]
+	}
+	return features, nil
+}
+
+func topBilled(cast []models.CastMember) []models.CastMember {
+	if len(cast) > 5 {
+		return cast[:5]
+	}
+	return cast
+}
+
+func releaseDateOf(media models.Media) string {
+	if media.ReleaseDate != "" {
+		return media.ReleaseDate
+	}
+	return media.FirstAirDate
+}
+
+func decadeOf(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year / 10 * 10
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"movie-discovery-app/internal/golden"
+	"movie-discovery-app/pkg/models"
+)
+
+// recommendFixtures are three library titles, one liked, one disliked and
+// one on the watchlist, and the candidates TMDB suggests from them
+var recommendFixtures = fstest.MapFS{
+	"tmdb/movie/1.json": {Data: []byte(`{"id": 1, "title": "Liked One", "release_date": "1994-01-01", "original_language": "en",
+		"genres": [{"id": 18, "name": "Drama"}],
+		"credits": {"cast": [{"id": 100, "name": "Star A"}], "crew": [{"id": 300, "name": "Jane Doe", "job": "Director"}]},
+		"keywords": {"keywords": [{"id": 7, "name": "heist"}]},
+		"recommendations": {"page": 1, "results": [
+			{"id": 10, "title": "Same Director", "release_date": "2001-01-01", "original_language": "en", "genre_ids": [18], "vote_average": 6},
+			{"id": 11, "title": "Horror Pick", "release_date": "2011-01-01", "original_language": "en", "genre_ids": [27], "vote_average": 7},
+			{"id": 12, "title": "Shares Star", "release_date": "2005-01-01", "original_language": "en", "genre_ids": [35], "vote_average": 6},
+			{"id": 3, "title": "Watchlist One", "release_date": "1998-01-01", "original_language": "fr", "genre_ids": [18, 35], "vote_average": 9}
+		]}}`)},
+	"tmdb/movie/2.json": {Data: []byte(`{"id": 2, "title": "Disliked One", "release_date": "2010-01-01", "original_language": "en",
+		"genres": [{"id": 27, "name": "Horror"}],
+		"credits": {"cast": [{"id": 200, "name": "Star B"}], "crew": [{"id": 301, "name": "Bad Director", "job": "Director"}]},
+		"keywords": {"keywords": [{"id": 8, "name": "gore"}]}}`)},
+	"tmdb/movie/3.json": {Data: []byte(`{"id": 3, "title": "Watchlist One", "release_date": "1998-01-01", "original_language": "fr",
+		"genres": [{"id": 18, "name": "Drama"}, {"id": 35, "name": "Comedy"}]}`)},
+	"tmdb/movie/10.json": {Data: []byte(`{"id": 10, "title": "Same Director", "release_date": "2001-01-01", "original_language": "en",
+		"genres": [{"id": 18, "name": "Drama"}],
+		"credits": {"crew": [{"id": 300, "name": "Jane Doe", "job": "Director"}]}}`)},
+	"tmdb/movie/11.json": {Data: []byte(`{"id": 11, "title": "Horror Pick", "release_date": "2011-01-01", "original_language": "en",
+		"genres": [{"id": 27, "name": "Horror"}],
+		"credits": {"cast": [{"id": 200, "name": "Star B"}], "crew": [{"id": 301, "name": "Bad Director", "job": "Director"}]}}`)},
+	"tmdb/movie/12.json": {Data: []byte(`{"id": 12, "title": "Shares Star", "release_date": "2005-01-01", "original_language": "en",
+		"genres": [{"id": 35, "name": "Comedy"}],
+		"credits": {"cast": [{"id": 100, "name": "Star A"}]},
+		"keywords": {"keywords": [{"id": 7, "name": "heist"}]}}`)},
+	"tmdb/movie/13.json": {Data: []byte(`{"id": 13, "title": "Discovered Drama", "release_date": "1996-01-01", "original_language": "en",
+		"genres": [{"id": 18, "name": "Drama"}]}`)},
+	"tmdb/discover/movie.json": {Data: []byte(`{"page": 1, "results": [
+		{"id": 13, "title": "Discovered Drama", "release_date": "1996-01-01", "original_language": "en", "genre_ids": [18], "vote_average": 8.5, "vote_count": 1000},
+		{"id": 14, "title": "Obscure Drama", "release_date": "1997-01-01", "original_language": "en", "genre_ids": [18], "vote_average": 9, "vote_count": 10},
+		{"id": 2, "title": "Disliked One", "release_date": "2010-01-01", "original_language": "en", "genre_ids": [18], "vote_average": 5, "vote_count": 1000}
+	], "total_pages": 1, "total_results": 3}`)},
+}
+
+func TestRecommend(t *testing.T) {
+	fake, srv := newFake(t, recommendFixtures)
+	s := NewRecommendationService(newTestService(srv, srv, testConfig))
+
+	library := &models.Library{
+		Watchlist: []models.WatchlistItem{{ID: 3, Title: "Watchlist One", MediaType: "movie"}},
+		Ratings: []models.Rating{
+			{ID: 1, Title: "Liked One", MediaType: "movie", Rating: 10},
+			{ID: 2, Title: "Disliked One", MediaType: "movie", Rating: 1},
+		},
+		Diary: []models.DiaryEntry{{ID: 1396, Title: "Breaking Bad", MediaType: "tv", Rating: 10}},
+	}
+
+	got, err := s.Recommend(context.Background(), library, "movie", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The director match outranks the shared star, the disliked director's
+	// film drops out and library titles are never suggested
+	type result struct {
+		ID          int
+		Explanation string
+	}
+	var results []result
+	for _, r := range got.Results {
+		results = append(results, result{r.ID, r.Explanation})
+	}
+	want := []result{
+		{10, "Because you liked Liked One, directed by Jane Doe"},
+		{12, "Because you liked Liked One"},
+		{13, "Because you enjoy Drama"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+	if got.BasedOn != 3 {
+		t.Errorf("based on %d titles, want 3", got.BasedOn)
+	}
+	if reasons := got.Results[1].Reasons; !reflect.DeepEqual(reasons, []string{
+		"Because you liked Liked One",
+		"Because you liked Liked One, starring Star A",
+		"Because you liked Liked One, also about heist",
+	}) {
+		t.Errorf("reasons for Shares Star = %q", reasons)
+	}
+	golden.AssertJSON(t, filepath.Join("testdata", "golden", "recommend_movie.json"), got)
+
+	// Only the liked title's recommendations are asked for, and the
+	// discover pool is drawn from the liked genres
+	fake.AssertCallCount(t, "/3/movie/1/recommendations", 1)
+	fake.AssertCallCount(t, "/3/movie/2/recommendations", 0)
+	fake.AssertQuery(t, "/3/discover/movie", "with_genres", "18|35")
+
+	// Details are cached, so a second run only asks for recommendations again
+	before := len(fake.Requests())
+	if _, err := s.Recommend(context.Background(), library, "movie", 10); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Requests()) - before; n != 2 {
+		t.Errorf("second run made %d requests, want 2", n)
+	}
+}
+
+func TestCollectSeeds(t *testing.T) {
+	tests := []struct {
+		name    string
+		library models.Library
+		want    []seed
+	}{
+		{
+			name: "watchlist and unrated diary",
+			library: models.Library{
+				Watchlist: []models.WatchlistItem{{ID: 1, Title: "A", MediaType: "movie"}},
+				Diary:     []models.DiaryEntry{{ID: 2, Title: "B", MediaType: "movie"}, {ID: 1, Title: "A", MediaType: "movie"}},
+			},
+			want: []seed{{id: 1, title: "A", weight: 0.4}, {id: 2, title: "B", weight: 0.3}},
+		},
+		{
+			name: "ratings win",
+			library: models.Library{
+				Watchlist: []models.WatchlistItem{{ID: 1, Title: "A", MediaType: "movie"}},
+				Diary:     []models.DiaryEntry{{ID: 1, Title: "A", MediaType: "movie", Rating: 10}},
+				Ratings:   []models.Rating{{ID: 1, Title: "A", MediaType: "movie", Rating: 1}},
+			},
+			want: []seed{{id: 1, title: "A", weight: -1}},
+		},
+		{
+			name: "neutral ratings and other media types dropped",
+			library: models.Library{
+				Ratings: []models.Rating{{ID: 1, MediaType: "movie", Rating: 5.5}, {ID: 2, MediaType: "tv", Rating: 10}},
+			},
+			want: []seed{},
+		},
+		{
+			name: "strongest first",
+			library: models.Library{
+				Ratings: []models.Rating{{ID: 3, MediaType: "movie", Rating: 7.75}, {ID: 2, MediaType: "movie", Rating: 1}, {ID: 1, MediaType: "movie", Rating: 10}},
+			},
+			want: []seed{{id: 1, weight: 1}, {id: 2, weight: -1}, {id: 3, weight: 0.5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := collectSeeds(&tt.library, "movie"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectSeeds = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var library models.Library
+	for i := 0; i < maxSeeds+5; i++ {
+		library.Watchlist = append(library.Watchlist, models.WatchlistItem{ID: i + 1, MediaType: "movie"})
+	}
+	if got := collectSeeds(&library, "movie"); len(got) != maxSeeds || got[maxSeeds-1].id != maxSeeds {
+		t.Errorf("collectSeeds kept %d seeds", len(got))
+	}
+}
+
+func TestFeatureCachePrune(t *testing.T) {
+	s := NewRecommendationService(nil)
+	now := time.Now()
+	s.cache["movie/1"] = cachedFeatures{fetched: now.Add(-featureCacheTTL)}
+	for i := 0; i < maxCachedFeatures; i++ {
+		s.cache[fmt.Sprintf("tv/%d", i)] = cachedFeatures{fetched: now.Add(time.Duration(i-maxCachedFeatures) * time.Second)}
+	}
+
+	s.pruneCache(now, 10)
+
+	if len(s.cache) != maxCachedFeatures-10 {
+		t.Errorf("cache has %d entries, want %d", len(s.cache), maxCachedFeatures-10)
+	}
+	if _, ok := s.cache["movie/1"]; ok {
+		t.Error("expired entry kept")
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := s.cache[fmt.Sprintf("tv/%d", i)]; ok {
+			t.Errorf("oldest entry tv/%d kept", i)
+		}
+	}
+	if _, ok := s.cache["tv/10"]; !ok {
+		t.Error("newer entry tv/10 evicted")
+	}
+}
+
+func TestFetchFeaturesCancelled(t *testing.T) {
+	_, srv := newFake(t, nil)
+	s := NewRecommendationService(newTestService(srv, srv, testConfig))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ids := make([]int, 4*fetchConcurrency)
+	for i := range ids {
+		ids[i] = 550
+	}
+	_, err := s.fetchFeatures(ctx, "movie", ids)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+}
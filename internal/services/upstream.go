@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-discovery-app/internal/metrics"
+	"movie-discovery-app/internal/tracing"
+)
+
+var (
+	upstreamRequests = metrics.NewCounterVec(metrics.Default, "upstream_requests_total",
+		"Calls to upstream APIs by provider, endpoint and status code.", "provider", "endpoint", "status")
+	upstreamDuration = metrics.NewHistogramVec(metrics.Default, "upstream_request_duration_seconds",
+		"Latency of calls to upstream APIs.", nil, "provider", "endpoint")
+)
+
+// omdbQuotaRemaining is updated by every OMDB call, since services keep
+// their own quotas
+var omdbQuotaRemaining = metrics.NewGaugeVec(metrics.Default, "omdb_quota_remaining",
+	"Estimated OMDB requests left today (UTC), as of the last OMDB call.")
+
+// dailyQuota counts calls per UTC day. OMDB does not report usage, so this
+// is an estimate that drops to zero once OMDB says the limit was reached.
+type dailyQuota struct {
+	mu        sync.Mutex
+	limit     int
+	day       string
+	used      int
+	exhausted bool
+}
+
+func newDailyQuota(limit int) *dailyQuota {
+	return &dailyQuota{limit: limit}
+}
+
+func (q *dailyQuota) rollover(now time.Time) {
+	if day := now.UTC().Format("2006-01-02"); day != q.day {
+		q.day, q.used, q.exhausted = day, 0, false
+	}
+}
+
+func (q *dailyQuota) record(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	q.used++
+	omdbQuotaRemaining.With().Set(float64(q.left()))
+}
+
+func (q *dailyQuota) exhaust(now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	q.exhausted = true
+	omdbQuotaRemaining.With().Set(0)
+}
+
+func (q *dailyQuota) remaining(now time.Time) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover(now)
+	return q.left()
+}
+
+// left is the calls remaining, with q.mu held
+func (q *dailyQuota) left() int {
+	if q.exhausted || q.used >= q.limit {
+		return 0
+	}
+	return q.limit - q.used
+}
+
+const (
+	// breakerThreshold consecutive failures open a provider's breaker
+	breakerThreshold = 5
+	// breakerCooldown is how long an open breaker rejects calls before
+	// letting a single trial call through
+	breakerCooldown = 30 * time.Second
+	// statsWindow is the number of recent calls error rates and latency
+	// percentiles are computed over
+	statsWindow = 100
+)
+
+// ErrCircuitOpen is returned instead of calling an upstream that keeps failing
+var ErrCircuitOpen = errors.New("upstream unavailable: circuit breaker is open")
+
+// Breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// UpstreamStatus describes the recent health of one upstream API
+type UpstreamStatus struct {
+	Name         string     `json:"name"`
+	BreakerState string     `json:"breaker_state"`
+	LastSuccess  *time.Time `json:"last_success,omitempty"`
+	LastFailure  *time.Time `json:"last_failure,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	Requests     int        `json:"recent_requests"`
+	ErrorRate    float64    `json:"error_rate"`
+	LatencyP50Ms float64    `json:"latency_p50_ms"`
+	LatencyP90Ms float64    `json:"latency_p90_ms"`
+	LatencyP99Ms float64    `json:"latency_p99_ms"`
+}
+
+type outcome struct {
+	latency time.Duration
+	failed  bool
+}
+
+// upstreamStats keeps the recent calls to one provider and the state of its
+// circuit breaker
+type upstreamStats struct {
+	mu          sync.Mutex
+	recent      [statsWindow]outcome
+	next, count int
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+
+	state    string
+	failures int
+	openedAt time.Time
+	// trial is set while the one call allowed by a half-open breaker is running
+	trial bool
+}
+
+func newUpstreamStats() *upstreamStats {
+	return &upstreamStats{state: BreakerClosed}
+}
+
+// allow reports whether a call may go ahead
+func (s *upstreamStats) allow(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case BreakerOpen:
+		if now.Sub(s.openedAt) < breakerCooldown {
+			return false
+		}
+		s.state = BreakerHalfOpen
+		s.trial = true
+		return true
+	case BreakerHalfOpen:
+		if s.trial {
+			return false
+		}
+		s.trial = true
+		return true
+	}
+	return true
+}
+
+func (s *upstreamStats) record(now time.Time, latency time.Duration, failure string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.recent[s.next] = outcome{latency: latency, failed: failure != ""}
+	s.next = (s.next + 1) % statsWindow
+	if s.count < statsWindow {
+		s.count++
+	}
+
+	s.trial = false
+	if failure == "" {
+		s.lastSuccess = now
+		s.failures = 0
+		s.state = BreakerClosed
+		return
+	}
+
+	s.lastFailure, s.lastError = now, failure
+	s.failures++
+	// A failed trial call reopens the breaker straight away
+	if s.state == BreakerHalfOpen || s.failures >= breakerThreshold {
+		s.state = BreakerOpen
+		s.openedAt = now
+	}
+}
+
+// cancel releases a trial call that ended without telling anything about
+// the upstream, e.g. because the client went away
+func (s *upstreamStats) cancel() {
+	s.mu.Lock()
+	s.trial = false
+	s.mu.Unlock()
+}
+
+func (s *upstreamStats) status(name string) UpstreamStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := UpstreamStatus{Name: name, BreakerState: s.state, LastError: s.lastError, Requests: s.count}
+	if !s.lastSuccess.IsZero() {
+		t := s.lastSuccess
+		status.LastSuccess = &t
+	}
+	if !s.lastFailure.IsZero() {
+		t := s.lastFailure
+		status.LastFailure = &t
+	}
+	if s.count == 0 {
+		return status
+	}
+
+	latencies := make([]time.Duration, 0, s.count)
+	failed := 0
+	for _, o := range s.recent[:s.count] {
+		latencies = append(latencies, o.latency)
+		if o.failed {
+			failed++
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	status.ErrorRate = float64(failed) / float64(s.count)
+	status.LatencyP50Ms = percentile(latencies, 0.50)
+	status.LatencyP90Ms = percentile(latencies, 0.90)
+	status.LatencyP99Ms = percentile(latencies, 0.99)
+	return status
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	rank := max(int(math.Ceil(p*float64(len(sorted))))-1, 0)
+	return float64(sorted[rank].Microseconds()) / 1000
+}
+
+// upstreamTransport logs and measures every call MovieService makes to TMDB
+// and OMDB. Query strings are never logged because they carry the API keys.
+// Each provider has a circuit breaker so an outage fails calls immediately
+// instead of tying up requests until the client timeout.
+type upstreamTransport struct {
+	next http.RoundTripper
+	// providers are matched by host and base path, longest path first, so
+	// TMDB and OMDB can share a host such as a local fake server
+	providers []provider
+	// stats is keyed by provider name
+	stats map[string]*upstreamStats
+	// omdbQuota counts the calls to OMDB
+	omdbQuota *dailyQuota
+}
+
+type provider struct {
+	name     string
+	host     string
+	basePath string
+}
+
+func newUpstreamTransport(next http.RoundTripper, baseURLs map[string]string) *upstreamTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	t := &upstreamTransport{next: next, stats: make(map[string]*upstreamStats)}
+	for name, baseURL := range baseURLs {
+		t.stats[name] = newUpstreamStats()
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			continue
+		}
+		t.providers = append(t.providers, provider{name: name, host: u.Host, basePath: strings.TrimSuffix(u.Path, "/")})
+	}
+	sort.Slice(t.providers, func(i, j int) bool {
+		return len(t.providers[i].basePath) > len(t.providers[j].basePath)
+	})
+	return t
+}
+
+// provider finds which upstream a request is for
+func (t *upstreamTransport) provider(u *url.URL) provider {
+	for _, p := range t.providers {
+		if u.Host != p.host {
+			continue
+		}
+		if p.basePath == "" || u.Path == p.basePath || strings.HasPrefix(u.Path, p.basePath+"/") {
+			return p
+		}
+	}
+	return provider{name: u.Host}
+}
+
+// status reports on every configured provider, sorted by name
+func (t *upstreamTransport) status() []UpstreamStatus {
+	out := make([]UpstreamStatus, 0, len(t.stats))
+	for name, stats := range t.stats {
+		out = append(out, stats.status(name))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.provider(req.URL)
+	endpoint := upstreamEndpoint(strings.TrimPrefix(req.URL.Path, p.basePath))
+
+	stats := t.stats[p.name]
+	if stats != nil && !stats.allow(time.Now()) {
+		upstreamRequests.With(p.name, endpoint, "breaker_open").Inc()
+		return nil, ErrCircuitOpen
+	}
+
+	ctx, span := tracing.Start(req.Context(), req.Method+" "+p.name+" "+endpoint,
+		tracing.WithKind(tracing.KindClient), tracing.WithAttributes(
+			tracing.String("http.request.method", req.Method),
+			tracing.String("server.address", req.URL.Host),
+			tracing.String("upstream.provider", p.name),
+			tracing.String("upstream.endpoint", endpoint),
+		))
+	defer span.End()
+
+	// A RoundTripper must not change the caller's request
+	req = req.Clone(ctx)
+	req.Header.Set("traceparent", span.SpanContext().Traceparent())
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+
+	if p.name == "omdb" && t.omdbQuota != nil {
+		t.omdbQuota.record(start)
+	}
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	upstreamRequests.With(p.name, endpoint, status).Inc()
+	upstreamDuration.With(p.name, endpoint).Observe(latency.Seconds())
+
+	if stats != nil {
+		switch {
+		case err != nil && errors.Is(err, context.Canceled):
+			// The caller gave up, which says nothing about the upstream
+			stats.cancel()
+		case err != nil:
+			stats.record(start, latency, err.Error())
+		case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+			stats.record(start, latency, resp.Status)
+		default:
+			stats.record(start, latency, "")
+		}
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		slog.WarnContext(req.Context(), "upstream call failed",
+			"provider", p.name,
+			"endpoint", endpoint,
+			"latency", latency,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+	level := slog.LevelInfo
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		span.SetStatus(tracing.StatusError, resp.Status)
+		level = slog.LevelWarn
+	}
+	slog.Log(req.Context(), level, "upstream call",
+		"provider", p.name,
+		"endpoint", endpoint,
+		"status", resp.StatusCode,
+		"latency", latency,
+	)
+	return resp, nil
+}
+
+// upstreamEndpoint replaces IDs in an API path so calls to the same endpoint
+// can be grouped, e.g. /movie/550/credits becomes /movie/{id}/credits
+func upstreamEndpoint(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		// IDs come from users too, so anything with a digit counts as one
+		if strings.ContainsAny(segment, "0123456789") {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
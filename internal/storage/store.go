@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"movie-discovery-app/pkg/models"
+)
+
+// ErrNotFound is returned when a document does not exist
+var ErrNotFound = errors.New("not found")
+
+// IDPattern matches the characters IDs may contain
+const IDPattern = `^[A-Za-z0-9_.-]+$`
+
+var validKey = regexp.MustCompile(IDPattern)
+
+// ValidID reports whether id can name a document
+func ValidID(id string) bool {
+	return validKey.MatchString(id) && strings.Trim(id, ".") != ""
+}
+
+// Store persists JSON documents on disk, grouped into collections
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) *Store {
+	if dir == "" {
+		dir = "./data"
+	}
+	return &Store{dir: dir}
+}
+
+// Load reads a document into v
+func (s *Store) Load(collection, id string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(collection, id, v)
+}
+
+// Save writes v as a document, replacing any existing one
+func (s *Store) Save(collection, id string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(collection, id, v)
+}
+
+// Delete removes a document
+func (s *Store) Delete(collection, id string) error {
+	path, err := s.path(collection, id)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s/%s: %w", collection, id, err)
+	}
+	return nil
+}
+
+// List returns the IDs of every document in a collection, sorted
+func (s *Store) List(collection string) ([]string, error) {
+	if !validKey.MatchString(collection) {
+		return nil, fmt.Errorf("invalid collection name: %q", collection)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list %s: %w", collection, err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Ping checks that the data directory exists and can be written to
+func (s *Store) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("data directory unavailable: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, ".ping-*")
+	if err != nil {
+		return fmt.Errorf("data directory not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// Library returns a user's library, or an empty one if nothing is saved yet
+func (s *Store) Library(userID string) (*models.Library, error) {
+	library := &models.Library{UserID: userID}
+	if err := s.Load("libraries", userID, library); err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return library, nil
+}
+
+// UpdateLibrary loads a user's library, applies fn and saves the result atomically
+func (s *Store) UpdateLibrary(userID string, fn func(*models.Library) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	library := &models.Library{UserID: userID}
+	if err := s.load("libraries", userID, library); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if err := fn(library); err != nil {
+		return err
+	}
+
+	return s.save("libraries", userID, library)
+}
+
+// ErrNotOnWatchlist is returned when removing a title the watchlist lacks
+var ErrNotOnWatchlist = errors.New("not on the watchlist")
+
+// AddToWatchlist adds item to a user's watchlist, or returns the item
+// already there for the same title. added reports which.
+func (s *Store) AddToWatchlist(userID string, item models.WatchlistItem) (saved models.WatchlistItem, added bool, err error) {
+	err = s.UpdateLibrary(userID, func(library *models.Library) error {
+		if i := library.FindWatchlistItem(item.ID, item.MediaType); i != -1 {
+			item = library.Watchlist[i]
+			return nil
+		}
+		added = library.AddToWatchlist(item)
+		return nil
+	})
+	return item, added, err
+}
+
+// RemoveFromWatchlist removes a title from a user's watchlist
+func (s *Store) RemoveFromWatchlist(userID, mediaType string, id int) error {
+	return s.UpdateLibrary(userID, func(library *models.Library) error {
+		if !library.RemoveFromWatchlist(id, mediaType) {
+			return ErrNotOnWatchlist
+		}
+		return nil
+	})
+}
+
+func (s *Store) path(collection, id string) (string, error) {
+	if !validKey.MatchString(collection) {
+		return "", fmt.Errorf("invalid collection name: %q", collection)
+	}
+	if !ValidID(id) {
+		return "", fmt.Errorf("invalid document id: %q", id)
+	}
+	return filepath.Join(s.dir, collection, id+".json"), nil
+}
+
+func (s *Store) load(collection, id string, v interface{}) error {
+	path, err := s.path(collection, id)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to read %s/%s: %w", collection, id, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s/%s: %w", collection, id, err)
+	}
+	return nil
+}
+
+func (s *Store) save(collection, id string, v interface{}) error {
+	path, err := s.path(collection, id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s/%s: %w", collection, id, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", collection, err)
+	}
+
+	// Write to a temporary file first so readers never see a partial document
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", collection, id, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", collection, id, err)
+	}
+	return nil
+}
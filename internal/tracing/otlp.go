@@ -0,0 +1,381 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxQueueSize   = 2048
+	maxBatchSize   = 512
+	exportInterval = 5 * time.Second
+)
+
+// Exporter sends finished spans to a tracing backend
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+}
+
+// NewOTLPExporter exports to endpoint, the full URL of the collector's
+// traces endpoint such as http://localhost:4318/v1/traces
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("OTLP collector returned status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP JSON request, see opentelemetry-proto's trace_service.proto. IDs are
+// hex strings and 64-bit integers are strings in the JSON mapping.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *OTLPExporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.sc.TraceID.String(),
+			SpanID:            s.sc.SpanID.String(),
+			Name:              s.name,
+			Kind:              int(s.kind),
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        keyValues(s.attributes),
+			Status:            otlpStatus{Code: s.status, Message: s.message},
+		}
+		if s.parent.IsValid() {
+			span.ParentSpanID = s.parent.String()
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: keyValues([]Attribute{
+			String("service.name", e.serviceName),
+			String("telemetry.sdk.language", "go"),
+		})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "movie-discovery-app"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func keyValues(attributes []Attribute) []otlpKeyValue {
+	out := make([]otlpKeyValue, 0, len(attributes))
+	for _, a := range attributes {
+		var v otlpValue
+		switch value := a.Value.(type) {
+		case string:
+			v.StringValue = &value
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &value
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: v})
+	}
+	return out
+}
+
+// batchProcessor queues finished spans and exports them in batches from a
+// background goroutine, so requests never wait on the collector
+type batchProcessor struct {
+	exporter Exporter
+	queue    chan *Span
+	flush    chan chan struct{}
+	done     chan struct{}
+
+	// mu guards closing the queue against spans that end after shutdown
+	mu     sync.RWMutex
+	closed bool
+}
+
+func newBatchProcessor(exporter Exporter) *batchProcessor {
+	p := &batchProcessor{
+		exporter: exporter,
+		queue:    make(chan *Span, maxQueueSize),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *batchProcessor) enqueue(span *Span) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+
+	select {
+	case p.queue <- span:
+	default:
+		// Dropping spans beats slowing requests down when the collector is behind
+	}
+}
+
+func (p *batchProcessor) loop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := p.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("failed to export spans", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = nil
+	}
+
+	for {
+		select {
+		case span, ok := <-p.queue:
+			if !ok {
+				export()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case ack := <-p.flush:
+			// Take what is already queued before exporting
+			for drained := false; !drained; {
+				select {
+				case span, ok := <-p.queue:
+					if !ok {
+						drained = true
+						break
+					}
+					batch = append(batch, span)
+				default:
+					drained = true
+				}
+			}
+			export()
+			close(ack)
+		}
+	}
+}
+
+func (p *batchProcessor) shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ForceFlush exports every span finished so far
+func (t *Tracer) ForceFlush(ctx context.Context) error {
+	if t.processor == nil {
+		return nil
+	}
+	ack := make(chan struct{})
+	select {
+	case t.processor.flush <- ack:
+	case <-t.processor.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Options configures a tracer. The fields match the standard OpenTelemetry
+// variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT, which config.Tracing reads.
+type Options struct {
+	// Endpoint is the collector's base URL, /v1/traces is appended
+	Endpoint string
+	// TracesEndpoint is the full traces URL and wins over Endpoint
+	TracesEndpoint string
+	// Headers are sent with every export, as key=value pairs separated by commas
+	Headers     string
+	ServiceName string
+	Sampler     string
+	SamplerArg  string
+}
+
+// New creates a tracer. Spans are only exported when an endpoint is set.
+func New(opts Options) (*Tracer, error) {
+	sampler, err := samplerFromEnv(opts.Sampler, opts.SamplerArg)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := opts.TracesEndpoint
+	if endpoint == "" && opts.Endpoint != "" {
+		endpoint = strings.TrimSuffix(opts.Endpoint, "/") + "/v1/traces"
+	}
+	if endpoint == "" {
+		return NewTracer(sampler, nil), nil
+	}
+
+	serviceName := opts.ServiceName
+	if serviceName == "" {
+		serviceName = "movie-discovery-app"
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(opts.Headers, ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	return NewTracer(sampler, NewOTLPExporter(endpoint, serviceName, headers)), nil
+}
+
+func samplerFromEnv(name, arg string) (Sampler, error) {
+	fraction := 1.0
+	if arg != "" {
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q", arg)
+		}
+		fraction = f
+	}
+
+	switch name {
+	case "", "parentbased_always_on":
+		return ParentBased(AlwaysOn()), nil
+	case "parentbased_always_off":
+		return ParentBased(AlwaysOff()), nil
+	case "parentbased_traceidratio":
+		return ParentBased(TraceIDRatio(fraction)), nil
+	case "always_on":
+		return AlwaysOn(), nil
+	case "always_off":
+		return AlwaysOff(), nil
+	case "traceidratio":
+		return TraceIDRatio(fraction), nil
+	}
+	return nil, fmt.Errorf("unknown OTEL_TRACES_SAMPLER %q", name)
+}
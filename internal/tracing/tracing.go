@@ -0,0 +1,366 @@
+// Package tracing is a small OpenTelemetry-style tracer: spans with W3C
+// traceparent propagation, head sampling and export over OTLP/HTTP.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id TraceID) IsValid() bool  { return id != TraceID{} }
+
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsValid() bool  { return id != SpanID{} }
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats the span context as a W3C traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent reads a W3C traceparent header
+func ParseTraceparent(header string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	// Version 00 has exactly four fields, later versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// SpanKind tells a backend how a span relates to other services
+type SpanKind int
+
+// Values match the OTLP protocol
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Status codes, matching the OTLP protocol
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Attribute is a key/value pair describing a span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute        { return Attribute{key, value} }
+func Int(key string, value int) Attribute       { return Attribute{key, int64(value)} }
+func Bool(key string, value bool) Attribute     { return Attribute{key, value} }
+func Float(key string, value float64) Attribute { return Attribute{key, value} }
+
+// Span is one timed operation. A span that is not sampled still carries
+// its IDs so they can be propagated and logged, but records nothing.
+type Span struct {
+	tracer    *Tracer
+	sc        SpanContext
+	parent    SpanID
+	kind      SpanKind
+	recording bool
+
+	mu         sync.Mutex
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes []Attribute
+	status     int
+	message    string
+	ended      bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// IsRecording reports whether the span will be exported
+func (s *Span) IsRecording() bool {
+	return s != nil && s.recording
+}
+
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attributes...)
+	s.mu.Unlock()
+}
+
+// SetStatus marks the span as ok or failed
+func (s *Span) SetStatus(code int, message string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	s.status, s.message = code, message
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed because of err
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetAttributes(String("exception.message", err.Error()))
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and hands it to the exporter
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.processor.enqueue(s)
+}
+
+type spanKey struct{}
+
+// SpanFromContext returns the current span, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan makes span the current span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+type remoteKey struct{}
+
+// ContextWithRemoteParent makes a span from another service, usually read
+// from a traceparent header, the parent of the next span started
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc, true
+	}
+	if sc, ok := ctx.Value(remoteKey{}).(SpanContext); ok && sc.IsValid() {
+		return sc, true
+	}
+	return SpanContext{}, false
+}
+
+// Sampler decides whether a new trace is recorded
+type Sampler interface {
+	ShouldSample(parent SpanContext, hasParent bool, traceID TraceID) bool
+	String() string
+}
+
+type alwaysOn struct{}
+
+func (alwaysOn) ShouldSample(SpanContext, bool, TraceID) bool { return true }
+func (alwaysOn) String() string                               { return "always_on" }
+
+type alwaysOff struct{}
+
+func (alwaysOff) ShouldSample(SpanContext, bool, TraceID) bool { return false }
+func (alwaysOff) String() string                               { return "always_off" }
+
+type ratio struct {
+	fraction float64
+	bound    uint64
+}
+
+func (r ratio) ShouldSample(_ SpanContext, _ bool, traceID TraceID) bool {
+	// Deciding on the trace ID keeps every service of a trace in agreement
+	return binary.BigEndian.Uint64(traceID[8:])>>1 < r.bound
+}
+
+func (r ratio) String() string { return fmt.Sprintf("traceidratio(%g)", r.fraction) }
+
+type parentBased struct {
+	root Sampler
+}
+
+func (p parentBased) ShouldSample(parent SpanContext, hasParent bool, traceID TraceID) bool {
+	if hasParent {
+		return parent.Sampled
+	}
+	return p.root.ShouldSample(parent, hasParent, traceID)
+}
+
+func (p parentBased) String() string { return "parentbased_" + p.root.String() }
+
+func AlwaysOn() Sampler  { return alwaysOn{} }
+func AlwaysOff() Sampler { return alwaysOff{} }
+
+// TraceIDRatio samples the given fraction of traces
+func TraceIDRatio(fraction float64) Sampler {
+	switch {
+	case fraction >= 1:
+		return alwaysOn{}
+	case fraction <= 0:
+		return alwaysOff{}
+	}
+	return ratio{fraction: fraction, bound: uint64(fraction * (1 << 63))}
+}
+
+// ParentBased follows the caller's sampling decision and uses root for new traces
+func ParentBased(root Sampler) Sampler {
+	return parentBased{root: root}
+}
+
+// Tracer starts spans and sends finished ones to its exporter
+type Tracer struct {
+	sampler   Sampler
+	processor *batchProcessor
+}
+
+// NewTracer creates a tracer. Without an exporter spans are never recorded,
+// though trace IDs are still created and propagated.
+func NewTracer(sampler Sampler, exporter Exporter) *Tracer {
+	if sampler == nil {
+		sampler = ParentBased(AlwaysOn())
+	}
+	t := &Tracer{sampler: sampler}
+	if exporter != nil {
+		t.processor = newBatchProcessor(exporter)
+	}
+	return t
+}
+
+// SpanOption configures a span when it starts
+type SpanOption func(*Span)
+
+func WithKind(kind SpanKind) SpanOption {
+	return func(s *Span) { s.kind = kind }
+}
+
+func WithAttributes(attributes ...Attribute) SpanOption {
+	return func(s *Span) { s.attributes = append(s.attributes, attributes...) }
+}
+
+// Start begins a span as a child of the span in ctx, if any
+func (t *Tracer) Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	parent, hasParent := parentFromContext(ctx)
+
+	span := &Span{tracer: t, name: name, kind: KindInternal, start: time.Now()}
+	if hasParent {
+		span.sc.TraceID = parent.TraceID
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.sc.TraceID[:])
+	}
+	rand.Read(span.sc.SpanID[:])
+
+	span.sc.Sampled = t.sampler.ShouldSample(parent, hasParent, span.sc.TraceID)
+	span.recording = span.sc.Sampled && t.processor != nil
+
+	for _, opt := range opts {
+		opt(span)
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown exports the spans that are still queued
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t.processor == nil {
+		return nil
+	}
+	return t.processor.shutdown(ctx)
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultTracer = NewTracer(nil, nil)
+)
+
+// SetDefault sets the tracer used by Start
+func SetDefault(t *Tracer) {
+	defaultMu.Lock()
+	defaultTracer = t
+	defaultMu.Unlock()
+}
+
+// Default returns the tracer used by Start
+func Default() *Tracer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultTracer
+}
+
+// Start begins a span with the default tracer
+func Start(ctx context.Context, name string, opts ...SpanOption) (context.Context, *Span) {
+	return Default().Start(ctx, name, opts...)
+}
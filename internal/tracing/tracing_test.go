@@ -0,0 +1,173 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const header = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(header)
+	if !ok {
+		t.Fatalf("ParseTraceparent(%q) failed", header)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("ParseTraceparent(%q) = %+v", header, sc)
+	}
+	if got := sc.Traceparent(); got != header {
+		t.Errorf("Traceparent() = %q, want %q", got, header)
+	}
+
+	unsampled := SpanContext{TraceID: sc.TraceID, SpanID: sc.SpanID}
+	if got, ok := ParseTraceparent(unsampled.Traceparent()); !ok || got != unsampled {
+		t.Errorf("round trip of %+v = %+v, %v", unsampled, got, ok)
+	}
+
+	for _, header := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	} {
+		if sc, ok := ParseTraceparent(header); ok {
+			t.Errorf("ParseTraceparent(%q) = %+v, want it refused", header, sc)
+		}
+	}
+
+	// Later versions may add fields after the flags
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("version 01 with an extra field refused")
+	}
+}
+
+// collector is a stand-in OTLP/HTTP collector that keeps what it receives
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req otlpRequest
+	if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	c.mu.Unlock()
+}
+
+func (c *collector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestOTLPExport(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer, err := New(Options{Endpoint: srv.URL + "/", Headers: "authorization=Bearer secret", ServiceName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteParent(context.Background(), remote)
+	ctx, parent := tracer.Start(ctx, "GET /api/search", WithKind(KindServer), WithAttributes(String("http.route", "/api/search")))
+	_, child := tracer.Start(ctx, "cache.lookup", WithAttributes(Int("cache.keys", 3), Bool("cache.hit", false), Float("ratio", 0.5)))
+	child.End()
+	parent.SetStatus(StatusError, "boom")
+	parent.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := c.spans()
+	if len(spans) != 2 {
+		t.Fatalf("collector got %d spans, want 2", len(spans))
+	}
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+	server, cache := byName["GET /api/search"], byName["cache.lookup"]
+
+	if server.TraceID != remote.TraceID.String() || server.ParentSpanID != remote.SpanID.String() {
+		t.Errorf("server span %s/%s, want a child of the remote parent", server.TraceID, server.ParentSpanID)
+	}
+	if server.Kind != int(KindServer) || server.Status.Code != StatusError || server.Status.Message != "boom" {
+		t.Errorf("server span = %+v", server)
+	}
+	if cache.TraceID != server.TraceID || cache.ParentSpanID != server.SpanID {
+		t.Errorf("cache span %s/%s, want a child of %s", cache.TraceID, cache.ParentSpanID, server.SpanID)
+	}
+	attributes := map[string]otlpValue{}
+	for _, kv := range cache.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	if v := attributes["cache.keys"]; v.IntValue == nil || *v.IntValue != "3" {
+		t.Errorf("cache.keys = %+v", v)
+	}
+	if v := attributes["cache.hit"]; v.BoolValue == nil || *v.BoolValue {
+		t.Errorf("cache.hit = %+v", v)
+	}
+	if v := attributes["ratio"]; v.DoubleValue == nil || *v.DoubleValue != 0.5 {
+		t.Errorf("ratio = %+v", v)
+	}
+
+	if got := c.headers[0].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Authorization = %q", got)
+	}
+	service := c.requests[0].ResourceSpans[0].Resource.Attributes[0]
+	if service.Key != "service.name" || *service.Value.StringValue != "test" {
+		t.Errorf("resource attribute = %+v", service)
+	}
+}
+
+func TestUnsampledSpansAreNotExported(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer, err := New(Options{TracesEndpoint: srv.URL + "/v1/traces", Sampler: "parentbased_always_on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "ignored")
+	if span.IsRecording() {
+		t.Error("span of an unsampled parent is recording")
+	}
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if spans := c.spans(); len(spans) != 0 {
+		t.Errorf("collector got %d spans, want none", len(spans))
+	}
+}
@@ -0,0 +1,148 @@
+package upstreamfs
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// discover filters and sorts discover/<kind>.json with the discover
+// parameters the app uses. Others, such as region, are ignored.
+func (h *Handler) discover(kind string, query url.Values) (map[string]interface{}, error) {
+	body, err := h.fixture("tmdb/discover/" + kind)
+	if err != nil {
+		return nil, err
+	}
+
+	dateField := "release_date"
+	if kind == "tv" {
+		dateField = "first_air_date"
+	}
+
+	var results []interface{}
+	for _, r := range list(body["results"]) {
+		item, _ := r.(map[string]interface{})
+		if item != nil && matchesDiscover(item, dateField, query) {
+			results = append(results, item)
+		}
+	}
+
+	if sortBy := query.Get("sort_by"); sortBy != "" {
+		field, order, _ := strings.Cut(sortBy, ".")
+		switch field {
+		case "primary_release_date", "first_air_date", "release_date":
+			field = dateField
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			a := results[i].(map[string]interface{})[field]
+			b := results[j].(map[string]interface{})[field]
+			if order == "asc" {
+				return less(a, b)
+			}
+			return less(b, a)
+		})
+	}
+
+	// Keep the fixture's totals when it holds one page of a longer list
+	if len(results) == len(list(body["results"])) {
+		body["results"] = results
+		return body, nil
+	}
+	return page(results), nil
+}
+
+func matchesDiscover(item map[string]interface{}, dateField string, query url.Values) bool {
+	date := str(item[dateField])
+	for key := range query {
+		value := query.Get(key)
+		switch key {
+		case "with_genres":
+			if !matchesGenres(list(item["genre_ids"]), value) {
+				return false
+			}
+		case "primary_release_year", "first_air_date_year", "year":
+			if !strings.HasPrefix(date, value) {
+				return false
+			}
+		case "primary_release_date.gte", "first_air_date.gte", "release_date.gte":
+			if date == "" || date < value {
+				return false
+			}
+		case "primary_release_date.lte", "first_air_date.lte", "release_date.lte":
+			if date == "" || date > value {
+				return false
+			}
+		case "vote_average.gte", "vote_count.gte", "popularity.gte":
+			if number(item[strings.TrimSuffix(key, ".gte")]) < parseNumber(value) {
+				return false
+			}
+		case "vote_average.lte", "vote_count.lte", "popularity.lte":
+			if number(item[strings.TrimSuffix(key, ".lte")]) > parseNumber(value) {
+				return false
+			}
+		case "with_original_language":
+			if item["original_language"] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesGenres reads with_genres, where a comma means all of and a pipe
+// means any of
+func matchesGenres(genreIDs []interface{}, with string) bool {
+	has := make(map[string]bool)
+	for _, id := range genreIDs {
+		has[numberString(id)] = true
+	}
+	if strings.Contains(with, "|") {
+		for _, id := range strings.Split(with, "|") {
+			if has[strings.TrimSpace(id)] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, id := range strings.Split(with, ",") {
+		if !has[strings.TrimSpace(id)] {
+			return false
+		}
+	}
+	return true
+}
+
+// less orders numbers by value and anything else as strings, with missing
+// values last
+func less(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return b == nil && a != nil
+	}
+	if _, ok := a.(json.Number); ok {
+		return number(a) < number(b)
+	}
+	return str(a) < str(b)
+}
+
+func number(v interface{}) float64 {
+	return parseNumber(numberString(v))
+}
+
+func numberString(v interface{}) string {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+func parseNumber(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,64 @@
+package upstreamfs
+
+import (
+	"bytes"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// MapFS is an in-memory file system of fixtures, keyed by path. It holds
+// files only: directories cannot be opened, but Glob finds files in them.
+type MapFS map[string][]byte
+
+func (m MapFS) Open(name string) (fs.File, error) {
+	data, ok := m[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &mapFile{Reader: bytes.NewReader(data), info: mapFileInfo{name: path.Base(name), size: int64(len(data))}}, nil
+}
+
+func (m MapFS) ReadFile(name string) ([]byte, error) {
+	data, ok := m[name]
+	if !ok || !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data), nil
+}
+
+// Glob returns the files matching pattern, sorted
+func (m MapFS) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range m {
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+type mapFile struct {
+	*bytes.Reader
+	info mapFileInfo
+}
+
+func (f *mapFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *mapFile) Close() error               { return nil }
+
+type mapFileInfo struct {
+	name string
+	size int64
+}
+
+func (i mapFileInfo) Name() string       { return i.name }
+func (i mapFileInfo) Size() int64        { return i.size }
+func (i mapFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i mapFileInfo) ModTime() time.Time { return time.Time{} }
+func (i mapFileInfo) IsDir() bool        { return false }
+func (i mapFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,262 @@
+package upstreamfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// appendable are the detail fields TMDB only returns when they are named in
+// append_to_response
+var appendable = []string{
+	"credits", "external_ids", "videos", "keywords", "release_dates",
+	"content_ratings", "watch/providers", "recommendations",
+}
+
+// pageSize is how many results TMDB lists per page
+const pageSize = 20
+
+// summaryFields are copied from a details fixture into find results
+var summaryFields = []string{
+	"id", "title", "original_title", "name", "original_name", "overview",
+	"poster_path", "backdrop_path", "release_date", "first_air_date",
+	"vote_average", "vote_count", "popularity", "adult", "original_language",
+}
+
+// ServeTMDB answers a TMDB request, whose path starts with /3/
+func (h *Handler) ServeTMDB(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, "/3/")
+	query := req.URL.Query()
+	parts := strings.Split(name, "/")
+
+	var (
+		body map[string]interface{}
+		err  error
+	)
+	switch {
+	case len(parts) == 2 && parts[0] == "search":
+		body, err = h.search(parts[1], query.Get("query"), query.Get("year")+query.Get("first_air_date_year"))
+	case len(parts) == 2 && parts[0] == "discover":
+		body, err = h.discover(parts[1], query)
+	case len(parts) == 2 && parts[0] == "find":
+		body, err = h.find(parts[1])
+	case len(parts) == 2 && (parts[0] == "movie" || parts[0] == "tv"):
+		if body, err = h.fixture("tmdb/" + name); err == nil {
+			trimAppended(body, query.Get("append_to_response"))
+		}
+	default:
+		body, err = h.fixture("tmdb/" + name)
+		// Sub-resources such as movie/550/external_ids are also read from
+		// the field of the same name in the details fixture
+		if errors.Is(err, fs.ErrNotExist) && len(parts) == 3 && (parts[0] == "movie" || parts[0] == "tv") {
+			var details map[string]interface{}
+			if details, err = h.fixture("tmdb/" + parts[0] + "/" + parts[1]); err == nil {
+				var ok bool
+				if body, ok = details[parts[2]].(map[string]interface{}); !ok {
+					err = fs.ErrNotExist
+				}
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeJSON(w, http.StatusNotFound, tmdbError(34, "The resource you requested could not be found."))
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, tmdbError(11, err.Error()))
+	default:
+		paginate(body, query.Get("page"))
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// ServeOMDB answers an OMDB request for the title in the i parameter
+func (h *Handler) ServeOMDB(w http.ResponseWriter, req *http.Request) {
+	id := req.URL.Query().Get("i")
+	if id == "" {
+		writeJSON(w, http.StatusOK, map[string]string{"Response": "False", "Error": "Incorrect IMDb ID."})
+		return
+	}
+
+	body, err := h.fixture("omdb/" + id)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		writeJSON(w, http.StatusOK, map[string]string{"Response": "False", "Error": "Incorrect IMDb ID."})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"Response": "False", "Error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, body)
+	}
+}
+
+// fixture reads name + ".json" as a JSON object
+func (h *Handler) fixture(name string) (map[string]interface{}, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrNotExist
+	}
+	data, err := fs.ReadFile(h.fixtures, name+".json")
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var body map[string]interface{}
+	if err := dec.Decode(&body); err != nil {
+		return nil, errors.New(name + ".json: " + err.Error())
+	}
+	return body, nil
+}
+
+// search filters search/<kind>.json, or search/multi.json by media type,
+// by title and year
+func (h *Handler) search(kind, query, year string) (map[string]interface{}, error) {
+	body, err := h.fixture("tmdb/search/" + kind)
+	mediaType := ""
+	if errors.Is(err, fs.ErrNotExist) && (kind == "movie" || kind == "tv") {
+		body, err = h.fixture("tmdb/search/multi")
+		mediaType = kind
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var results []interface{}
+	for _, r := range list(body["results"]) {
+		item, _ := r.(map[string]interface{})
+		if mediaType != "" && item["media_type"] != mediaType {
+			continue
+		}
+		title := str(item["title"]) + " " + str(item["name"])
+		if !strings.Contains(strings.ToLower(title), query) {
+			continue
+		}
+		date := str(item["release_date"]) + str(item["first_air_date"])
+		if year != "" && !strings.HasPrefix(date, year) {
+			continue
+		}
+		results = append(results, item)
+	}
+	return page(results), nil
+}
+
+// find looks through the movie and tv fixtures for an IMDb ID
+func (h *Handler) find(imdbID string) (map[string]interface{}, error) {
+	body := map[string]interface{}{
+		"movie_results":      []interface{}{},
+		"tv_results":         []interface{}{},
+		"person_results":     []interface{}{},
+		"tv_episode_results": []interface{}{},
+		"tv_season_results":  []interface{}{},
+	}
+	for _, mediaType := range []string{"movie", "tv"} {
+		files, err := fs.Glob(h.fixtures, "tmdb/"+mediaType+"/*.json")
+		if err != nil {
+			return nil, err
+		}
+		var results []interface{}
+		for _, file := range files {
+			details, err := h.fixture(strings.TrimSuffix(file, ".json"))
+			if err != nil {
+				return nil, err
+			}
+			ids, _ := details["external_ids"].(map[string]interface{})
+			if details["imdb_id"] != imdbID && (ids == nil || ids["imdb_id"] != imdbID) {
+				continue
+			}
+			results = append(results, summary(details, mediaType))
+		}
+		if results != nil {
+			body[mediaType+"_results"] = results
+		}
+	}
+	return body, nil
+}
+
+// summary turns details into the short form used in lists
+func summary(details map[string]interface{}, mediaType string) map[string]interface{} {
+	item := map[string]interface{}{"media_type": mediaType}
+	for _, field := range summaryFields {
+		if v, ok := details[field]; ok {
+			item[field] = v
+		}
+	}
+	genreIDs := []interface{}{}
+	for _, g := range list(details["genres"]) {
+		if genre, ok := g.(map[string]interface{}); ok {
+			genreIDs = append(genreIDs, genre["id"])
+		}
+	}
+	item["genre_ids"] = genreIDs
+	return item
+}
+
+// trimAppended removes the appendable fields that were not asked for
+func trimAppended(body map[string]interface{}, appendToResponse string) {
+	wanted := make(map[string]bool)
+	for _, name := range strings.Split(appendToResponse, ",") {
+		wanted[strings.TrimSpace(name)] = true
+	}
+	for _, name := range appendable {
+		if !wanted[name] {
+			delete(body, name)
+		}
+	}
+}
+
+// paginate serves lists of more than pageSize results a page at a time and
+// answers pages after the last with no results, like TMDB does
+func paginate(body map[string]interface{}, p string) {
+	if _, ok := body["page"]; !ok {
+		return
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || n < 1 {
+		n = 1
+	}
+	body["page"] = n
+
+	results := list(body["results"])
+	if len(results) <= pageSize {
+		// A fixture with a single page of a longer list keeps its totals
+		if n > 1 {
+			body["results"] = []interface{}{}
+		}
+		return
+	}
+	body["total_results"] = len(results)
+	body["total_pages"] = (len(results) + pageSize - 1) / pageSize
+	start := min((n-1)*pageSize, len(results))
+	end := min(start+pageSize, len(results))
+	body["results"] = results[start:end]
+}
+
+func page(results []interface{}) map[string]interface{} {
+	if results == nil {
+		results = []interface{}{}
+	}
+	totalPages := 1
+	if len(results) == 0 {
+		totalPages = 0
+	}
+	return map[string]interface{}{
+		"page":          1,
+		"results":       results,
+		"total_pages":   totalPages,
+		"total_results": len(results),
+	}
+}
+
+func list(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+func str(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,49 @@
+// Package upstreamfs answers TMDB and OMDB API requests from JSON fixtures
+// in a file system, in process or over HTTP. The demo serves its bundled
+// catalogue through it, and fakeupstream adds faults and request recording
+// for tests.
+//
+// Fixtures are JSON files named after the request path: tmdb/movie/550.json
+// answers /3/movie/550 and omdb/tt0137523.json answers /?i=tt0137523.
+package upstreamfs
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Handler is an http.Handler answering TMDB requests under /3/ and OMDB
+// requests at / from fixtures. Any API key is accepted.
+type Handler struct {
+	fixtures fs.FS
+}
+
+// New returns a Handler serving fixtures
+func New(fixtures fs.FS) *Handler {
+	return &Handler{fixtures: fixtures}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method != http.MethodGet && req.Method != http.MethodHead:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case strings.HasPrefix(req.URL.Path, "/3/"):
+		h.ServeTMDB(w, req)
+	case req.URL.Path == "/":
+		h.ServeOMDB(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func tmdbError(code int, msg string) map[string]interface{} {
+	return map[string]interface{}{"status_code": code, "status_message": msg, "success": false}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
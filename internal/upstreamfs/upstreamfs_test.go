@@ -0,0 +1,87 @@
+package upstreamfs
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var testFixtures = MapFS{
+	"tmdb/movie/1.json": []byte(`{"id": 1, "title": "Film", "imdb_id": "tt0000001", "credits": {"cast": []}, "keywords": {"keywords": []}}`),
+	"tmdb/tv/2.json":    []byte(`{"id": 2, "name": "Show", "external_ids": {"imdb_id": "tt0000002"}}`),
+	"tmdb/search/multi.json": []byte(`{"page": 1, "results": [
+		{"id": 1, "media_type": "movie", "title": "Film"},
+		{"id": 2, "media_type": "tv", "name": "Show"}
+	], "total_pages": 1, "total_results": 2}`),
+	"omdb/tt0000001.json": []byte(`{"Title": "Film", "Response": "True"}`),
+}
+
+func TestHandler(t *testing.T) {
+	client := &http.Client{Transport: Transport(New(testFixtures))}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   string
+		absent string
+	}{
+		{"details", "/3/movie/1?append_to_response=credits", http.StatusOK, `"credits":{"cast":[]}`, "keywords"},
+		{"sub-resource", "/3/tv/2/external_ids", http.StatusOK, `{"imdb_id":"tt0000002"}`, ""},
+		{"search by media type", "/3/search/tv?query=sho", http.StatusOK, `"name":"Show"`, "Film"},
+		{"find", "/3/find/tt0000002", http.StatusOK, `"tv_results":[{`, `"movie_results":[{`},
+		{"missing", "/3/movie/9", http.StatusNotFound, `"status_code":34`, ""},
+		{"omdb", "/?i=tt0000001", http.StatusOK, `"Response":"True"`, ""},
+		{"omdb missing", "/?i=tt9", http.StatusOK, `"Error":"Incorrect IMDb ID."`, ""},
+		{"unknown path", "/other", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get("http://upstream.invalid" + tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d\n%s", resp.StatusCode, tt.status, body)
+			}
+			if !strings.Contains(string(body), tt.want) {
+				t.Errorf("body %s does not contain %s", body, tt.want)
+			}
+			if tt.absent != "" && strings.Contains(string(body), tt.absent) {
+				t.Errorf("body %s contains %s", body, tt.absent)
+			}
+		})
+	}
+}
+
+func TestMapFS(t *testing.T) {
+	names, err := testFixtures.Glob("tmdb/*/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, " "); got != "tmdb/movie/1.json tmdb/search/multi.json tmdb/tv/2.json" {
+		t.Errorf("Glob = %s", got)
+	}
+
+	f, err := testFixtures.Open("omdb/tt0000001.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Name() != "tt0000001.json" || info.Size() != int64(len(testFixtures["omdb/tt0000001.json"])) {
+		t.Errorf("Stat = %v, %v", info, err)
+	}
+
+	for _, name := range []string{"omdb", "omdb/missing.json", "/omdb/tt0000001.json"} {
+		if _, err := testFixtures.Open(name); err == nil {
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+}
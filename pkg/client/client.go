@@ -0,0 +1,486 @@
+// Package client calls the movie discovery server's REST API from Go,
+// decoding responses into the types of package models.
+//
+// Calls retry connection failures and 429, 502, 503 and 504 responses with
+// exponential backoff, and stop as soon as their context is done:
+//
+//	c := client.New("http://localhost:8080")
+//	movie, err := c.GetMovie(ctx, 550)
+//	if errors.Is(err, client.ErrNotFound) {
+//		...
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"movie-discovery-app/pkg/models"
+)
+
+const (
+	// DefaultRetries is the number of times a failed call is retried
+	DefaultRetries = 3
+	// DefaultBackoff is the wait before the first retry, doubling for each
+	// one after it
+	DefaultBackoff = 250 * time.Millisecond
+	// maxBackoff caps the wait between retries, including waits asked for
+	// with Retry-After
+	maxBackoff = 10 * time.Second
+	// maxErrorBody is how much of an error response is read for its message
+	maxErrorBody = 4 << 10
+)
+
+// ErrNotFound matches, with errors.Is, the error of a call for a title or
+// page the server does not have
+var ErrNotFound = errors.New("not found")
+
+// Error is a response from the server with an error status
+type Error struct {
+	StatusCode int
+	// Message is the server's description of the error
+	Message string
+	// RequestID identifies the request in the server's logs
+	RequestID string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is reports whether e is a 404, for errors.Is(err, ErrNotFound)
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Client calls one server's API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userID     string
+	retries    int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests with c instead of http.DefaultClient
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithUserID makes calls on behalf of a user, as the X-User-ID header
+// does. Personal endpoints such as GetForYou need one.
+func WithUserID(id string) Option {
+	return func(c *Client) {
+		c.userID = id
+	}
+}
+
+// WithRetries sets how many times a failed call is retried, 0 for never,
+// and the wait before the first retry
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = max(backoff, 0)
+	}
+}
+
+// New returns a Client for the server at baseURL, such as
+// http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		httpClient: http.DefaultClient,
+		retries:    DefaultRetries,
+		backoff:    DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Search returns one page of movies and TV shows matching query. mediaType
+// is "movie", "tv", or "" for both; pages count from 1.
+func (c *Client) Search(ctx context.Context, query, mediaType string, page int) (*models.SearchResponse, error) {
+	params := url.Values{"q": {query}}
+	if mediaType != "" {
+		params.Set("type", mediaType)
+	}
+	if page > 0 {
+		params.Set("page", strconv.Itoa(page))
+	}
+	var results models.SearchResponse
+	if err := c.get(ctx, "/search", params, &results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+// GetMovie returns a movie's details, with its credits, external IDs,
+// videos and keywords
+func (c *Client) GetMovie(ctx context.Context, id int) (*models.MovieDetails, error) {
+	var details models.MovieDetails
+	if err := c.get(ctx, "/movie/"+strconv.Itoa(id), nil, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetTV returns a TV show's details, with its credits, external IDs,
+// videos and keywords
+func (c *Client) GetTV(ctx context.Context, id int) (*models.TVDetails, error) {
+	var details models.TVDetails
+	if err := c.get(ctx, "/tv/"+strconv.Itoa(id), nil, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetSeason returns the episodes of a TV show's season, 0 for the specials
+func (c *Client) GetSeason(ctx context.Context, id, season int) (*models.SeasonDetails, error) {
+	var details models.SeasonDetails
+	if err := c.get(ctx, fmt.Sprintf("/tv/%d/season/%d", id, season), nil, &details); err != nil {
+		return nil, err
+	}
+	return &details, nil
+}
+
+// GetCredits returns the cast and crew of a "movie" or "tv" show
+func (c *Client) GetCredits(ctx context.Context, mediaType string, id int) (*models.Credits, error) {
+	var credits models.Credits
+	if err := c.get(ctx, titlePath(mediaType, id, "/credits"), nil, &credits); err != nil {
+		return nil, err
+	}
+	return &credits, nil
+}
+
+// GetVideos returns the trailers and clips of a "movie" or "tv" show
+func (c *Client) GetVideos(ctx context.Context, mediaType string, id int) (*models.VideosResponse, error) {
+	var videos models.VideosResponse
+	if err := c.get(ctx, titlePath(mediaType, id, "/videos"), nil, &videos); err != nil {
+		return nil, err
+	}
+	return &videos, nil
+}
+
+// GetRecommendations returns titles like a "movie" or "tv" show
+func (c *Client) GetRecommendations(ctx context.Context, mediaType string, id int) ([]models.Media, error) {
+	var results []models.Media
+	if err := c.get(ctx, titlePath(mediaType, id, "/recommendations"), nil, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// GetExternalIDs returns the IMDb and other IDs of a "movie" or "tv" show
+func (c *Client) GetExternalIDs(ctx context.Context, mediaType string, id int) (*models.ExternalIDs, error) {
+	var ids models.ExternalIDs
+	if err := c.get(ctx, titlePath(mediaType, id, "/external_ids"), nil, &ids); err != nil {
+		return nil, err
+	}
+	return &ids, nil
+}
+
+// GetAvailability returns where a "movie" or "tv" show can be watched in a
+// country, given as an ISO 3166-1 code; "" is the US
+func (c *Client) GetAvailability(ctx context.Context, mediaType string, id int, region string) (*models.Availability, error) {
+	var params url.Values
+	if region != "" {
+		params = url.Values{"region": {region}}
+	}
+	var availability models.Availability
+	if err := c.get(ctx, titlePath(mediaType, id, "/availability"), params, &availability); err != nil {
+		return nil, err
+	}
+	return &availability, nil
+}
+
+// GetReleaseDates returns a movie's release dates and certifications by
+// country
+func (c *Client) GetReleaseDates(ctx context.Context, id int) (*models.ReleaseDatesResponse, error) {
+	var dates models.ReleaseDatesResponse
+	if err := c.get(ctx, titlePath("movie", id, "/release_dates"), nil, &dates); err != nil {
+		return nil, err
+	}
+	return &dates, nil
+}
+
+// GetTrending returns the movies and TV shows trending over timeWindow,
+// "day" or "week"
+func (c *Client) GetTrending(ctx context.Context, timeWindow string) (*models.TrendingResponse, error) {
+	var params url.Values
+	if timeWindow != "" {
+		params = url.Values{"time_window": {timeWindow}}
+	}
+	var trending models.TrendingResponse
+	if err := c.get(ctx, "/trending", params, &trending); err != nil {
+		return nil, err
+	}
+	return &trending, nil
+}
+
+// GetGenres returns the movie and TV genres, under the keys "movie" and
+// "tv"
+func (c *Client) GetGenres(ctx context.Context) (map[string][]models.Genre, error) {
+	var genres map[string][]models.Genre
+	if err := c.get(ctx, "/genres", nil, &genres); err != nil {
+		return nil, err
+	}
+	return genres, nil
+}
+
+// GetForYou returns up to limit recommendations of mediaType, "movie" or
+// "tv", built from the library of the client's user; see WithUserID.
+// A limit of 0 leaves it to the server.
+func (c *Client) GetForYou(ctx context.Context, mediaType string, limit int) (*models.RecommendationResponse, error) {
+	params := url.Values{}
+	if mediaType != "" {
+		params.Set("type", mediaType)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	var recommendations models.RecommendationResponse
+	if err := c.get(ctx, "/for-you", params, &recommendations); err != nil {
+		return nil, err
+	}
+	return &recommendations, nil
+}
+
+// DiscoverOptions filters and orders Discover's results
+type DiscoverOptions = models.DiscoverOptions
+
+// Discover returns a page of movies or TV shows, for a mediaType of
+// "movie" or "tv", matching opts
+func (c *Client) Discover(ctx context.Context, mediaType string, opts DiscoverOptions) (*models.SearchResponse, error) {
+	params := url.Values{}
+	if mediaType != "" {
+		params.Set("type", mediaType)
+	}
+	if len(opts.Genres) > 0 {
+		genres := make([]string, len(opts.Genres))
+		for i, id := range opts.Genres {
+			genres[i] = strconv.Itoa(id)
+		}
+		params.Set("genre", strings.Join(genres, ","))
+	}
+	if opts.Year > 0 {
+		params.Set("year", strconv.Itoa(opts.Year))
+	}
+	if opts.SortBy != "" {
+		params.Set("sort_by", opts.SortBy)
+	}
+	if opts.Page > 0 {
+		params.Set("page", strconv.Itoa(opts.Page))
+	}
+	var results models.SearchResponse
+	if err := c.get(ctx, "/discover", params, &results); err != nil {
+		return nil, err
+	}
+	return &results, nil
+}
+
+// GetWatchlist returns the watchlist of the client's user, oldest first
+func (c *Client) GetWatchlist(ctx context.Context) ([]models.WatchlistItem, error) {
+	var watchlist []models.WatchlistItem
+	if err := c.get(ctx, "/watchlist", nil, &watchlist); err != nil {
+		return nil, err
+	}
+	return watchlist, nil
+}
+
+// AddToWatchlist adds a "movie" or "tv" show to the watchlist of the
+// client's user and returns its item. Adding a title already there returns
+// the existing item.
+func (c *Client) AddToWatchlist(ctx context.Context, mediaType string, id int) (*models.WatchlistItem, error) {
+	body := struct {
+		ID        int    `json:"id"`
+		MediaType string `json:"media_type"`
+	}{id, mediaType}
+	var item models.WatchlistItem
+	if err := c.call(ctx, http.MethodPost, "/watchlist", nil, body, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// RemoveFromWatchlist removes a "movie" or "tv" show from the watchlist of
+// the client's user. A title not on the watchlist is ErrNotFound.
+func (c *Client) RemoveFromWatchlist(ctx context.Context, mediaType string, id int) error {
+	return c.call(ctx, http.MethodDelete, "/watchlist/"+url.PathEscape(mediaType)+"/"+strconv.Itoa(id), nil, nil, nil)
+}
+
+func titlePath(mediaType string, id int, sub string) string {
+	return "/" + url.PathEscape(mediaType) + "/" + strconv.Itoa(id) + sub
+}
+
+// get calls the API at path and decodes its JSON response into v,
+// retrying failures that may be temporary
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	return c.call(ctx, http.MethodGet, path, params, nil, v)
+}
+
+// call sends a request with body, if not nil, as JSON, and decodes the
+// response into v, if not nil. Only idempotent calls are made, so failures
+// that may be temporary are retried.
+func (c *Client) call(ctx context.Context, method, path string, params url.Values, body, v interface{}) error {
+	u := c.baseURL + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.do(ctx, method, u, payload, v)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		wait := c.backoff
+		for i := 0; i < attempt && wait < maxBackoff; i++ {
+			wait *= 2
+		}
+		// Jitter spreads out the retries of clients that failed together
+		wait += rand.N(wait/2 + 1)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do makes one request, returning how long the server asked the client to
+// wait before retrying along with any error
+func (c *Client) do(ctx context.Context, method, u string, payload []byte, v interface{}) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.userID != "" {
+		req.Header.Set("X-User-ID", c.userID)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// Report a cancelled call as such rather than as a failed request
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), readError(resp)
+	}
+	if v == nil {
+		return 0, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		return 0, fmt.Errorf("decoding %s: %w", req.URL.Path, err)
+	}
+	return 0, nil
+}
+
+// readError turns an error response into an *Error. Most errors are plain
+// text, while some come as a JSON object of an error and a request ID.
+func readError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	e := &Error{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(body)),
+		RequestID:  resp.Header.Get("X-Request-ID"),
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var envelope struct {
+			Error     string `json:"error"`
+			RequestID string `json:"request_id"`
+		}
+		if json.Unmarshal(body, &envelope) == nil && envelope.Error != "" {
+			e.Message = envelope.Error
+			if envelope.RequestID != "" {
+				e.RequestID = envelope.RequestID
+			}
+		}
+	}
+	return e
+}
+
+// retryable reports whether err may go away if the request is made again:
+// a failure to connect, rate limiting, or an unavailable server or upstream
+func retryable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		// Responses that cannot be decoded will not decode next time either
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as a date
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(s); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,383 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"movie-discovery-app/internal/api"
+	"movie-discovery-app/internal/config"
+	"movie-discovery-app/internal/fakeupstream"
+	"movie-discovery-app/internal/services"
+)
+
+// newTestServer serves the real API, backed by the fake TMDB and OMDb
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	cfg, err := config.Load(config.Sources{Environ: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Storage.DataDir = t.TempDir()
+
+	upstream := httptest.NewServer(fakeupstream.New(fakeupstream.Options{}))
+	t.Cleanup(upstream.Close)
+	movieService := services.NewMovieService(services.Config{
+		TMDBAPIKey:   "test",
+		TMDBBaseURL:  upstream.URL + "/3",
+		ImageBaseURL: "https://image.test/t/p/w500",
+		OMDBAPIKey:   "test",
+		OMDBBaseURL:  upstream.URL,
+	}, upstream.Client())
+
+	router := api.NewRouter(cfg,
+		api.WithMovieService(movieService),
+		api.WithTemplates(template.Must(template.New("index.html").Parse(""))),
+		api.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	t.Cleanup(func() { router.Shutdown(context.Background()) })
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestServer(t)
+	c := New(srv.URL, WithHTTPClient(srv.Client()))
+	ctx := context.Background()
+
+	t.Run("search", func(t *testing.T) {
+		results, err := c.Search(ctx, "i", "movie", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, m := range results.Results {
+			titles = append(titles, m.Title)
+		}
+		if fmt.Sprint(titles) != "[Inception The Matrix Fight Club]" {
+			t.Errorf("titles %v", titles)
+		}
+	})
+
+	t.Run("movie", func(t *testing.T) {
+		movie, err := c.GetMovie(ctx, 550)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if movie.Title != "Fight Club" || movie.ExternalIDs == nil || movie.ExternalIDs.IMDBID != "tt0137523" {
+			t.Errorf("movie %q, external IDs %+v", movie.Title, movie.ExternalIDs)
+		}
+	})
+
+	t.Run("tv", func(t *testing.T) {
+		show, err := c.GetTV(ctx, 1396)
+		if err != nil {
+			t.Fatal(err)
+		}
+		season, err := c.GetSeason(ctx, 1396, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if show.Name != "Breaking Bad" || len(season.Episodes) == 0 {
+			t.Errorf("show %q, %d episodes in season 5", show.Name, len(season.Episodes))
+		}
+	})
+
+	t.Run("credits", func(t *testing.T) {
+		credits, err := c.GetCredits(ctx, "movie", 550)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(credits.Cast) == 0 {
+			t.Error("no cast")
+		}
+	})
+
+	t.Run("trending and genres", func(t *testing.T) {
+		trending, err := c.GetTrending(ctx, "week")
+		if err != nil {
+			t.Fatal(err)
+		}
+		genres, err := c.GetGenres(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(trending.Results) == 0 || len(genres["movie"]) == 0 || len(genres["tv"]) == 0 {
+			t.Errorf("%d trending, %d movie and %d TV genres", len(trending.Results), len(genres["movie"]), len(genres["tv"]))
+		}
+	})
+
+	t.Run("discover", func(t *testing.T) {
+		results, err := c.Discover(ctx, "movie", DiscoverOptions{Genres: []int{878}, Year: 1999})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results.Results) != 1 || results.Results[0].Title != "The Matrix" {
+			t.Errorf("results %+v", results.Results)
+		}
+	})
+
+	t.Run("watchlist", func(t *testing.T) {
+		alice := New(srv.URL, WithHTTPClient(srv.Client()), WithUserID("alice"))
+		item, err := alice.AddToWatchlist(ctx, "tv", 1396)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Title != "Breaking Bad" || item.MediaType != "tv" || item.AddedDate == "" {
+			t.Errorf("added %+v", item)
+		}
+		if _, err := alice.AddToWatchlist(ctx, "movie", 550); err != nil {
+			t.Fatal(err)
+		}
+
+		watchlist, err := alice.GetWatchlist(ctx)
+		if err != nil || len(watchlist) != 2 {
+			t.Fatalf("watchlist %+v, error %v", watchlist, err)
+		}
+		if err := alice.RemoveFromWatchlist(ctx, "tv", 1396); err != nil {
+			t.Fatal(err)
+		}
+		if err := alice.RemoveFromWatchlist(ctx, "tv", 1396); !errors.Is(err, ErrNotFound) {
+			t.Errorf("removing twice: %v", err)
+		}
+		if watchlist, _ := alice.GetWatchlist(ctx); len(watchlist) != 1 || watchlist[0].ID != 550 {
+			t.Errorf("watchlist after removing %+v", watchlist)
+		}
+
+		// Each user has their own
+		if watchlist, err := c.GetWatchlist(ctx); err != nil || len(watchlist) != 0 {
+			t.Errorf("default user's watchlist %+v, error %v", watchlist, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := c.GetMovie(ctx, 999999)
+		var e *Error
+		if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.RequestID == "" {
+			t.Errorf("error %#v, want a 404 with a request ID", err)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		_, err := c.Search(ctx, "", "", 0)
+		var e *Error
+		if !errors.As(err, &e) || e.StatusCode != http.StatusBadRequest || e.Message != "Query parameter 'q' is required" {
+			t.Errorf("error %v", err)
+		}
+	})
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error":"Internal server error","request_id":"abc123"}`)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).GetGenres(context.Background())
+	var e *Error
+	if !errors.As(err, &e) || e.Message != "Internal server error" || e.RequestID != "abc123" {
+		t.Fatalf("error %#v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("a 500 matches ErrNotFound")
+	}
+}
+
+// searchServer serves total search results, 20 to a page, counting the
+// requests it answers
+func searchServer(t *testing.T, total int, requests *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		var results []string
+		for i := (page-1)*20 + 1; i <= total && i <= page*20; i++ {
+			results = append(results, fmt.Sprintf(`{"id":%d,"title":"Sequel %d"}`, i, i))
+		}
+		pages := (total + 19) / 20
+		fmt.Fprintf(w, `{"page":%d,"results":[`, page)
+		for i, r := range results {
+			if i > 0 {
+				io.WriteString(w, ",")
+			}
+			io.WriteString(w, r)
+		}
+		fmt.Fprintf(w, `],"total_pages":%d,"total_results":%d}`, pages, total)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchAll(t *testing.T) {
+	var requests atomic.Int32
+	srv := searchServer(t, 45, &requests)
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	pager := c.SearchAll(ctx, "sequel", "movie")
+	var ids []int
+	for m := range pager.All() {
+		ids = append(ids, m.ID)
+	}
+	if err := pager.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 45 || ids[0] != 1 || ids[44] != 45 || requests.Load() != 3 {
+		t.Errorf("%d results from %d requests", len(ids), requests.Load())
+	}
+
+	// Breaking out of the loop fetches no more pages
+	requests.Store(0)
+	n := 0
+	for range c.SearchAll(ctx, "sequel", "").All() {
+		if n++; n == 25 {
+			break
+		}
+	}
+	if requests.Load() != 2 {
+		t.Errorf("%d requests for 25 results", requests.Load())
+	}
+
+	pages := 0
+	for page := range c.SearchAll(ctx, "sequel", "").Pages() {
+		if pages++; page.Page != pages {
+			t.Errorf("page %d is numbered %d", pages, page.Page)
+		}
+	}
+	if pages != 3 {
+		t.Errorf("%d pages", pages)
+	}
+}
+
+func TestSearchAllError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("page") == "2" {
+			http.Error(w, "page 2 is broken", http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, `{"page":1,"results":[{"id":1}],"total_pages":3,"total_results":3}`)
+	}))
+	defer srv.Close()
+
+	pager := New(srv.URL).SearchAll(context.Background(), "x", "")
+	n := 0
+	for range pager.All() {
+		n++
+	}
+	var e *Error
+	if n != 1 || !errors.As(pager.Err(), &e) || e.Message != "page 2 is broken" {
+		t.Errorf("%d results, error %v", n, pager.Err())
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		wantErr  int
+		requests int32
+	}{
+		{"unavailable then ok", []int{503, 502, 200}, 3, 0, 3},
+		{"rate limited", []int{429, 200}, 3, 0, 2},
+		{"gives up", []int{503, 503, 503}, 2, 503, 3},
+		{"no retries", []int{503, 200}, 0, 503, 1},
+		{"client error", []int{400, 200}, 3, 400, 1},
+		{"server error", []int{500, 200}, 3, 500, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				status := tt.statuses[requests.Add(1)-1]
+				if status != http.StatusOK {
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+				io.WriteString(w, `{"movie":[{"id":28,"name":"Action"}]}`)
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, WithRetries(tt.retries, time.Millisecond))
+			genres, err := c.GetGenres(context.Background())
+			if tt.wantErr == 0 {
+				if err != nil || len(genres["movie"]) != 1 {
+					t.Errorf("genres %v, error %v", genres, err)
+				}
+			} else {
+				var e *Error
+				if !errors.As(err, &e) || e.StatusCode != tt.wantErr {
+					t.Errorf("error %v, want status %d", err, tt.wantErr)
+				}
+			}
+			if requests.Load() != tt.requests {
+				t.Errorf("%d requests, want %d", requests.Load(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	if _, err := New(srv.URL, WithRetries(1, time.Millisecond)).GetGenres(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, before the server's Retry-After", elapsed)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	// A call waiting on the server returns once its context is done
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := New(slow.URL).GetMovie(ctx, 550); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow server: error %v", err)
+	}
+
+	// So does one waiting to retry
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := New(unavailable.URL, WithRetries(5, time.Hour)).GetMovie(ctx, 550)
+	if !errors.Is(err, context.Canceled) || time.Since(start) > 5*time.Second {
+		t.Errorf("backing off: error %v after %v", err, time.Since(start))
+	}
+}
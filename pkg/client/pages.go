@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"iter"
+
+	"movie-discovery-app/pkg/models"
+)
+
+// Pager iterates over every page of a search, fetching each page as the
+// loop reaches it. Stopping the loop early fetches no more pages.
+//
+//	pager := c.SearchAll(ctx, "star wars", "movie")
+//	for media := range pager.All() {
+//		...
+//	}
+//	if err := pager.Err(); err != nil {
+//		...
+//	}
+type Pager struct {
+	client    *Client
+	ctx       context.Context
+	query     string
+	mediaType string
+	err       error
+}
+
+// SearchAll returns a Pager over all the results of a search. mediaType is
+// "movie", "tv", or "" for both.
+func (c *Client) SearchAll(ctx context.Context, query, mediaType string) *Pager {
+	return &Pager{client: c, ctx: ctx, query: query, mediaType: mediaType}
+}
+
+// Pages yields each page of results in turn. A failed page ends the loop,
+// and Err returns its error.
+func (p *Pager) Pages() iter.Seq[*models.SearchResponse] {
+	return func(yield func(*models.SearchResponse) bool) {
+		p.err = nil
+		for page := 1; ; page++ {
+			resp, err := p.client.Search(p.ctx, p.query, p.mediaType, page)
+			if err != nil {
+				p.err = err
+				return
+			}
+			if len(resp.Results) == 0 || !yield(resp) || page >= resp.TotalPages {
+				return
+			}
+		}
+	}
+}
+
+// All yields the results of every page in turn. A failed page ends the
+// loop, and Err returns its error.
+func (p *Pager) All() iter.Seq[models.Media] {
+	return func(yield func(models.Media) bool) {
+		for page := range p.Pages() {
+			for _, media := range page.Results {
+				if !yield(media) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Err returns the error that ended the last loop over the pager, if any
+func (p *Pager) Err() error {
+	return p.err
+}
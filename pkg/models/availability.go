@@ -0,0 +1,65 @@
+package models
+
+// WatchProvider represents a streaming, rental or purchase service
+type WatchProvider struct {
+	ProviderID      int    `json:"provider_id"`
+	ProviderName    string `json:"provider_name"`
+	LogoPath        string `json:"logo_path"`
+	DisplayPriority int    `json:"display_priority"`
+}
+
+// WatchProviderRegion lists where a title can be watched in one country
+type WatchProviderRegion struct {
+	Link     string          `json:"link"`
+	Flatrate []WatchProvider `json:"flatrate,omitempty"`
+	Free     []WatchProvider `json:"free,omitempty"`
+	Ads      []WatchProvider `json:"ads,omitempty"`
+	Rent     []WatchProvider `json:"rent,omitempty"`
+	Buy      []WatchProvider `json:"buy,omitempty"`
+}
+
+// WatchProvidersResponse represents the watch providers API response, keyed by country code
+type WatchProvidersResponse struct {
+	Results map[string]WatchProviderRegion `json:"results"`
+}
+
+// ReleaseDate represents one release of a movie in a country
+type ReleaseDate struct {
+	Certification string `json:"certification"`
+	ISO6391       string `json:"iso_639_1"`
+	Note          string `json:"note"`
+	ReleaseDate   string `json:"release_date"`
+	Type          int    `json:"type"` // 1 premiere, 2 limited, 3 theatrical, 4 digital, 5 physical, 6 TV
+}
+
+// CountryReleaseDates represents the releases of a movie in one country
+type CountryReleaseDates struct {
+	ISO31661     string        `json:"iso_3166_1"`
+	ReleaseDates []ReleaseDate `json:"release_dates"`
+}
+
+// ReleaseDatesResponse represents the movie release dates API response
+type ReleaseDatesResponse struct {
+	Results []CountryReleaseDates `json:"results"`
+}
+
+// ContentRating represents a TV show's age rating in one country
+type ContentRating struct {
+	ISO31661 string `json:"iso_3166_1"`
+	Rating   string `json:"rating"`
+}
+
+// ContentRatingsResponse represents the TV content ratings API response
+type ContentRatingsResponse struct {
+	Results []ContentRating `json:"results"`
+}
+
+// Availability summarises what is needed to decide whether a title suits a
+// viewing: how long it is, its age rating and where it is streaming
+type Availability struct {
+	ID            int             `json:"id"`
+	MediaType     string          `json:"media_type"`
+	Runtime       int             `json:"runtime"`
+	Certification string          `json:"certification"`
+	Providers     []WatchProvider `json:"providers"`
+}
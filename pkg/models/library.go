@@ -0,0 +1,98 @@
+package models
+
+// Library represents everything a user has saved: watchlist, ratings and diary
+type Library struct {
+	UserID    string          `json:"user_id"`
+	Watchlist []WatchlistItem `json:"watchlist"`
+	Ratings   []Rating        `json:"ratings"`
+	Diary     []DiaryEntry    `json:"diary"`
+}
+
+// WatchlistItem represents a title on a user's watchlist
+type WatchlistItem struct {
+	ID          int     `json:"id"`
+	Title       string  `json:"title"`
+	PosterPath  string  `json:"poster_path"`
+	ReleaseDate string  `json:"release_date"`
+	VoteAverage float64 `json:"vote_average"`
+	Overview    string  `json:"overview"`
+	MediaType   string  `json:"media_type"` // "movie" or "tv"
+	AddedDate   string  `json:"added_date"`
+	Watched     bool    `json:"watched"`
+	IMDBID      string  `json:"imdb_id,omitempty"`
+}
+
+// Rating represents a user's rating of a title on a 0.5-10 scale
+type Rating struct {
+	ID        int     `json:"id"`
+	Title     string  `json:"title"`
+	Year      int     `json:"year,omitempty"`
+	MediaType string  `json:"media_type"`
+	Rating    float64 `json:"rating"`
+	RatedDate string  `json:"rated_date,omitempty"`
+	IMDBID    string  `json:"imdb_id,omitempty"`
+}
+
+// DiaryEntry represents a single viewing of a title
+type DiaryEntry struct {
+	ID          int      `json:"id"`
+	Title       string   `json:"title"`
+	Year        int      `json:"year,omitempty"`
+	MediaType   string   `json:"media_type"`
+	WatchedDate string   `json:"watched_date"`
+	Rating      float64  `json:"rating,omitempty"`
+	Rewatch     bool     `json:"rewatch,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	IMDBID      string   `json:"imdb_id,omitempty"`
+}
+
+// FindWatchlistItem returns the index of a watchlist item, or -1
+func (l *Library) FindWatchlistItem(id int, mediaType string) int {
+	for i, item := range l.Watchlist {
+		if item.ID == id && item.MediaType == mediaType {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddToWatchlist adds an item unless it is already present
+func (l *Library) AddToWatchlist(item WatchlistItem) bool {
+	if l.FindWatchlistItem(item.ID, item.MediaType) != -1 {
+		return false
+	}
+	l.Watchlist = append(l.Watchlist, item)
+	return true
+}
+
+// RemoveFromWatchlist removes an item, reporting whether it was present
+func (l *Library) RemoveFromWatchlist(id int, mediaType string) bool {
+	i := l.FindWatchlistItem(id, mediaType)
+	if i == -1 {
+		return false
+	}
+	l.Watchlist = append(l.Watchlist[:i], l.Watchlist[i+1:]...)
+	return true
+}
+
+// SetRating adds a rating or replaces an existing one for the same title
+func (l *Library) SetRating(rating Rating) {
+	for i, r := range l.Ratings {
+		if r.ID == rating.ID && r.MediaType == rating.MediaType {
+			l.Ratings[i] = rating
+			return
+		}
+	}
+	l.Ratings = append(l.Ratings, rating)
+}
+
+// AddDiaryEntry adds a diary entry unless the same viewing is already logged
+func (l *Library) AddDiaryEntry(entry DiaryEntry) bool {
+	for _, e := range l.Diary {
+		if e.ID == entry.ID && e.MediaType == entry.MediaType && e.WatchedDate == entry.WatchedDate {
+			return false
+		}
+	}
+	l.Diary = append(l.Diary, entry)
+	return true
+}
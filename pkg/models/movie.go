@@ -1,5 +1,22 @@
+// Package models holds the movies, TV shows and library types the server
+// stores and serves as JSON. Client code can decode the API's responses
+// into them.
 package models
 
+// DiscoverOptions filters and orders discovered titles. The zero value
+// lists the most popular titles of any genre and year.
+type DiscoverOptions struct {
+	// Genres are genre IDs, all of which a title must have
+	Genres []int
+	// Year is the year of release, or of the first episode
+	Year int
+	// SortBy is "popularity.desc", the default, "vote_average.desc",
+	// "release_date.desc" or "release_date.asc"
+	SortBy string
+	// Page counts from 1
+	Page int
+}
+
 // SearchResponse represents the response from search API
 type SearchResponse struct {
 	Page         int     `json:"page"`
@@ -57,6 +74,7 @@ type MovieDetails struct {
 	Credits             *Credits            `json:"credits,omitempty"`
 	ExternalIDs         *ExternalIDs        `json:"external_ids,omitempty"`
 	Videos              *VideosResponse     `json:"videos,omitempty"`
+	Keywords            *KeywordsResponse   `json:"keywords,omitempty"`
 	OMDBData            *OMDBResponse       `json:"omdb_data,omitempty"`
 }
 
@@ -78,6 +96,7 @@ type TVDetails struct {
 	Popularity          float64             `json:"popularity"`
 	Status              string              `json:"status"`
 	Type                string              `json:"type"`
+	EpisodeRunTime      []int               `json:"episode_run_time"`
 	OriginalLanguage    string              `json:"original_language"`
 	SpokenLanguages     []SpokenLanguage    `json:"spoken_languages"`
 	ProductionCompanies []ProductionCompany `json:"production_companies"`
@@ -85,9 +104,12 @@ type TVDetails struct {
 	Networks            []Network           `json:"networks"`
 	CreatedBy           []Creator           `json:"created_by"`
 	Seasons             []Season            `json:"seasons"`
+	LastEpisodeToAir    *Episode            `json:"last_episode_to_air,omitempty"`
+	NextEpisodeToAir    *Episode            `json:"next_episode_to_air,omitempty"`
 	Credits             *Credits            `json:"credits,omitempty"`
 	ExternalIDs         *ExternalIDs        `json:"external_ids,omitempty"`
 	Videos              *VideosResponse     `json:"videos,omitempty"`
+	Keywords            *KeywordsResponse   `json:"keywords,omitempty"`
 	OMDBData            *OMDBResponse       `json:"omdb_data,omitempty"`
 }
 
@@ -184,6 +206,30 @@ type Season struct {
 	AirDate      string `json:"air_date"`
 }
 
+// Episode represents a single TV episode
+type Episode struct {
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	Overview      string  `json:"overview"`
+	AirDate       string  `json:"air_date"`
+	EpisodeNumber int     `json:"episode_number"`
+	SeasonNumber  int     `json:"season_number"`
+	Runtime       int     `json:"runtime"`
+	StillPath     string  `json:"still_path"`
+	VoteAverage   float64 `json:"vote_average"`
+}
+
+// SeasonDetails represents a TV season with its episodes
+type SeasonDetails struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Overview     string    `json:"overview"`
+	PosterPath   string    `json:"poster_path"`
+	SeasonNumber int       `json:"season_number"`
+	AirDate      string    `json:"air_date"`
+	Episodes     []Episode `json:"episodes"`
+}
+
 // TrendingResponse represents trending content response
 type TrendingResponse struct {
 	Page         int     `json:"page"`
@@ -197,6 +243,30 @@ type GenreResponse struct {
 	Genres []Genre `json:"genres"`
 }
 
+// Keyword represents a TMDB keyword such as "heist" or "time travel"
+type Keyword struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// KeywordsResponse represents the keywords API response. Movies list them
+// under "keywords", TV shows under "results".
+type KeywordsResponse struct {
+	Keywords []Keyword `json:"keywords,omitempty"`
+	Results  []Keyword `json:"results,omitempty"`
+}
+
+// All returns the keywords regardless of which field TMDB used
+func (k *KeywordsResponse) All() []Keyword {
+	if k == nil {
+		return nil
+	}
+	if len(k.Keywords) > 0 {
+		return k.Keywords
+	}
+	return k.Results
+}
+
 // Video represents a video (trailer, teaser, etc.)
 type Video struct {
 	ID          string `json:"id"`
@@ -246,3 +316,9 @@ type OMDBResponse struct {
 	Response     string `json:"Response"`
 	Error        string `json:"Error,omitempty"`
 }
+
+// FindResponse represents the response from the TMDB find-by-external-ID API
+type FindResponse struct {
+	MovieResults []Media `json:"movie_results"`
+	TVResults    []Media `json:"tv_results"`
+}
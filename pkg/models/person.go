@@ -0,0 +1,38 @@
+package models
+
+// Person represents an actor or crew member
+type Person struct {
+	ID                 int            `json:"id"`
+	Name               string         `json:"name"`
+	Biography          string         `json:"biography"`
+	Birthday           string         `json:"birthday"`
+	Deathday           string         `json:"deathday"`
+	PlaceOfBirth       string         `json:"place_of_birth"`
+	ProfilePath        string         `json:"profile_path"`
+	KnownForDepartment string         `json:"known_for_department"`
+	Gender             int            `json:"gender"`
+	Popularity         float64        `json:"popularity"`
+	IMDBID             string         `json:"imdb_id"`
+	CombinedCredits    *PersonCredits `json:"combined_credits,omitempty"`
+}
+
+// PersonCredits lists the movies and TV shows a person worked on
+type PersonCredits struct {
+	Cast []PersonCastCredit `json:"cast"`
+	Crew []PersonCrewCredit `json:"crew"`
+}
+
+// PersonCastCredit is a title a person acted in
+type PersonCastCredit struct {
+	Media
+	Character string `json:"character"`
+	CreditID  string `json:"credit_id"`
+}
+
+// PersonCrewCredit is a title a person worked on behind the camera
+type PersonCrewCredit struct {
+	Media
+	Job        string `json:"job"`
+	Department string `json:"department"`
+	CreditID   string `json:"credit_id"`
+}
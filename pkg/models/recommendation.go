@@ -0,0 +1,15 @@
+package models
+
+// Recommendation represents a suggested title with the reasons it was picked
+type Recommendation struct {
+	Media
+	Score       float64  `json:"score"`
+	Explanation string   `json:"explanation"`
+	Reasons     []string `json:"reasons,omitempty"`
+}
+
+// RecommendationResponse represents the personalised recommendations API response
+type RecommendationResponse struct {
+	Results []Recommendation `json:"results"`
+	BasedOn int              `json:"based_on"` // number of library titles the profile was built from
+}
@@ -1,7 +1,7 @@
 // API service for handling all API calls
 class APIService {
     constructor() {
-        this.baseURL = '';
+        this.baseURL = '/api/v1';
         this.cache = new Map();
         this.cacheDuration = 5 * 60 * 1000; // 5 minutes
     }
@@ -40,17 +40,7 @@ class APIService {
             return data;
         } catch (error) {
             console.error('API request failed:', error);
-
-            // Check if it's an API key configuration error
-            if (error.message.includes('500') && url.includes('/api/')) {
-                showToast('API keys not configured. Using demo mode with sample data.', 'warning');
-                enableDemoMode();
-            } else if (error.message.includes('TMDB API key not configured')) {
-                showToast('TMDB API key not configured. Please add your API key to the .env file.', 'warning');
-                enableDemoMode();
-            } else {
-                showToast('Failed to fetch data. Please try again.', 'error');
-            }
+            showToast('Failed to fetch data. Please try again.', 'error');
             throw error;
         } finally {
             showLoading(false);
@@ -63,76 +53,38 @@ class APIService {
             return { results: [], total_pages: 0, total_results: 0 };
         }
 
-        try {
-            const params = new URLSearchParams({
-                q: query.trim(),
-                type: type,
-                page: page.toString()
-            });
+        const params = new URLSearchParams({
+            q: query.trim(),
+            type: type,
+            page: page.toString()
+        });
 
-            const url = `/api/search?${params.toString()}`;
-            return await this.makeRequest(url);
-        } catch (error) {
-            // If API fails, return demo data filtered by query
-            if (typeof DEMO_DATA !== 'undefined' && checkDemoMode()) {
-                console.log('Search API failed, using demo data');
-                const filteredResults = DEMO_DATA.trending.results.filter(item => {
-                    const title = item.title || item.name || '';
-                    return title.toLowerCase().includes(query.toLowerCase());
-                });
-                return {
-                    results: filteredResults,
-                    total_pages: 1,
-                    total_results: filteredResults.length,
-                    page: 1
-                };
-            }
-            throw error;
-        }
+        const url = `${this.baseURL}/search?${params.toString()}`;
+        return await this.makeRequest(url);
     }
 
     // Get movie details
     async getMovieDetails(id) {
-        const url = `/api/movie/${id}`;
+        const url = `${this.baseURL}/movie/${id}`;
         return await this.makeRequest(url);
     }
 
     // Get TV show details
     async getTVDetails(id) {
-        const url = `/api/tv/${id}`;
+        const url = `${this.baseURL}/tv/${id}`;
         return await this.makeRequest(url);
     }
 
     // Get trending content
     async getTrending(timeWindow = 'day') {
-        try {
-            const url = `/api/trending?time_window=${timeWindow}`;
-            return await this.makeRequest(url);
-        } catch (error) {
-            // Return demo data if API fails
-            if (typeof DEMO_DATA !== 'undefined') {
-                console.log('API failed, switching to demo mode for trending content');
-                enableDemoMode();
-                return DEMO_DATA.trending;
-            }
-            throw error;
-        }
+        const url = `${this.baseURL}/trending?time_window=${timeWindow}`;
+        return await this.makeRequest(url);
     }
 
     // Get genres
     async getGenres() {
-        try {
-            const url = '/api/genres';
-            return await this.makeRequest(url);
-        } catch (error) {
-            // Enable demo mode and return demo data
-            if (typeof enableDemoMode === 'function' && typeof DEMO_DATA !== 'undefined') {
-                console.log('API failed, switching to demo mode for genres');
-                enableDemoMode();
-                return DEMO_DATA.genres;
-            }
-            throw error;
-        }
+        const url = `${this.baseURL}/genres`;
+        return await this.makeRequest(url);
     }
 
     // Clear cache
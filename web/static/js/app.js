@@ -172,11 +172,10 @@ class MovieDiscoveryApp {
 
         } catch (error) {
             console.error('Failed to load trending preview:', error);
-            // The API service will handle demo mode automatically
         }
 
-        // Check if we're in demo mode and show indicator
-        if (typeof checkDemoMode === 'function' && checkDemoMode()) {
+        // The server marks the page when it serves its demo catalogue
+        if (document.body.dataset.demo === 'true') {
             this.showDemoModeIndicator();
         }
     }
@@ -833,7 +832,7 @@ class MovieDiscoveryApp {
         indicator.innerHTML = `
             <div class="demo-content">
                 <i class="fas fa-info-circle"></i>
-                <span>Demo Mode: Using sample data. Add API keys for full functionality.</span>
+                <span>Demo Mode: Browsing a sample catalogue. Add a TMDB API key for real movies and shows.</span>
                 <button onclick="this.parentElement.parentElement.remove()" class="demo-close">×</button>
             </div>
         `;
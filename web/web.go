@@ -0,0 +1,8 @@
+// Package web holds the UI's templates and static files, embedded in the
+// binary so the server runs from any working directory
+package web
+
+import "embed"
+
+//go:embed templates static
+var FS embed.FS